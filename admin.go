@@ -0,0 +1,325 @@
+// Copyright (c) nano Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package nano
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kensomanpow/nano/cluster"
+)
+
+const (
+	adminSubject = "nano.admin"
+
+	adminOpStats = "stats"
+	adminOpKick  = "kick"
+)
+
+// ErrAdminTimeout represents no node replied the admin request in time.
+var ErrAdminTimeout = errors.New("admin request timeout")
+
+type (
+	// NodeStats represents the runtime statistics of a node
+	NodeStats struct {
+		Node       string              `json:"node"`
+		Labels     map[string]string   `json:"labels,omitempty"`
+		Sessions   int                 `json:"sessions"`
+		RouteQPS   map[string]int64    `json:"routeQps"`   // requests of each route in last second
+		SlowTimers int64               `json:"slowTimers"` // slow timer function executions
+		Traffic    TrafficStats        `json:"traffic"`    // traffic since node started
+		Slowest    []SlowHandler       `json:"slowest"`    // the worst slow handlers
+		Payloads   []RoutePayloadSizes `json:"payloads"`   // payload sizes of each route
+		Latency    LatencyStats        `json:"latency"`    // RTT percentiles of sessions
+		Laggiest   []SessionLatency    `json:"laggiest"`   // the worst latency sessions
+		Conns      ConnStats           `json:"conns"`      // connection limit statistics
+	}
+
+	// AdminClient sends admin requests to all nodes that enabled cluster
+	// admin, so ops tooling could inspect and operate any node remotely.
+	AdminClient struct {
+		bus     cluster.Bus
+		timeout time.Duration
+		replyTo string // subject for replies of current client
+		seq     uint64 // request id
+		mu      sync.Mutex
+		pending map[uint64]chan []byte // request id map to reply channel
+	}
+
+	adminRequest struct {
+		ID      uint64 `json:"id"`
+		Op      string `json:"op"`
+		ReplyTo string `json:"replyTo"`
+		UID     int64  `json:"uid,omitempty"`
+		Reason  string `json:"reason,omitempty"`
+	}
+
+	adminReply struct {
+		ID     uint64     `json:"id"`
+		Stats  *NodeStats `json:"stats,omitempty"`
+		Kicked bool       `json:"kicked,omitempty"`
+	}
+)
+
+// routeQPS counts requests of each route of an application, counts are
+// rotated every second
+type routeQPS struct {
+	enabled int32            // whether route statistics enabled
+	mu      sync.Mutex       // protect counts & last
+	counts  map[string]int64 // counts of current second
+	last    map[string]int64 // counts of last second
+}
+
+func newRouteQPS() *routeQPS {
+	return &routeQPS{
+		counts: map[string]int64{},
+		last:   map[string]int64{},
+	}
+}
+
+func (q *routeQPS) count(route string) {
+	if atomic.LoadInt32(&q.enabled) == 0 {
+		return
+	}
+
+	q.mu.Lock()
+	q.counts[route]++
+	q.mu.Unlock()
+}
+
+func (q *routeQPS) rotate() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.last = q.counts
+	q.counts = map[string]int64{}
+}
+
+func (q *routeQPS) lastSecond() map[string]int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	qps := make(map[string]int64, len(q.last))
+	for route, c := range q.last {
+		qps[route] = c
+	}
+	return qps
+}
+
+// localStats returns the statistics of current node
+func (app *App) localStats() *NodeStats {
+	return &NodeStats{
+		Node:       app.env.nodeID,
+		Labels:     app.env.nodeLabels,
+		Sessions:   app.agents.Count(),
+		RouteQPS:   app.qps.lastSecond(),
+		SlowTimers: app.SlowTimerCount(),
+		Traffic:    app.Traffic(),
+		Slowest:    app.SlowHandlers(10),
+		Payloads:   PayloadSizes(),
+		Latency:    Latency(),
+		Laggiest:   WorstLatencySessions(10),
+		Conns:      app.ConnectionStats(),
+	}
+}
+
+// EnableClusterAdmin makes current node serve the admin requests sent by
+// AdminClient via the cluster bus, and starts route statistics
+func EnableClusterAdmin(bus cluster.Bus) error {
+	return defaultApp.EnableClusterAdmin(bus)
+}
+
+// EnableClusterAdmin makes the node of application serve the admin requests
+// sent by AdminClient via the cluster bus
+func (app *App) EnableClusterAdmin(bus cluster.Bus) error {
+	if !atomic.CompareAndSwapInt32(&app.admin, 0, 1) {
+		return nil
+	}
+
+	// route statistics are rotated until the application shutdown
+	atomic.StoreInt32(&app.qps.enabled, 1)
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				app.qps.rotate()
+			case <-app.env.die:
+				return
+			}
+		}
+	}()
+
+	return bus.Subscribe(adminSubject, func(data []byte) {
+		req := &adminRequest{}
+		if err := json.Unmarshal(data, req); err != nil {
+			app.log().Println(fmt.Sprintf("nano/admin: invalid admin request, Error=%s", err.Error()))
+			return
+		}
+
+		reply := &adminReply{ID: req.ID}
+		switch req.Op {
+		case adminOpStats:
+			reply.Stats = app.localStats()
+
+		case adminOpKick:
+			s, err := app.agents.Member(req.UID)
+			if err != nil {
+				return // not in current node
+			}
+			if err := s.Kick(req.Reason); err != nil {
+				app.log().Println(fmt.Sprintf("nano/admin: kick failed, UID=%d, Error=%s", req.UID, err.Error()))
+				return
+			}
+			reply.Kicked = true
+
+		default:
+			return
+		}
+
+		data, err := json.Marshal(reply)
+		if err != nil {
+			app.log().Println(err.Error())
+			return
+		}
+		if err := bus.Publish(req.ReplyTo, data); err != nil {
+			app.log().Println(fmt.Sprintf("nano/admin: reply failed, Error=%s", err.Error()))
+		}
+	})
+}
+
+// NewAdminClient returns a new admin client, requests wait replies for at
+// most timeout
+func NewAdminClient(bus cluster.Bus, timeout time.Duration) (*AdminClient, error) {
+	c := &AdminClient{
+		bus:     bus,
+		timeout: timeout,
+		replyTo: fmt.Sprintf("%s.reply.%s.%d", adminSubject, defaultApp.env.nodeID, time.Now().UnixNano()),
+		pending: make(map[uint64]chan []byte),
+	}
+
+	err := bus.Subscribe(c.replyTo, func(data []byte) {
+		reply := &adminReply{}
+		if err := json.Unmarshal(data, reply); err != nil {
+			return
+		}
+
+		c.mu.Lock()
+		ch, ok := c.pending[reply.ID]
+		c.mu.Unlock()
+		if !ok {
+			return
+		}
+
+		select {
+		case ch <- data:
+		default:
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// request publishes the request to all nodes, and calls fn with each reply
+// until fn returns false or timeout
+func (c *AdminClient) request(req *adminRequest, fn func(reply *adminReply) bool) error {
+	req.ID = atomic.AddUint64(&c.seq, 1)
+	req.ReplyTo = c.replyTo
+
+	ch := make(chan []byte, 64)
+	c.mu.Lock()
+	c.pending[req.ID] = ch
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, req.ID)
+		c.mu.Unlock()
+	}()
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	if err := c.bus.Publish(adminSubject, data); err != nil {
+		return err
+	}
+
+	timer := time.NewTimer(c.timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case data := <-ch:
+			reply := &adminReply{}
+			if err := json.Unmarshal(data, reply); err != nil {
+				continue
+			}
+			if !fn(reply) {
+				return nil
+			}
+		case <-timer.C:
+			return nil
+		}
+	}
+}
+
+// Stats returns the statistics(sessions, route QPS) of all nodes that replied
+// in time, which also lists all living nodes
+func (c *AdminClient) Stats() ([]*NodeStats, error) {
+	expect := len(cluster.Nodes())
+	var stats []*NodeStats
+	err := c.request(&adminRequest{Op: adminOpStats}, func(reply *adminReply) bool {
+		if reply.Stats != nil {
+			stats = append(stats, reply.Stats)
+		}
+		return expect < 1 || len(stats) < expect
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(stats) < 1 {
+		return nil, ErrAdminTimeout
+	}
+	return stats, nil
+}
+
+// Kick kicks the session bound to uid on whichever node it lives
+func (c *AdminClient) Kick(uid int64, reason string) error {
+	kicked := false
+	err := c.request(&adminRequest{Op: adminOpKick, UID: uid, Reason: reason}, func(reply *adminReply) bool {
+		kicked = reply.Kicked
+		return !kicked
+	})
+	if err != nil {
+		return err
+	}
+	if !kicked {
+		return ErrMemberNotFound
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package nano
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kensomanpow/nano/cluster"
+)
+
+func TestAdminClient(t *testing.T) {
+	bus := cluster.NewMemoryBus()
+	if err := EnableClusterAdmin(bus); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		defaultApp.qps.count("TestComp.HandleJSON")
+	}
+	defaultApp.qps.rotate()
+
+	c, err := NewAdminClient(bus, 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := c.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 1 || stats[0].Node != defaultApp.env.nodeID || stats[0].RouteQPS["TestComp.HandleJSON"] != 3 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	if err := c.Kick(10010, "maintenance"); err != ErrMemberNotFound {
+		t.Fatalf("expect: %v, got: %v", ErrMemberNotFound, err)
+	}
+
+	// route statistics are not counted for the applications without admin
+	app := NewApp()
+	app.qps.count("TestComp.HandleJSON")
+	app.qps.rotate()
+	if qps := app.qps.lastSecond(); len(qps) != 0 {
+		t.Fatalf("unexpected route qps %v", qps)
+	}
+}
@@ -21,6 +21,7 @@
 package nano
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net"
@@ -29,7 +30,6 @@ import (
 	"sync/atomic"
 	"time"
 
-	"github.com/kensomanpow/nano/internal/codec"
 	"github.com/kensomanpow/nano/internal/message"
 	"github.com/kensomanpow/nano/internal/packet"
 	"github.com/kensomanpow/nano/session"
@@ -37,24 +37,37 @@ import (
 
 const (
 	agentWriteBacklog = 16
+
+	// kickFlushTimeout is the max duration to wait the kick reason of a
+	// rejected handshake written besides the kick grace
+	kickFlushTimeout = time.Second
 )
 
 var (
-	// ErrBrokenPipe represents the low-level connection has broken.
-	ErrBrokenPipe = errors.New("broken low-level pipe")
+	// ErrBrokenPipe represents the low-level connection has broken, it's
+	// same with ErrSessionClosed.
+	ErrBrokenPipe = ErrSessionClosed
 	// ErrBufferExceed indicates that the current session buffer is full and
 	// can not receive more data.
 	ErrBufferExceed = errors.New("session send buffer exceed")
-	// AgentGroup 裝所有的Agent
-	AgentGroup = NewGroup("agents")
+	// AgentGroup 裝所有的Agent, the sessions of default App
+	AgentGroup = defaultApp.agents
 
 	AgentGroupLock = sync.RWMutex{}
+
+	// all alive agents, session id map to agent
+	agents sync.Map
+
+	// errRejected is returned by the packet processing when the handshake is
+	// rejected and the kick reason queued
+	errRejected = errors.New("handshake rejected, session will be closed")
 )
 
 type (
 	// Agent corresponding a user, used for store raw conn information
 	agent struct {
 		// regular agent member
+		app     *App                // application which the agent belongs to
 		session *session.Session    // session
 		conn    net.Conn            // low-level conn fd
 		lastMid uint                // last message id
@@ -62,7 +75,30 @@ type (
 		chDie   chan struct{}       // wait for close
 		chSend  chan pendingMessage // push message queue
 		lastAt  int64               // last heartbeat unix time stamp
-		decoder *codec.Decoder      // binary decoder
+		codec   Codec               // wire codec
+		decoder PacketDecoder       // binary decoder
+		hbd     []byte              // heartbeat packet data
+
+		protocol  int          // negotiated protocol version
+		fragment  int32        // client supports packet fragmentation
+		compress  int32        // client supports message body compression
+		checksum  int32        // client supports packet checksum
+		timestamp int32        // client supports heartbeat timestamp
+		dictPush  int32        // client supports dictionary updates
+		dictMax   int32        // max code of dictionary received by client, -1 if all routes known
+		fragments []byte       // fragments received, used by read goroutine only
+		handshake atomic.Value // *HandShakeData, nil if not handshake yet
+		requests  sync.Map     // message id map to route of pending requests
+
+		capabilities Capability // negotiated capabilities
+
+		traffic   trafficCounter // traffic statistics
+		bandwidth *slidingWindow // bandwidth in window, nil if quota not set
+		flood     *floodState    // flood control state, nil if not set
+		kicked    int32          // kick reason written, inbound messages are ignored
+		kickQueue int32          // kick packet queued, closed after written
+		challenge string         // handshake challenge waiting for answer
+		settled   int32          // handshake acked or timed out, whichever first
 
 		srv reflect.Value // cached session reflect.Value
 	}
@@ -73,31 +109,49 @@ type (
 		mid     uint         // response message id(response)
 		payload interface{}  // payload
 		kick    bool
+		packet  []byte // encoded packet which written directly
 	}
 
 	writePacket struct {
-		data []byte
-		kick bool
+		data  []byte
+		kick  bool
+		close bool // close the connection after written, eg: kick packet
 	}
 )
 
 // Create new agent instance
-func newAgent(conn net.Conn) *agent {
+func newAgent(app *App, conn net.Conn) *agent {
+	return newAgentInGroup(app, conn, app.agents, DefaultCodec)
+}
+
+// newAgentInGroup creates an agent with the wire codec whose session is added
+// to group instead of the sessions of application, eg: the replayed sessions
+func newAgentInGroup(app *App, conn net.Conn, group *Group, c Codec) *agent {
 	a := &agent{
+		app:     app,
 		conn:    conn,
 		state:   statusStart,
 		chDie:   make(chan struct{}),
-		lastAt:  time.Now().Unix(),
+		lastAt:  app.clock.Now().Unix(),
 		chSend:  make(chan pendingMessage, agentWriteBacklog),
-		decoder: codec.NewDecoder(),
+		dictMax: -1,
+	}
+	a.setCodec(c)
+	if fc := app.env.floodControl; fc != nil {
+		a.flood = newFloodState(fc, app.clock.Now())
+	}
+	if q := app.env.bandwidthQuota; q != nil {
+		a.bandwidth = newSlidingWindow(q.Window)
 	}
 
 	// binding session
 	s := session.New(a)
+	s.LastHandlerAccessTime = app.clock.Now()
 	a.session = s
 	a.srv = reflect.ValueOf(s)
 
-	AgentGroup.Add(s)
+	group.Add(s)
+	agents.Store(s.ID(), a)
 
 	return a
 }
@@ -116,14 +170,12 @@ func (a *agent) Push(route string, v interface{}) error {
 		return ErrBufferExceed
 	}
 
-	if env.debug {
+	if a.app.debugEnabled(LogPush) {
 		switch d := v.(type) {
 		case []byte:
-			logger.Println(fmt.Sprintf("Type=Push, ID=%d, UID=%d, Route=%s, Data=%dbytes",
-				a.session.ID(), a.session.UID(), route, len(d)))
+			logSession(a.session).Debug("Push message", "route", route, "bytes", len(d))
 		default:
-			logger.Println(fmt.Sprintf("Type=Push, ID=%d, UID=%d, Route=%s, Data=%+v",
-				a.session.ID(), a.session.UID(), route, v))
+			logSession(a.session).Debug("Push message", "route", route, "data", v)
 		}
 	}
 
@@ -131,11 +183,46 @@ func (a *agent) Push(route string, v interface{}) error {
 	return nil
 }
 
+// Kick pushes the reason v on route `error` and closes the session after the
+// pending messages flushed, v is serialized by the serializer of session,
+// eg: a *KickReason. See SetKickGrace
 func (a *agent) Kick(v interface{}) error {
 	if a.status() == statusClosed {
 		return ErrBrokenPipe
 	}
 
+	auditSecurity(a, SecurityKicked, "", v)
+	return a.kick(v)
+}
+
+// reject kicks the agent with reason v at handshake, the rejection is
+// audited by caller. The agent is marked kicked synchronously, so that the
+// packets following in the same segment are not processed, errRejected is
+// returned to stop the read loop
+func (a *agent) reject(v interface{}) error {
+	atomic.StoreInt32(&a.kicked, 1)
+	a.kick(v)
+	return errRejected
+}
+
+// awaitKick waits the kick reason of rejection or the kick packet written by
+// write goroutine before the read loop closes the connection
+func (a *agent) awaitKick() {
+	timer := time.NewTimer(a.app.env.kickGrace + kickFlushTimeout)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-a.chDie:
+	}
+}
+
+// kick pushes the kick reason without the security event, it is used when
+// the rejection has been audited, eg: auth failed
+func (a *agent) kick(v interface{}) error {
+	if a.status() == statusClosed {
+		return ErrBrokenPipe
+	}
+
 	if len(a.chSend) >= agentWriteBacklog {
 		return ErrBufferExceed
 	}
@@ -162,17 +249,16 @@ func (a *agent) ResponseMID(mid uint, v interface{}) error {
 	}
 
 	if len(a.chSend) >= agentWriteBacklog {
+		a.requests.Delete(mid)
 		return ErrBufferExceed
 	}
 
-	if env.debug {
+	if a.app.debugEnabled(LogPush) {
 		switch d := v.(type) {
 		case []byte:
-			logger.Println(fmt.Sprintf("Type=Response, ID=%d, UID=%d, MID=%d, Data=%dbytes",
-				a.session.ID(), a.session.UID(), mid, len(d)))
+			logSession(a.session).Debug("Response message", "mid", mid, "bytes", len(d))
 		default:
-			logger.Println(fmt.Sprintf("Type=Response, ID=%d, UID=%d, MID=%d, Data=%+v",
-				a.session.ID(), a.session.UID(), mid, v))
+			logSession(a.session).Debug("Response message", "mid", mid, "data", v)
 		}
 	}
 
@@ -180,19 +266,195 @@ func (a *agent) ResponseMID(mid uint, v interface{}) error {
 	return nil
 }
 
+// appendFragment appends data to the fragments received, the connection will
+// be kicked when the reassembled message exceeds the max message size
+func (a *agent) appendFragment(data []byte) error {
+	if len(a.fragments)+len(data) > a.app.env.maxMessageSize {
+		a.kickPacket("message size exceeded")
+		return fmt.Errorf("fragmented message exceeds %d bytes, session will be closed immediately, remote=%s",
+			a.app.env.maxMessageSize, a.conn.RemoteAddr().String())
+	}
+	a.fragments = append(a.fragments, data...)
+	return nil
+}
+
+// verifyPacket verifies the checksum of data if checksum negotiated, and
+// returns the data without checksum, the connection will be kicked when the
+// packet is corrupted
+func (a *agent) verifyPacket(data []byte) ([]byte, error) {
+	if atomic.LoadInt32(&a.checksum) == 0 {
+		return data, nil
+	}
+
+	data, err := verifyChecksum(data)
+	if err != nil {
+		a.kickPacket(err.Error())
+		return nil, fmt.Errorf("%s, session will be closed immediately, remote=%s",
+			err.Error(), a.conn.RemoteAddr().String())
+	}
+	return data, nil
+}
+
+// setCodec set the wire codec, it must be called before reading connection
+func (a *agent) setCodec(c Codec) {
+	hbd, err := c.Encode(packet.Heartbeat, nil)
+	if err != nil {
+		panic(err)
+	}
+
+	a.codec = c
+	a.decoder = c.NewDecoder()
+	a.hbd = hbd
+
+	// limit the packet size of application
+	if d, ok := a.decoder.(interface{ SetMaxPacketSize(size int) }); ok {
+		d.SetMaxPacketSize(a.app.env.maxPacketSize)
+	}
+}
+
+// CreateTimer implements the session.TimerEntity interface, the session
+// timers are executed by the application of agent
+func (a *agent) CreateTimer(ctx context.Context, interval time.Duration, count int, fn func()) session.Timer {
+	return a.app.timers.addContext(ctx, interval, count, fn)
+}
+
+// WritePacket implements the PacketWriter interface, the packet is written
+// by write goroutine in order with messages
+func (a *agent) WritePacket(typ PacketType, data []byte) error {
+	if a.status() == statusClosed {
+		return ErrBrokenPipe
+	}
+
+	if len(a.chSend) >= agentWriteBacklog {
+		return ErrBufferExceed
+	}
+
+	p, err := a.codec.Encode(typ, data)
+	if err != nil {
+		return err
+	}
+
+	a.chSend <- pendingMessage{packet: p}
+	return nil
+}
+
+// handshakeData returns the handshake data, nil if not handshake yet
+func (a *agent) handshakeData() *HandShakeData {
+	data, _ := a.handshake.Load().(*HandShakeData)
+	return data
+}
+
+// writeHandshake writes handshake response of the negotiated protocol
+// version to the connection
+func (a *agent) writeHandshake() error {
+	resp := a.app.newHandshakeResponse(a.protocol, a.capabilities)
+	if len(a.app.env.challengeSecret) > 0 {
+		challenge, err := newChallenge()
+		if err != nil {
+			return err
+		}
+		a.challenge, resp.Sys.Challenge = challenge, challenge
+	}
+	if atomic.LoadInt32(&a.dictPush) == 0 {
+		var max int32
+		for _, code := range resp.Sys.Dict {
+			if int32(code) > max {
+				max = int32(code)
+			}
+		}
+		atomic.StoreInt32(&a.dictMax, max)
+	}
+	data, err := a.app.marshalSystem(resp)
+	if err != nil {
+		return err
+	}
+
+	p, err := a.codec.Encode(packet.Handshake, data)
+	if err != nil {
+		return err
+	}
+	_, err = a.conn.Write(p)
+	return err
+}
+
+// linger waits the client closing the connection after kicked until d
+// exceeded, so that the kick reason is received before the connection closed,
+// the inbound messages are ignored meanwhile
+func (a *agent) linger(d time.Duration) {
+	atomic.StoreInt32(&a.kicked, 1)
+	if d <= 0 {
+		return
+	}
+
+	timer := a.app.newTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C():
+	case <-a.chDie:
+	}
+}
+
+// awaitHandshake kicks the connection which does not complete handshake
+// within d, so that the idle sockets do not hold the agent resources
+func (a *agent) awaitHandshake(d time.Duration) {
+	timer := a.app.newTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C():
+	case <-a.chDie:
+		return
+	}
+	// the handshake ACK received meanwhile wins
+	if !atomic.CompareAndSwapInt32(&a.settled, 0, 1) {
+		return
+	}
+
+	logSession(a.session).Info("Session handshake timeout, session will be closed immediately", "remote", a.conn.RemoteAddr())
+	a.kickPacket("handshake timeout")
+}
+
+// kickPacket queues a kick packet, it is used when the connection violates
+// protocol and will be closed immediately after the packet written
+func (a *agent) kickPacket(reason string) {
+	auditSecurity(a, SecurityKicked, "", reason)
+	a.writeKickPacket()
+}
+
+// writeKickPacket queues a kick packet without the security event, the
+// packet is written by write goroutine which closes the connection after,
+// so that it is not interleaved with the messages being written. The
+// connection is closed immediately if the packet could not be queued
+func (a *agent) writeKickPacket() {
+	atomic.StoreInt32(&a.kicked, 1)
+	p, err := a.codec.Encode(packet.Kick, nil)
+	if err != nil || a.status() == statusClosed {
+		a.Close()
+		return
+	}
+
+	select {
+	case a.chSend <- pendingMessage{packet: p, kick: true}:
+		atomic.StoreInt32(&a.kickQueue, 1)
+	default:
+		logSession(a.session).Warn("Write kick packet error", "error", ErrBufferExceed)
+		a.Close()
+	}
+}
+
 // Close, implementation for session.NetworkEntity interface
 // Close closes the agent, clean inner state and close low-level connection.
 // Any blocked Read or Write operations will be unblocked and return errors.
 func (a *agent) Close() error {
-	AgentGroup.Leave(a.session)
+	a.app.agents.Leave(a.session)
+	agents.Delete(a.session.ID())
 	if a.status() == statusClosed {
 		return ErrCloseClosedSession
 	}
 	a.setStatus(statusClosed)
 
-	if env.debug {
-		logger.Println(fmt.Sprintf("Session closed, ID=%d, UID=%d, IP=%s",
-			a.session.ID(), a.session.UID(), a.conn.RemoteAddr()))
+	if a.app.debugEnabled(LogSession) {
+		logSession(a.session).Debug("Session closed", "remote", a.conn.RemoteAddr())
 	}
 
 	// prevent closing closed channel
@@ -201,8 +463,15 @@ func (a *agent) Close() error {
 		// expect
 	default:
 		close(a.chDie)
+		a.session.Cancel()
+		a.app.deregisterUID(a.session)
+		a.app.notify(EventClosed, a.session, "")
 		if a.session.UID() != 0 {
-			handler.chCloseSession <- a.session
+			select {
+			case a.app.handler.chCloseSession <- a.session:
+				observeDepth(&a.app.handler.maxCloseSession, len(a.app.handler.chCloseSession))
+			case <-a.app.env.die: // application quit, no dispatcher
+			}
 		}
 	}
 
@@ -229,7 +498,8 @@ func (a *agent) setStatus(state int32) {
 }
 
 func (a *agent) write() {
-	ticker := time.NewTicker(env.heartbeat)
+	env := a.app.env
+	ticker := a.app.clock.NewTicker(env.heartbeat)
 	chWrite := make(chan writePacket, agentWriteBacklog)
 	// clean func
 	defer func() {
@@ -237,73 +507,149 @@ func (a *agent) write() {
 		// close(a.chSend)
 		// close(chWrite)
 		a.Close()
-		if env.debug {
-			logger.Println(fmt.Sprintf("Session write goroutine exit, SessionID=%d, UID=%d", a.session.ID(), a.session.UID()))
+		if a.app.debugEnabled(LogSession) {
+			logSession(a.session).Debug("Session write goroutine exit")
 		}
 	}()
 
 	for {
 		select {
-		case <-ticker.C:
-			deadline := time.Now().Add(-2 * env.heartbeat).Unix()
-			if a.lastAt < deadline {
-				logger.Println(fmt.Sprintf("Session heartbeat timeout, LastTime=%d, Deadline=%d", a.lastAt, deadline))
+		case <-ticker.C():
+			if a.timeout(a.app.clock.Now()) {
 				return
 			}
+			if env.heartbeatMode == HeartbeatClient {
+				break
+			}
 			chWrite <- writePacket{
-				data: hbd,
+				data: a.heartbeatPacket(),
 				kick: false,
 			}
 
 		case writePacket := <-chWrite:
 			// close agent while low-level conn broken
-			_, err := a.conn.Write(writePacket.data)
+			n, err := a.conn.Write(writePacket.data)
+			a.countOut(n)
 
 			if err != nil {
-				logger.Println(err.Error())
+				logSession(a.session).Info("Write message error, session will be closed immediately", "error", err)
 				return
 			}
 
 			if writePacket.kick {
+				a.linger(env.kickGrace)
+				return
+			}
+			if writePacket.close {
 				return
 			}
 
 		case data := <-a.chSend:
-			payload, err := serializeOrRaw(data.payload)
-			if err != nil {
-				logger.Println(err.Error())
+			if data.packet != nil {
+				chWrite <- writePacket{data: data.packet, close: data.kick}
 				break
 			}
 
-			if len(Pipeline.Outbound.handlers) > 0 {
-				for _, h := range Pipeline.Outbound.handlers {
-					payload, err = h(a.session, payload)
-					if err != nil {
-						logger.Println("broken pipeline", err.Error())
-						break
+			payload, err := a.app.serializeOrRaw(data.payload)
+			if err != nil {
+				logSession(a.session).Error("nano/agent: serialize error", "route", data.route, "error", err)
+				if data.typ != message.Response && !data.kick {
+					break
+				}
+				// the client is waiting for the response, and the kicked
+				// session is closed anyway, the reason is sent as JSON
+				payload = err.(*Error).payload()
+				if data.kick {
+					if reason, err := a.app.marshalSystem(data.payload); err == nil {
+						payload = reason
 					}
 				}
 			}
 
+			route := data.route
+			if data.typ == message.Response {
+				if r, ok := a.requests.Load(data.mid); ok {
+					a.requests.Delete(data.mid)
+					route = r.(string)
+				}
+			}
+			if route != "" {
+				observeOutbound(route, len(payload))
+			}
+
+			meta := &PipelineMeta{
+				Route: route,
+				Type:  data.typ.String(),
+				ID:    data.mid,
+			}
+			payload, err = a.app.Pipeline.Outbound.process(a.session, meta, payload)
+			if err != nil {
+				logSession(a.session).Warn("nano/agent: broken pipeline", "route", route, "error", err)
+				a.app.reportError(err, ErrorContext{Source: ErrorSourceOutbound, Route: route, Session: a.session})
+
+				// replace the aborted response with error, or kick the
+				// session, pushes are dropped otherwise
+				e, ok := err.(*PipelineError)
+				if !ok || !(e.Kick || data.typ == message.Response) {
+					break
+				}
+				if e.Kick {
+					data = pendingMessage{typ: message.Push, route: "error", kick: true}
+				}
+				payload, meta.Flags = e.payload(), 0
+			}
+
+			if data.typ == message.Push {
+				tapMessage(a.session, data.typ, data.route, payload)
+			}
+
 			// construct message and encode
 			m := &message.Message{
 				Type:  data.typ,
 				Data:  payload,
 				Route: data.route,
 				ID:    data.mid,
+				Flags: meta.Flags &^ message.Compressed,
+			}
+			if atomic.LoadInt32(&a.compress) > 0 && len(payload) >= env.compressThreshold {
+				if m.Data, err = compress(payload); err != nil {
+					logSession(a.session).Error("nano/agent: compress error", "route", data.route, "error", err)
+					break
+				}
+				m.Flags |= message.Compressed
 			}
-			em, err := m.Encode()
+			// the routes registered after handshake are unknown to the
+			// client which does not receive dictionary updates
+			em, err := a.app.routes.EncodeUpTo(m, int(atomic.LoadInt32(&a.dictMax)))
 			if err != nil {
-				logger.Println(err.Error())
+				logSession(a.session).Error("nano/agent: encode message error", "route", data.route, "error", err)
 				break
 			}
 
-			// packet encode
-			p, err := codec.Encode(packet.Data, em)
+			// packet encode, the message longer than max packet size will be
+			// fragmented if client supports
+			c, size := a.codec, env.maxPacketSize
+			if atomic.LoadInt32(&a.checksum) > 0 {
+				c, size = checksumCodec{c}, size-checksumSize
+			}
+			var p []byte
+			if atomic.LoadInt32(&a.fragment) > 0 {
+				p, err = encodeFragments(c, em, size)
+			} else {
+				p, err = c.Encode(packet.Data, em)
+			}
 			if err != nil {
-				logger.Println(err)
+				logSession(a.session).Error("nano/agent: encode packet error", "route", data.route, "error", err)
 				break
 			}
+			a.countMessageOut()
+			// the kick packet follows the reason, so that clients could tell
+			// the kick from the pushes of route error
+			if data.kick {
+				if k, err := a.codec.Encode(packet.Kick, nil); err == nil {
+					p = append(p, k...)
+				}
+			}
 			chWrite <- writePacket{
 				data: p,
 				kick: data.kick,
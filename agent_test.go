@@ -0,0 +1,199 @@
+package nano
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kensomanpow/nano/internal/message"
+	"github.com/kensomanpow/nano/internal/packet"
+	"github.com/kensomanpow/nano/session"
+)
+
+func TestAgent_AppendFragment(t *testing.T) {
+	defer func(size int) { defaultApp.env.maxMessageSize = size }(defaultApp.env.maxMessageSize)
+	defaultApp.env.maxMessageSize = 8
+
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	go io.Copy(ioutil.Discard, c2)
+
+	a := newAgent(defaultApp, c1)
+	if err := a.appendFragment([]byte("1234")); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.appendFragment([]byte("5678")); err != nil {
+		t.Fatal(err)
+	}
+	if string(a.fragments) != "12345678" {
+		t.Fatalf("unexpected fragments: %s", a.fragments)
+	}
+	if err := a.appendFragment([]byte("9")); err == nil {
+		t.Fatal("fragments exceed max message size should fail")
+	}
+}
+
+func TestAgent_WriteFlags(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+
+	Pipeline.Outbound.Add(PipelineStage{
+		Name:  "encrypt",
+		Route: "flags.*",
+		Handler: func(s *session.Session, meta *PipelineMeta, in []byte) ([]byte, error) {
+			meta.Flags |= FlagEncrypted
+			return in, nil
+		},
+	})
+	defer Pipeline.Outbound.Remove("encrypt")
+
+	a := newAgent(defaultApp, c1)
+	defer a.Close()
+	go a.write()
+
+	if err := a.Push("flags.secret", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 64)
+	n, err := c2.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packets, err := DefaultCodec.NewDecoder().Decode(buf[:n])
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := message.Decode(packets[0].Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Flags != FlagEncrypted || string(m.Data) != "hello" {
+		t.Fatalf("unexpected message, Flags=%d, Data=%s", m.Flags, m.Data)
+	}
+}
+
+func TestAgent_ResponseRoute(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+
+	routes := make(chan string, 1)
+	Pipeline.Outbound.Add(PipelineStage{
+		Name:  "route",
+		Route: "route.*",
+		Handler: func(s *session.Session, meta *PipelineMeta, in []byte) ([]byte, error) {
+			routes <- meta.Route
+			return in, nil
+		},
+	})
+	defer Pipeline.Outbound.Remove("route")
+
+	a := newAgent(defaultApp, c1)
+	defer a.Close()
+	go a.write()
+	go io.Copy(ioutil.Discard, c2)
+
+	a.requests.Store(uint(1), "route.join")
+	if err := a.ResponseMID(1, []byte("ok")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case route := <-routes:
+		if route != "route.join" {
+			t.Fatalf("expect route of request, got %q", route)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("route scoped stage should process the response")
+	}
+}
+
+func TestAgent_HandshakeTimeout(t *testing.T) {
+	app := NewApp()
+	c := NewManualClock(time.Now())
+	app.SetClock(c)
+
+	client, server := net.Pipe()
+	defer client.Close()
+	received := make(chan []byte, 1)
+	go func() {
+		buf := make([]byte, 64)
+		n, _ := client.Read(buf)
+		received <- buf[:n]
+		io.Copy(ioutil.Discard, client)
+	}()
+
+	a := newAgent(app, server)
+	go a.write()
+	go a.awaitHandshake(app.env.handshakeTimeout)
+
+	deadline := time.Now().Add(time.Second)
+	for a.status() != statusClosed {
+		if time.Now().After(deadline) {
+			t.Fatalf("session should be closed after handshake timeout")
+		}
+		c.Advance(app.env.handshakeTimeout)
+		time.Sleep(time.Millisecond)
+	}
+	packets, err := DefaultCodec.NewDecoder().Decode(<-received)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packets) != 1 || packets[0].Type != PacketKick {
+		t.Fatalf("unexpected packets %v", packets)
+	}
+}
+
+func TestAgent_HandshakeCompleted(t *testing.T) {
+	app := NewApp()
+	c := NewManualClock(time.Now())
+	app.SetClock(c)
+
+	client, server := net.Pipe()
+	defer client.Close()
+
+	a := newAgent(app, server)
+	defer a.Close()
+	// handshake ACK received
+	atomic.StoreInt32(&a.settled, 1)
+	a.setStatus(statusWorking)
+	done := make(chan struct{})
+	go func() {
+		a.awaitHandshake(app.env.handshakeTimeout)
+		close(done)
+	}()
+
+	for {
+		c.Advance(app.env.handshakeTimeout)
+		select {
+		case <-done:
+			if a.status() != statusWorking {
+				t.Fatalf("session completed handshake should not be closed")
+			}
+			return
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func TestAgent_HandshakeAckAfterTimeout(t *testing.T) {
+	app := NewApp()
+	client, server := net.Pipe()
+	defer client.Close()
+
+	a := newAgent(app, server)
+	defer a.Close()
+	a.setStatus(statusHandshake)
+	// handshake timed out
+	atomic.StoreInt32(&a.settled, 1)
+
+	if err := app.handler.processPacket(a, &packet.Packet{Type: packet.HandshakeAck}); err == nil {
+		t.Fatal("handshake ACK after timeout should be rejected")
+	}
+	if a.status() == statusWorking {
+		t.Fatal("session timed out should not be working")
+	}
+}
@@ -21,129 +21,377 @@
 package nano
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
-	"syscall"
-
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/kensomanpow/nano/internal/message"
+	"github.com/kensomanpow/nano/serialize"
+	"github.com/kensomanpow/nano/serialize/protobuf"
 )
 
-var server *http.Server
+// App represents a nano application, which holds the environment, handler
+// service, serializers, pipelines, components and timers of its own. The
+// package level functions operate on the default App, so the existing
+// applications keep working without an App.
+type App struct {
+	// Pipeline contains the handlers which process the payload of every
+	// message of the application, see the package level Pipeline
+	Pipeline Pipelines
+
+	name          string               // application name
+	startAt       time.Time            // startup time
+	env           *environment         // environment of application
+	handler       *handlerService      // handler service of application
+	serializer    serialize.Serializer // application serializer
+	sysSerializer serialize.Serializer // system payloads serializer
+	timers        *timerManager        // timers of application
+	muComps       sync.RWMutex         // protect comps
+	comps         []regComp            // registered components
+	running       int32                // set after components started up
+	admin         int32                // set after cluster admin enabled
+	ready         int32                // set after listening and components started
+	agents        *Group               // all sessions of application
+	routes        *message.Dictionary  // compressed routes of application
+	mux           *http.ServeMux       // websocket server handlers
+	server        *http.Server         // websocket server
+	listener      atomic.Value         // *ListenerConfig of running listener
+	stopOnce      sync.Once            // close die only once
+	logs          atomic.Value         // *appLogger of application
+	scheduler     *Scheduler           // steps timers and dispatch in deterministic mode
+	clock         Clock                // clock of heartbeats, expiration and timers
+	durable       *durableTimers       // timer store and durable functions
+	alarm         *saturationAlarm     // saturation alarm of dispatch queues
+	slow          *slowHandlers        // slow handlers of application
+	qps           *routeQPS            // requests of each route, counted after cluster admin enabled
+	traffic       trafficCounter       // traffic of all sessions since application started
+}
+
+// defaultApp is the application which the package level functions operate
+// on, it shares the http.DefaultServeMux and the default route dictionary
+// with the applications which do not use App
+var defaultApp = newDefaultApp()
+
+func newDefaultApp() *App {
+	app := NewApp()
+	app.routes = message.DefaultDictionary()
+	app.mux = http.DefaultServeMux
+	return app
+}
+
+// apps counts the applications created in the process
+var apps int64
+
+// NewApp returns a new application with default configs, the node id of
+// application is suffixed with a sequence unless it's the first application
+// of the process, so that the applications in one process are distinguished
+// in the cluster, see App.SetNodeID
+func NewApp() *App {
+	app := &App{
+		Pipeline:   Pipelines{Outbound: &pipelineChannel{}, Inbound: &pipelineChannel{}},
+		name:       processName(),
+		startAt:    time.Now(),
+		env:        newEnvironment(),
+		serializer: protobuf.NewSerializer(),
+		clock:      realClock{},
+		durable:    newDurableTimers(),
+		alarm:      newSaturationAlarm(),
+		slow:       newSlowHandlers(),
+		qps:        newRouteQPS(),
+		routes:     message.NewDictionary(),
+		mux:        http.NewServeMux(),
+	}
+	if n := atomic.AddInt64(&apps, 1); n > 1 {
+		app.env.nodeID = fmt.Sprintf("%s-%d", app.env.nodeID, n)
+	}
+	app.timers = newTimerManager(app)
+	app.handler = newHandlerService(app)
+	app.agents = newGroup(app, "agents")
+	return app
+}
+
+// ServeMux returns the handlers of the websocket server, eg: to serve static
+// files with the websocket server. The default App uses http.DefaultServeMux
+func (app *App) ServeMux() *http.ServeMux {
+	return app.mux
+}
+
+// Listen listens on the TCP network address addr
+// and then calls Serve with handler to handle requests
+// on incoming connections. It blocks until the application
+// shutdown, and returns the error if the address can not
+// be listened or the server failed.
+func (app *App) Listen(addr string, opts ...Option) error {
+	return app.listen(context.Background(), addr, false, opts...)
+}
+
+// ListenContext likes Listen, but the application will be
+// shutdown when the ctx is cancelled.
+func (app *App) ListenContext(ctx context.Context, addr string, opts ...Option) error {
+	return app.listen(ctx, addr, false, opts...)
+}
+
+// ListenWS listens on the TCP network address addr
+// and then upgrades the HTTP server connection to the WebSocket protocol
+// to handle requests on incoming connections.
+func (app *App) ListenWS(addr string, opts ...Option) error {
+	return app.listen(context.Background(), addr, true, opts...)
+}
 
-func listen(addr string, isWs bool) {
-	startupComponents()
-	hbdEncode()
+// ListenWSContext likes ListenWS, but the application will be
+// shutdown when the ctx is cancelled.
+func (app *App) ListenWSContext(ctx context.Context, addr string, opts ...Option) error {
+	return app.listen(ctx, addr, true, opts...)
+}
 
-	// create global ticker instance, timer precision could be customized
-	// by SetTimerPrecision
-	globalTicker = time.NewTicker(timerPrecision)
+// Shutdown send a signal to let the application shutdown itself.
+func (app *App) Shutdown() {
+	app.stopOnce.Do(func() { close(app.env.die) })
+}
 
-	sessionExpiredTimer()
+// Serve likes ListenContext, but accepts the connections from ln, eg: an
+// in-memory listener for tests, or a listener inherited from parent process.
+// The ln is closed when the application shutdown
+func (app *App) Serve(ctx context.Context, ln net.Listener, opts ...Option) error {
+	o, err := app.options(opts)
+	if err != nil {
+		ln.Close()
+		return err
+	}
+	return app.run(ctx, ln, false, o)
+}
+
+// options validates the options and applies them to application
+func (app *App) options(opts []Option) (*options, error) {
+	o := &options{codec: DefaultCodec, signals: defaultSignals}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if err := app.apply(o); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+func (app *App) listen(ctx context.Context, addr string, isWs bool, opts ...Option) error {
+	o, err := app.options(opts)
+	if err != nil {
+		return err
+	}
+
+	// listen before components startup, so that the application
+	// could fail fast when the address is in use
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return app.run(ctx, ln, isWs, o)
+}
+
+// run serves the connections accepted by ln until application shutdown
+func (app *App) run(ctx context.Context, ln net.Listener, isWs bool, o *options) error {
+	if o.tlsConfig != nil {
+		ln = tls.NewListener(ln, o.tlsConfig)
+	}
+	app.storeListenerConfig(ln.Addr().String(), isWs, o)
+	app.startupComponents()
+	app.watchConfig()
+
+	// startup timer scheduler, timer precision could be customized
+	// by WithTimerPrecision or SetTimerPrecision, the timers are executed
+	// by Scheduler in deterministic mode
+	if app.scheduler == nil {
+		go app.timers.schedule(app.env.die)
+	}
+	app.restoreDurableTimers()
+
+	app.sessionExpiredTimer()
+	app.monitorQueues()
 
 	// startup logic dispatcher
-	go handler.dispatch()
+	if app.scheduler == nil {
+		go app.handler.dispatch()
+	}
 
+	if o.debugAddr != "" {
+		serveDebug(app, o.debugAddr)
+	}
+	if o.consoleAddr != "" {
+		serveConsole(app, o.consoleAddr, o.consoleToken)
+	}
+
+	chErr := make(chan error, 1)
 	go func() {
 		if isWs {
-			listenAndServeWS(addr)
+			chErr <- app.serveWS(ln, o)
 		} else {
-			listenAndServe(addr)
+			chErr <- app.serve(ln, o)
 		}
 	}()
 
-	logger.Println(fmt.Sprintf("starting application %s, listen at %s", app.name, addr))
-	sg := make(chan os.Signal)
-	signal.Notify(sg, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGKILL)
+	if o.probeAddr != "" {
+		serveProbe(app, o.probeAddr)
+	}
+
+	// receive from nil channel blocks forever if signal handling disabled,
+	// the signals are handled once the application is ready
+	var sg chan os.Signal
+	if o.signals != nil {
+		sg = make(chan os.Signal, 1)
+		signal.Notify(sg, o.signals...)
+		defer signal.Stop(sg)
+	}
+	atomic.StoreInt32(&app.ready, 1)
+
+	app.log().Println(fmt.Sprintf("starting application %s, listen at %s", app.name, ln.Addr()))
 
 	// stop server
-	select {
-	case <-env.die:
-		server.Shutdown(nil)
-		logger.Println("The app will shutdown in a few seconds")
-	case s := <-sg:
-		logger.Println("got signal", s)
+	var err error
+wait:
+	for {
+		select {
+		case <-app.env.die:
+			app.log().Println("The app will shutdown in a few seconds")
+		case <-ctx.Done():
+			app.log().Println("context done:", ctx.Err())
+		case s := <-sg:
+			app.log().Println("got signal", s)
+			if o.signalHook != nil && !o.signalHook(s) {
+				continue
+			}
+		case err = <-chErr:
+			app.log().Println(fmt.Sprintf("serve failed, Error=%s", err.Error()))
+		}
+		break wait
 	}
 
-	logger.Println("server is stopping...")
+	app.log().Println("server is stopping...")
+	atomic.StoreInt32(&app.ready, 0)
+	app.Shutdown()
+	ln.Close()
+	app.unwatchConfig()
+	app.notify(EventDraining, nil, "")
+	app.runShutdownHooks()
 
 	// shutdown all components registered by application, that
 	// call by reverse order against register
-	shutdownComponents()
+	app.shutdownComponents()
+	app.closeAgents()
+	return err
 }
 
-// Enable current server accept connection
-func listenAndServe(addr string) {
-	listener, err := net.Listen("tcp", addr)
-	if err != nil {
-		logger.Fatal(err.Error())
-	}
+// closeAgents closes the connections of application after shutdown, so
+// that the other applications in process are not affected
+func (app *App) closeAgents() {
+	agents.Range(func(_, v interface{}) bool {
+		if a := v.(*agent); a.app == app {
+			a.Close()
+		}
+		return true
+	})
+}
 
-	defer listener.Close()
+// serve accepts the connections until the listener closed
+func (app *App) serve(ln net.Listener, o *options) error {
 	for {
-		conn, err := listener.Accept()
+		conn, err := ln.Accept()
 		if err != nil {
-			logger.Println(err.Error())
+			select {
+			case <-app.env.die:
+				return nil // listener closed by shutdown
+			default:
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				app.log().Println(err.Error())
+				continue
+			}
+			return err
+		}
+		if !app.allowAddr(conn.RemoteAddr().String()) {
+			conn.Close()
 			continue
 		}
 
-		go handler.handle(conn)
+		go app.handler.handle(conn, o)
 	}
 }
 
-func listenAndServeWS(addr string) {
+func (app *App) serveWS(ln net.Listener, o *options) error {
 	var upgrader = websocket.Upgrader{
 		ReadBufferSize:  1024,
 		WriteBufferSize: 1024,
-		CheckOrigin:     env.checkOrigin,
+		CheckOrigin:     app.env.checkOrigin,
+		Subprotocols:    app.env.wsSubprotocols,
 	}
 
 	// restart
-	if server == nil {
-		http.HandleFunc("/"+strings.TrimPrefix(env.wsPath, "/"), func(w http.ResponseWriter, r *http.Request) {
+	if app.server == nil {
+		app.mux.HandleFunc("/"+strings.TrimPrefix(app.env.wsPath, "/"), func(w http.ResponseWriter, r *http.Request) {
+			if !app.allowAddr(r.RemoteAddr) {
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+			values, ok := app.upgradeWS(w, r)
+			if !ok {
+				return
+			}
 			conn, err := upgrader.Upgrade(w, r, nil)
 			if err != nil {
-				logger.Println(fmt.Sprintf("Upgrade failure, URI=%s, Error=%s", r.RequestURI, err.Error()))
+				app.log().Println(fmt.Sprintf("Upgrade failure, URI=%s, Error=%s", r.RequestURI, err.Error()))
 				return
 			}
 
-			handler.handleWS(conn)
+			app.handler.handleWS(conn, o, values)
 		})
 	}
 
-	server = &http.Server{
-		Addr:           addr,
-		Handler:        http.DefaultServeMux,
+	app.server = &http.Server{
+		Addr:           ln.Addr().String(),
+		Handler:        app.mux,
 		ReadTimeout:    20 * time.Second,
 		WriteTimeout:   40 * time.Second,
 		MaxHeaderBytes: 1 << 20,
 	}
 
-	server.ListenAndServe()
+	if err := app.server.Serve(ln); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
 }
 
-func sessionExpiredTimer() {
-	tick := time.NewTicker(time.Second)
+func (app *App) sessionExpiredTimer() {
+	tick := app.clock.NewTicker(time.Second)
 	go func() {
+		defer tick.Stop()
 		for {
 			select {
-			case <-tick.C:
-				t := time.Now()
-				for _, uid := range AgentGroup.Members() {
-					s, _ := AgentGroup.Member(uid)
-					if s != nil && t.Sub(s.LastHandlerAccessTime) > time.Duration(env.sessionExpireSecs)*time.Second {
-						if env.debug {
-							logger.Println(fmt.Sprintf("sessionExpired kick UID [%d]", uid))
+			case <-tick.C():
+				t := app.clock.Now()
+				for _, uid := range app.agents.Members() {
+					s, _ := app.agents.Member(uid)
+					if s == nil {
+						continue
+					}
+					if t.Sub(s.LastHandlerAccessTime) > time.Duration(app.env.sessionExpireSecs)*time.Second {
+						if app.debugEnabled(LogSession) {
+							app.log().Println(fmt.Sprintf("sessionExpired kick UID [%d]", uid))
 						}
 						s.Close()
-						AgentGroup.Leave(s)
+						app.agents.Leave(s)
 					}
 				}
+
+			case <-app.env.die:
+				return
 			}
 		}
 	}()
@@ -0,0 +1,75 @@
+package nano
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/kensomanpow/nano/component"
+	"github.com/kensomanpow/nano/session"
+)
+
+type AppComp struct {
+	component.Base
+}
+
+func (c *AppComp) Hello(s *session.Session, _ []byte) error {
+	return nil
+}
+
+func TestApp_Isolated(t *testing.T) {
+	a1, a2 := NewApp(), NewApp()
+	a1.SetNodeID("node-1")
+	a2.SetNodeID("node-2")
+	a1.SetMinProtocolVersion(3)
+
+	if a1.Configuration().NodeID != "node-1" || a2.Configuration().NodeID != "node-2" {
+		t.Fatalf("node id should be isolated")
+	}
+	if a2.env.minProtocol != ProtocolLegacy {
+		t.Fatalf("min protocol should be isolated, got %d", a2.env.minProtocol)
+	}
+	if defaultApp.env.nodeID == "node-1" || defaultApp.env.nodeID == "node-2" {
+		t.Fatalf("default app should not be affected")
+	}
+
+	a1.Register(&AppComp{})
+	a1.startupComponents()
+	if _, ok := a1.handler.dictionary()["AppComp.Hello"]; !ok {
+		t.Fatalf("route should be registered in a1")
+	}
+	if _, ok := a2.handler.dictionary()["AppComp.Hello"]; ok {
+		t.Fatalf("route should not be registered in a2")
+	}
+}
+
+func TestApp_ListenContext(t *testing.T) {
+	app := NewApp()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- app.ListenContext(ctx, "127.0.0.1:0") }()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("expect nil error after context cancelled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("application should shutdown when context cancelled")
+	}
+}
+
+func TestApp_ListenError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	if err := NewApp().Listen(ln.Addr().String()); err == nil {
+		t.Fatalf("expect error when address in use")
+	}
+}
@@ -0,0 +1,392 @@
+// Copyright (c) nano Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package auth provides the handshake authentication helpers, which could be
+// set as the auth function of application, eg:
+//
+//	nano.SetAuthFunc(auth.JWT(auth.JWTConfig{Key: secret}))
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	_ "crypto/sha256" // register SHA256
+	_ "crypto/sha512" // register SHA384 and SHA512
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kensomanpow/nano"
+	"github.com/kensomanpow/nano/session"
+)
+
+// ClaimsKey is the session key of the claims of authenticated token, eg:
+// s.Value(auth.ClaimsKey).(auth.Claims), the `roles` claim is checked by
+// nano.GuardStage
+const ClaimsKey = nano.ClaimsKey
+
+// Errors of token validation
+var (
+	ErrMalformedToken   = errors.New("auth: malformed token")
+	ErrAlgorithm        = errors.New("auth: algorithm not allowed")
+	ErrSignature        = errors.New("auth: invalid signature")
+	ErrExpired          = errors.New("auth: token expired")
+	ErrMissingExpiry    = errors.New("auth: missing exp claim")
+	ErrNotValidYet      = errors.New("auth: token not valid yet")
+	ErrIssuer           = errors.New("auth: invalid issuer")
+	ErrAudience         = errors.New("auth: invalid audience")
+	ErrUIDClaim         = errors.New("auth: invalid uid claim")
+	ErrKeyNotFound      = errors.New("auth: key not found")
+	ErrUnsupportedKey   = errors.New("auth: unsupported key type")
+	ErrMissingToken     = errors.New("auth: missing token")
+	errInvalidECDSASize = errors.New("auth: invalid ecdsa signature size")
+)
+
+type (
+	// Claims represents the claims of JWT
+	Claims map[string]interface{}
+
+	// Header represents the JOSE header of JWT
+	Header struct {
+		Alg string `json:"alg"`
+		Typ string `json:"typ"`
+		Kid string `json:"kid,omitempty"`
+	}
+
+	// JWTConfig represents the options of JWT validation
+	JWTConfig struct {
+		// Key verifies the signature, []byte for HS256/HS384/HS512,
+		// *rsa.PublicKey for RS256/RS384/RS512 and *ecdsa.PublicKey for
+		// ES256/ES384/ES512
+		Key interface{}
+		// KeyFunc returns the key by the header, eg: find the key by `kid`
+		// for the key rotation, it overrides Key
+		KeyFunc func(h Header) (interface{}, error)
+		// Algorithms are the allowed algorithms, default allows the
+		// algorithms of the key type
+		Algorithms []string
+		// Issuer is the expected `iss` claim, empty skips the check
+		Issuer string
+		// Audience is the expected `aud` claim, empty skips the check
+		Audience string
+		// UIDClaim is the claim of session UID, default is `sub`
+		UIDClaim string
+		// Leeway is the tolerance of clock skew for `exp` and `nbf`
+		Leeway time.Duration
+		// AllowNoExpiry accepts the tokens without `exp` claim, which are
+		// rejected by default, because they are valid forever once leaked
+		AllowNoExpiry bool
+		// Validate checks the claims additionally, optional
+		Validate func(s *session.Session, claims Claims) error
+		// Now returns current time, default is time.Now
+		Now func() time.Time
+	}
+)
+
+// JWT returns the auth function which validates the JWT in `Token` of
+// handshake data, the session is bound with the UID in claims and the claims
+// are stored with ClaimsKey. The session is kicked with nano.ErrUnauthorized
+// if the token is invalid, the cause is reported to the security sink but not
+// sent to client
+func JWT(c JWTConfig) func(s *session.Session, data *nano.HandShakeData) interface{} {
+	return func(s *session.Session, data *nano.HandShakeData) interface{} {
+		if err := authenticate(c, s, data); err != nil {
+			return unauthorized(err)
+		}
+		return nil
+	}
+}
+
+func authenticate(c JWTConfig, s *session.Session, data *nano.HandShakeData) error {
+	if data == nil || data.Token == "" {
+		return ErrMissingToken
+	}
+	claims, err := ParseJWT(data.Token, c)
+	if err != nil {
+		return err
+	}
+
+	name := c.UIDClaim
+	if name == "" {
+		name = "sub"
+	}
+	uid, err := claims.Int64(name)
+	if err != nil {
+		return err
+	}
+	if c.Validate != nil {
+		if err := c.Validate(s, claims); err != nil {
+			return err
+		}
+	}
+	if err := s.Bind(uid); err != nil {
+		return err
+	}
+	s.Set(ClaimsKey, claims)
+	return nil
+}
+
+// unauthorized returns the kick reason, the cause is kept in Err which is not
+// sent to client
+func unauthorized(err error) *nano.Error {
+	e := *nano.ErrUnauthorized
+	e.Err = err
+	return &e
+}
+
+// ParseJWT verifies the signature and the registered claims of token, and
+// returns the claims
+func ParseJWT(token string, c JWTConfig) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformedToken
+	}
+
+	h := Header{}
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, err
+	}
+	key := c.Key
+	if c.KeyFunc != nil {
+		var err error
+		if key, err = c.KeyFunc(h); err != nil {
+			return nil, err
+		}
+	}
+	if key == nil {
+		return nil, ErrKeyNotFound
+	}
+	if !allowed(c.Algorithms, key, h.Alg) {
+		return nil, ErrAlgorithm
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+	if err := verify(h.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	claims := Claims{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if c.Now != nil {
+		now = c.Now()
+	}
+	if err := claims.validate(c, now); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return ErrMalformedToken
+	}
+	d := json.NewDecoder(strings.NewReader(string(data)))
+	d.UseNumber()
+	if err := d.Decode(v); err != nil {
+		return ErrMalformedToken
+	}
+	return nil
+}
+
+// allowed reports whether alg is allowed for the key
+func allowed(algs []string, key interface{}, alg string) bool {
+	if len(algs) > 0 {
+		for _, a := range algs {
+			if a == alg {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch key.(type) {
+	case []byte:
+		return strings.HasPrefix(alg, "HS")
+	case *rsa.PublicKey:
+		return strings.HasPrefix(alg, "RS")
+	case *ecdsa.PublicKey:
+		return strings.HasPrefix(alg, "ES")
+	default:
+		return false
+	}
+}
+
+// hashes of the algorithm suffixes
+var hashes = map[string]crypto.Hash{
+	"256": crypto.SHA256,
+	"384": crypto.SHA384,
+	"512": crypto.SHA512,
+}
+
+func verify(alg string, key interface{}, signed string, sig []byte) error {
+	if len(alg) != 5 {
+		return ErrAlgorithm
+	}
+	hash, ok := hashes[alg[2:]]
+	if !ok {
+		return ErrAlgorithm
+	}
+
+	switch alg[:2] {
+	case "HS":
+		secret, ok := key.([]byte)
+		if !ok {
+			return ErrUnsupportedKey
+		}
+		mac := hmac.New(hash.New, secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return ErrSignature
+		}
+		return nil
+
+	case "RS":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return ErrUnsupportedKey
+		}
+		if rsa.VerifyPKCS1v15(pub, hash, digest(hash, signed), sig) != nil {
+			return ErrSignature
+		}
+		return nil
+
+	case "ES":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return ErrUnsupportedKey
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return errInvalidECDSASize
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(pub, digest(hash, signed), r, s) {
+			return ErrSignature
+		}
+		return nil
+
+	default:
+		return ErrAlgorithm
+	}
+}
+
+func digest(hash crypto.Hash, signed string) []byte {
+	h := hash.New()
+	h.Write([]byte(signed))
+	return h.Sum(nil)
+}
+
+// validate checks the registered claims
+func (claims Claims) validate(c JWTConfig, now time.Time) error {
+	exp, ok := claims.time("exp")
+	if !ok && !c.AllowNoExpiry {
+		return ErrMissingExpiry
+	}
+	if ok && !now.Before(exp.Add(c.Leeway)) {
+		return ErrExpired
+	}
+	if nbf, ok := claims.time("nbf"); ok && now.Add(c.Leeway).Before(nbf) {
+		return ErrNotValidYet
+	}
+	if c.Issuer != "" && claims.String("iss") != c.Issuer {
+		return ErrIssuer
+	}
+	if c.Audience != "" && !claims.hasAudience(c.Audience) {
+		return ErrAudience
+	}
+	return nil
+}
+
+// String returns the string claim, empty if not exists or not a string
+func (claims Claims) String(name string) string {
+	s, _ := claims[name].(string)
+	return s
+}
+
+// Strings returns the claim of string or string array, eg: roles
+func (claims Claims) Strings(name string) []string {
+	switch v := claims[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		ss := make([]string, 0, len(v))
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				ss = append(ss, s)
+			}
+		}
+		return ss
+	default:
+		return nil
+	}
+}
+
+// Int64 returns the integer claim, the numeric string is also accepted
+func (claims Claims) Int64(name string) (int64, error) {
+	switch v := claims[name].(type) {
+	case json.Number:
+		return v.Int64()
+	case float64:
+		return int64(v), nil
+	case string:
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %s", ErrUIDClaim, name)
+		}
+		return n, nil
+	default:
+		return 0, fmt.Errorf("%w: %s", ErrUIDClaim, name)
+	}
+}
+
+func (claims Claims) time(name string) (time.Time, bool) {
+	n, ok := claims[name].(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	secs, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, int64(secs*float64(time.Second))), true
+}
+
+func (claims Claims) hasAudience(aud string) bool {
+	for _, a := range claims.Strings("aud") {
+		if a == aud {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kensomanpow/nano"
+	"github.com/kensomanpow/nano/session/sessiontest"
+)
+
+func encode(t *testing.T, v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func signHS256(t *testing.T, secret []byte, claims Claims) string {
+	signed := encode(t, Header{Alg: "HS256", Typ: "JWT"}) + "." + encode(t, claims)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestParseJWT_HS256(t *testing.T) {
+	secret := []byte("secret")
+	now := time.Unix(1700000000, 0)
+	c := JWTConfig{Key: secret, Issuer: "login", Audience: "game", Now: func() time.Time { return now }}
+
+	token := signHS256(t, secret, Claims{"sub": "42", "iss": "login", "aud": []string{"game"}, "exp": now.Unix() + 60})
+	claims, err := ParseJWT(token, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uid, err := claims.Int64("sub"); err != nil || uid != 42 {
+		t.Fatalf("unexpected uid %d, %v", uid, err)
+	}
+
+	exp := now.Unix() + 60
+	cases := map[error]string{
+		ErrExpired:       signHS256(t, secret, Claims{"iss": "login", "aud": "game", "exp": now.Unix()}),
+		ErrMissingExpiry: signHS256(t, secret, Claims{"iss": "login", "aud": "game"}),
+		ErrIssuer:        signHS256(t, secret, Claims{"iss": "other", "aud": "game", "exp": exp}),
+		ErrAudience:      signHS256(t, secret, Claims{"iss": "login", "aud": "other", "exp": exp}),
+		ErrSignature:     signHS256(t, []byte("other"), Claims{"iss": "login", "aud": "game", "exp": exp}),
+	}
+	for expect, token := range cases {
+		if _, err := ParseJWT(token, c); err != expect {
+			t.Fatalf("expect %v, got %v", expect, err)
+		}
+	}
+
+	// the tokens without exp are accepted if allowed explicitly
+	c.AllowNoExpiry = true
+	if _, err := ParseJWT(cases[ErrMissingExpiry], c); err != nil {
+		t.Fatal(err)
+	}
+
+	none := encode(t, Header{Alg: "none"}) + "." + encode(t, Claims{"sub": 1}) + "."
+	if _, err := ParseJWT(none, c); err != ErrAlgorithm {
+		t.Fatalf("none algorithm should be rejected, got %v", err)
+	}
+}
+
+func TestParseJWT_Asymmetric(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := encode(t, Claims{"sub": 7, "exp": time.Now().Add(time.Hour).Unix()})
+	digest := func(signed string) []byte {
+		h := crypto.SHA256.New()
+		h.Write([]byte(signed))
+		return h.Sum(nil)
+	}
+
+	signed := encode(t, Header{Alg: "RS256"}) + "." + claims
+	sig, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest(signed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseJWT(signed+"."+base64.RawURLEncoding.EncodeToString(sig), JWTConfig{Key: &rsaKey.PublicKey}); err != nil {
+		t.Fatal(err)
+	}
+
+	signed = encode(t, Header{Alg: "ES256", Kid: "k1"}) + "." + claims
+	r, s, err := ecdsa.Sign(rand.Reader, ecKey, digest(signed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig = make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	c := JWTConfig{KeyFunc: func(h Header) (interface{}, error) {
+		if h.Kid != "k1" {
+			return nil, ErrKeyNotFound
+		}
+		return &ecKey.PublicKey, nil
+	}}
+	if _, err := ParseJWT(signed+"."+base64.RawURLEncoding.EncodeToString(sig), c); err != nil {
+		t.Fatal(err)
+	}
+
+	// the algorithm confusion is rejected
+	if _, err := ParseJWT(signHS256(t, []byte("key"), Claims{"sub": 7}), JWTConfig{Key: &rsaKey.PublicKey}); err != ErrAlgorithm {
+		t.Fatalf("expect algorithm error, got %v", err)
+	}
+}
+
+func TestJWT(t *testing.T) {
+	secret := []byte("secret")
+	authFunc := JWT(JWTConfig{Key: secret, UIDClaim: "uid"})
+
+	s, _ := sessiontest.NewSession()
+	data := &nano.HandShakeData{Token: signHS256(t, secret, Claims{"uid": 42, "roles": []string{"gm"}, "exp": time.Now().Add(time.Hour).Unix()})}
+	if reason := authFunc(s, data); reason != nil {
+		t.Fatalf("unexpected kick %s", reason)
+	}
+	if s.UID() != 42 {
+		t.Fatalf("session should be bound, got %d", s.UID())
+	}
+	if roles := s.Value(ClaimsKey).(Claims).Strings("roles"); len(roles) != 1 || roles[0] != "gm" {
+		t.Fatalf("unexpected roles %v", roles)
+	}
+
+	s, _ = sessiontest.NewSession()
+	reason := authFunc(s, &nano.HandShakeData{Token: "bad"})
+	e, ok := reason.(*nano.Error)
+	if !ok || !errors.Is(e, nano.ErrUnauthorized) || s.UID() != 0 {
+		t.Fatalf("unexpected kick %+v", reason)
+	}
+
+	// the cause is not sent to client
+	payload, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Err != ErrMalformedToken || strings.Contains(string(payload), "malformed") {
+		t.Fatalf("unexpected kick payload %s, cause %v", payload, e.Err)
+	}
+}
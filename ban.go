@@ -0,0 +1,423 @@
+package nano
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kensomanpow/nano/session"
+)
+
+// DeviceIDKey is the session key of the device ID reported by handshake
+const DeviceIDKey = "nano.device"
+
+// ErrNoBanList is returned when banning without a ban list, see SetBanList
+var ErrNoBanList = errors.New("nano/ban: no ban list")
+
+// banCode is the code of KickReason pushed to the banned clients
+const banCode = 403
+
+func init() {
+	// the UID is usually bound by handler after handshake, eg: login
+	session.OnBind(func(s *session.Session) {
+		if v, ok := agents.Load(s.ID()); ok {
+			v.(*agent).rejectBanned()
+		}
+	})
+}
+
+// BanKind represents what a ban matches
+type BanKind string
+
+// Kinds of bans
+const (
+	BanUID    BanKind = "uid"    // matches the UID bound to session
+	BanIP     BanKind = "ip"     // matches the remote IP of connection
+	BanDevice BanKind = "device" // matches the device ID reported by handshake
+)
+
+type (
+	// BanEntry represents a ban of a UID, IP or device ID
+	BanEntry struct {
+		Kind   BanKind    `json:"kind"`
+		Value  string     `json:"value"`
+		Reason string     `json:"reason,omitempty"`
+		Until  *time.Time `json:"until,omitempty"` // nil if permanent
+	}
+
+	// BanStore persists the bans, a ban is saved when added and deleted when
+	// removed or expired
+	BanStore interface {
+		Save(ban *BanEntry) error
+		Delete(kind BanKind, value string) error
+		Load() ([]*BanEntry, error)
+	}
+
+	// BanList holds the bans, which are checked at handshake time: the IP and
+	// device ID before the auth function called, and the UID when it is bound,
+	// eg: by the auth function or a login handler. The banned clients are
+	// kicked with a KickReason, so that they could show when the ban expires
+	BanList struct {
+		mu    sync.Mutex
+		store BanStore
+		bans  map[string]*BanEntry
+		clock Clock // clock of the application which the list set to
+	}
+
+	fileBanStore struct {
+		mu   sync.Mutex
+		path string
+		bans map[string]*BanEntry
+	}
+)
+
+func banKey(kind BanKind, value string) string {
+	return string(kind) + ":" + value
+}
+
+// normalizeBan returns the canonical value of ban, eg: the IPv4 mapped IPv6
+// addresses are converted to IPv4
+func normalizeBan(kind BanKind, value string) string {
+	if kind == BanIP {
+		if ip := net.ParseIP(value); ip != nil {
+			return ip.String()
+		}
+	}
+	return value
+}
+
+// expired reports whether the ban is expired at now
+func (b *BanEntry) expired(now time.Time) bool {
+	return b.Until != nil && !now.Before(*b.Until)
+}
+
+// matches reports whether the ban matches session s
+func (b *BanEntry) matches(s *session.Session) bool {
+	switch b.Kind {
+	case BanUID:
+		return s.UID() > 0 && strconv.FormatInt(s.UID(), 10) == b.Value
+	case BanIP:
+		return sessionIP(s) == b.Value
+	case BanDevice:
+		return b.Value != "" && s.String(DeviceIDKey) == b.Value
+	}
+	return false
+}
+
+func (b *BanEntry) kickReason() *KickReason {
+	reason := b.Reason
+	if reason == "" {
+		reason = "banned"
+	}
+	return &KickReason{Code: banCode, Reason: reason, Until: b.Until}
+}
+
+// NewBanList returns a BanList which persists the bans in store, the stored
+// bans are loaded, and the expired ones are removed when looked up. The bans
+// are kept in memory only if store is nil. The expiration is checked by the
+// clock of the application which the list set to
+func NewBanList(store BanStore) (*BanList, error) {
+	l := &BanList{store: store, bans: map[string]*BanEntry{}, clock: realClock{}}
+	if store == nil {
+		return l, nil
+	}
+
+	bans, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range bans {
+		l.bans[banKey(b.Kind, b.Value)] = b
+	}
+	return l, nil
+}
+
+// now returns the current time of the clock of list
+func (l *BanList) now() time.Time {
+	l.mu.Lock()
+	c := l.clock
+	l.mu.Unlock()
+	return c.Now()
+}
+
+func (l *BanList) setClock(c Clock) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.clock = c
+}
+
+// Add adds or replaces the ban, it is persisted before taking effect
+func (l *BanList) Add(ban *BanEntry) error {
+	b := *ban
+	b.Value = normalizeBan(b.Kind, b.Value)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.store != nil {
+		if err := l.store.Save(&b); err != nil {
+			return err
+		}
+	}
+	l.bans[banKey(b.Kind, b.Value)] = &b
+	return nil
+}
+
+// Remove removes the ban of kind and value
+func (l *BanList) Remove(kind BanKind, value string) error {
+	value = normalizeBan(kind, value)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.store != nil {
+		if err := l.store.Delete(kind, value); err != nil {
+			return err
+		}
+	}
+	delete(l.bans, banKey(kind, value))
+	return nil
+}
+
+// Lookup returns the ban of kind and value, nil if not banned
+func (l *BanList) Lookup(kind BanKind, value string) *BanEntry {
+	return l.lookup(kind, normalizeBan(kind, value))
+}
+
+// List returns the bans not expired
+func (l *BanList) List() []*BanEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock.Now()
+	bans := make([]*BanEntry, 0, len(l.bans))
+	for _, b := range l.bans {
+		if !b.expired(now) {
+			c := *b
+			bans = append(bans, &c)
+		}
+	}
+	return bans
+}
+
+// lookup returns the ban of kind and value, the expired ban is removed
+func (l *BanList) lookup(kind BanKind, value string) *BanEntry {
+	key := banKey(kind, value)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.bans[key]
+	if !ok {
+		return nil
+	}
+	if b.expired(l.clock.Now()) {
+		delete(l.bans, key)
+		if l.store != nil {
+			if err := l.store.Delete(kind, value); err != nil {
+				logger.Println(fmt.Sprintf("nano/ban: delete expired ban failed, Key=%s, Error=%s", key, err.Error()))
+			}
+		}
+		return nil
+	}
+	c := *b
+	return &c
+}
+
+// match returns the ban matches session s, nil if not banned
+func (l *BanList) match(s *session.Session) *BanEntry {
+	if uid := s.UID(); uid > 0 {
+		if b := l.lookup(BanUID, strconv.FormatInt(uid, 10)); b != nil {
+			return b
+		}
+	}
+	if device := s.String(DeviceIDKey); device != "" {
+		if b := l.lookup(BanDevice, device); b != nil {
+			return b
+		}
+	}
+	if ip := sessionIP(s); ip != "" {
+		return l.lookup(BanIP, ip)
+	}
+	return nil
+}
+
+// sessionIP returns the normalized remote IP of session s
+func sessionIP(s *session.Session) string {
+	addr := s.RemoteAddr()
+	if addr == nil {
+		return ""
+	}
+	host := addr.String()
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return normalizeBan(BanIP, host)
+}
+
+// NewFileBanStore returns a BanStore which persists bans in a JSON file
+func NewFileBanStore(path string) (BanStore, error) {
+	s := &fileBanStore{path: path, bans: map[string]*BanEntry{}}
+	if !fileExists(path) {
+		return s, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &s.bans); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *fileBanStore) Save(ban *BanEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.bans[banKey(ban.Kind, ban.Value)] = ban
+	return s.flush()
+}
+
+func (s *fileBanStore) Delete(kind BanKind, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.bans, banKey(kind, value))
+	return s.flush()
+}
+
+func (s *fileBanStore) Load() ([]*BanEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bans := make([]*BanEntry, 0, len(s.bans))
+	for _, b := range s.bans {
+		bans = append(bans, b)
+	}
+	return bans, nil
+}
+
+// flush writes all bans to a temporary file then renames it, so a crash
+// during writing will not corrupt the store
+func (s *fileBanStore) flush() error {
+	data, err := json.Marshal(s.bans)
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// SetBanList set the ban list checked at handshake time, nil disables it
+func SetBanList(l *BanList) {
+	defaultApp.SetBanList(l)
+}
+
+// SetBanList set the ban list of the application, the bans expire by the
+// clock of application
+func (app *App) SetBanList(l *BanList) {
+	if l != nil {
+		l.setClock(app.clock)
+	}
+	app.env.banList = l
+}
+
+// WithBanList set the ban list checked at handshake time, see SetBanList
+func WithBanList(l *BanList) Option {
+	return withSetting(func(app *App) error {
+		app.SetBanList(l)
+		return nil
+	})
+}
+
+// Ban bans the UID, IP or device ID for d, zero d bans permanently, the
+// sessions matched are kicked with reason immediately
+func Ban(kind BanKind, value string, d time.Duration, reason string) error {
+	return defaultApp.Ban(kind, value, d, reason)
+}
+
+// Ban bans the UID, IP or device ID in the ban list of the application, and
+// kicks the sessions matched
+func (app *App) Ban(kind BanKind, value string, d time.Duration, reason string) error {
+	l := app.env.banList
+	if l == nil {
+		return ErrNoBanList
+	}
+
+	ban := &BanEntry{Kind: kind, Value: normalizeBan(kind, value), Reason: reason}
+	if d > 0 {
+		until := l.now().Add(d)
+		ban.Until = &until
+	}
+	if err := l.Add(ban); err != nil {
+		return err
+	}
+
+	app.agents.mu.RLock()
+	matched := make([]*session.Session, 0, 1)
+	for _, s := range app.agents.sessions {
+		if ban.matches(s) {
+			matched = append(matched, s)
+		}
+	}
+	app.agents.mu.RUnlock()
+
+	for _, s := range matched {
+		logSession(s).Info("Session banned, session will be closed", "kind", kind, "value", ban.Value)
+		if err := s.Kick(ban.kickReason()); err != nil {
+			logSession(s).Warn("nano/ban: kick failed", "error", err)
+		}
+	}
+	return nil
+}
+
+// Unban removes the ban of UID, IP or device ID
+func Unban(kind BanKind, value string) error {
+	return defaultApp.Unban(kind, value)
+}
+
+// Unban removes the ban from the ban list of the application
+func (app *App) Unban(kind BanKind, value string) error {
+	l := app.env.banList
+	if l == nil {
+		return ErrNoBanList
+	}
+	return l.Remove(kind, value)
+}
+
+// rejectBanned kicks the agent if it is banned, and reports whether it is
+// kicked, the agent kicked already is reported as well
+func (a *agent) rejectBanned() bool {
+	if atomic.LoadInt32(&a.kicked) > 0 {
+		return true
+	}
+	l := a.app.env.banList
+	if l == nil {
+		return false
+	}
+	ban := l.match(a.session)
+	if ban == nil {
+		return false
+	}
+
+	logSession(a.session).Info("Session banned, session will be closed", "kind", ban.Kind, "value", ban.Value)
+	auditSecurity(a, SecurityBanned, "", ban.Reason)
+	a.reject(ban.kickReason())
+	return true
+}
@@ -0,0 +1,211 @@
+package nano
+
+import (
+	"context"
+	encjson "encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kensomanpow/nano/internal/message"
+	"github.com/kensomanpow/nano/internal/packet"
+	"github.com/kensomanpow/nano/serialize/json"
+)
+
+func TestBanList(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nano-ban")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := NewFileBanStore(filepath.Join(dir, "bans.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := NewBanList(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	past := time.Now().Add(-time.Minute)
+	if err := l.Add(&BanEntry{Kind: BanUID, Value: "1001", Reason: "cheating"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Add(&BanEntry{Kind: BanIP, Value: "::ffff:10.0.0.1", Until: &past}); err != nil {
+		t.Fatal(err)
+	}
+	if b := l.Lookup(BanUID, "1001"); b == nil || b.Reason != "cheating" || b.Until != nil {
+		t.Fatalf("unexpected ban %+v", b)
+	}
+	if b := l.Lookup(BanIP, "10.0.0.1"); b != nil {
+		t.Fatalf("expired ban should be removed, got %+v", b)
+	}
+
+	// the bans are restored from store
+	l, err = NewBanList(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bans := l.List(); len(bans) != 1 || bans[0].Value != "1001" {
+		t.Fatalf("unexpected bans %+v", bans)
+	}
+	if err := l.Remove(BanUID, "1001"); err != nil {
+		t.Fatal(err)
+	}
+	if b := l.Lookup(BanUID, "1001"); b != nil {
+		t.Fatalf("ban should be removed, got %+v", b)
+	}
+}
+
+func TestBanList_Handshake(t *testing.T) {
+	l, _ := NewBanList(nil)
+	app := NewApp()
+	if err := app.Ban(BanIP, "127.0.0.1", 0, ""); err != ErrNoBanList {
+		t.Fatalf("expect ErrNoBanList, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ln, addr := listenLocal(t)
+	app.SetBanList(l)
+	go app.Serve(ctx, ln, WithSerializer(json.NewSerializer()), WithoutSignals())
+
+	reason := func(c *testClient) *KickReason {
+		m, err := message.Decode(c.read(PacketData).Data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := &KickReason{}
+		if err := encjson.Unmarshal(m.Data, r); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	if err := app.Ban(BanDevice, "device-1", time.Hour, "cheating"); err != nil {
+		t.Fatal(err)
+	}
+	c := dialApp(t, addr)
+	defer c.conn.Close()
+	c.write(PacketHandshake, []byte(`{"deviceId":"device-1","sys":{"protocol":1}}`))
+	if r := reason(c); r.Code != banCode || r.Reason != "cheating" || r.Until == nil {
+		t.Fatalf("unexpected kick reason %+v", r)
+	}
+
+	// the live sessions are kicked when banned
+	c2 := dialApp(t, addr)
+	defer c2.conn.Close()
+	c2.write(PacketHandshake, []byte(`{"deviceId":"device-2","sys":{"protocol":1}}`))
+	c2.read(PacketHandshake)
+	c2.write(PacketHandshakeAck, nil)
+	if err := app.Ban(BanIP, "127.0.0.1", 0, ""); err != nil {
+		t.Fatal(err)
+	}
+	if r := reason(c2); r.Reason != "banned" || r.Until != nil {
+		t.Fatalf("unexpected kick reason %+v", r)
+	}
+	if err := app.Unban(BanIP, "127.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBanList_Clock(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewManualClock(start)
+	app := NewApp()
+	app.SetClock(clock)
+	l, _ := NewBanList(nil)
+	app.SetBanList(l)
+
+	if err := app.Ban(BanUID, "1001", time.Minute, "cheating"); err != nil {
+		t.Fatal(err)
+	}
+	if b := l.Lookup(BanUID, "1001"); b == nil || !b.Until.Equal(start.Add(time.Minute)) {
+		t.Fatalf("unexpected ban %+v", b)
+	}
+	clock.Advance(time.Minute)
+	if bans := l.List(); len(bans) != 0 {
+		t.Fatalf("ban should be expired by the clock of application, got %+v", bans)
+	}
+}
+
+func TestBanList_Reject(t *testing.T) {
+	l, _ := NewBanList(nil)
+	app := NewApp()
+	app.Register(&LoginComp{})
+	app.SetBanList(l)
+	if err := app.Ban(BanDevice, "device-1", 0, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Ban(BanUID, "42", 0, "cheating"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ln, addr := listenLocal(t)
+	go app.Serve(ctx, ln, WithSerializer(json.NewSerializer()), WithoutSignals())
+
+	login, err := (&message.Message{Type: message.Notify, Route: "LoginComp.Login"}).Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var segment []byte
+	for _, p := range []Packet{
+		{Type: PacketHandshake, Data: []byte(`{"deviceId":"device-1","sys":{"protocol":1}}`)},
+		{Type: PacketHandshakeAck},
+		{Type: PacketData, Data: login},
+	} {
+		data, err := DefaultCodec.Encode(p.Type, p.Data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		segment = append(segment, data...)
+	}
+
+	// the data following the rejected handshake in one segment is not
+	// dispatched
+	c := dialApp(t, addr)
+	defer c.conn.Close()
+	if _, err := c.conn.Write(segment); err != nil {
+		t.Fatal(err)
+	}
+	c.read(PacketData)
+	time.Sleep(50 * time.Millisecond)
+	if _, err := app.agents.Member(42); err != ErrMemberNotFound {
+		t.Fatal("the data of rejected handshake should not be dispatched")
+	}
+
+	// the UID bound by handler is checked
+	c2 := dialApp(t, addr)
+	defer c2.conn.Close()
+	c2.write(PacketHandshake, []byte(`{"deviceId":"device-2","sys":{"protocol":1}}`))
+	c2.read(PacketHandshake)
+	c2.write(PacketHandshakeAck, nil)
+	c2.write(PacketData, login)
+	m, err := message.Decode(c2.read(PacketData).Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &KickReason{}
+	if err := encjson.Unmarshal(m.Data, r); err != nil || r.Reason != "cheating" {
+		t.Fatalf("unexpected kick reason %+v, error %v", r, err)
+	}
+}
+
+func TestHandshakeAck_BeforeHandshake(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	a := newAgent(defaultApp, c1)
+	defer a.Close()
+
+	if err := defaultApp.handler.processPacket(a, &packet.Packet{Type: packet.HandshakeAck}); err == nil {
+		t.Fatal("handshake ACK before handshake should fail")
+	}
+	if a.status() == statusWorking {
+		t.Fatal("agent should not be working")
+	}
+}
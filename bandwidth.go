@@ -0,0 +1,154 @@
+package nano
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/kensomanpow/nano/session"
+)
+
+// QuotaPolicy represents the action when a session exceeds bandwidth quota
+type QuotaPolicy byte
+
+const (
+	// QuotaThrottle drops the inbound messages until the bandwidth of
+	// session falls back under quota
+	QuotaThrottle QuotaPolicy = iota
+
+	// QuotaKick kicks the session
+	QuotaKick
+)
+
+func (p QuotaPolicy) String() string {
+	switch p {
+	case QuotaThrottle:
+		return "throttle"
+	case QuotaKick:
+		return "kick"
+	default:
+		return fmt.Sprintf("QuotaPolicy(%d)", p)
+	}
+}
+
+const (
+	// bandwidthBuckets is the number of buckets of a sliding window
+	bandwidthBuckets = 10
+
+	// minBandwidthWindow is the min sliding window, so that each bucket is
+	// one millisecond at least
+	minBandwidthWindow = bandwidthBuckets * time.Millisecond
+)
+
+type (
+	// BandwidthQuota limits the inbound bytes of each session in a sliding
+	// window, eg: to contain the clients stuck in request loops. The outbound
+	// bytes are not counted, so that the broadcasts never exceed the quota of
+	// clients. The throttled requests are responded with ErrRateLimited
+	BandwidthQuota struct {
+		Bytes    int64         // max bytes in window
+		Window   time.Duration // sliding window
+		Policy   QuotaPolicy
+		OnExceed func(s *session.Session, bytes int64) // called when the session exceeds quota, optional
+	}
+
+	// slidingWindow counts bytes in a sliding window, which is divided into
+	// fixed buckets
+	slidingWindow struct {
+		mu       sync.Mutex
+		interval int64 // bucket interval in nanoseconds
+		buckets  [bandwidthBuckets]int64
+		current  int64 // index of current bucket since epoch
+		sum      int64 // bytes of all buckets
+		exceeded bool  // whether quota exceeded
+	}
+)
+
+// SetBandwidthQuota set the bandwidth quota of sessions, nil disables it. It
+// should be called before application running
+func SetBandwidthQuota(q *BandwidthQuota) {
+	defaultApp.SetBandwidthQuota(q)
+}
+
+// SetBandwidthQuota set the bandwidth quota of the sessions of the
+// application
+func (app *App) SetBandwidthQuota(q *BandwidthQuota) {
+	if q != nil && (q.Bytes < 1 || q.Window < minBandwidthWindow) {
+		panic("nano: invalid bandwidth quota")
+	}
+	app.env.bandwidthQuota = q
+}
+
+// SessionBandwidth returns the bytes of session in the sliding window of
+// bandwidth quota, zero if quota not set or the session has closed
+func SessionBandwidth(s *session.Session) int64 {
+	v, ok := agents.Load(s.ID())
+	if !ok || v.(*agent).bandwidth == nil {
+		return 0
+	}
+	a := v.(*agent)
+	return a.bandwidth.add(a.app.clock.Now(), 0)
+}
+
+func newSlidingWindow(window time.Duration) *slidingWindow {
+	return &slidingWindow{interval: int64(window) / bandwidthBuckets}
+}
+
+// add adds n bytes at now, returns the bytes in window
+func (w *slidingWindow) add(now time.Time, n int64) int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	index := now.UnixNano() / w.interval
+	if elapsed := index - w.current; elapsed > 0 {
+		if elapsed > bandwidthBuckets {
+			elapsed = bandwidthBuckets
+		}
+		for i := int64(1); i <= elapsed; i++ {
+			b := (w.current + i) % bandwidthBuckets
+			w.sum -= w.buckets[b]
+			w.buckets[b] = 0
+		}
+		w.current = index
+	}
+
+	w.buckets[w.current%bandwidthBuckets] += n
+	w.sum += n
+	return w.sum
+}
+
+// exceed updates the quota state with the bytes in window, returns whether
+// the quota exceeded and whether it is the first time since last recovery
+func (w *slidingWindow) exceed(bytes, quota int64) (exceeded, first bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	exceeded = bytes > quota
+	first = exceeded && !w.exceeded
+	w.exceeded = exceeded
+	return
+}
+
+// countBandwidth counts n inbound bytes of agent, and reports whether the
+// session exceeds quota
+func (a *agent) countBandwidth(n int) bool {
+	q := a.app.env.bandwidthQuota
+	if q == nil || a.bandwidth == nil {
+		return false
+	}
+
+	bytes := a.bandwidth.add(a.app.clock.Now(), int64(n))
+	exceeded, first := a.bandwidth.exceed(bytes, q.Bytes)
+	if first {
+		logSession(a.session).Warn("nano/bandwidth: quota exceeded", "bytes", bytes, "quota", q.Bytes)
+		if q.OnExceed != nil {
+			q.OnExceed(a.session, bytes)
+		}
+	}
+	return exceeded
+}
+
+// overQuota reports whether the session exceeds quota
+func (a *agent) overQuota() bool {
+	return a.countBandwidth(0)
+}
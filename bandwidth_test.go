@@ -0,0 +1,84 @@
+package nano
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/kensomanpow/nano/internal/message"
+	"github.com/kensomanpow/nano/internal/packet"
+)
+
+func TestSlidingWindow(t *testing.T) {
+	w := newSlidingWindow(10 * time.Second)
+	now := time.Unix(1000, 0)
+
+	if n := w.add(now, 100); n != 100 {
+		t.Fatalf("expect 100, got %d", n)
+	}
+	if n := w.add(now.Add(5*time.Second), 50); n != 150 {
+		t.Fatalf("expect 150, got %d", n)
+	}
+	// first bucket slides out of window
+	if n := w.add(now.Add(10*time.Second), 0); n != 50 {
+		t.Fatalf("expect 50, got %d", n)
+	}
+	if n := w.add(now.Add(time.Minute), 0); n != 0 {
+		t.Fatalf("expect 0, got %d", n)
+	}
+}
+
+func TestSlidingWindow_Exceed(t *testing.T) {
+	w := newSlidingWindow(time.Second)
+	if exceeded, first := w.exceed(200, 100); !exceeded || !first {
+		t.Fatalf("expect first exceeded")
+	}
+	if exceeded, first := w.exceed(300, 100); !exceeded || first {
+		t.Fatalf("expect exceeded again")
+	}
+	if exceeded, _ := w.exceed(50, 100); exceeded {
+		t.Fatalf("expect recovered")
+	}
+}
+
+func TestBandwidthQuota_Throttle(t *testing.T) {
+	app := NewApp()
+	app.SetBandwidthQuota(&BandwidthQuota{Bytes: 100, Window: time.Second})
+
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	a := newAgent(app, c1)
+	defer a.Close()
+	a.setStatus(statusWorking)
+
+	// the outbound bytes do not count toward quota
+	a.countOut(1000)
+	if a.overQuota() {
+		t.Fatal("outbound bytes should not exceed quota")
+	}
+	a.countIn(1000)
+	if !a.overQuota() {
+		t.Fatal("inbound bytes should exceed quota")
+	}
+
+	data, err := (&message.Message{Type: message.Request, ID: 7, Route: "bandwidth.test"}).Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.handler.processPacket(a, &packet.Packet{Type: packet.Data, Data: data}); err != nil {
+		t.Fatal(err)
+	}
+	m := <-a.chSend
+	if m.typ != message.Response || m.mid != 7 || string(m.payload.([]byte)) != `{"code":429,"msg":"rate limited","route":"bandwidth.test"}` {
+		t.Fatalf("unexpected response %+v", m)
+	}
+}
+
+func TestSetBandwidthQuota_Window(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("window shorter than 10ms should panic")
+		}
+	}()
+	NewApp().SetBandwidthQuota(&BandwidthQuota{Bytes: 100, Window: 5 * time.Millisecond})
+}
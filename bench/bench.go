@@ -0,0 +1,315 @@
+// Copyright (c) nano Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package bench generates the load of a nano server with simulated clients,
+// each client connects and executes the steps of a scenario, eg: login, join
+// a room, then chat at a rate, and the latency percentiles and error rates
+// of the steps are reported, so that the capacity planning does not require
+// a bespoke bot each time. The payloads of scenario are JSON, so the server
+// should use the JSON serializer.
+package bench
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kensomanpow/nano/client"
+)
+
+// Types of steps
+const (
+	StepRequest = "request" // sends a request and waits for the response
+	StepNotify  = "notify"  // sends a notify
+	StepWait    = "wait"    // sleeps for the duration
+)
+
+// connectStep is the name of the stats of connecting
+const connectStep = "connect"
+
+// idPlaceholder in the payload of steps is replaced with the client index
+var idPlaceholder = []byte("{{id}}")
+
+// defaultTimeout is the default timeout of requests
+const defaultTimeout = 5 * time.Second
+
+// maxRate is the max rate of steps, the interval of which is a nanosecond
+const maxRate = float64(time.Second)
+
+// ErrNoScenario is returned when running without scenario
+var ErrNoScenario = errors.New("bench: no scenario")
+
+type (
+	// Duration is a time.Duration decoded from JSON string, eg: "30s"
+	Duration time.Duration
+
+	// Step represents a step of scenario, the step is executed once if Rate
+	// is zero, otherwise it is repeated at Rate per second for Duration
+	Step struct {
+		Name     string          `json:"name,omitempty"` // name of stats, default is route
+		Type     string          `json:"type"`           // one of StepXxx
+		Route    string          `json:"route,omitempty"`
+		Data     json.RawMessage `json:"data,omitempty"` // payload, {{id}} is replaced with the client index
+		Rate     float64         `json:"rate,omitempty"`
+		Duration Duration        `json:"duration,omitempty"`
+	}
+
+	// Scenario represents the steps executed by each client in order
+	Scenario struct {
+		Name  string `json:"name"`
+		Steps []Step `json:"steps"`
+	}
+
+	// Config represents the options of load test
+	Config struct {
+		Clients  int           // number of simulated clients
+		RampUp   time.Duration // the clients are connected evenly in the duration
+		Duration time.Duration // the scenario is repeated until the duration elapsed, zero runs once
+		Timeout  time.Duration // timeout of requests, default 5 seconds
+		Scenario *Scenario
+
+		// Dial connects the client of index id, eg: client.Dial with the
+		// token of the test account
+		Dial func(id int) (*client.Client, error)
+	}
+
+	// StepStats represents the stats of a step
+	StepStats struct {
+		Name      string        `json:"name"`
+		Count     int           `json:"count"`
+		Errors    int           `json:"errors"`
+		ErrorRate float64       `json:"errorRate"`
+		Mean      time.Duration `json:"mean"`
+		P50       time.Duration `json:"p50"`
+		P90       time.Duration `json:"p90"`
+		P99       time.Duration `json:"p99"`
+		Max       time.Duration `json:"max"`
+	}
+
+	// Report represents the result of load test, the stats of connecting
+	// are named `connect`
+	Report struct {
+		Scenario string        `json:"scenario"`
+		Clients  int           `json:"clients"`
+		Elapsed  time.Duration `json:"elapsed"`
+		Steps    []*StepStats  `json:"steps"`
+	}
+)
+
+// UnmarshalJSON decodes the duration from string, eg: "500ms"
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// MarshalJSON encodes the duration as string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// LoadScenario decodes the JSON encoded scenario
+func LoadScenario(r io.Reader) (*Scenario, error) {
+	s := &Scenario{}
+	if err := json.NewDecoder(r).Decode(s); err != nil {
+		return nil, err
+	}
+	for i, step := range s.Steps {
+		switch step.Type {
+		case StepRequest, StepNotify:
+			if step.Route == "" {
+				return nil, fmt.Errorf("bench: route of step %d is required", i)
+			}
+		case StepWait:
+		default:
+			return nil, fmt.Errorf("bench: unknown type %s of step %d", step.Type, i)
+		}
+		if step.Rate < 0 || step.Duration < 0 {
+			return nil, fmt.Errorf("bench: rate and duration of step %d can not be negative", i)
+		}
+		if step.Rate > maxRate {
+			return nil, fmt.Errorf("bench: rate of step %d can not exceed %.0f per second", i, maxRate)
+		}
+	}
+	return s, nil
+}
+
+// Run runs the load test until all clients finished the scenario or ctx
+// done, and returns the report
+func Run(ctx context.Context, c Config) (*Report, error) {
+	if c.Scenario == nil {
+		return nil, ErrNoScenario
+	}
+	if c.Clients < 1 || c.Dial == nil {
+		return nil, errors.New("bench: clients and dial are required")
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = defaultTimeout
+	}
+
+	rec := newRecorder()
+	start := time.Now()
+	var wg sync.WaitGroup
+	for id := 0; id < c.Clients; id++ {
+		delay := c.RampUp * time.Duration(id) / time.Duration(c.Clients)
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			if !sleep(ctx, delay) {
+				return
+			}
+			run(ctx, id, c, rec)
+		}(id)
+	}
+	wg.Wait()
+
+	return &Report{
+		Scenario: c.Scenario.Name,
+		Clients:  c.Clients,
+		Elapsed:  time.Since(start),
+		Steps:    rec.stats(),
+	}, nil
+}
+
+// run executes the scenario by the client of index id
+func run(ctx context.Context, id int, c Config, rec *recorder) {
+	start := time.Now()
+	cli, err := c.Dial(id)
+	rec.add(connectStep, time.Since(start), err)
+	if err != nil {
+		return
+	}
+	defer cli.Close()
+
+	deadline := start.Add(c.Duration)
+	for {
+		for _, step := range c.Scenario.Steps {
+			if !execute(ctx, cli, id, step, c.Timeout, rec) {
+				return
+			}
+		}
+		if c.Duration <= 0 || time.Now().After(deadline) {
+			return
+		}
+	}
+}
+
+// execute executes the step, and reports whether the scenario should go on
+func execute(ctx context.Context, cli *client.Client, id int, step Step, timeout time.Duration, rec *recorder) bool {
+	if step.Type == StepWait {
+		return sleep(ctx, time.Duration(step.Duration))
+	}
+
+	name := step.Name
+	if name == "" {
+		name = step.Route
+	}
+	data := bytes.Replace(step.Data, idPlaceholder, []byte(strconv.Itoa(id)), -1)
+	send := func() {
+		start := time.Now()
+		var err error
+		if step.Type == StepRequest {
+			// the errors responded by server are returned as *nano.Error
+			rctx, cancel := context.WithTimeout(ctx, timeout)
+			err = cli.RequestContext(rctx, step.Route, data, nil)
+			cancel()
+		} else {
+			err = cli.Notify(step.Route, data)
+		}
+		if ctx.Err() == nil {
+			rec.add(name, time.Since(start), err)
+		}
+	}
+
+	if step.Rate <= 0 {
+		send()
+		return alive(ctx, cli)
+	}
+
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / step.Rate))
+	defer ticker.Stop()
+	end := time.After(time.Duration(step.Duration))
+	for {
+		send()
+		if !alive(ctx, cli) {
+			return false
+		}
+		select {
+		case <-ticker.C:
+		case <-end:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// alive reports whether the client is connected and ctx not done
+func alive(ctx context.Context, cli *client.Client) bool {
+	select {
+	case <-cli.Done():
+		return false
+	case <-ctx.Done():
+		return false
+	default:
+		return true
+	}
+}
+
+// sleep sleeps for d, and reports whether ctx not done
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// String formats the report as a table
+func (r *Report) String() string {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "scenario %s, %d clients, elapsed %v\n", r.Scenario, r.Clients, r.Elapsed.Round(time.Millisecond))
+	fmt.Fprintf(buf, "%-24s %8s %8s %8s %10s %10s %10s %10s %10s\n", "STEP", "COUNT", "ERRORS", "ERR%", "MEAN", "P50", "P90", "P99", "MAX")
+	for _, s := range r.Steps {
+		fmt.Fprintf(buf, "%-24s %8d %8d %8.2f %10v %10v %10v %10v %10v\n", s.Name, s.Count, s.Errors, s.ErrorRate*100,
+			s.Mean.Round(time.Microsecond), s.P50.Round(time.Microsecond), s.P90.Round(time.Microsecond),
+			s.P99.Round(time.Microsecond), s.Max.Round(time.Microsecond))
+	}
+	return buf.String()
+}
@@ -0,0 +1,119 @@
+package bench
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kensomanpow/nano"
+	"github.com/kensomanpow/nano/client"
+	"github.com/kensomanpow/nano/component"
+	"github.com/kensomanpow/nano/nanotest"
+	"github.com/kensomanpow/nano/serialize/json"
+	"github.com/kensomanpow/nano/session"
+)
+
+type (
+	Room struct {
+		component.Base
+	}
+
+	LoginRequest struct {
+		Name string `json:"name"`
+	}
+)
+
+func (r *Room) Login(s *session.Session, req *LoginRequest, respond func(interface{}) error) error {
+	if !strings.HasPrefix(req.Name, "bot") {
+		return respond(&nano.Error{Code: nano.CodeUnauthorized, Message: "invalid name"})
+	}
+	return respond(req)
+}
+
+func (r *Room) Message(s *session.Session, _ []byte) error {
+	return nil
+}
+
+const scenario = `{
+	"name": "chat",
+	"steps": [
+		{"type": "request", "route": "Room.Login", "data": {"name": "bot{{id}}"}},
+		{"name": "bad-login", "type": "request", "route": "Room.Login", "data": {"name": "player"}},
+		{"type": "notify", "route": "Room.Message", "data": {"content": "hi"}, "rate": 100, "duration": "50ms"},
+		{"type": "wait", "duration": "10ms"}
+	]
+}`
+
+func TestRun(t *testing.T) {
+	app := nano.NewApp()
+	app.Register(&Room{})
+	srv := nanotest.NewServer(app, nano.WithSerializer(json.NewSerializer()))
+	defer srv.Close()
+
+	s, err := LoadScenario(strings.NewReader(scenario))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := Run(context.Background(), Config{
+		Clients:  4,
+		RampUp:   20 * time.Millisecond,
+		Scenario: s,
+		Dial: func(id int) (*client.Client, error) {
+			return client.Connect(srv.Dial, client.Config{})
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats := map[string]*StepStats{}
+	for _, st := range report.Steps {
+		stats[st.Name] = st
+	}
+	if st := stats["connect"]; st == nil || st.Count != 4 || st.Errors != 0 {
+		t.Fatalf("unexpected connect stats %+v", st)
+	}
+	if st := stats["Room.Login"]; st == nil || st.Count != 4 || st.Errors != 0 || st.P99 <= 0 || st.Max < st.P50 {
+		t.Fatalf("unexpected login stats %+v", st)
+	}
+	if st := stats["bad-login"]; st == nil || st.Count != 4 || st.ErrorRate != 1 {
+		t.Fatalf("unexpected bad login stats %+v", st)
+	}
+	if st := stats["Room.Message"]; st == nil || st.Count < 8 || st.Errors != 0 {
+		t.Fatalf("unexpected message stats %+v", st)
+	}
+	if !strings.Contains(report.String(), "Room.Message") {
+		t.Fatalf("unexpected report %s", report)
+	}
+}
+
+func TestLoadScenario(t *testing.T) {
+	for _, s := range []string{
+		`{"steps": [{"type": "request"}]}`,
+		`{"steps": [{"type": "push", "route": "Room.Login"}]}`,
+		`{"steps": [{"type": "wait", "duration": "forever"}]}`,
+		`{"steps": [{"type": "notify", "route": "Room.Message", "rate": -1}]}`,
+		`{"steps": [{"type": "notify", "route": "Room.Message", "rate": 2e9}]}`,
+	} {
+		if _, err := LoadScenario(strings.NewReader(s)); err == nil {
+			t.Fatalf("scenario %s should be invalid", s)
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var sorted []time.Duration
+	for i := 1; i <= 100; i++ {
+		sorted = append(sorted, time.Duration(i))
+	}
+	if p := percentile(sorted, 0.5); p != 50 {
+		t.Fatalf("expect p50 50, got %v", p)
+	}
+	if p := percentile(sorted, 0.99); p != 99 {
+		t.Fatalf("expect p99 99, got %v", p)
+	}
+	if p := percentile(nil, 0.99); p != 0 {
+		t.Fatalf("expect 0, got %v", p)
+	}
+}
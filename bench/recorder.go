@@ -0,0 +1,87 @@
+package bench
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+type (
+	// recorder records the latencies and errors of steps
+	recorder struct {
+		mu    sync.Mutex
+		names []string // in order of first recorded
+		steps map[string]*samples
+	}
+
+	samples struct {
+		latencies []time.Duration // latencies of succeeded steps
+		errors    int
+	}
+)
+
+func newRecorder() *recorder {
+	return &recorder{steps: map[string]*samples{}}
+}
+
+func (r *recorder) add(name string, d time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.steps[name]
+	if !ok {
+		s = &samples{}
+		r.steps[name] = s
+		r.names = append(r.names, name)
+	}
+	if err != nil {
+		s.errors++
+		return
+	}
+	s.latencies = append(s.latencies, d)
+}
+
+// stats returns the stats of steps in order of first recorded
+func (r *recorder) stats() []*StepStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats := make([]*StepStats, 0, len(r.names))
+	for _, name := range r.names {
+		s := r.steps[name]
+		latencies := append([]time.Duration(nil), s.latencies...)
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+		st := &StepStats{
+			Name:   name,
+			Count:  len(latencies) + s.errors,
+			Errors: s.errors,
+			P50:    percentile(latencies, 0.5),
+			P90:    percentile(latencies, 0.9),
+			P99:    percentile(latencies, 0.99),
+		}
+		st.ErrorRate = float64(st.Errors) / float64(st.Count)
+		if n := len(latencies); n > 0 {
+			var sum time.Duration
+			for _, d := range latencies {
+				sum += d
+			}
+			st.Mean, st.Max = sum/time.Duration(n), latencies[n-1]
+		}
+		stats = append(stats, st)
+	}
+	return stats
+}
+
+// percentile returns the p percentile of the sorted latencies by nearest rank
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) < 1 {
+		return 0
+	}
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
@@ -0,0 +1,99 @@
+package nano
+
+import "sync"
+
+const (
+	// the read buffer grows when the reads fill the buffer for growReads
+	// times in a row, and shrinks when the reads use less than a quarter of
+	// the buffer for shrinkReads times in a row
+	growReads   = 2
+	shrinkReads = 64
+)
+
+var (
+	// size classes of read buffers
+	readBufferSizes = []int{512, 2048, 8192, 32768}
+
+	// read buffer pools, one pool per size class
+	readBufferPools = func() []*sync.Pool {
+		pools := make([]*sync.Pool, len(readBufferSizes))
+		for i := range pools {
+			size := readBufferSizes[i]
+			pools[i] = &sync.Pool{New: func() interface{} { return make([]byte, size) }}
+		}
+		return pools
+	}()
+)
+
+// readBuffer is a pooled read buffer of a connection, which size adapts to
+// the traffic of the connection, it grows for the bulky sessions and shrinks
+// for the chatty but small ones. It is used by read goroutine only.
+type readBuffer struct {
+	fixed bool   // fixed size, not pooled nor adaptive
+	class int    // size class
+	buf   []byte // buffer of current size class
+	full  int    // count of consecutive reads that filled the buffer
+	small int    // count of consecutive reads that used less than a quarter
+}
+
+// newReadBuffer returns a read buffer of fixed size, or an adaptive one starts
+// from 2KB if size is zero
+func newReadBuffer(size int) *readBuffer {
+	if size > 0 {
+		return &readBuffer{fixed: true, buf: make([]byte, size)}
+	}
+
+	b := &readBuffer{class: 1}
+	b.buf = readBufferPools[b.class].Get().([]byte)
+	return b
+}
+
+// bytes returns the buffer for next read
+func (b *readBuffer) bytes() []byte {
+	return b.buf
+}
+
+// adapt adapts the buffer size according to n bytes read, the buffer may be
+// replaced, so the bytes read must not be used after adapt
+func (b *readBuffer) adapt(n int) {
+	if b.fixed {
+		return
+	}
+
+	switch {
+	case n >= len(b.buf):
+		b.full++
+		b.small = 0
+		if b.full >= growReads && b.class < len(readBufferSizes)-1 {
+			b.resize(b.class + 1)
+		}
+
+	case n < len(b.buf)/4:
+		b.small++
+		b.full = 0
+		if b.small >= shrinkReads && b.class > 0 {
+			b.resize(b.class - 1)
+		}
+
+	default:
+		b.full, b.small = 0, 0
+	}
+}
+
+func (b *readBuffer) resize(class int) {
+	readBufferPools[b.class].Put(b.buf)
+	b.class = class
+	b.buf = readBufferPools[class].Get().([]byte)
+	b.full, b.small = 0, 0
+}
+
+// release returns the buffer to pool, the buffer must not be used after
+// released
+func (b *readBuffer) release() {
+	if b.fixed {
+		b.buf = nil
+		return
+	}
+	readBufferPools[b.class].Put(b.buf)
+	b.buf = nil
+}
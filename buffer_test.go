@@ -0,0 +1,50 @@
+package nano
+
+import "testing"
+
+func TestReadBuffer_Adapt(t *testing.T) {
+	b := newReadBuffer(0)
+	defer b.release()
+
+	if len(b.bytes()) != 2048 {
+		t.Fatalf("expect 2048, got %d", len(b.bytes()))
+	}
+
+	// bulky session
+	for i := 0; i < growReads; i++ {
+		b.adapt(len(b.bytes()))
+	}
+	if len(b.bytes()) != 8192 {
+		t.Fatalf("buffer should grow, got %d", len(b.bytes()))
+	}
+
+	// chatty but small session
+	for i := 0; i < shrinkReads; i++ {
+		b.adapt(16)
+	}
+	if len(b.bytes()) != 2048 {
+		t.Fatalf("buffer should shrink, got %d", len(b.bytes()))
+	}
+
+	// interrupted by a medium read
+	for i := 0; i < shrinkReads-1; i++ {
+		b.adapt(16)
+	}
+	b.adapt(1024)
+	b.adapt(16)
+	if len(b.bytes()) != 2048 {
+		t.Fatalf("buffer should not shrink, got %d", len(b.bytes()))
+	}
+}
+
+func TestReadBuffer_Fixed(t *testing.T) {
+	b := newReadBuffer(65536)
+	defer b.release()
+
+	for i := 0; i < shrinkReads; i++ {
+		b.adapt(16)
+	}
+	if len(b.bytes()) != 65536 {
+		t.Fatalf("fixed buffer should not adapt, got %d", len(b.bytes()))
+	}
+}
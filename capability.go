@@ -0,0 +1,91 @@
+package nano
+
+import (
+	"strings"
+
+	"github.com/kensomanpow/nano/session"
+)
+
+// Capability represents the optional features a client supports, the client
+// declares its capabilities in `sys.capabilities` of handshake request, and
+// the capabilities both client and server support are responded in
+// `sys.capabilities` of handshake response and stored on the session, so
+// that the server could adapt the behavior per client version, eg:
+//
+//	if nano.Capabilities(s).Has(nano.CapBatch) { ... }
+type Capability uint32
+
+// Capabilities could be negotiated in handshake
+const (
+	// CapCompress indicates the message body compression, which is supported
+	// by server if the compress threshold set
+	CapCompress Capability = 1 << iota
+	// CapEncrypt indicates the message body encryption
+	CapEncrypt
+	// CapBatch indicates the batch messages
+	CapBatch
+	// CapReconnect indicates the reconnection with session resume
+	CapReconnect
+)
+
+// CapabilitiesKey is the session key of negotiated capabilities
+const CapabilitiesKey = "nano.capabilities"
+
+var capabilityNames = []string{"compress", "encrypt", "batch", "reconnect"}
+
+// Has reports whether all capabilities of c are contained
+func (caps Capability) Has(c Capability) bool {
+	return caps&c == c
+}
+
+func (caps Capability) String() string {
+	var names []string
+	for i, name := range capabilityNames {
+		if caps.Has(1 << uint(i)) {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+// Capabilities returns the capabilities negotiated in handshake of session,
+// it is zero if the session has not handshake yet
+func Capabilities(s *session.Session) Capability {
+	caps, _ := s.Value(CapabilitiesKey).(Capability)
+	return caps
+}
+
+// SetCapabilities set the capabilities supported by server besides the
+// compression, which is determined by compress threshold
+func SetCapabilities(caps Capability) {
+	defaultApp.SetCapabilities(caps)
+}
+
+// SetCapabilities set the capabilities supported by the application
+func (app *App) SetCapabilities(caps Capability) {
+	app.env.capabilities = caps
+}
+
+// WithCapabilities set the capabilities supported by server, see
+// SetCapabilities
+func WithCapabilities(caps Capability) Option {
+	return withSetting(func(app *App) error {
+		app.SetCapabilities(caps)
+		return nil
+	})
+}
+
+// negotiateCapabilities returns the capabilities both client and server
+// support, the legacy compress flag of client is also respected
+func (app *App) negotiateCapabilities(data *HandShakeData) Capability {
+	client := data.Sys.Capabilities
+	if data.Sys.Compress {
+		client |= CapCompress
+	}
+
+	server := app.env.capabilities &^ CapCompress
+	if app.env.compressThreshold > 0 {
+		server |= CapCompress
+	}
+	return client & server
+}
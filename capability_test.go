@@ -0,0 +1,40 @@
+package nano
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestNegotiateCapabilities(t *testing.T) {
+	app := NewApp()
+	app.SetCapabilities(CapBatch | CapReconnect | CapCompress)
+
+	data := &HandShakeData{}
+	data.Sys.Capabilities = CapBatch | CapEncrypt
+	data.Sys.Compress = true
+	if caps := app.negotiateCapabilities(data); caps != CapBatch {
+		t.Fatalf("unexpected capabilities %s", caps)
+	}
+
+	app.SetCompression(128)
+	if caps := app.negotiateCapabilities(data); caps != CapBatch|CapCompress {
+		t.Fatalf("unexpected capabilities %s", caps)
+	}
+	if s := (CapCompress | CapReconnect).String(); s != "compress|reconnect" {
+		t.Fatalf("unexpected string %s", s)
+	}
+}
+
+func TestHandshakeResponse_Capabilities(t *testing.T) {
+	data, err := defaultApp.handshakeResponse(ProtocolVersion, CapBatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := &HandshakeResponse{}
+	if err := json.Unmarshal(data, resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Sys.Capabilities != CapBatch {
+		t.Fatalf("unexpected capabilities %s", resp.Sys.Capabilities)
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright (c) nano Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package nano
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kensomanpow/nano/internal/packet"
+	"github.com/kensomanpow/nano/session"
+)
+
+type (
+	// CaptureRecord represents an inbound packet captured by Recorder
+	CaptureRecord struct {
+		Time       time.Time  `json:"time"`
+		SessionID  int64      `json:"sessionId"`
+		UID        int64      `json:"uid"`
+		RemoteAddr string     `json:"remoteAddr,omitempty"`
+		Type       PacketType `json:"type"`
+		Route      string     `json:"route,omitempty"` // route of data packet
+		Data       []byte     `json:"data"`
+	}
+
+	// CaptureFilter selects the packets to capture, route is empty for the
+	// packets except data packets
+	CaptureFilter func(s *session.Session, route string) bool
+
+	// Recorder captures the inbound packets of the selected sessions and
+	// routes as JSON lines, eg: to reproduce desync bugs by Replay
+	Recorder struct {
+		mu     sync.Mutex
+		enc    *json.Encoder
+		filter CaptureFilter
+	}
+)
+
+// capturing recorder, nil if capture stopped
+var recorder = &struct {
+	sync.RWMutex
+	r *Recorder
+}{}
+
+// NewRecorder returns a recorder writes to w, all packets are captured if
+// filter is nil
+func NewRecorder(w io.Writer, filter CaptureFilter) *Recorder {
+	return &Recorder{enc: json.NewEncoder(w), filter: filter}
+}
+
+// StartCapture starts capturing inbound packets with r
+func StartCapture(r *Recorder) {
+	recorder.Lock()
+	defer recorder.Unlock()
+
+	recorder.r = r
+}
+
+// StopCapture stops capturing inbound packets
+func StopCapture() {
+	StartCapture(nil)
+}
+
+func (r *Recorder) record(a *agent, p *packet.Packet) {
+	var route string
+	if p.Type == packet.Data && len(a.fragments) == 0 && atomic.LoadInt32(&a.checksum) == 0 {
+		if m, err := a.app.routes.Decode(p.Data); err == nil {
+			route = m.Route
+		}
+	}
+	if r.filter != nil && !r.filter(a.session, route) {
+		return
+	}
+
+	rec := &CaptureRecord{
+		Time:      time.Now(),
+		SessionID: a.session.ID(),
+		UID:       a.session.UID(),
+		Type:      p.Type,
+		Route:     route,
+		Data:      p.Data,
+	}
+	if p.Type == packet.Handshake {
+		rec.Data = redactHandshake(a.app, p.Data)
+	}
+	if a.conn != nil {
+		rec.RemoteAddr = a.conn.RemoteAddr().String()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.enc.Encode(rec); err != nil {
+		logSession(a.session).Warn("nano/capture: record packet error", "error", err)
+	}
+}
+
+// redactHandshake returns the handshake data without the token, which is a
+// credential and must not be written to disk, nil if the data is malformed
+func redactHandshake(app *App, data []byte) []byte {
+	var hs *HandShakeData
+	if err := app.unmarshalSystem(data, &hs); err != nil || hs == nil {
+		return nil
+	}
+	hs.Token = ""
+	redacted, err := app.marshalSystem(hs)
+	if err != nil {
+		return nil
+	}
+	return redacted
+}
+
+// capturePacket captures the inbound packet if capture started
+func capturePacket(a *agent, p *packet.Packet) {
+	recorder.RLock()
+	r := recorder.r
+	recorder.RUnlock()
+
+	if r != nil {
+		r.record(a, p)
+	}
+}
+
+// Replay feeds the packets captured by Recorder back through the packet
+// processing of current application, eg: a test server with the same
+// handlers. A session is created for each captured session, the sessions
+// captured without handshake are treated as handshake acknowledged. The
+// packets are replayed with the captured intervals if realtime is true.
+// The responses and pushes are discarded, and the replayed sessions are not
+// members of the sessions of application, so they do not receive broadcasts.
+// The captured handshakes carry no token
+func Replay(r io.Reader, realtime bool) error {
+	dec := json.NewDecoder(r)
+	group := defaultApp.NewGroup("replay")
+	replayed := map[int64]*agent{}
+	defer func() {
+		for _, a := range replayed {
+			a.Close()
+		}
+		group.Close()
+	}()
+
+	var last time.Time
+	for {
+		rec := &CaptureRecord{}
+		if err := dec.Decode(rec); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if realtime && !last.IsZero() && rec.Time.After(last) {
+			time.Sleep(rec.Time.Sub(last))
+		}
+		last = rec.Time
+
+		a, ok := replayed[rec.SessionID]
+		if !ok {
+			a = replayAgent(rec, group)
+			replayed[rec.SessionID] = a
+		}
+
+		p := &packet.Packet{Type: rec.Type, Length: len(rec.Data), Data: rec.Data}
+		if err := defaultApp.handler.processPacket(a, p); err != nil {
+			logSession(a.session).Warn("nano/capture: replay packet error", "error", err)
+		}
+	}
+}
+
+// replayAgent creates the agent of a captured session
+func replayAgent(rec *CaptureRecord, group *Group) *agent {
+	c1, c2 := net.Pipe()
+	go io.Copy(ioutil.Discard, c2)
+
+	a := newAgentInGroup(defaultApp, c1, group, DefaultCodec)
+	go a.write()
+	if rec.Type != packet.Handshake {
+		a.setStatus(statusWorking)
+	}
+	if rec.UID > 0 {
+		a.session.Bind(rec.UID)
+	}
+	return a
+}
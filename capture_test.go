@@ -0,0 +1,82 @@
+package nano
+
+import (
+	"bytes"
+	encjson "encoding/json"
+	"testing"
+
+	"github.com/kensomanpow/nano/internal/message"
+	"github.com/kensomanpow/nano/internal/packet"
+	"github.com/kensomanpow/nano/serialize"
+	"github.com/kensomanpow/nano/serialize/json"
+	"github.com/kensomanpow/nano/session"
+)
+
+func TestCapture(t *testing.T) {
+	buf := &bytes.Buffer{}
+	StartCapture(NewRecorder(buf, func(s *session.Session, route string) bool {
+		return route == "capture.selected"
+	}))
+	defer StopCapture()
+
+	a := newAgent(defaultApp, nil)
+	for _, route := range []string{"capture.selected", "capture.ignored"} {
+		data, err := (&message.Message{Type: message.Notify, Route: route, Data: []byte("hi")}).Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		capturePacket(a, &packet.Packet{Type: packet.Data, Data: data})
+	}
+
+	rec := &CaptureRecord{}
+	if err := encjson.NewDecoder(buf).Decode(rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Route != "capture.selected" || rec.SessionID != a.session.ID() || rec.Type != PacketData {
+		t.Fatalf("unexpected record %+v", rec)
+	}
+	if buf.Len() > 0 {
+		t.Fatalf("unexpected records %s", buf.String())
+	}
+
+	// replay the heartbeat captured without handshake
+	rec.Type, rec.Data = PacketHeartbeat, nil
+	buf.Reset()
+	encjson.NewEncoder(buf).Encode(rec)
+	if err := Replay(buf, false); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCapture_Handshake(t *testing.T) {
+	buf := &bytes.Buffer{}
+	StartCapture(NewRecorder(buf, nil))
+	defer StopCapture()
+
+	defer func(s serialize.Serializer) { defaultApp.sysSerializer = s }(defaultApp.sysSerializer)
+	defaultApp.sysSerializer = json.NewSerializer()
+
+	a := newAgent(defaultApp, nil)
+	defer agents.Delete(a.session.ID())
+	capturePacket(a, &packet.Packet{Type: packet.Handshake, Data: []byte(`{"token":"secret","gameId":7,"sys":{"protocol":1}}`)})
+
+	rec := &CaptureRecord{}
+	if err := encjson.NewDecoder(buf).Decode(rec); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(rec.Data, []byte("secret")) || !bytes.Contains(rec.Data, []byte(`"GameID":7`)) {
+		t.Fatalf("the token should be redacted, got %s", rec.Data)
+	}
+
+	// the replayed sessions do not receive the broadcasts of application
+	group := defaultApp.NewGroup("replay")
+	rec.UID = 404405
+	ra := replayAgent(rec, group)
+	defer ra.Close()
+	if _, err := defaultApp.agents.Member(rec.UID); err != ErrMemberNotFound {
+		t.Fatalf("replayed session should not be a member of application, got %v", err)
+	}
+	if _, err := group.Member(rec.UID); err != nil {
+		t.Fatal(err)
+	}
+}
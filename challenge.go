@@ -0,0 +1,74 @@
+package nano
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// SetHandshakeChallenge enables the challenge round of handshake with the
+// shared secret, nil disables it. The handshake response carries a random
+// `sys.challenge`, and the client must answer it in the handshake ACK packet
+// with the hex encoded HMAC-SHA256 of the challenge, see AnswerChallenge. The
+// connections answered wrong are kicked before reaching the handlers, so
+// that the trivially scripted clients are rejected. It should be called
+// before application running
+func SetHandshakeChallenge(secret []byte) {
+	defaultApp.SetHandshakeChallenge(secret)
+}
+
+// SetHandshakeChallenge set the shared secret of handshake challenge of the
+// application
+func (app *App) SetHandshakeChallenge(secret []byte) {
+	app.env.challengeSecret = secret
+}
+
+// WithHandshakeChallenge enables the challenge round of handshake, see
+// SetHandshakeChallenge
+func WithHandshakeChallenge(secret []byte) Option {
+	return withSetting(func(app *App) error {
+		if secret != nil && len(secret) < 1 {
+			return invalidOption("WithHandshakeChallenge", "secret can not be empty")
+		}
+		app.SetHandshakeChallenge(secret)
+		return nil
+	})
+}
+
+// AnswerChallenge returns the answer of handshake challenge with secret,
+// which is sent as the body of handshake ACK packet, eg: called by a Go
+// client
+func AnswerChallenge(secret []byte, challenge string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(challenge))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newChallenge() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// verifyChallenge verifies the answer of handshake challenge, the connection
+// will be kicked when the answer is wrong
+func (a *agent) verifyChallenge(answer []byte) error {
+	secret := a.app.env.challengeSecret
+	if len(secret) < 1 {
+		return nil
+	}
+	challenge := a.challenge
+	a.challenge = ""
+	if challenge != "" && hmac.Equal(answer, []byte(AnswerChallenge(secret, challenge))) {
+		return nil
+	}
+
+	auditSecurity(a, SecurityAuthFailed, "", "invalid challenge answer")
+	a.writeKickPacket()
+	return fmt.Errorf("invalid challenge answer, session will be closed immediately, remote=%s",
+		a.conn.RemoteAddr().String())
+}
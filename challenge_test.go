@@ -0,0 +1,61 @@
+package nano
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestHandshakeChallenge(t *testing.T) {
+	secret := []byte("secret")
+	app := NewApp()
+	app.SetHandshakeChallenge(secret)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ln, addr := listenLocal(t)
+	go app.Serve(ctx, ln, WithoutSignals())
+
+	handshake := func() (*testClient, string) {
+		c := dialApp(t, addr)
+		c.write(PacketHandshake, []byte(`{"sys":{"protocol":1}}`))
+		resp := &HandshakeResponse{}
+		if err := json.Unmarshal(c.read(PacketHandshake).Data, resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Sys.Challenge == "" {
+			t.Fatalf("handshake response should carry challenge")
+		}
+		return c, resp.Sys.Challenge
+	}
+
+	c, challenge := handshake()
+	defer c.conn.Close()
+	c.write(PacketHandshakeAck, []byte(AnswerChallenge(secret, challenge)))
+	working := func() int {
+		n := 0
+		agents.Range(func(_, v interface{}) bool {
+			if a := v.(*agent); a.app == app && a.status() == statusWorking {
+				n++
+			}
+			return true
+		})
+		return n
+	}
+	for deadline := time.Now().Add(time.Second); working() < 1; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("session answered right should be working")
+		}
+	}
+
+	c2, challenge := handshake()
+	defer c2.conn.Close()
+	c2.write(PacketHandshakeAck, []byte(AnswerChallenge([]byte("guess"), challenge)))
+	c2.read(PacketKick)
+	for deadline := time.Now().Add(time.Second); app.agents.Count() > 1; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("session answered wrong should be closed")
+		}
+	}
+}
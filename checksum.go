@@ -0,0 +1,48 @@
+package nano
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+// checksumSize is the length of the CRC32 checksum trailing the data of data
+// and fragment packets
+const checksumSize = 4
+
+// ErrChecksumMismatch represents a packet corrupted in transit
+var ErrChecksumMismatch = errors.New("packet checksum mismatch")
+
+// checksumCodec appends a big endian CRC32(IEEE) checksum to the data of data
+// and fragment packets, the length in packet header includes the checksum
+type checksumCodec struct {
+	Codec
+}
+
+func (c checksumCodec) Encode(typ PacketType, data []byte) ([]byte, error) {
+	if typ != PacketData && typ != PacketFragment {
+		return c.Codec.Encode(typ, data)
+	}
+	return c.Codec.Encode(typ, appendChecksum(data))
+}
+
+// appendChecksum returns a copy of data followed by the checksum of data
+func appendChecksum(data []byte) []byte {
+	buf := make([]byte, len(data)+checksumSize)
+	copy(buf, data)
+	binary.BigEndian.PutUint32(buf[len(data):], crc32.ChecksumIEEE(data))
+	return buf
+}
+
+// verifyChecksum verifies the checksum trailing data, and returns the data
+// without checksum
+func verifyChecksum(data []byte) ([]byte, error) {
+	if len(data) < checksumSize {
+		return nil, ErrChecksumMismatch
+	}
+	n := len(data) - checksumSize
+	if crc32.ChecksumIEEE(data[:n]) != binary.BigEndian.Uint32(data[n:]) {
+		return nil, ErrChecksumMismatch
+	}
+	return data[:n], nil
+}
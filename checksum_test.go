@@ -0,0 +1,60 @@
+package nano
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/kensomanpow/nano/internal/codec"
+)
+
+func TestChecksum(t *testing.T) {
+	data := []byte("hello nano")
+	sum := appendChecksum(data)
+	if len(sum) != len(data)+checksumSize {
+		t.Fatalf("unexpected length %d", len(sum))
+	}
+
+	out, err := verifyChecksum(sum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Fatalf("expect %s, got %s", data, out)
+	}
+
+	sum[0] ^= 0xFF
+	if _, err := verifyChecksum(sum); err != ErrChecksumMismatch {
+		t.Fatalf("expect ErrChecksumMismatch, got %v", err)
+	}
+	if _, err := verifyChecksum(sum[:2]); err != ErrChecksumMismatch {
+		t.Fatalf("expect ErrChecksumMismatch, got %v", err)
+	}
+}
+
+func TestChecksumCodec(t *testing.T) {
+	c := checksumCodec{DefaultCodec}
+
+	p, err := c.Encode(PacketHeartbeat, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p) != codec.HeadLength {
+		t.Fatalf("heartbeat should not carry checksum, got %v", p)
+	}
+
+	p, err = c.Encode(PacketData, []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	packets, err := c.NewDecoder().Decode(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := verifyChecksum(packets[0].Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "hello" {
+		t.Fatalf("expect hello, got %s", data)
+	}
+}
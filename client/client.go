@@ -0,0 +1,770 @@
+// Copyright (c) nano Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package client implements the nano protocol for Go clients, eg: the bots,
+// tools and integration tests. It completes the handshake, keeps the
+// heartbeat, decodes the compressed routes with the dictionary of server, and
+// provides the request, notify and push callbacks.
+//
+//	c, err := client.Dial("127.0.0.1:3250", client.Config{})
+//	if err != nil {
+//		return err
+//	}
+//	defer c.Close()
+//	c.On("onChat", func(data []byte) { ... })
+//	err = c.Request("Room.Join", &JoinRequest{Name: "alice"}, &resp)
+package client
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kensomanpow/nano"
+	"github.com/kensomanpow/nano/internal/message"
+	"github.com/kensomanpow/nano/serialize"
+	jsonserialize "github.com/kensomanpow/nano/serialize/json"
+)
+
+const (
+	// DefaultTimeout is the default duration which the client waits for the
+	// handshake and responses
+	DefaultTimeout = 5 * time.Second
+
+	// DefaultMaxMessageSize is the default max length of decompressed
+	// messages, which is same with the default of server
+	DefaultMaxMessageSize = 1024 * 1024
+
+	// kickRoute is the route of the push which Session.Kick sends as the
+	// kick reason, the reason is followed by a kick packet
+	kickRoute = "error"
+
+	// pushBacklog is the number of pushes waiting for the callbacks, the
+	// pushes exceed it are dropped
+	pushBacklog = 256
+
+	// heartbeatMisses is the number of heartbeat intervals without any packet
+	// received before the connection considered dead
+	heartbeatMisses = 3
+
+	// timestampSize is the size of heartbeat timestamp, see nano.HeartbeatMode
+	timestampSize = 8
+)
+
+// Errors returned by client
+var (
+	ErrTimeout         = errors.New("client: timeout")
+	ErrClosed          = errors.New("client: connection closed")
+	ErrKicked          = errors.New("client: kicked by server")
+	ErrDisconnected    = errors.New("client: disconnected before response")
+	ErrChallengeSecret = errors.New("client: handshake challenge requires secret")
+	ErrMessageTooLarge = errors.New("client: decompressed message too large")
+)
+
+// states of link
+const (
+	linkHandshaking int32 = iota
+	linkReady
+	linkLost
+)
+
+type (
+	// Config represents the options of client
+	Config struct {
+		// Serializer marshals the payloads of requests, notifies and pushes,
+		// default is JSON
+		Serializer serialize.Serializer
+
+		// Codec encodes and decodes the packets, default is nano.DefaultCodec
+		Codec nano.Codec
+
+		// Timeout is the duration which the client waits for the handshake
+		// and responses, DefaultTimeout if zero
+		Timeout time.Duration
+
+		// MaxMessageSize is the max length of decompressed messages, the
+		// message exceeds it is dropped, DefaultMaxMessageSize if zero
+		MaxMessageSize int
+
+		// Handshake is the handshake data, eg: Token and DeviceID, the
+		// protocol version and capabilities are set by client
+		Handshake nano.HandShakeData
+
+		// ChallengeSecret answers the handshake challenge, see
+		// nano.SetHandshakeChallenge
+		ChallengeSecret []byte
+
+		// ReplaySecret signs the handshake with a random nonce, see
+		// nano.ReplayProtection
+		ReplaySecret []byte
+
+		// TLS dials the server over TLS if not nil
+		TLS *tls.Config
+
+		// Reconnect reconnects the lost connection automatically if not nil
+		Reconnect *ReconnectPolicy
+
+		// OnKick is called with the kick reason when the server kicks the
+		// client, the reason is nil if kicked by packet
+		OnKick func(reason []byte)
+	}
+
+	// Dialer returns a new connection to server
+	Dialer func() (net.Conn, error)
+
+	// KickError is returned when the server kicks the client, eg: the
+	// handshake is rejected
+	KickError struct {
+		Reason []byte
+	}
+
+	// Client is a connection to nano server, it is safe for concurrent use
+	Client struct {
+		config Config
+		dial   Dialer
+		dict   *message.Dictionary
+
+		writeMu sync.Mutex // serializes the packets written
+
+		mu       sync.Mutex
+		link     *link                    // current connection
+		mid      uint                     // last request id
+		pending  map[uint]*pendingRequest // request id map to pending request
+		handlers map[string]func([]byte)  // push callbacks
+		kicked   *KickError               // nil if not kicked
+
+		chHandshake chan []byte
+		chPush      chan *message.Message
+		die         chan struct{} // closed when client closed
+		closeOnce   sync.Once
+	}
+
+	// link represents a connection of client, which is replaced when
+	// reconnected
+	link struct {
+		conn      net.Conn
+		state     int32           // one of linkXxx
+		caps      nano.Capability // capabilities negotiated in handshake
+		heartbeat time.Duration   // heartbeat interval of server
+		mode      string          // heartbeat mode of server
+		lastRecv  int64           // unix nanoseconds of last packet received
+		die       chan struct{}   // closed when connection lost
+
+		// reason is the push of kick route, which is the kick reason if it
+		// is followed by kick packet, accessed by read goroutine only
+		reason *message.Message
+	}
+
+	// pendingRequest represents a request waiting for response
+	pendingRequest struct {
+		ch chan result
+	}
+
+	result struct {
+		m   *message.Message
+		err error
+	}
+)
+
+func (e *KickError) Error() string {
+	return fmt.Sprintf("client: kicked by server, Reason=%s", e.Reason)
+}
+
+// Is reports whether target is ErrKicked
+func (e *KickError) Is(target error) bool {
+	return target == ErrKicked
+}
+
+// Dial connects to the server at TCP address addr and completes handshake
+func Dial(addr string, config Config) (*Client, error) {
+	return Connect(func() (net.Conn, error) {
+		if config.TLS != nil {
+			return tls.Dial("tcp", addr, config.TLS)
+		}
+		return net.Dial("tcp", addr)
+	}, config)
+}
+
+// Connect connects to the server by dial and completes handshake, dial is
+// called again when reconnecting
+func Connect(dial Dialer, config Config) (*Client, error) {
+	if config.Serializer == nil {
+		config.Serializer = jsonserialize.NewSerializer()
+	}
+	if config.Codec == nil {
+		config.Codec = nano.DefaultCodec
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultTimeout
+	}
+	if config.MaxMessageSize <= 0 {
+		config.MaxMessageSize = DefaultMaxMessageSize
+	}
+
+	c := &Client{
+		config:      config,
+		dial:        dial,
+		dict:        message.NewDictionary(),
+		pending:     map[uint]*pendingRequest{},
+		handlers:    map[string]func([]byte){},
+		chHandshake: make(chan []byte, 1),
+		chPush:      make(chan *message.Message, pushBacklog),
+		die:         make(chan struct{}),
+	}
+	if err := c.connect(); err != nil {
+		c.Close()
+		return nil, err
+	}
+	go c.dispatch()
+	return c, nil
+}
+
+// connect dials a new connection and completes handshake
+func (c *Client) connect() error {
+	conn, err := c.dial()
+	if err != nil {
+		return err
+	}
+
+	l := &link{conn: conn, lastRecv: time.Now().UnixNano(), die: make(chan struct{})}
+	c.mu.Lock()
+	c.link = l
+	c.mu.Unlock()
+
+	go c.read(l)
+	if err := c.handshake(l); err != nil {
+		conn.Close()
+		return err
+	}
+	go c.keepalive(l)
+	return nil
+}
+
+func (c *Client) handshake(l *link) error {
+	data := c.config.Handshake
+	data.Sys.Protocol = nano.ProtocolVersion
+	data.Sys.Compress = true
+	data.Sys.Capabilities |= nano.CapCompress
+	if data.Sys.Type == "" {
+		data.Sys.Type = "go"
+	}
+	if len(c.config.ReplaySecret) > 0 {
+		nonce := make([]byte, 16)
+		if _, err := rand.Read(nonce); err != nil {
+			return err
+		}
+		nano.SignHandshake(c.config.ReplaySecret, &data, hex.EncodeToString(nonce), time.Now())
+	}
+	req, err := json.Marshal(&data)
+	if err != nil {
+		return err
+	}
+	if err := c.write(l, nano.PacketHandshake, req); err != nil {
+		return err
+	}
+
+	var payload []byte
+	select {
+	case payload = <-c.chHandshake:
+	case <-l.die:
+		return c.closedErr()
+	case <-time.After(c.config.Timeout):
+		return ErrTimeout
+	}
+
+	resp := &nano.HandshakeResponse{}
+	if err := json.Unmarshal(payload, resp); err != nil {
+		return err
+	}
+	if resp.Code != 200 {
+		return fmt.Errorf("client: handshake failed, Code=%d", resp.Code)
+	}
+	c.dict.Set(resp.Sys.Dict)
+	l.caps = resp.Sys.Capabilities
+	l.heartbeat = time.Duration(resp.Sys.Heartbeat * float64(time.Second))
+	l.mode = resp.Sys.HeartbeatMode
+
+	var answer []byte
+	if resp.Sys.Challenge != "" {
+		if len(c.config.ChallengeSecret) < 1 {
+			return ErrChallengeSecret
+		}
+		answer = []byte(nano.AnswerChallenge(c.config.ChallengeSecret, resp.Sys.Challenge))
+	}
+	if err := c.write(l, nano.PacketHandshakeAck, answer); err != nil {
+		return err
+	}
+
+	// the connection lost during handshake is handled by caller
+	if !atomic.CompareAndSwapInt32(&l.state, linkHandshaking, linkReady) {
+		return c.closedErr()
+	}
+	return nil
+}
+
+// read reads and processes the packets until the connection closed
+func (c *Client) read(l *link) {
+	defer c.lost(l)
+	defer func() {
+		// the connection closed without kick packet
+		if l.reason != nil {
+			c.push(l.reason)
+		}
+	}()
+
+	decoder := c.config.Codec.NewDecoder()
+	buf := make([]byte, 4096)
+	for {
+		n, err := l.conn.Read(buf)
+		if err != nil {
+			return
+		}
+		atomic.StoreInt64(&l.lastRecv, time.Now().UnixNano())
+
+		packets, err := decoder.Decode(buf[:n])
+		if err != nil {
+			return
+		}
+		for _, p := range packets {
+			if !c.processPacket(l, p) {
+				return
+			}
+		}
+	}
+}
+
+// lost cleans the lost connection, and reconnects if the connection has
+// completed handshake and the client is not kicked or closed
+func (c *Client) lost(l *link) {
+	l.conn.Close()
+	close(l.die)
+	if atomic.SwapInt32(&l.state, linkLost) == linkHandshaking {
+		return
+	}
+
+	// the requests could not be responded on the new session
+	c.failPending(ErrDisconnected)
+	if c.config.Reconnect == nil || c.Kicked() != nil || c.closed() {
+		c.Close()
+		return
+	}
+	go c.reconnect()
+}
+
+// processPacket processes the packet, and reports whether the connection
+// should be kept
+func (c *Client) processPacket(l *link, p *nano.Packet) bool {
+	switch p.Type {
+	case nano.PacketHandshake:
+		select {
+		case c.chHandshake <- p.Data:
+		default:
+		}
+
+	case nano.PacketHeartbeat:
+		// the heartbeat settings are written by handshake before ready
+		if atomic.LoadInt32(&l.state) == linkReady && l.mode == nano.HeartbeatServer.String() {
+			c.write(l, nano.PacketHeartbeat, echoHeartbeat(p.Data, time.Now()))
+		}
+
+	case nano.PacketDictionary:
+		update := &nano.DictionaryUpdate{}
+		if err := json.Unmarshal(p.Data, update); err == nil {
+			c.dict.Set(update.Dict)
+		}
+
+	case nano.PacketKick:
+		// the reason is sent by kick packet if the connection is rejected
+		// before handshake, eg: too many connections
+		reason := p.Data
+		if len(reason) < 1 && l.reason != nil {
+			reason = l.reason.Data
+		}
+		l.reason = nil
+		c.kick(reason)
+		return false
+
+	case nano.PacketData:
+		// the push of kick route is an ordinary push if not followed by
+		// kick packet
+		if l.reason != nil {
+			c.push(l.reason)
+			l.reason = nil
+		}
+
+		m, err := c.dict.Decode(p.Data)
+		if err != nil {
+			return true
+		}
+		if m.Flags&message.Compressed != 0 {
+			if m.Data, err = c.decompress(m.Data); err != nil {
+				return true
+			}
+		}
+
+		switch {
+		case m.Type == message.Response:
+			c.mu.Lock()
+			r, ok := c.pending[m.ID]
+			delete(c.pending, m.ID)
+			c.mu.Unlock()
+			if ok {
+				r.ch <- result{m: m}
+			}
+		case m.Route == kickRoute:
+			l.reason = m
+		default:
+			c.push(m)
+		}
+	}
+	return true
+}
+
+// push queues the push for the callbacks, the push is dropped if the
+// callbacks are too slow, so that the responses and heartbeats are not
+// blocked
+func (c *Client) push(m *message.Message) {
+	select {
+	case c.chPush <- m:
+	default:
+	}
+}
+
+// decompress decompresses the message body, which must not be longer than
+// the max message size
+func (c *Client) decompress(data []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(data))
+	defer r.Close()
+
+	limit := c.config.MaxMessageSize
+	out, err := ioutil.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(out) > limit {
+		return nil, ErrMessageTooLarge
+	}
+	return out, nil
+}
+
+// responseError returns the error responded by server, eg:
+// {"code":404,"msg":"route not found"}, nil if data is not an error
+func responseError(data []byte) error {
+	if len(data) < 1 || data[0] != '{' {
+		return nil
+	}
+	e := &nano.Error{}
+	if json.Unmarshal(data, e) != nil || e.Code < 400 || e.Message == "" {
+		return nil
+	}
+	return e
+}
+
+// echoHeartbeat returns the data of heartbeat echo, which is the server
+// timestamp followed by the client timestamp at now
+func echoHeartbeat(data []byte, now time.Time) []byte {
+	if len(data) < timestampSize {
+		return nil
+	}
+	echo := make([]byte, 2*timestampSize)
+	copy(echo, data[:timestampSize])
+	binary.BigEndian.PutUint64(echo[timestampSize:], uint64(now.UnixNano()/int64(time.Millisecond)))
+	return echo
+}
+
+// dispatch calls the push callbacks in order
+func (c *Client) dispatch() {
+	for {
+		select {
+		case m := <-c.chPush:
+			c.mu.Lock()
+			fn := c.handlers[m.Route]
+			c.mu.Unlock()
+			if fn != nil {
+				fn(m.Data)
+			}
+		case <-c.die:
+			return
+		}
+	}
+}
+
+// keepalive sends heartbeat in client driven mode, and closes the connection
+// if no packet received in heartbeat misses
+func (c *Client) keepalive(l *link) {
+	if l.heartbeat <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(l.heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			if now.Sub(time.Unix(0, atomic.LoadInt64(&l.lastRecv))) > heartbeatMisses*l.heartbeat {
+				l.conn.Close()
+				return
+			}
+			if l.mode == nano.HeartbeatClient.String() {
+				c.write(l, nano.PacketHeartbeat, nil)
+			}
+		case <-l.die:
+			return
+		}
+	}
+}
+
+// kick records the kick reason and closes the client
+func (c *Client) kick(reason []byte) {
+	c.mu.Lock()
+	c.kicked = &KickError{Reason: append([]byte(nil), reason...)}
+	c.mu.Unlock()
+
+	if fn := c.config.OnKick; fn != nil {
+		fn(reason)
+	}
+	c.Close()
+}
+
+// failPending fails all pending requests with err
+func (c *Client) failPending(err error) {
+	c.mu.Lock()
+	pending := c.pending
+	c.pending = map[uint]*pendingRequest{}
+	c.mu.Unlock()
+
+	for _, r := range pending {
+		r.ch <- result{err: err}
+	}
+}
+
+func (c *Client) closed() bool {
+	select {
+	case <-c.die:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *Client) closedErr() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.kicked != nil {
+		return c.kicked
+	}
+	return ErrClosed
+}
+
+// current returns the current connection, nil if it has not completed
+// handshake or has been lost
+func (c *Client) current() *link {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.link == nil || atomic.LoadInt32(&c.link.state) != linkReady {
+		return nil
+	}
+	return c.link
+}
+
+func (c *Client) write(l *link, typ nano.PacketType, data []byte) error {
+	if l == nil {
+		if c.closed() {
+			return c.closedErr()
+		}
+		return ErrDisconnected
+	}
+
+	p, err := c.config.Codec.Encode(typ, data)
+	if err != nil {
+		return err
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if _, err = l.conn.Write(p); err != nil {
+		select {
+		case <-l.die:
+			if c.closed() {
+				return c.closedErr()
+			}
+			return ErrDisconnected
+		default:
+		}
+	}
+	return err
+}
+
+func (c *Client) encode(typ message.Type, mid uint, route string, v interface{}) ([]byte, error) {
+	data, err := c.marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return c.dict.Encode(&message.Message{Type: typ, ID: mid, Route: route, Data: data})
+}
+
+func (c *Client) marshal(v interface{}) ([]byte, error) {
+	if data, ok := v.([]byte); ok {
+		return data, nil
+	}
+	return c.config.Serializer.Marshal(v)
+}
+
+// Unmarshal unmarshals the payload of response or push into v by the
+// serializer of client, v could be a *[]byte to receive the raw payload
+func (c *Client) Unmarshal(data []byte, v interface{}) error {
+	if v == nil {
+		return nil
+	}
+	if p, ok := v.(*[]byte); ok {
+		*p = data
+		return nil
+	}
+	return c.config.Serializer.Unmarshal(data, v)
+}
+
+// Request sends a request to route, and waits for the response which is
+// unmarshaled into resp, resp could be nil to discard the response. The
+// errors responded by server are returned as *nano.Error, eg:
+//
+//	if errors.Is(err, nano.ErrRouteNotFound) { ... }
+func (c *Client) Request(route string, req, resp interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.config.Timeout)
+	defer cancel()
+
+	err := c.RequestContext(ctx, route, req, resp)
+	if err == context.DeadlineExceeded {
+		return ErrTimeout
+	}
+	return err
+}
+
+// RequestContext sends a request to route, and waits for the response until
+// ctx done. ErrDisconnected is returned if the connection lost before
+// response, the request is not delivered again after reconnected
+func (c *Client) RequestContext(ctx context.Context, route string, req, resp interface{}) error {
+	c.mu.Lock()
+	c.mid++
+	mid := c.mid
+	c.mu.Unlock()
+
+	data, err := c.encode(message.Request, mid, route, req)
+	if err != nil {
+		return err
+	}
+	r := &pendingRequest{ch: make(chan result, 1)}
+	c.mu.Lock()
+	c.pending[mid] = r
+	c.mu.Unlock()
+
+	if err := c.write(c.current(), nano.PacketData, data); err != nil {
+		c.mu.Lock()
+		delete(c.pending, mid)
+		c.mu.Unlock()
+		return err
+	}
+
+	select {
+	case res := <-r.ch:
+		if res.err != nil {
+			return res.err
+		}
+		if err := responseError(res.m.Data); err != nil {
+			return err
+		}
+		return c.Unmarshal(res.m.Data, resp)
+	case <-c.die:
+		return c.closedErr()
+	case <-ctx.Done():
+		c.mu.Lock()
+		delete(c.pending, mid)
+		c.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// Notify sends a notify to route, ErrDisconnected is returned if the client
+// is reconnecting
+func (c *Client) Notify(route string, v interface{}) error {
+	data, err := c.encode(message.Notify, 0, route, v)
+	if err != nil {
+		return err
+	}
+	return c.write(c.current(), nano.PacketData, data)
+}
+
+// On registers the callback of the pushes of route, nil removes it. The
+// callbacks are called in order in a dedicated goroutine, the pushes are
+// dropped if more than 256 pushes are waiting for the slow callbacks
+func (c *Client) On(route string, fn func(data []byte)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if fn == nil {
+		delete(c.handlers, route)
+		return
+	}
+	c.handlers[route] = fn
+}
+
+// Kicked returns the kick error, nil if not kicked
+func (c *Client) Kicked() *KickError {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.kicked
+}
+
+// Done returns a channel which is closed when the client closed, eg: kicked,
+// or the connection lost and not reconnected
+func (c *Client) Done() <-chan struct{} {
+	return c.die
+}
+
+// Close closes the connection, and stops reconnecting
+func (c *Client) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.die)
+		c.mu.Lock()
+		l := c.link
+		c.mu.Unlock()
+		if l != nil {
+			err = l.conn.Close()
+		}
+	})
+	return err
+}
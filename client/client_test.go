@@ -0,0 +1,187 @@
+package client
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kensomanpow/nano"
+	"github.com/kensomanpow/nano/component"
+	"github.com/kensomanpow/nano/nanotest"
+	"github.com/kensomanpow/nano/serialize/json"
+	"github.com/kensomanpow/nano/session"
+)
+
+type (
+	Room struct {
+		component.Base
+	}
+
+	JoinRequest struct {
+		Name string `json:"name"`
+	}
+
+	JoinResponse struct {
+		Name string `json:"name"`
+	}
+)
+
+func (r *Room) Join(s *session.Session, req *JoinRequest, respond func(interface{}) error) error {
+	if err := s.Push("onJoined", &JoinResponse{Name: req.Name}); err != nil {
+		return err
+	}
+	return respond(&JoinResponse{Name: req.Name})
+}
+
+func (r *Room) Alert(s *session.Session, _ []byte, respond func(interface{}) error) error {
+	if err := s.Push("error", []byte(`{"msg":"alert"}`)); err != nil {
+		return err
+	}
+	return respond([]byte(`{}`))
+}
+
+func (r *Room) Leave(s *session.Session, _ []byte) error {
+	return s.Kick(&nano.KickReason{Code: 403, Reason: "bye"})
+}
+
+func TestClient(t *testing.T) {
+	app := nano.NewApp()
+	app.Register(&Room{})
+	app.SetHandshakeChallenge([]byte("secret"))
+	app.SetCompression(1)
+	srv := nanotest.NewServer(app, nano.WithSerializer(json.NewSerializer()))
+	defer srv.Close()
+
+	if _, err := Connect(srv.Dial, Config{Timeout: time.Second}); err != ErrChallengeSecret {
+		t.Fatalf("expect ErrChallengeSecret, got %v", err)
+	}
+
+	var kicked []byte
+	c, err := Connect(srv.Dial, Config{
+		ChallengeSecret: []byte("secret"),
+		OnKick:          func(reason []byte) { kicked = reason },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	pushed := make(chan string, 1)
+	c.On("onJoined", func(data []byte) {
+		resp := &JoinResponse{}
+		if err := c.Unmarshal(data, resp); err != nil {
+			t.Error(err)
+		}
+		pushed <- resp.Name
+	})
+
+	resp := &JoinResponse{}
+	if err := c.Request("Room.Join", &JoinRequest{Name: "alice"}, resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Name != "alice" {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+	select {
+	case name := <-pushed:
+		if name != "alice" {
+			t.Fatalf("unexpected push %s", name)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("push not received")
+	}
+
+	// the push of route error is not a kick without kick packet
+	alerted := make(chan []byte, 1)
+	c.On("error", func(data []byte) { alerted <- data })
+	if err := c.Request("Room.Alert", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case data := <-alerted:
+		if string(data) != `{"msg":"alert"}` {
+			t.Fatalf("unexpected push %s", data)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("push of route error not received")
+	}
+	if c.Kicked() != nil {
+		t.Fatalf("client should not be kicked by push")
+	}
+
+	if err := c.Request("Room.Missing", nil, resp); !errors.Is(err, nano.ErrRouteNotFound) {
+		t.Fatalf("expect ErrRouteNotFound, got %v", err)
+	}
+
+	if err := c.Notify("Room.Leave", nil); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-c.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("client should be closed after kicked")
+	}
+	if c.Kicked() == nil || string(kicked) != string(c.Kicked().Reason) || !strings.Contains(string(kicked), "bye") {
+		t.Fatalf("unexpected kick reason %s", kicked)
+	}
+	if err := c.RequestContext(context.Background(), "Room.Join", &JoinRequest{}, nil); !errors.Is(err, ErrKicked) {
+		t.Fatalf("expect ErrKicked, got %v", err)
+	}
+}
+
+func TestClient_WebSocket(t *testing.T) {
+	app := nano.NewApp()
+	app.Register(&Room{})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go app.ListenWSContext(ctx, addr, nano.WithSerializer(json.NewSerializer()), nano.WithoutSignals())
+
+	var c *Client
+	for i := 0; i < 50; i++ {
+		if c, err = DialWS("ws://"+addr+"/", nil, Config{}); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	resp := &JoinResponse{}
+	if err := c.Request("Room.Join", &JoinRequest{Name: "bob"}, resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Name != "bob" {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+}
+
+func TestClient_Decompress(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := flate.NewWriter(&buf, flate.BestCompression)
+	w.Write(make([]byte, 1024))
+	w.Close()
+
+	c := &Client{config: Config{MaxMessageSize: 1024}}
+	if data, err := c.decompress(buf.Bytes()); err != nil || len(data) != 1024 {
+		t.Fatalf("unexpected decompressed %d bytes, %v", len(data), err)
+	}
+	c.config.MaxMessageSize = 1023
+	if _, err := c.decompress(buf.Bytes()); err != ErrMessageTooLarge {
+		t.Fatalf("expect ErrMessageTooLarge, got %v", err)
+	}
+}
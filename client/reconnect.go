@@ -0,0 +1,85 @@
+package client
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Default backoff of reconnecting
+const (
+	DefaultMinBackoff = 500 * time.Millisecond
+	DefaultMaxBackoff = 30 * time.Second
+)
+
+// ReconnectPolicy represents how the client reconnects the lost connection,
+// the delay before each attempt starts from MinBackoff and doubles after
+// each failure up to MaxBackoff, with a random jitter of half the delay. The
+// client is closed if the server kicks it, or all attempts failed. The new
+// connection starts a new session, so the requests waiting for responses fail
+// with ErrDisconnected when the connection lost, and the requests and notifies
+// sent while reconnecting fail with ErrDisconnected too
+type ReconnectPolicy struct {
+	MinBackoff  time.Duration // DefaultMinBackoff if zero
+	MaxBackoff  time.Duration // DefaultMaxBackoff if zero
+	MaxAttempts int           // zero retries forever
+
+	// OnDisconnect is called when the connection lost
+	OnDisconnect func()
+
+	// OnReconnect is called after reconnected with the number of attempts,
+	// eg: authenticates and joins the rooms again
+	OnReconnect func(attempts int)
+}
+
+// backoff returns the delay before the attempt, which starts from 1
+func (p *ReconnectPolicy) backoff(attempt int) time.Duration {
+	min, max := p.MinBackoff, p.MaxBackoff
+	if min <= 0 {
+		min = DefaultMinBackoff
+	}
+	if max <= 0 {
+		max = DefaultMaxBackoff
+	}
+
+	d := min
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// reconnect dials until a new connection completes handshake
+func (c *Client) reconnect() {
+	p := c.config.Reconnect
+	if fn := p.OnDisconnect; fn != nil {
+		fn()
+	}
+
+	for attempt := 1; p.MaxAttempts <= 0 || attempt <= p.MaxAttempts; attempt++ {
+		timer := time.NewTimer(p.backoff(attempt))
+		select {
+		case <-timer.C:
+		case <-c.die:
+			timer.Stop()
+			return
+		}
+
+		if err := c.connect(); err != nil {
+			if c.Kicked() != nil || c.closed() {
+				c.Close()
+				return
+			}
+			continue
+		}
+
+		if fn := p.OnReconnect; fn != nil {
+			fn(attempt)
+		}
+		return
+	}
+	c.failPending(ErrDisconnected)
+	c.Close()
+}
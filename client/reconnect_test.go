@@ -0,0 +1,103 @@
+package client
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kensomanpow/nano"
+	"github.com/kensomanpow/nano/component"
+	"github.com/kensomanpow/nano/nanotest"
+	"github.com/kensomanpow/nano/serialize/json"
+	"github.com/kensomanpow/nano/session"
+)
+
+// Slow responds the requests except the first one
+type Slow struct {
+	component.Base
+	mu      sync.Mutex
+	calls   int
+	chCalls chan int
+}
+
+func (s *Slow) Call(_ *session.Session, _ []byte, respond func(interface{}) error) error {
+	s.mu.Lock()
+	s.calls++
+	n := s.calls
+	s.mu.Unlock()
+
+	s.chCalls <- n
+	if n == 1 {
+		return nil
+	}
+	return respond([]byte(`{"n":2}`))
+}
+
+func TestReconnectPolicy_Backoff(t *testing.T) {
+	p := &ReconnectPolicy{MinBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	for attempt, max := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		max *= time.Millisecond
+		if d := p.backoff(attempt + 1); d < max/2 || d > max {
+			t.Fatalf("attempt %d, backoff %v out of [%v, %v]", attempt+1, d, max/2, max)
+		}
+	}
+}
+
+func TestClient_Reconnect(t *testing.T) {
+	slow := &Slow{chCalls: make(chan int, 2)}
+	app := nano.NewApp()
+	app.Register(slow)
+	srv := nanotest.NewServer(app, nano.WithSerializer(json.NewSerializer()))
+	defer srv.Close()
+
+	var mu sync.Mutex
+	var conn net.Conn
+	dial := func() (net.Conn, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		var err error
+		conn, err = srv.Dial()
+		return conn, err
+	}
+
+	reconnected := make(chan int, 1)
+	c, err := Connect(dial, Config{Reconnect: &ReconnectPolicy{
+		MinBackoff:  time.Millisecond,
+		OnReconnect: func(attempts int) { reconnected <- attempts },
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	done := make(chan error, 1)
+	resp := map[string]int{}
+	go func() { done <- c.Request("Slow.Call", nil, &resp) }()
+	<-slow.chCalls
+
+	// the pending request fails and is not delivered again on the new session
+	mu.Lock()
+	conn.Close()
+	mu.Unlock()
+	if err := <-done; err != ErrDisconnected {
+		t.Fatalf("pending request should fail with ErrDisconnected, got %v", err)
+	}
+	select {
+	case <-reconnected:
+	case <-time.After(time.Second):
+		t.Fatalf("client should be reconnected")
+	}
+
+	if err := c.Request("Slow.Call", nil, &resp); err != nil || resp["n"] != 2 {
+		t.Fatalf("unexpected response %v, %v", resp, err)
+	}
+	select {
+	case n := <-slow.chCalls:
+		if n != 2 {
+			t.Fatalf("handler called %d times, want 2", n)
+		}
+	default:
+		t.Fatalf("handler should be called by the new request")
+	}
+}
@@ -0,0 +1,72 @@
+package client
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// wsConn adapts *websocket.Conn to net.Conn, each packet is written as a
+// binary message
+type wsConn struct {
+	conn   *websocket.Conn
+	reader io.Reader
+}
+
+// DialWS connects to the server at WebSocket url, eg: ws://127.0.0.1:3250/,
+// and completes handshake, header is sent with the upgrade request
+func DialWS(url string, header http.Header, config Config) (*Client, error) {
+	return Connect(func() (net.Conn, error) {
+		dialer := *websocket.DefaultDialer
+		dialer.TLSClientConfig = config.TLS
+		conn, _, err := dialer.Dial(url, header)
+		if err != nil {
+			return nil, err
+		}
+		return &wsConn{conn: conn}, nil
+	}, config)
+}
+
+func (c *wsConn) Read(b []byte) (int, error) {
+	for {
+		if c.reader == nil {
+			_, r, err := c.conn.NextReader()
+			if err != nil {
+				return 0, err
+			}
+			c.reader = r
+		}
+		n, err := c.reader.Read(b)
+		if err == io.EOF {
+			c.reader = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (c *wsConn) Write(b []byte) (int, error) {
+	if err := c.conn.WriteMessage(websocket.BinaryMessage, b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *wsConn) Close() error                       { return c.conn.Close() }
+func (c *wsConn) LocalAddr() net.Addr                { return c.conn.LocalAddr() }
+func (c *wsConn) RemoteAddr() net.Addr               { return c.conn.RemoteAddr() }
+func (c *wsConn) SetReadDeadline(t time.Time) error  { return c.conn.SetReadDeadline(t) }
+func (c *wsConn) SetWriteDeadline(t time.Time) error { return c.conn.SetWriteDeadline(t) }
+
+func (c *wsConn) SetDeadline(t time.Time) error {
+	if err := c.conn.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.conn.SetWriteDeadline(t)
+}
@@ -0,0 +1,202 @@
+package nano
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// Clock provides the current time and the tickers of an application,
+	// the heartbeats, session expiration, bandwidth windows and timers are
+	// driven by it, eg: a ManualClock in tests to simulate heartbeat
+	// timeouts and idle kicks instantly
+	Clock interface {
+		Now() time.Time
+		NewTicker(d time.Duration) Ticker
+	}
+
+	// Ticker delivers the ticks of a Clock periodically
+	Ticker interface {
+		C() <-chan time.Time
+		Stop()
+	}
+
+	// timerClock is implemented by the clocks which provide one-shot timers,
+	// the timer is a Ticker which ticks only once
+	timerClock interface {
+		NewTimer(d time.Duration) Ticker
+	}
+
+	// realClock reads the system clock
+	realClock struct{}
+
+	// realTicker wraps time.Ticker
+	realTicker struct {
+		*time.Ticker
+	}
+
+	// realTimer wraps time.Timer
+	realTimer struct {
+		*time.Timer
+	}
+
+	// ManualClock is a Clock which only moves when it is set or advanced,
+	// the tickers fire when the time passes their ticks
+	ManualClock struct {
+		mu      sync.Mutex
+		now     time.Time
+		tickers map[*manualTicker]struct{}
+	}
+
+	// manualTicker is a ticker of ManualClock
+	manualTicker struct {
+		clock    *ManualClock
+		c        chan time.Time
+		interval time.Duration
+		next     time.Time // time of next tick
+		once     bool      // stopped after the first tick
+	}
+)
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
+
+// NewTimer returns a one-shot timer fires after d
+func (realClock) NewTimer(d time.Duration) Ticker {
+	return realTimer{time.NewTimer(d)}
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+func (t realTimer) Stop() {
+	t.Timer.Stop()
+}
+
+// NewManualClock returns a ManualClock starts at start
+func NewManualClock(start time.Time) *ManualClock {
+	return &ManualClock{now: start, tickers: map[*manualTicker]struct{}{}}
+}
+
+// Now implements the Clock interface
+func (c *ManualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// NewTicker implements the Clock interface
+func (c *ManualClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	return c.newTicker(d, false)
+}
+
+// NewTimer returns a one-shot timer fires when the clock passes d
+func (c *ManualClock) NewTimer(d time.Duration) Ticker {
+	return c.newTicker(d, true)
+}
+
+func (c *ManualClock) newTicker(d time.Duration, once bool) *manualTicker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := &manualTicker{clock: c, c: make(chan time.Time, 1), interval: d, next: c.now.Add(d), once: once}
+	c.tickers[t] = struct{}{}
+	return t
+}
+
+// Set moves the clock to now, the tickers whose ticks passed fire once, and
+// like time.Ticker, the ticks are dropped for slow receivers
+func (c *ManualClock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = now
+	for t := range c.tickers {
+		if t.next.After(now) {
+			continue
+		}
+		select {
+		case t.c <- now:
+		default:
+		}
+		if t.once {
+			delete(c.tickers, t)
+			continue
+		}
+		for !t.next.After(now) {
+			t.next = t.next.Add(t.interval)
+		}
+	}
+}
+
+// Advance moves the clock forward by d
+func (c *ManualClock) Advance(d time.Duration) {
+	c.Set(c.Now().Add(d))
+}
+
+func (t *manualTicker) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *manualTicker) Stop() {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	delete(t.clock.tickers, t)
+}
+
+// newTimer returns a one-shot timer of the application clock fires after d,
+// the clocks without timers fall back to a ticker
+func (app *App) newTimer(d time.Duration) Ticker {
+	if c, ok := app.clock.(timerClock); ok {
+		return c.NewTimer(d)
+	}
+	return app.clock.NewTicker(d)
+}
+
+// Clock returns the clock of the application
+func (app *App) Clock() Clock {
+	return app.clock
+}
+
+// SetClock set the clock of the application, it should be called before any
+// timer created, and can not be called after application running. The
+// default clock is the system clock
+func (app *App) SetClock(c Clock) {
+	if atomic.LoadInt32(&app.running) == 1 {
+		panic("nano/clock: clock can not be changed after application running")
+	}
+
+	app.clock = c
+	app.timers.clock = c
+	app.timers.wheel = newTimingWheel(c.Now(), app.timers.precision)
+	if l := app.env.banList; l != nil {
+		l.setClock(c)
+	}
+}
+
+// WithClock set the clock of the application, see App.SetClock
+func WithClock(c Clock) Option {
+	return withSetting(func(app *App) error {
+		if c == nil {
+			return invalidOption("WithClock", "clock can not be nil")
+		}
+		app.SetClock(c)
+		return nil
+	})
+}
@@ -0,0 +1,85 @@
+package nano
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestManualClock(t *testing.T) {
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewManualClock(start)
+	ticker := c.NewTicker(time.Second)
+
+	c.Advance(500 * time.Millisecond)
+	select {
+	case <-ticker.C():
+		t.Fatalf("ticker should not fire before interval")
+	default:
+	}
+
+	c.Advance(3 * time.Second)
+	if now := <-ticker.C(); !now.Equal(start.Add(3500 * time.Millisecond)) {
+		t.Fatalf("unexpected tick %s", now)
+	}
+	select {
+	case <-ticker.C():
+		t.Fatalf("ticks should be dropped for slow receivers")
+	default:
+	}
+
+	ticker.Stop()
+	c.Advance(time.Second)
+	select {
+	case <-ticker.C():
+		t.Fatalf("stopped ticker should not fire")
+	default:
+	}
+}
+
+func TestManualClock_Timer(t *testing.T) {
+	c := NewManualClock(time.Now())
+	timer := c.NewTimer(time.Second)
+
+	c.Advance(time.Second)
+	<-timer.C()
+	c.Advance(time.Second)
+	select {
+	case <-timer.C():
+		t.Fatalf("timer should fire only once")
+	default:
+	}
+	if len(c.tickers) != 0 {
+		t.Fatalf("fired timer should be removed, got %d", len(c.tickers))
+	}
+}
+
+func TestClock_HeartbeatTimeout(t *testing.T) {
+	app := NewApp()
+	c := NewManualClock(time.Now())
+	app.SetClock(c)
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go io.Copy(ioutil.Discard, client)
+
+	a := newAgent(app, server)
+	go a.write()
+
+	c.Advance(app.env.heartbeat)
+	time.Sleep(10 * time.Millisecond)
+	if a.status() == statusClosed {
+		t.Fatalf("session should not timeout in heartbeat misses")
+	}
+
+	c.Advance(time.Duration(app.env.heartbeatMisses) * app.env.heartbeat)
+	deadline := time.Now().Add(time.Second)
+	for a.status() != statusClosed {
+		if time.Now().After(deadline) {
+			t.Fatalf("session should be closed after heartbeat timeout")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
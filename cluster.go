@@ -0,0 +1,248 @@
+// Copyright (c) nano Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package nano
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/kensomanpow/nano/cluster"
+	"github.com/kensomanpow/nano/session"
+)
+
+// ErrNoForwarder represents the uid lives on a remote node but no forwarder
+// was set to deliver the message.
+var ErrNoForwarder = errors.New("no cluster forwarder to reach remote node")
+
+func init() {
+	session.OnBind(func(s *session.Session) { appOf(s).registerUID(s) })
+}
+
+// appOf returns the application which the session belongs to
+func appOf(s *session.Session) *App {
+	if v, ok := agents.Load(s.ID()); ok {
+		return v.(*agent).app
+	}
+	return defaultApp
+}
+
+// location returns the location of session in current node
+func (app *App) location(s *session.Session) cluster.Location {
+	return cluster.Location{Node: app.env.nodeID, SessionID: s.ID()}
+}
+
+func (app *App) registerUID(s *session.Session) {
+	if app.env.registry == nil {
+		return
+	}
+
+	if err := app.env.registry.Register(s.UID(), app.location(s)); err != nil {
+		app.log().Println(fmt.Sprintf("nano/cluster: register uid failed, UID=%d, Error=%s", s.UID(), err.Error()))
+	}
+}
+
+func (app *App) deregisterUID(s *session.Session) {
+	if app.env.registry == nil || s.UID() == 0 {
+		return
+	}
+
+	if err := app.env.registry.Deregister(s.UID(), app.location(s)); err != nil {
+		app.log().Println(fmt.Sprintf("nano/cluster: deregister uid failed, UID=%d, Error=%s", s.UID(), err.Error()))
+	}
+}
+
+// SetNodeID set the id of current node, which is used to identify the node
+// in the cluster UID registry
+func SetNodeID(id string) {
+	defaultApp.SetNodeID(id)
+}
+
+// SetNodeID set the node id of the application
+func (app *App) SetNodeID(id string) {
+	app.env.nodeID = id
+}
+
+// SetNodeLabels set the labels of current node, which are advertised to the
+// cluster and used by label based routing rules
+func SetNodeLabels(labels map[string]string) {
+	defaultApp.SetNodeLabels(labels)
+}
+
+// SetNodeLabels set the node labels of the application
+func (app *App) SetNodeLabels(labels map[string]string) {
+	app.env.nodeLabels = labels
+}
+
+// LocalNode returns the cluster node information of current process
+func LocalNode() *cluster.Node {
+	return defaultApp.LocalNode()
+}
+
+// LocalNode returns the cluster node information of the application
+func (app *App) LocalNode() *cluster.Node {
+	return &cluster.Node{ID: app.env.nodeID, Labels: app.env.nodeLabels}
+}
+
+// SetUIDRegistry set the cluster UID registry, which will be updated when a
+// session bind UID and when a session closed
+func SetUIDRegistry(r cluster.Registry) {
+	defaultApp.SetUIDRegistry(r)
+}
+
+// SetUIDRegistry set the cluster UID registry of the application
+func (app *App) SetUIDRegistry(r cluster.Registry) {
+	app.env.registry = r
+}
+
+// SetElector set the elector which elects the node that runs each activation
+// of the singleton cron jobs
+func SetElector(e cluster.Elector) {
+	defaultApp.SetElector(e)
+}
+
+// SetElector set the singleton cron job elector of the application
+func (app *App) SetElector(e cluster.Elector) {
+	app.env.elector = e
+}
+
+// SetForwarder set the forwarder which deliver push messages to UIDs that
+// live on remote nodes
+func SetForwarder(f cluster.Forwarder) {
+	defaultApp.SetForwarder(f)
+}
+
+// SetForwarder set the remote push forwarder of the application
+func (app *App) SetForwarder(f cluster.Forwarder) {
+	app.env.forwarder = f
+}
+
+// SetForwardBus set a bus based forwarder, and serves push messages that
+// forwarded to current node from other nodes via the bus
+func SetForwardBus(bus cluster.Bus) error {
+	return defaultApp.SetForwardBus(bus)
+}
+
+// SetForwardBus set a bus based forwarder of the application, and serves
+// push messages that forwarded to the node of application via the bus
+func (app *App) SetForwardBus(bus cluster.Bus) error {
+	app.env.forwarder = cluster.NewBusForwarder(bus)
+	return cluster.ServeForwarded(bus, app.env.nodeID, func(uid int64, route string, data []byte) {
+		s, err := app.agents.Member(uid)
+		if err != nil {
+			return // session has gone
+		}
+		if err := s.Push(route, data); err != nil {
+			app.log().Println(fmt.Sprintf("nano/cluster: push forwarded message failed, UID=%d, Error=%s", uid, err.Error()))
+		}
+	})
+}
+
+// SetRateLimiter set the limiter which limits the inbound messages of each
+// UID(or session when UID not bound) in the whole cluster, the messages
+// exceed the limit will be dropped
+func SetRateLimiter(l cluster.RateLimiter) {
+	defaultApp.SetRateLimiter(l)
+}
+
+// SetRateLimiter set the cluster rate limiter of the application
+func (app *App) SetRateLimiter(l cluster.RateLimiter) {
+	app.env.rateLimiter = l
+}
+
+// rateLimited reports whether the message of session should be dropped
+func (app *App) rateLimited(s *session.Session) bool {
+	if app.env.rateLimiter == nil {
+		return false
+	}
+
+	key := fmt.Sprintf("uid:%d", s.UID())
+	if s.UID() == 0 {
+		key = fmt.Sprintf("session:%s:%d", app.env.nodeID, s.ID())
+	}
+
+	ok, err := app.env.rateLimiter.Allow(key)
+	if err != nil {
+		// fail open, limiter backend broken should not stop the game
+		app.log().Println(fmt.Sprintf("nano/cluster: rate limiter error, Key=%s, Error=%s", key, err.Error()))
+		return false
+	}
+	return !ok
+}
+
+// IsOnline reports whether the uid has a living session in the cluster
+func IsOnline(uid int64) bool {
+	return defaultApp.IsOnline(uid)
+}
+
+// IsOnline reports whether the uid has a living session in the cluster, the
+// sessions of current node are the sessions of the application
+func (app *App) IsOnline(uid int64) bool {
+	if app.agents.Contains(uid) {
+		return true
+	}
+
+	if app.env.registry == nil {
+		return false
+	}
+
+	_, err := app.env.registry.Lookup(uid)
+	return err == nil
+}
+
+// PushToUID push the message to the session bound to uid, the session could
+// live on current node or on any node registered in the UID registry
+func PushToUID(uid int64, route string, v interface{}) error {
+	return defaultApp.PushToUID(uid, route, v)
+}
+
+// PushToUID push the message to the session bound to uid, the session could
+// be a session of the application or live on any node registered in the UID
+// registry
+func (app *App) PushToUID(uid int64, route string, v interface{}) error {
+	if s, err := app.agents.Member(uid); err == nil {
+		return s.Push(route, v)
+	}
+
+	if app.env.registry == nil {
+		return ErrMemberNotFound
+	}
+
+	loc, err := app.env.registry.Lookup(uid)
+	if err != nil {
+		return err
+	}
+
+	// stale location, the session has gone from current node
+	if loc.Node == app.env.nodeID {
+		return ErrMemberNotFound
+	}
+
+	if app.env.forwarder == nil {
+		return ErrNoForwarder
+	}
+
+	data, err := app.serializeOrRaw(v)
+	if err != nil {
+		return err
+	}
+
+	return app.env.forwarder.Forward(loc.Node, uid, route, data)
+}
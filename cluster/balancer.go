@@ -0,0 +1,383 @@
+// Copyright (c) nano Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/kensomanpow/nano/session"
+)
+
+// ErrNoAvailableNode represents there is no node could serve the route.
+var ErrNoAvailableNode = errors.New("cluster: no available node")
+
+// GameIDKey is the session key which stores the GameID of handshake data, it
+// is used by routing rules to match sessions.
+const GameIDKey = "nano.cluster.gameID"
+
+type (
+	// Balancer selects a node from the candidates which serve the same route
+	// namespace for the session, candidates are never empty.
+	Balancer interface {
+		Select(s *session.Session, candidates []*Node) *Node
+	}
+
+	// BalancerFunc is an adapter to allow the use of ordinary functions as Balancer
+	BalancerFunc func(s *session.Session, candidates []*Node) *Node
+
+	// LoadReporter reports the last known load of a node, HealthChecker
+	// implements the interface
+	LoadReporter interface {
+		Load(id string) Load
+	}
+
+	// HealthReporter reports whether a node is healthy, HealthChecker
+	// implements the interface
+	HealthReporter interface {
+		IsHealthy(id string) bool
+	}
+
+	roundRobin struct {
+		next uint64
+	}
+
+	leastSessions struct {
+		reporter LoadReporter
+	}
+
+	weighted struct {
+		mu      sync.Mutex
+		weights map[string]int // node id map to weight
+		current map[string]int // node id map to current weight
+	}
+
+	// Rule restricts the routes or the sessions it matched to the nodes that
+	// carry all the labels. Route prefix and game ids are both optional, an
+	// empty field matches everything.
+	Rule struct {
+		RoutePrefix string            // route prefix, eg: Room.
+		GameIDs     []uint32          // GameID in handshake data
+		Labels      map[string]string // required node labels, eg: tier=vip
+	}
+
+	// Router selects backend node for the route by the balancer registered
+	// to the longest matched route prefix. When sticky is enabled, the node
+	// selected for the first request of a session will serve all subsequent
+	// requests in the same namespace until released.
+	Router struct {
+		mu        sync.RWMutex
+		balancers map[string]Balancer         // route prefix map to balancer
+		fallback  Balancer                    // balancer for unmatched routes
+		rules     []Rule                      // label based routing rules
+		health    HealthReporter              // excludes unhealthy nodes, nil if not checked
+		sticky    bool                        // enable session affinity
+		affinity  map[int64]map[string]string // session id map to namespace bound node id
+	}
+)
+
+// Select calls f(s, candidates)
+func (f BalancerFunc) Select(s *session.Session, candidates []*Node) *Node {
+	return f(s, candidates)
+}
+
+// NewRoundRobin returns a balancer which select candidates in turn
+func NewRoundRobin() Balancer {
+	return &roundRobin{}
+}
+
+func (r *roundRobin) Select(_ *session.Session, candidates []*Node) *Node {
+	n := atomic.AddUint64(&r.next, 1)
+	return candidates[(n-1)%uint64(len(candidates))]
+}
+
+// NewLeastSessions returns a balancer which select the candidate which has
+// the least sessions reported by reporter
+func NewLeastSessions(reporter LoadReporter) Balancer {
+	if reporter == nil {
+		panic("nano/cluster: nil load reporter")
+	}
+	return &leastSessions{reporter: reporter}
+}
+
+func (l *leastSessions) Select(_ *session.Session, candidates []*Node) *Node {
+	selected := candidates[0]
+	least := l.reporter.Load(selected.ID).Sessions
+	for _, n := range candidates[1:] {
+		if c := l.reporter.Load(n.ID).Sessions; c < least {
+			selected, least = n, c
+		}
+	}
+	return selected
+}
+
+// NewWeighted returns a smooth weighted round-robin balancer, weights map
+// node id to weight, node that not in weights has weight 1
+func NewWeighted(weights map[string]int) Balancer {
+	w := &weighted{
+		weights: make(map[string]int),
+		current: make(map[string]int),
+	}
+	for id, weight := range weights {
+		w.weights[id] = weight
+	}
+	return w
+}
+
+func (w *weighted) weight(id string) int {
+	if weight, ok := w.weights[id]; ok {
+		return weight
+	}
+	return 1
+}
+
+func (w *weighted) Select(_ *session.Session, candidates []*Node) *Node {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var (
+		selected *Node
+		total    int
+	)
+	for _, n := range candidates {
+		weight := w.weight(n.ID)
+		total += weight
+		w.current[n.ID] += weight
+		if selected == nil || w.current[n.ID] > w.current[selected.ID] {
+			selected = n
+		}
+	}
+	w.current[selected.ID] -= total
+	return selected
+}
+
+// NewRouter returns a router which use round-robin balancer for the routes
+// that have no balancer registered
+func NewRouter() *Router {
+	return &Router{
+		balancers: make(map[string]Balancer),
+		fallback:  NewRoundRobin(),
+		affinity:  make(map[int64]map[string]string),
+	}
+}
+
+// matches reports whether the rule applies to the route and session
+func (r *Rule) matches(route string, s *session.Session) bool {
+	if !strings.HasPrefix(route, r.RoutePrefix) {
+		return false
+	}
+	if len(r.GameIDs) == 0 {
+		return true
+	}
+	if s == nil {
+		return false
+	}
+
+	gameID := s.Uint32(GameIDKey)
+	for _, id := range r.GameIDs {
+		if id == gameID {
+			return true
+		}
+	}
+	return false
+}
+
+// AddRule adds a label based routing rule, all matched rules are applied to
+// filter the candidates
+func (r *Router) AddRule(rule Rule) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.rules = append(r.rules, rule)
+}
+
+// SetHealthReporter set the reporter of node health, the unhealthy nodes are
+// not routed to, and the sessions bound to them are routed to another node.
+// A HealthChecker is usually used, the nodes should be added to it before
+// routed to
+func (r *Router) SetHealthReporter(h HealthReporter) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.health = h
+}
+
+// filter returns the healthy candidates which satisfy all matched rules
+func (r *Router) filter(route string, s *session.Session, candidates []*Node) []*Node {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.health != nil {
+		var healthy []*Node
+		for _, n := range candidates {
+			if r.health.IsHealthy(n.ID) {
+				healthy = append(healthy, n)
+			}
+		}
+		candidates = healthy
+	}
+
+	for i := range r.rules {
+		rule := &r.rules[i]
+		if !rule.matches(route, s) {
+			continue
+		}
+
+		var filtered []*Node
+		for _, n := range candidates {
+			if n.HasLabels(rule.Labels) {
+				filtered = append(filtered, n)
+			}
+		}
+		candidates = filtered
+	}
+	return candidates
+}
+
+// SetSticky enables or disables session to backend affinity
+func (r *Router) SetSticky(sticky bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.sticky = sticky
+}
+
+// Namespace returns the namespace of route, eg: Room.Join => Room
+func Namespace(route string) string {
+	if i := strings.Index(route, "."); i >= 0 {
+		return route[:i]
+	}
+	return route
+}
+
+// Bound returns the node id which the session bound to in namespace
+func (r *Router) Bound(s *session.Session, namespace string) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	id, ok := r.affinity[s.ID()][namespace]
+	return id, ok
+}
+
+// Release releases the affinity between session and the node in namespace,
+// the next request will be routed by the balancer again
+func (r *Router) Release(s *session.Session, namespace string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if bound, ok := r.affinity[s.ID()]; ok {
+		delete(bound, namespace)
+		if len(bound) == 0 {
+			delete(r.affinity, s.ID())
+		}
+	}
+}
+
+// ReleaseAll releases all affinities of the session, it should be called
+// when the session closed
+func (r *Router) ReleaseAll(s *session.Session) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.affinity, s.ID())
+}
+
+func (r *Router) bind(s *session.Session, namespace, id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	bound, ok := r.affinity[s.ID()]
+	if !ok {
+		bound = make(map[string]string)
+		r.affinity[s.ID()] = bound
+	}
+	bound[namespace] = id
+}
+
+func (r *Router) isSticky() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.sticky
+}
+
+// SetBalancer registers balancer for all routes that start with prefix,
+// empty prefix replaces the fallback balancer
+func (r *Router) SetBalancer(prefix string, b Balancer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if prefix == "" {
+		r.fallback = b
+		return
+	}
+	r.balancers[prefix] = b
+}
+
+// balancer returns the balancer registered to the longest matched prefix
+func (r *Router) balancer(route string) Balancer {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var (
+		matched string
+		b       = r.fallback
+	)
+	for prefix, balancer := range r.balancers {
+		if strings.HasPrefix(route, prefix) && len(prefix) > len(matched) {
+			matched, b = prefix, balancer
+		}
+	}
+	return b
+}
+
+// Select selects a node from candidates to serve the route for session
+func (r *Router) Select(route string, s *session.Session, candidates []*Node) (*Node, error) {
+	candidates = r.filter(route, s, candidates)
+	if len(candidates) < 1 {
+		return nil, ErrNoAvailableNode
+	}
+
+	sticky := s != nil && r.isSticky()
+	namespace := Namespace(route)
+	if sticky {
+		// bound node is still a candidate(eg: healthy)
+		if id, ok := r.Bound(s, namespace); ok {
+			for _, n := range candidates {
+				if n.ID == id {
+					return n, nil
+				}
+			}
+		}
+	}
+
+	n := r.balancer(route).Select(s, candidates)
+	if n == nil {
+		return nil, ErrNoAvailableNode
+	}
+
+	if sticky {
+		r.bind(s, namespace, n.ID)
+	}
+	return n, nil
+}
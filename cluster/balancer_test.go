@@ -0,0 +1,126 @@
+package cluster
+
+import (
+	"testing"
+
+	"github.com/kensomanpow/nano/session"
+)
+
+type testLoads map[string]Load
+
+func (l testLoads) Load(id string) Load {
+	return l[id]
+}
+
+var testNodes = []*Node{{ID: "n1"}, {ID: "n2"}, {ID: "n3"}}
+
+func TestRoundRobin(t *testing.T) {
+	b := NewRoundRobin()
+	for i := 0; i < 6; i++ {
+		if n := b.Select(nil, testNodes); n != testNodes[i%3] {
+			t.Fatalf("expect: %s, got: %s", testNodes[i%3].ID, n.ID)
+		}
+	}
+}
+
+func TestLeastSessions(t *testing.T) {
+	b := NewLeastSessions(testLoads{"n1": {Sessions: 10}, "n2": {Sessions: 2}, "n3": {Sessions: 5}})
+	if n := b.Select(nil, testNodes); n.ID != "n2" {
+		t.Fatalf("expect: n2, got: %s", n.ID)
+	}
+}
+
+func TestWeighted(t *testing.T) {
+	b := NewWeighted(map[string]int{"n1": 5, "n2": 1, "n3": 1})
+	counts := map[string]int{}
+	for i := 0; i < 70; i++ {
+		counts[b.Select(nil, testNodes).ID]++
+	}
+	if counts["n1"] != 50 || counts["n2"] != 10 || counts["n3"] != 10 {
+		t.Fatalf("unexpected distribution: %v", counts)
+	}
+}
+
+func TestRouter_Select(t *testing.T) {
+	r := NewRouter()
+	r.SetBalancer("Room.", BalancerFunc(func(s *session.Session, candidates []*Node) *Node {
+		return candidates[len(candidates)-1]
+	}))
+	r.SetBalancer("Room.VIP", BalancerFunc(func(s *session.Session, candidates []*Node) *Node {
+		return candidates[1]
+	}))
+
+	if n, _ := r.Select("Room.Join", nil, testNodes); n.ID != "n3" {
+		t.Fatalf("expect: n3, got: %s", n.ID)
+	}
+	if n, _ := r.Select("Room.VIPJoin", nil, testNodes); n.ID != "n2" {
+		t.Fatalf("expect: n2, got: %s", n.ID)
+	}
+	if _, err := r.Select("Room.Join", nil, nil); err != ErrNoAvailableNode {
+		t.Fatalf("expect: %v, got: %v", ErrNoAvailableNode, err)
+	}
+}
+
+func TestRouter_Sticky(t *testing.T) {
+	r := NewRouter()
+	r.SetSticky(true)
+	s := session.New(nil)
+
+	first, _ := r.Select("Room.Join", s, testNodes)
+	for i := 0; i < 5; i++ {
+		if n, _ := r.Select("Room.Chat", s, testNodes); n != first {
+			t.Fatalf("expect: %s, got: %s", first.ID, n.ID)
+		}
+	}
+
+	// bound node is not available anymore
+	var rest []*Node
+	for _, n := range testNodes {
+		if n != first {
+			rest = append(rest, n)
+		}
+	}
+	second, _ := r.Select("Room.Chat", s, rest)
+	if second == first {
+		t.Fatal("should re-select when bound node unavailable")
+	}
+	if id, _ := r.Bound(s, "Room"); id != second.ID {
+		t.Fatalf("expect bound: %s, got: %s", second.ID, id)
+	}
+
+	r.Release(s, "Room")
+	if _, ok := r.Bound(s, "Room"); ok {
+		t.Fatal("affinity should be released")
+	}
+}
+
+func TestRouter_Rules(t *testing.T) {
+	nodes := []*Node{
+		{ID: "eu-1", Labels: map[string]string{"region": "eu"}},
+		{ID: "eu-vip", Labels: map[string]string{"region": "eu", "tier": "vip"}},
+		{ID: "us-1", Labels: map[string]string{"region": "us"}},
+	}
+
+	r := NewRouter()
+	r.AddRule(Rule{RoutePrefix: "Room.", Labels: map[string]string{"region": "eu"}})
+	r.AddRule(Rule{GameIDs: []uint32{100}, Labels: map[string]string{"tier": "vip"}})
+
+	for i := 0; i < 4; i++ {
+		n, _ := r.Select("Room.Join", nil, nodes)
+		if n.Labels["region"] != "eu" {
+			t.Fatalf("expect eu node, got: %s", n.ID)
+		}
+	}
+
+	vip := session.New(nil)
+	vip.Set(GameIDKey, uint32(100))
+	for i := 0; i < 4; i++ {
+		if n, _ := r.Select("Room.Join", vip, nodes); n.ID != "eu-vip" {
+			t.Fatalf("expect: eu-vip, got: %s", n.ID)
+		}
+	}
+
+	if _, err := r.Select("Room.Join", vip, nodes[2:]); err != ErrNoAvailableNode {
+		t.Fatalf("expect: %v, got: %v", ErrNoAvailableNode, err)
+	}
+}
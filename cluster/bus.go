@@ -0,0 +1,120 @@
+// Copyright (c) nano Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+)
+
+type (
+	// Bus is the message bus between nodes, a subject could be subscribed by
+	// any number of nodes, and the published data will be delivered to all
+	// subscribers. It could be backed by NATS, Redis pub/sub, etc.
+	Bus interface {
+		Publish(subject string, data []byte) error
+		Subscribe(subject string, handler func(data []byte)) error
+	}
+
+	busForwarder struct {
+		bus Bus
+	}
+
+	forwardMessage struct {
+		UID   int64  `json:"uid"`
+		Route string `json:"route"`
+		Data  []byte `json:"data"`
+	}
+
+	memoryBus struct {
+		mu       sync.RWMutex
+		handlers map[string][]func([]byte) // subject map to handlers
+	}
+)
+
+// NewMemoryBus returns a Bus which delivers messages in current process, it's
+// suitable for single process deployment and tests.
+func NewMemoryBus() Bus {
+	return &memoryBus{handlers: make(map[string][]func([]byte))}
+}
+
+func (b *memoryBus) Publish(subject string, data []byte) error {
+	b.mu.RLock()
+	handlers := b.handlers[subject]
+	b.mu.RUnlock()
+
+	for _, h := range handlers {
+		deliver(subject, h, data)
+	}
+	return nil
+}
+
+func (b *memoryBus) Subscribe(subject string, handler func(data []byte)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.handlers[subject] = append(b.handlers[subject], handler)
+	return nil
+}
+
+func deliver(subject string, handler func([]byte), data []byte) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Printf("nano/cluster: bus handler panic, Subject=%s, Error=%v", subject, err)
+		}
+	}()
+
+	handler(data)
+}
+
+// ForwardSubject returns the subject which push messages forwarded to node
+// are published to
+func ForwardSubject(node string) string {
+	return "nano.push." + node
+}
+
+// NewBusForwarder returns a Forwarder which publishes push messages to the
+// forward subject of the target node
+func NewBusForwarder(bus Bus) Forwarder {
+	return &busForwarder{bus: bus}
+}
+
+func (f *busForwarder) Forward(node string, uid int64, route string, data []byte) error {
+	msg, err := json.Marshal(&forwardMessage{UID: uid, Route: route, Data: data})
+	if err != nil {
+		return err
+	}
+	return f.bus.Publish(ForwardSubject(node), msg)
+}
+
+// ServeForwarded subscribes the forward subject of node, deliver will be
+// called for each push message forwarded to the node
+func ServeForwarded(bus Bus, node string, deliver func(uid int64, route string, data []byte)) error {
+	return bus.Subscribe(ForwardSubject(node), func(data []byte) {
+		msg := &forwardMessage{}
+		if err := json.Unmarshal(data, msg); err != nil {
+			log.Printf("nano/cluster: invalid forward message, Error=%s", err.Error())
+			return
+		}
+		deliver(msg.UID, msg.Route, msg.Data)
+	})
+}
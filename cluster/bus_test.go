@@ -0,0 +1,24 @@
+package cluster
+
+import "testing"
+
+func TestBusForwarder(t *testing.T) {
+	bus := NewMemoryBus()
+
+	var (
+		uid   int64
+		route string
+		data  []byte
+	)
+	ServeForwarded(bus, "gate-1", func(u int64, r string, d []byte) {
+		uid, route, data = u, r, d
+	})
+
+	f := NewBusForwarder(bus)
+	if err := f.Forward("gate-1", 7, "room.chat", []byte("hi")); err != nil {
+		t.Fatal(err)
+	}
+	if uid != 7 || route != "room.chat" || string(data) != "hi" {
+		t.Fatalf("unexpected forwarded message: %d %s %s", uid, route, data)
+	}
+}
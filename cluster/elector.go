@@ -0,0 +1,70 @@
+// Copyright (c) nano Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"sync"
+	"time"
+)
+
+type (
+	// Elector elects exactly one node among the nodes which take part in the
+	// same election, eg: the node that runs a cluster singleton cron job.
+	Elector interface {
+		// Elect reports whether node wins the election identified by key,
+		// the winner is kept for ttl, during which all other nodes lose.
+		Elect(key, node string, ttl time.Duration) (bool, error)
+	}
+
+	winner struct {
+		node   string
+		expire time.Time
+	}
+
+	memoryElector struct {
+		mu      sync.Mutex
+		winners map[string]winner
+	}
+)
+
+// NewMemoryElector returns an Elector which keeps the winners in current
+// process memory, it is useful for single process deployment and testing.
+func NewMemoryElector() Elector {
+	return &memoryElector{winners: make(map[string]winner)}
+}
+
+func (e *memoryElector) Elect(key, node string, ttl time.Duration) (bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := time.Now()
+	for k, w := range e.winners {
+		if now.After(w.expire) {
+			delete(e.winners, k)
+		}
+	}
+
+	if w, ok := e.winners[key]; ok {
+		return w.node == node, nil
+	}
+	e.winners[key] = winner{node: node, expire: now.Add(ttl)}
+	return true, nil
+}
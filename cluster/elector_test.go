@@ -0,0 +1,27 @@
+package cluster
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryElector(t *testing.T) {
+	e := NewMemoryElector()
+	if ok, _ := e.Elect("settle", "gate-1", time.Hour); !ok {
+		t.Fatal("first node should win")
+	}
+	if ok, _ := e.Elect("settle", "gate-2", time.Hour); ok {
+		t.Fatal("second node should lose")
+	}
+	if ok, _ := e.Elect("settle", "gate-1", time.Hour); !ok {
+		t.Fatal("winner should keep winning")
+	}
+
+	if ok, _ := e.Elect("expired", "gate-1", time.Nanosecond); !ok {
+		t.Fatal("first node should win")
+	}
+	time.Sleep(time.Millisecond)
+	if ok, _ := e.Elect("expired", "gate-2", time.Hour); !ok {
+		t.Fatal("election should restart after ttl")
+	}
+}
@@ -0,0 +1,232 @@
+// Copyright (c) nano Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Default health check settings
+const (
+	DefaultCheckInterval = 5 * time.Second
+	DefaultFailThreshold = 3
+	minimumCheckInterval = 100 * time.Millisecond
+)
+
+type (
+	// Load represents the load report of a backend which returned by ping
+	Load struct {
+		Sessions int     // living sessions count on the backend
+		CPU      float64 // cpu usage, 0~1
+	}
+
+	// Pinger pings a backend, usually via a ping RPC, and returns the load
+	// report of the backend, an error means the backend is unreachable.
+	Pinger interface {
+		Ping(node *Node) (Load, error)
+	}
+
+	// PingerFunc is an adapter to allow the use of ordinary functions as Pinger
+	PingerFunc func(node *Node) (Load, error)
+
+	// HealthChecker checks all backends periodically, the backend will be
+	// marked unhealthy after continuous failures reach the threshold, and will
+	// be marked healthy again once a ping succeeded. The Router set with it
+	// does not route to the unhealthy backends, see Router.SetHealthReporter
+	HealthChecker struct {
+		mu        sync.RWMutex
+		pinger    Pinger
+		interval  time.Duration
+		threshold int
+		backends  map[string]*backend
+		onDown    []func(*Node)
+		onUp      []func(*Node)
+		die       chan struct{}
+		stopOnce  sync.Once
+	}
+
+	backend struct {
+		node    *Node
+		load    Load
+		fails   int
+		healthy bool
+	}
+)
+
+// Ping calls f(node)
+func (f PingerFunc) Ping(node *Node) (Load, error) {
+	return f(node)
+}
+
+// NewHealthChecker returns a new health checker, backend will be pinged every
+// interval and considered unhealthy after threshold continuous failures.
+func NewHealthChecker(pinger Pinger, interval time.Duration, threshold int) *HealthChecker {
+	if pinger == nil {
+		panic("nano/cluster: nil pinger")
+	}
+	if interval < minimumCheckInterval {
+		interval = DefaultCheckInterval
+	}
+	if threshold < 1 {
+		threshold = DefaultFailThreshold
+	}
+
+	return &HealthChecker{
+		pinger:    pinger,
+		interval:  interval,
+		threshold: threshold,
+		backends:  make(map[string]*backend),
+		die:       make(chan struct{}),
+	}
+}
+
+// Add adds a backend to checker, the backend is considered healthy until
+// the ping failures reach the threshold
+func (h *HealthChecker) Add(node *Node) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.backends[node.ID]; ok {
+		return
+	}
+	h.backends[node.ID] = &backend{node: node, healthy: true}
+}
+
+// Remove removes the backend from checker
+func (h *HealthChecker) Remove(id string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.backends, id)
+}
+
+// OnBackendDown registers a callback which will be called when a backend
+// becomes unhealthy, gates could error out or re-route in-flight sessions
+func (h *HealthChecker) OnBackendDown(fn func(node *Node)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.onDown = append(h.onDown, fn)
+}
+
+// OnBackendUp registers a callback which will be called when an unhealthy
+// backend recovered
+func (h *HealthChecker) OnBackendUp(fn func(node *Node)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.onUp = append(h.onUp, fn)
+}
+
+// IsHealthy reports whether the backend is healthy
+func (h *HealthChecker) IsHealthy(id string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	b, ok := h.backends[id]
+	return ok && b.healthy
+}
+
+// Load returns the last load report of the backend
+func (h *HealthChecker) Load(id string) Load {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if b, ok := h.backends[id]; ok {
+		return b.load
+	}
+	return Load{}
+}
+
+// Healthy returns all healthy backends which are available for routing
+func (h *HealthChecker) Healthy() []*Node {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	nodes := make([]*Node, 0, len(h.backends))
+	for _, b := range h.backends {
+		if b.healthy {
+			nodes = append(nodes, b.node)
+		}
+	}
+	return nodes
+}
+
+// Start starts checking backends in a new goroutine
+func (h *HealthChecker) Start() {
+	go func() {
+		ticker := time.NewTicker(h.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				h.check()
+			case <-h.die:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops checking backends, it could be called more than once
+func (h *HealthChecker) Stop() {
+	h.stopOnce.Do(func() { close(h.die) })
+}
+
+// check pings all backends once
+func (h *HealthChecker) check() {
+	h.mu.RLock()
+	backends := make([]*backend, 0, len(h.backends))
+	for _, b := range h.backends {
+		backends = append(backends, b)
+	}
+	h.mu.RUnlock()
+
+	for _, b := range backends {
+		load, err := h.pinger.Ping(b.node)
+
+		h.mu.Lock()
+		var callbacks []func(*Node)
+		if err != nil {
+			b.fails++
+			if b.healthy && b.fails >= h.threshold {
+				b.healthy = false
+				callbacks = h.onDown
+				log.Printf("nano/cluster: backend down, ID=%s, Addr=%s, Error=%s", b.node.ID, b.node.Addr, err.Error())
+			}
+		} else {
+			b.fails = 0
+			b.load = load
+			if !b.healthy {
+				b.healthy = true
+				callbacks = h.onUp
+			}
+		}
+		h.mu.Unlock()
+
+		for _, fn := range callbacks {
+			fn(b.node)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package cluster
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/kensomanpow/nano/session"
+)
+
+func TestHealthChecker(t *testing.T) {
+	alive := map[string]bool{"b1": true, "b2": true}
+	h := NewHealthChecker(PingerFunc(func(node *Node) (Load, error) {
+		if !alive[node.ID] {
+			return Load{}, errors.New("unreachable")
+		}
+		return Load{Sessions: 1}, nil
+	}), 0, 2)
+
+	var down, up []string
+	h.OnBackendDown(func(node *Node) { down = append(down, node.ID) })
+	h.OnBackendUp(func(node *Node) { up = append(up, node.ID) })
+	h.Add(&Node{ID: "b1"})
+	h.Add(&Node{ID: "b2"})
+
+	h.check()
+	if len(h.Healthy()) != 2 || h.Load("b1").Sessions != 1 {
+		t.Fatal("all backends should be healthy")
+	}
+
+	alive["b2"] = false
+	h.check()
+	if !h.IsHealthy("b2") {
+		t.Fatal("b2 should be healthy before reach the threshold")
+	}
+	h.check()
+	if h.IsHealthy("b2") || len(h.Healthy()) != 1 || len(down) != 1 || down[0] != "b2" {
+		t.Fatalf("b2 should be down, down callbacks: %v", down)
+	}
+
+	alive["b2"] = true
+	h.check()
+	if !h.IsHealthy("b2") || len(up) != 1 {
+		t.Fatal("b2 should be recovered")
+	}
+}
+
+func TestHealthChecker_Router(t *testing.T) {
+	alive := map[string]bool{"n1": true, "n2": true, "n3": true}
+	h := NewHealthChecker(PingerFunc(func(node *Node) (Load, error) {
+		if !alive[node.ID] {
+			return Load{}, errors.New("unreachable")
+		}
+		return Load{}, nil
+	}), 0, 1)
+	for _, n := range testNodes {
+		h.Add(n)
+	}
+
+	r := NewRouter()
+	r.SetHealthReporter(h)
+	r.SetBalancer("", BalancerFunc(func(s *session.Session, candidates []*Node) *Node {
+		return candidates[0]
+	}))
+	if n, _ := r.Select("Room.Join", nil, testNodes); n.ID != "n1" {
+		t.Fatalf("expect: n1, got: %s", n.ID)
+	}
+
+	alive["n1"] = false
+	h.check()
+	if n, _ := r.Select("Room.Join", nil, testNodes); n.ID != "n2" {
+		t.Fatalf("unhealthy node should not be routed, got: %s", n.ID)
+	}
+
+	h.Start()
+	h.Stop()
+	h.Stop()
+}
@@ -0,0 +1,121 @@
+// Copyright (c) nano Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"log"
+	"sync"
+)
+
+type (
+	// NodeHandler represents a callback that will be called when the cluster
+	// topology changed.
+	NodeHandler func(node *Node)
+
+	membership struct {
+		mu      sync.RWMutex
+		nodes   map[string]*Node // node id map to node
+		onJoin  []NodeHandler
+		onLeave []NodeHandler
+	}
+)
+
+// members holds all nodes known by current process, discovery backends keep
+// it update via Join and Leave.
+var members = &membership{nodes: make(map[string]*Node)}
+
+// OnNodeJoin registers a callback which will be called when a node joined
+// the cluster
+func OnNodeJoin(fn NodeHandler) {
+	members.mu.Lock()
+	defer members.mu.Unlock()
+
+	members.onJoin = append(members.onJoin, fn)
+}
+
+// OnNodeLeave registers a callback which will be called when a node left
+// the cluster
+func OnNodeLeave(fn NodeHandler) {
+	members.mu.Lock()
+	defer members.mu.Unlock()
+
+	members.onLeave = append(members.onLeave, fn)
+}
+
+// Join adds node to the cluster membership, the join callbacks will only be
+// called when the node is new, otherwise the node information is updated.
+func Join(node *Node) {
+	members.mu.Lock()
+	_, exists := members.nodes[node.ID]
+	members.nodes[node.ID] = node
+	callbacks := members.onJoin
+	members.mu.Unlock()
+
+	if !exists {
+		emit(callbacks, node)
+	}
+}
+
+// Leave removes node from the cluster membership
+func Leave(id string) {
+	members.mu.Lock()
+	node, exists := members.nodes[id]
+	delete(members.nodes, id)
+	callbacks := members.onLeave
+	members.mu.Unlock()
+
+	if exists {
+		emit(callbacks, node)
+	}
+}
+
+// Member returns the node of specified id
+func Member(id string) (*Node, bool) {
+	members.mu.RLock()
+	defer members.mu.RUnlock()
+
+	node, ok := members.nodes[id]
+	return node, ok
+}
+
+// Nodes returns all nodes in the cluster
+func Nodes() []*Node {
+	members.mu.RLock()
+	defer members.mu.RUnlock()
+
+	nodes := make([]*Node, 0, len(members.nodes))
+	for _, n := range members.nodes {
+		nodes = append(nodes, n)
+	}
+	return nodes
+}
+
+func emit(callbacks []NodeHandler, node *Node) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Printf("nano/cluster: node event callback panic, ID=%s, Error=%v", node.ID, err)
+		}
+	}()
+
+	for _, fn := range callbacks {
+		fn(node)
+	}
+}
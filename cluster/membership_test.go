@@ -0,0 +1,28 @@
+package cluster
+
+import "testing"
+
+func TestMembership(t *testing.T) {
+	var joined, left []string
+	OnNodeJoin(func(node *Node) { joined = append(joined, node.ID) })
+	OnNodeLeave(func(node *Node) { left = append(left, node.ID) })
+
+	Join(&Node{ID: "m1", Metadata: map[string]string{"shard": "1"}})
+	Join(&Node{ID: "m2"})
+	Join(&Node{ID: "m1", Metadata: map[string]string{"shard": "2"}})
+	if len(joined) != 2 || len(Nodes()) != 2 {
+		t.Fatalf("expect 2 joined nodes, got: %v", joined)
+	}
+
+	n, ok := Member("m1")
+	if !ok || n.Metadata["shard"] != "2" {
+		t.Fatal("node metadata should be updated")
+	}
+
+	Leave("m1")
+	Leave("m1")
+	if len(left) != 1 || left[0] != "m1" || len(Nodes()) != 1 {
+		t.Fatalf("expect m1 left, got: %v", left)
+	}
+	Leave("m2")
+}
@@ -0,0 +1,110 @@
+// Copyright (c) nano Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cluster
+
+import (
+	"sync"
+	"time"
+)
+
+type (
+	// RateLimiter limits the events of a key(eg: uid) in the whole cluster,
+	// implementations coordinate the counters across nodes so that a limit
+	// still holds when the player reconnects through another gate.
+	RateLimiter interface {
+		// Allow reports whether an event of key may happen now
+		Allow(key string) (bool, error)
+	}
+
+	// AdjustableRateLimiter is a RateLimiter which limit could be adjusted
+	// at runtime, eg: by admin console
+	AdjustableRateLimiter interface {
+		RateLimiter
+		SetLimit(limit int)
+	}
+
+	// fixed window counter
+	window struct {
+		start int64 // window start unix nano
+		count int
+	}
+
+	memoryRateLimiter struct {
+		mu      sync.Mutex
+		limit   int
+		window  time.Duration
+		windows map[string]*window
+		gcAt    int64 // last gc unix nano
+	}
+)
+
+// NewMemoryRateLimiter returns a RateLimiter which allows limit events of a
+// key in every window, counters are kept in current process memory.
+func NewMemoryRateLimiter(limit int, w time.Duration) RateLimiter {
+	if limit < 1 || w <= 0 {
+		panic("nano/cluster: invalid rate limit")
+	}
+
+	return &memoryRateLimiter{
+		limit:   limit,
+		window:  w,
+		windows: make(map[string]*window),
+		gcAt:    time.Now().UnixNano(),
+	}
+}
+
+// SetLimit implements the AdjustableRateLimiter interface
+func (l *memoryRateLimiter) SetLimit(limit int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.limit = limit
+}
+
+func (l *memoryRateLimiter) Allow(key string) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now().UnixNano()
+	start := now - now%int64(l.window)
+
+	// release expired windows
+	if now-l.gcAt > int64(l.window) {
+		for k, w := range l.windows {
+			if w.start < start {
+				delete(l.windows, k)
+			}
+		}
+		l.gcAt = now
+	}
+
+	w, ok := l.windows[key]
+	if !ok || w.start != start {
+		w = &window{start: start}
+		l.windows[key] = w
+	}
+
+	if w.count >= l.limit {
+		return false, nil
+	}
+	w.count++
+	return true, nil
+}
@@ -0,0 +1,33 @@
+package cluster
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryRateLimiter(t *testing.T) {
+	l := NewMemoryRateLimiter(3, time.Hour)
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("uid:1"); !ok {
+			t.Fatalf("event %d should be allowed", i)
+		}
+	}
+	if ok, _ := l.Allow("uid:1"); ok {
+		t.Fatal("event should be limited")
+	}
+	if ok, _ := l.Allow("uid:2"); !ok {
+		t.Fatal("other key should not be limited")
+	}
+}
+
+func TestMemoryRateLimiter_SetLimit(t *testing.T) {
+	l := NewMemoryRateLimiter(1, time.Hour).(AdjustableRateLimiter)
+	l.Allow("uid:1")
+	if ok, _ := l.Allow("uid:1"); ok {
+		t.Fatal("event should be limited")
+	}
+	l.SetLimit(2)
+	if ok, _ := l.Allow("uid:1"); !ok {
+		t.Fatal("event should be allowed after limit raised")
+	}
+}
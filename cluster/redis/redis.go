@@ -0,0 +1,345 @@
+// Copyright (c) nano Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package redis implements a Redis based cluster backplane, which provides
+// node discovery, the UID registry and the message bus(cross-node push,
+// distributed groups, admin) with a single dependency.
+package redis
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/kensomanpow/nano/cluster"
+)
+
+// DefaultTTL is the default time to live of node announcements.
+const DefaultTTL = 10 * time.Second
+
+// count hint of SCAN, when listing node announcements
+const scanCount = 100
+
+// compare and delete, used to deregister uid only if location matched
+const deregisterScript = `
+if redis.call("HGET", KEYS[1], ARGV[1]) == ARGV[2] then
+	return redis.call("HDEL", KEYS[1], ARGV[1])
+end
+return 0`
+
+// fixed window counter, returns the count of current window
+const rateLimitScript = `
+local count = redis.call("INCR", KEYS[1])
+if count == 1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return count`
+
+// set the winner if absent, returns the winner of the election
+const electScript = `
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return ARGV[1]
+end
+return redis.call("GET", KEYS[1])`
+
+// client is the subset of *redis.Client used by Backplane, so that the
+// backplane could be tested without Redis
+type client interface {
+	HSet(key, field string, value interface{}) *redis.BoolCmd
+	HGet(key, field string) *redis.StringCmd
+	Eval(script string, keys []string, args ...interface{}) *redis.Cmd
+	Publish(channel string, message interface{}) *redis.IntCmd
+	Subscribe(channels ...string) *redis.PubSub
+	Set(key string, value interface{}, expiration time.Duration) *redis.StatusCmd
+	Get(key string) *redis.StringCmd
+	Del(keys ...string) *redis.IntCmd
+	Scan(cursor uint64, match string, count int64) *redis.ScanCmd
+}
+
+// Backplane implements cluster.Registry, cluster.Bus and cluster.Elector on
+// Redis, and keeps the cluster membership updated by announcing local node
+// and watching announcements of other nodes.
+type Backplane struct {
+	client client
+	prefix string        // key and channel prefix
+	ttl    time.Duration // node announcement ttl
+
+	mu       sync.RWMutex
+	pubsub   *redis.PubSub
+	handlers map[string][]func([]byte) // channel map to handlers
+	die      chan struct{}
+	stopOnce sync.Once // close die only once
+}
+
+// New returns a backplane, all keys and channels are prefixed with prefix so
+// that multiple clusters could share the same Redis.
+func New(client *redis.Client, prefix string) *Backplane {
+	return newBackplane(client, prefix)
+}
+
+func newBackplane(c client, prefix string) *Backplane {
+	return &Backplane{
+		client:   c,
+		prefix:   prefix,
+		ttl:      DefaultTTL,
+		handlers: make(map[string][]func([]byte)),
+		die:      make(chan struct{}),
+	}
+}
+
+// SetTTL set the node announcement ttl, node will be considered left if its
+// announcement has not been refreshed in ttl
+func (b *Backplane) SetTTL(ttl time.Duration) {
+	b.ttl = ttl
+}
+
+func (b *Backplane) key(parts ...string) string {
+	return b.prefix + ":" + strings.Join(parts, ":")
+}
+
+// Register implements the cluster.Registry interface
+func (b *Backplane) Register(uid int64, loc cluster.Location) error {
+	data, err := json.Marshal(loc)
+	if err != nil {
+		return err
+	}
+	return b.client.HSet(b.key("uids"), fmt.Sprint(uid), data).Err()
+}
+
+// Deregister implements the cluster.Registry interface
+func (b *Backplane) Deregister(uid int64, loc cluster.Location) error {
+	data, err := json.Marshal(loc)
+	if err != nil {
+		return err
+	}
+	return b.client.Eval(deregisterScript, []string{b.key("uids")}, fmt.Sprint(uid), string(data)).Err()
+}
+
+// Lookup implements the cluster.Registry interface
+func (b *Backplane) Lookup(uid int64) (cluster.Location, error) {
+	loc := cluster.Location{}
+	data, err := b.client.HGet(b.key("uids"), fmt.Sprint(uid)).Bytes()
+	if err == redis.Nil {
+		return loc, cluster.ErrUIDNotFound
+	}
+	if err != nil {
+		return loc, err
+	}
+
+	err = json.Unmarshal(data, &loc)
+	return loc, err
+}
+
+// Publish implements the cluster.Bus interface
+func (b *Backplane) Publish(subject string, data []byte) error {
+	return b.client.Publish(b.key(subject), data).Err()
+}
+
+// Subscribe implements the cluster.Bus interface
+func (b *Backplane) Subscribe(subject string, handler func(data []byte)) error {
+	channel := b.key(subject)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.handlers[channel]; !ok {
+		if b.pubsub == nil {
+			b.pubsub = b.client.Subscribe(channel)
+			go b.receive(b.pubsub.Channel())
+		} else if err := b.pubsub.Subscribe(channel); err != nil {
+			return err
+		}
+	}
+	b.handlers[channel] = append(b.handlers[channel], handler)
+	return nil
+}
+
+func (b *Backplane) receive(ch <-chan *redis.Message) {
+	for msg := range ch {
+		b.mu.RLock()
+		handlers := b.handlers[msg.Channel]
+		b.mu.RUnlock()
+
+		for _, h := range handlers {
+			deliver(msg.Channel, h, []byte(msg.Payload))
+		}
+	}
+}
+
+func deliver(channel string, handler func([]byte), data []byte) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Printf("nano/redis: handler panic, Channel=%s, Error=%v", channel, err)
+		}
+	}()
+
+	handler(data)
+}
+
+// Start announces local node periodically and watches the announcements of
+// all nodes, the cluster membership is updated via cluster.Join/Leave
+func (b *Backplane) Start(local *cluster.Node) error {
+	if err := b.announce(local); err != nil {
+		return err
+	}
+	b.watch()
+
+	go func() {
+		ticker := time.NewTicker(b.ttl / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := b.announce(local); err != nil {
+					log.Printf("nano/redis: announce node failed, Error=%s", err.Error())
+				}
+				b.watch()
+
+			case <-b.die:
+				b.client.Del(b.key("nodes", local.ID))
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop stops announcing local node and closes the subscriptions, it's safe
+// to call Stop more than once
+func (b *Backplane) Stop() {
+	b.stopOnce.Do(func() {
+		close(b.die)
+
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if b.pubsub != nil {
+			b.pubsub.Close()
+		}
+	})
+}
+
+func (b *Backplane) announce(local *cluster.Node) error {
+	data, err := json.Marshal(local)
+	if err != nil {
+		return err
+	}
+	return b.client.Set(b.key("nodes", local.ID), data, b.ttl).Err()
+}
+
+// nodeKeys lists the keys of node announcements incrementally with SCAN, so
+// that Redis is not blocked as KEYS does
+func (b *Backplane) nodeKeys() ([]string, error) {
+	var (
+		keys   []string
+		cursor uint64
+	)
+	for {
+		page, next, err := b.client.Scan(cursor, b.key("nodes", "*"), scanCount).Result()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, page...)
+		if next == 0 {
+			return keys, nil
+		}
+		cursor = next
+	}
+}
+
+// watch synchronizes the cluster membership with node announcements
+func (b *Backplane) watch() {
+	keys, err := b.nodeKeys()
+	if err != nil {
+		log.Printf("nano/redis: list nodes failed, Error=%s", err.Error())
+		return
+	}
+
+	alive := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		data, err := b.client.Get(key).Bytes()
+		if err != nil {
+			continue // expired
+		}
+
+		node := &cluster.Node{}
+		if err := json.Unmarshal(data, node); err != nil {
+			log.Printf("nano/redis: invalid node announcement, Key=%s, Error=%s", key, err.Error())
+			continue
+		}
+		alive[node.ID] = true
+		cluster.Join(node)
+	}
+
+	for _, node := range cluster.Nodes() {
+		if !alive[node.ID] {
+			cluster.Leave(node.ID)
+		}
+	}
+}
+
+type rateLimiter struct {
+	b      *Backplane
+	limit  int64
+	window time.Duration
+}
+
+// NewRateLimiter returns a cluster.RateLimiter which allows limit events of
+// a key in every window, counters are shared by all nodes via Redis.
+func (b *Backplane) NewRateLimiter(limit int, window time.Duration) cluster.RateLimiter {
+	return &rateLimiter{b: b, limit: int64(limit), window: window}
+}
+
+// SetLimit implements the cluster.AdjustableRateLimiter interface
+func (l *rateLimiter) SetLimit(limit int) {
+	atomic.StoreInt64(&l.limit, int64(limit))
+}
+
+func (l *rateLimiter) Allow(key string) (bool, error) {
+	now := time.Now().UnixNano()
+	start := now - now%int64(l.window)
+	k := l.b.key("ratelimit", key, fmt.Sprint(start))
+
+	count, err := l.b.client.Eval(rateLimitScript, []string{k}, int64(l.window/time.Millisecond)).Int64()
+	if err != nil {
+		return false, err
+	}
+	return count <= atomic.LoadInt64(&l.limit), nil
+}
+
+// Elect implements the cluster.Elector interface
+func (b *Backplane) Elect(key, node string, ttl time.Duration) (bool, error) {
+	ms := int64(ttl / time.Millisecond)
+	if ms < 1 {
+		ms = 1
+	}
+
+	winner, err := b.client.Eval(electScript, []string{b.key("elect", key)}, node, ms).String()
+	if err != nil {
+		return false, err
+	}
+	return winner == node, nil
+}
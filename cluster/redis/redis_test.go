@@ -0,0 +1,253 @@
+package redis
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/kensomanpow/nano/cluster"
+)
+
+// fakeClient implements client in memory, the scripts of backplane are
+// executed natively
+type fakeClient struct {
+	mu      sync.Mutex
+	strings map[string]string
+	hashes  map[string]map[string]string
+	scans   int // SCAN calls
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{strings: map[string]string{}, hashes: map[string]map[string]string{}}
+}
+
+func (c *fakeClient) HSet(key, field string, value interface{}) *redis.BoolCmd {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	h, ok := c.hashes[key]
+	if !ok {
+		h = map[string]string{}
+		c.hashes[key] = h
+	}
+	_, exists := h[field]
+	h[field] = fmt.Sprintf("%s", value)
+	return redis.NewBoolResult(!exists, nil)
+}
+
+func (c *fakeClient) HGet(key, field string) *redis.StringCmd {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	v, ok := c.hashes[key][field]
+	if !ok {
+		return redis.NewStringResult("", redis.Nil)
+	}
+	return redis.NewStringResult(v, nil)
+}
+
+func (c *fakeClient) Eval(script string, keys []string, args ...interface{}) *redis.Cmd {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch script {
+	case deregisterScript:
+		field, value := fmt.Sprint(args[0]), fmt.Sprint(args[1])
+		if c.hashes[keys[0]][field] == value {
+			delete(c.hashes[keys[0]], field)
+			return redis.NewCmdResult(int64(1), nil)
+		}
+		return redis.NewCmdResult(int64(0), nil)
+
+	case rateLimitScript:
+		var count int64
+		fmt.Sscan(c.strings[keys[0]], &count)
+		count++
+		c.strings[keys[0]] = fmt.Sprint(count)
+		return redis.NewCmdResult(count, nil)
+
+	case electScript:
+		if winner, ok := c.strings[keys[0]]; ok {
+			return redis.NewCmdResult(winner, nil)
+		}
+		c.strings[keys[0]] = fmt.Sprint(args[0])
+		return redis.NewCmdResult(args[0], nil)
+	}
+	return redis.NewCmdResult(nil, fmt.Errorf("unknown script"))
+}
+
+func (c *fakeClient) Publish(channel string, message interface{}) *redis.IntCmd {
+	return redis.NewIntResult(0, nil)
+}
+
+func (c *fakeClient) Subscribe(channels ...string) *redis.PubSub {
+	panic("fakeClient: subscribe not supported")
+}
+
+func (c *fakeClient) Set(key string, value interface{}, expiration time.Duration) *redis.StatusCmd {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.strings[key] = fmt.Sprintf("%s", value)
+	return redis.NewStatusResult("OK", nil)
+}
+
+func (c *fakeClient) Get(key string) *redis.StringCmd {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	v, ok := c.strings[key]
+	if !ok {
+		return redis.NewStringResult("", redis.Nil)
+	}
+	return redis.NewStringResult(v, nil)
+}
+
+func (c *fakeClient) Del(keys ...string) *redis.IntCmd {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var n int64
+	for _, key := range keys {
+		if _, ok := c.strings[key]; ok {
+			delete(c.strings, key)
+			n++
+		}
+	}
+	return redis.NewIntResult(n, nil)
+}
+
+// Scan returns one key in every call, so that the cursor is iterated
+func (c *fakeClient) Scan(cursor uint64, match string, count int64) *redis.ScanCmd {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.scans++
+	var keys []string
+	for key := range c.strings {
+		if ok, _ := path.Match(match, key); ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	if int(cursor) >= len(keys) {
+		return redis.NewScanCmdResult(nil, 0, nil)
+	}
+	next := cursor + 1
+	if int(next) == len(keys) {
+		next = 0
+	}
+	return redis.NewScanCmdResult(keys[cursor:cursor+1], next, nil)
+}
+
+func TestBackplane_Registry(t *testing.T) {
+	b := newBackplane(newFakeClient(), "test")
+
+	if _, err := b.Lookup(1); err != cluster.ErrUIDNotFound {
+		t.Fatalf("expect uid not found, got %v", err)
+	}
+
+	loc := cluster.Location{Node: "n1", SessionID: 10}
+	if err := b.Register(1, loc); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := b.Lookup(1); err != nil || got != loc {
+		t.Fatalf("expect %+v, got %+v, %v", loc, got, err)
+	}
+
+	// deregistered only if the location matched
+	if err := b.Deregister(1, cluster.Location{Node: "n2", SessionID: 10}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Lookup(1); err != nil {
+		t.Fatal("uid should not be deregistered by other location")
+	}
+	if err := b.Deregister(1, loc); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Lookup(1); err != cluster.ErrUIDNotFound {
+		t.Fatalf("expect uid not found, got %v", err)
+	}
+}
+
+func TestBackplane_Watch(t *testing.T) {
+	c := newFakeClient()
+	b := newBackplane(c, "test")
+	defer func() {
+		for _, node := range cluster.Nodes() {
+			cluster.Leave(node.ID)
+		}
+	}()
+
+	for _, id := range []string{"w1", "w2", "w3"} {
+		if err := b.announce(&cluster.Node{ID: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b.watch()
+	if len(cluster.Nodes()) != 3 {
+		t.Fatalf("expect 3 nodes, got %d", len(cluster.Nodes()))
+	}
+	if c.scans < 3 {
+		t.Fatalf("nodes should be listed by SCAN cursor, got %d scans", c.scans)
+	}
+
+	// announcement expired
+	c.Del(b.key("nodes", "w2"))
+	b.watch()
+	if _, ok := cluster.Member("w2"); ok || len(cluster.Nodes()) != 2 {
+		t.Fatal("node w2 should leave after announcement expired")
+	}
+}
+
+func TestBackplane_Stop(t *testing.T) {
+	b := newBackplane(newFakeClient(), "test")
+	defer func() {
+		for _, node := range cluster.Nodes() {
+			cluster.Leave(node.ID)
+		}
+	}()
+
+	if err := b.Start(&cluster.Node{ID: "s1"}); err != nil {
+		t.Fatal(err)
+	}
+	b.Stop()
+	b.Stop()
+}
+
+func TestBackplane_Elect(t *testing.T) {
+	b := newBackplane(newFakeClient(), "test")
+
+	if ok, err := b.Elect("cron", "n1", time.Second); err != nil || !ok {
+		t.Fatalf("n1 should be elected, got %v, %v", ok, err)
+	}
+	if ok, err := b.Elect("cron", "n2", time.Second); err != nil || ok {
+		t.Fatalf("n2 should not be elected, got %v, %v", ok, err)
+	}
+	if ok, _ := b.Elect("cron", "n1", time.Second); !ok {
+		t.Fatal("winner should be elected again")
+	}
+}
+
+func TestBackplane_RateLimiter(t *testing.T) {
+	b := newBackplane(newFakeClient(), "test")
+	l := b.NewRateLimiter(2, time.Hour)
+
+	for i := 0; i < 2; i++ {
+		if ok, err := l.Allow("uid"); err != nil || !ok {
+			t.Fatalf("event %d should be allowed, got %v, %v", i, ok, err)
+		}
+	}
+	if ok, _ := l.Allow("uid"); ok {
+		t.Fatal("event over limit should not be allowed")
+	}
+
+	l.(cluster.AdjustableRateLimiter).SetLimit(4)
+	if ok, _ := l.Allow("uid"); !ok {
+		t.Fatal("event should be allowed after limit raised")
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright (c) nano Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package cluster contains the building blocks used to run nano on more than
+// one node: the UID location registry and the interfaces used to reach
+// sessions that live on other nodes.
+package cluster
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrUIDNotFound represents the uid has no location in the registry.
+var ErrUIDNotFound = errors.New("cluster: uid not found in registry")
+
+type (
+	// Location represents where a bound session lives in the cluster.
+	Location struct {
+		Node      string // node id which hold the session
+		SessionID int64  // session id on the node
+	}
+
+	// Registry maintains the UID to Location mapping of the whole cluster, it
+	// is updated when a session bind a UID and when the session closed. The
+	// registry could be backed by memory (single node), Redis, etcd, etc.
+	Registry interface {
+		// Register records the location of uid, override the old location
+		Register(uid int64, loc Location) error
+
+		// Deregister removes the location of uid only if it still points to
+		// loc, so a stale close will not remove a newer login on other node
+		Deregister(uid int64, loc Location) error
+
+		// Lookup returns the location of uid
+		Lookup(uid int64) (Location, error)
+	}
+
+	// Forwarder delivers a push message to a UID which session lives on a
+	// remote node.
+	Forwarder interface {
+		Forward(node string, uid int64, route string, data []byte) error
+	}
+)
+
+type memoryRegistry struct {
+	mu        sync.RWMutex
+	locations map[int64]Location
+}
+
+// NewMemoryRegistry returns a Registry which stores all locations in current
+// process memory, it's suitable for single node deployment and tests.
+func NewMemoryRegistry() Registry {
+	return &memoryRegistry{locations: make(map[int64]Location)}
+}
+
+func (r *memoryRegistry) Register(uid int64, loc Location) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.locations[uid] = loc
+	return nil
+}
+
+func (r *memoryRegistry) Deregister(uid int64, loc Location) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if cur, ok := r.locations[uid]; ok && cur == loc {
+		delete(r.locations, uid)
+	}
+	return nil
+}
+
+func (r *memoryRegistry) Lookup(uid int64) (Location, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	loc, ok := r.locations[uid]
+	if !ok {
+		return Location{}, ErrUIDNotFound
+	}
+	return loc, nil
+}
@@ -0,0 +1,31 @@
+package cluster
+
+import "testing"
+
+func TestMemoryRegistry(t *testing.T) {
+	r := NewMemoryRegistry()
+
+	if _, err := r.Lookup(1); err != ErrUIDNotFound {
+		t.Fatalf("expect: %v, got: %v", ErrUIDNotFound, err)
+	}
+
+	old := Location{Node: "gate-1", SessionID: 10}
+	cur := Location{Node: "gate-2", SessionID: 20}
+	r.Register(1, old)
+	r.Register(1, cur)
+
+	// stale deregister should not remove the newer location
+	r.Deregister(1, old)
+	loc, err := r.Lookup(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc != cur {
+		t.Fatalf("expect: %v, got: %v", cur, loc)
+	}
+
+	r.Deregister(1, cur)
+	if _, err := r.Lookup(1); err != ErrUIDNotFound {
+		t.Fatalf("expect: %v, got: %v", ErrUIDNotFound, err)
+	}
+}
@@ -0,0 +1,51 @@
+package nano
+
+import (
+	"testing"
+
+	"github.com/kensomanpow/nano/cluster"
+	"github.com/kensomanpow/nano/serialize/json"
+)
+
+type testForwarder struct {
+	node  string
+	uid   int64
+	route string
+	data  []byte
+}
+
+func (f *testForwarder) Forward(node string, uid int64, route string, data []byte) error {
+	f.node, f.uid, f.route, f.data = node, uid, route, data
+	return nil
+}
+
+func TestPushToUID(t *testing.T) {
+	SetSerializer(json.NewSerializer())
+	r := cluster.NewMemoryRegistry()
+	f := &testForwarder{}
+	SetUIDRegistry(r)
+	SetForwarder(f)
+	defer func() {
+		SetUIDRegistry(nil)
+		SetForwarder(nil)
+	}()
+
+	const uid = 10086
+	if IsOnline(uid) {
+		t.Fatal("uid should be offline")
+	}
+	if err := PushToUID(uid, "test.push", []byte("hello")); err != cluster.ErrUIDNotFound {
+		t.Fatalf("expect: %v, got: %v", cluster.ErrUIDNotFound, err)
+	}
+
+	r.Register(uid, cluster.Location{Node: "remote", SessionID: 1})
+	if !IsOnline(uid) {
+		t.Fatal("uid should be online")
+	}
+	if err := PushToUID(uid, "test.push", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if f.node != "remote" || f.uid != uid || f.route != "test.push" || string(f.data) != "hello" {
+		t.Fatalf("unexpected forward: %+v", f)
+	}
+}
@@ -0,0 +1,143 @@
+// Command nano-bench spins up simulated clients executing a scenario against
+// a nano server, and reports the latency percentiles and error rates, eg:
+//
+//	nano-bench --addr 127.0.0.1:3250 --clients 1000 --ramp 10s --duration 1m --scenario chat.json
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/kensomanpow/nano"
+	"github.com/kensomanpow/nano/bench"
+	"github.com/kensomanpow/nano/client"
+	"github.com/urfave/cli"
+)
+
+func main() {
+	app := cli.NewApp()
+
+	app.Name = "nano-bench"
+	app.Author = "nano authors"
+	app.Version = "0.0.1"
+	app.Copyright = "nano authors reserved"
+	app.Usage = "load testing tool of nano server"
+
+	// flags
+	app.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:  "addr",
+			Value: "127.0.0.1:3250",
+			Usage: "TCP address of server",
+		},
+		cli.StringFlag{
+			Name:  "ws",
+			Usage: "WebSocket URL of server, eg: ws://127.0.0.1:3250/nano, takes precedence over addr",
+		},
+		cli.StringFlag{
+			Name:  "scenario",
+			Usage: "JSON file of scenario",
+		},
+		cli.IntFlag{
+			Name:  "clients",
+			Value: 100,
+			Usage: "number of simulated clients",
+		},
+		cli.DurationFlag{
+			Name:  "ramp",
+			Usage: "clients are connected evenly in the duration",
+		},
+		cli.DurationFlag{
+			Name:  "duration",
+			Usage: "scenario is repeated until the duration elapsed, zero runs once",
+		},
+		cli.DurationFlag{
+			Name:  "timeout",
+			Usage: "timeout of handshake and requests",
+		},
+		cli.StringFlag{
+			Name:  "token",
+			Usage: "handshake token, {{id}} is replaced with the client index",
+		},
+		cli.StringFlag{
+			Name:  "challenge-secret",
+			Usage: "secret to answer the handshake challenge",
+		},
+		cli.BoolFlag{
+			Name:  "json",
+			Usage: "print the report as JSON",
+		},
+	}
+
+	app.Action = run
+
+	if err := app.Run(os.Args); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(c *cli.Context) error {
+	if c.String("scenario") == "" {
+		return errors.New("scenario is required")
+	}
+	f, err := os.Open(c.String("scenario"))
+	if err != nil {
+		return err
+	}
+	scenario, err := bench.LoadScenario(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	config := client.Config{Timeout: c.Duration("timeout")}
+	if secret := c.String("challenge-secret"); secret != "" {
+		config.ChallengeSecret = []byte(secret)
+	}
+	dial := func(id int) (*client.Client, error) {
+		cfg := config
+		cfg.Handshake = nano.HandShakeData{Token: strings.Replace(c.String("token"), "{{id}}", strconv.Itoa(id), -1)}
+		if url := c.String("ws"); url != "" {
+			return client.DialWS(url, nil, cfg)
+		}
+		return client.Dial(c.String("addr"), cfg)
+	}
+
+	// stops and reports on interrupt
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sg := make(chan os.Signal, 1)
+	signal.Notify(sg, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sg
+		cancel()
+	}()
+
+	report, err := bench.Run(ctx, bench.Config{
+		Clients:  c.Int("clients"),
+		RampUp:   c.Duration("ramp"),
+		Duration: c.Duration("duration"),
+		Timeout:  c.Duration("timeout"),
+		Scenario: scenario,
+		Dial:     dial,
+	})
+	if err != nil {
+		return err
+	}
+
+	if c.Bool("json") {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	fmt.Print(report)
+	return nil
+}
@@ -0,0 +1,143 @@
+package nano
+
+import (
+	"sync"
+
+	"github.com/kensomanpow/nano/internal/codec"
+	"github.com/kensomanpow/nano/internal/packet"
+	"github.com/kensomanpow/nano/session"
+)
+
+type (
+	// PacketType represents the type of network packet
+	PacketType = packet.Type
+
+	// Packet represents a network packet
+	Packet = packet.Packet
+
+	// Codec encodes packets to the wire format and creates decoders, a
+	// custom codec makes nano interoperate with a proprietary framing while
+	// keeping the session layer, eg: the framing of a legacy client.
+	Codec interface {
+		// Encode encodes a packet to network bytes slice
+		Encode(typ PacketType, data []byte) ([]byte, error)
+
+		// NewDecoder returns a decoder for a new connection
+		NewDecoder() PacketDecoder
+	}
+
+	// PacketDecoder decodes the network bytes slice of a connection to
+	// packets, the bytes of an incomplete packet should be kept until the
+	// remaining bytes arrived. The returned packets must own their data,
+	// which must not alias the read buffer or be reused by decoder, because
+	// packets are processed asynchronously. A decoder returns
+	// ErrPacketSizeExceed to kick the connection when a packet is too large.
+	PacketDecoder interface {
+		Decode(data []byte) ([]*Packet, error)
+	}
+
+	// PacketWriter writes packets to a connection
+	PacketWriter interface {
+		WritePacket(typ PacketType, data []byte) error
+	}
+
+	// PacketHandler handles the custom packets, w writes packets back to the
+	// connection which the packet received from
+	PacketHandler func(s *session.Session, w PacketWriter, data []byte) error
+
+	// defaultCodec implements the pomelo compatible framing
+	defaultCodec struct{}
+)
+
+// Packet types
+const (
+	PacketHandshake    PacketType = packet.Handshake
+	PacketHandshakeAck PacketType = packet.HandshakeAck
+	PacketHeartbeat    PacketType = packet.Heartbeat
+	PacketData         PacketType = packet.Data
+	PacketKick         PacketType = packet.Kick
+	PacketFragment     PacketType = packet.Fragment
+	PacketDictionary   PacketType = packet.Dictionary
+
+	// MinCustomPacketType is the min type of custom packets, the smaller
+	// types are reserved by nano
+	MinCustomPacketType PacketType = 0x10
+)
+
+var (
+	muPacketHandlers sync.RWMutex
+
+	// custom packet handlers, type map to handler
+	packetHandlers = map[PacketType]PacketHandler{}
+)
+
+// ErrPacketSizeExceed represents a packet exceeds the max packet size
+var ErrPacketSizeExceed = codec.ErrPacketSizeExcced
+
+// DefaultCodec is the codec used by default, the packets are framed as a 1
+// byte type and a 3 bytes big endian length followed by data
+var DefaultCodec Codec = defaultCodec{}
+
+func (defaultCodec) Encode(typ PacketType, data []byte) ([]byte, error) {
+	return codec.Encode(typ, data)
+}
+
+func (defaultCodec) NewDecoder() PacketDecoder {
+	d := codec.NewDecoder()
+	d.SetMaxPacketSize(defaultApp.env.maxPacketSize)
+	return d
+}
+
+// RegisterPacket registers a handler for the custom packets of typ, custom
+// packets are handled at the packet layer without message routing, eg: low
+// level ping probes and bandwidth tests. The type must not be less than
+// MinCustomPacketType, and the handler must not be nil
+func RegisterPacket(typ PacketType, h PacketHandler) error {
+	if typ < MinCustomPacketType {
+		return ErrReservedPacketType
+	}
+	if h == nil {
+		return ErrNilPacketHandler
+	}
+
+	muPacketHandlers.Lock()
+	defer muPacketHandlers.Unlock()
+
+	codec.RegisterType(typ)
+	packetHandlers[typ] = h
+	return nil
+}
+
+// packetHandler returns the handler of custom packets of typ
+func packetHandler(typ PacketType) (PacketHandler, bool) {
+	muPacketHandlers.RLock()
+	defer muPacketHandlers.RUnlock()
+
+	h, ok := packetHandlers[typ]
+	return h, ok
+}
+
+// encodeFragments encodes data to a data packet, the data longer than size is
+// split into fragment packets followed by a data packet that carries the last
+// part, so that every packet is not longer than size
+func encodeFragments(c Codec, data []byte, size int) ([]byte, error) {
+	if size <= 0 || len(data) <= size {
+		return c.Encode(PacketData, data)
+	}
+
+	var buf []byte
+	for len(data) > size {
+		p, err := c.Encode(PacketFragment, data[:size])
+		if err != nil {
+			return nil, err
+		}
+		buf = append(buf, p...)
+		data = data[size:]
+	}
+
+	p, err := c.Encode(PacketData, data)
+	if err != nil {
+		return nil, err
+	}
+	return append(buf, p...), nil
+}
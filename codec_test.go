@@ -0,0 +1,88 @@
+package nano
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kensomanpow/nano/session"
+)
+
+func TestEncodeFragments(t *testing.T) {
+	data := []byte("hello world")
+	buf, err := encodeFragments(DefaultCodec, data, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	packets, err := DefaultCodec.NewDecoder().Decode(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packets) != 3 {
+		t.Fatalf("expect 3 packets, got %d", len(packets))
+	}
+
+	var joined []byte
+	for i, p := range packets {
+		expect := PacketFragment
+		if i == len(packets)-1 {
+			expect = PacketData
+		}
+		if p.Type != expect || p.Length > 4 {
+			t.Fatalf("unexpected packet: %v", p)
+		}
+		joined = append(joined, p.Data...)
+	}
+	if string(joined) != string(data) {
+		t.Fatalf("expect %s, got %s", data, joined)
+	}
+}
+
+func TestRegisterPacket(t *testing.T) {
+	if err := RegisterPacket(PacketKick, func(s *session.Session, w PacketWriter, data []byte) error { return nil }); err != ErrReservedPacketType {
+		t.Fatalf("expect %v, got %v", ErrReservedPacketType, err)
+	}
+	if err := RegisterPacket(MinCustomPacketType, nil); err != ErrNilPacketHandler {
+		t.Fatalf("expect %v, got %v", ErrNilPacketHandler, err)
+	}
+
+	ping := MinCustomPacketType + 1
+	err := RegisterPacket(ping, func(s *session.Session, w PacketWriter, data []byte) error {
+		return w.WritePacket(ping, data)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := newAgent(defaultApp, nil)
+	a.setStatus(statusWorking)
+	if err := defaultApp.handler.processPacket(a, &Packet{Type: ping, Data: []byte("probe")}); err != nil {
+		t.Fatal(err)
+	}
+
+	m := <-a.chSend
+	packets, err := DefaultCodec.NewDecoder().Decode(m.packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packets) != 1 || packets[0].Type != ping || string(packets[0].Data) != "probe" {
+		t.Fatalf("unexpected reply: %v", packets)
+	}
+}
+
+func TestMaxPacketSize_Kick(t *testing.T) {
+	app := NewApp()
+	app.SetMaxPacketSize(64)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ln, addr := listenLocal(t)
+	go app.Serve(ctx, ln, WithoutSignals())
+
+	// the kick packet is written by write goroutine before the connection
+	// closed
+	c := dialApp(t, addr)
+	defer c.conn.Close()
+	c.write(PacketHandshake, make([]byte, 128))
+	c.read(PacketKick)
+}
@@ -21,11 +21,10 @@
 package nano
 
 import (
-	"github.com/kensomanpow/nano/component"
-)
+	"sort"
+	"sync/atomic"
 
-var (
-	comps = make([]regComp, 0)
+	"github.com/kensomanpow/nano/component"
 )
 
 type regComp struct {
@@ -33,7 +32,28 @@ type regComp struct {
 	opts []component.Option
 }
 
-func startupComponents() {
+// sortComps sorts the components by priority, and keeps the registration
+// order of components with the same priority
+func (app *App) sortComps() {
+	sort.SliceStable(app.comps, func(i, j int) bool {
+		return component.Priority(app.comps[i].opts) < component.Priority(app.comps[j].opts)
+	})
+}
+
+// components returns a copy of the registered components
+func (app *App) components() []regComp {
+	app.muComps.RLock()
+	defer app.muComps.RUnlock()
+
+	return append([]regComp(nil), app.comps...)
+}
+
+func (app *App) startupComponents() {
+	app.muComps.Lock()
+	app.sortComps()
+	app.muComps.Unlock()
+	comps := app.components()
+
 	// component initialize hooks
 	for _, c := range comps {
 		c.comp.Init()
@@ -46,15 +66,43 @@ func startupComponents() {
 
 	// register all components
 	for _, c := range comps {
-		if err := handler.register(c.comp, c.opts); err != nil {
-			logger.Println(err.Error())
+		if err := app.handler.register(c.comp, c.opts); err != nil {
+			app.log().Println(err.Error())
 		}
 	}
 
-	handler.DumpServices()
+	app.handler.DumpServices()
+	atomic.StoreInt32(&app.running, 1)
+}
+
+// registerRuntime registers a component after application running, and
+// pushes the dictionary of new routes to connected clients. The component is
+// initialized only if its handlers are valid
+func (app *App) registerRuntime(comp component.Component, opts []component.Option) {
+	s, err := app.handler.newService(comp, opts)
+	if err != nil {
+		app.log().Println(err.Error())
+		return
+	}
+
+	comp.Init()
+	comp.AfterInit()
+
+	dict, err := app.handler.registerService(s)
+	if err != nil {
+		app.log().Println(err.Error())
+		return
+	}
+	app.muComps.Lock()
+	app.comps = append(app.comps, regComp{comp, opts})
+	app.sortComps()
+	app.muComps.Unlock()
+	app.pushDictionary(dict)
 }
 
-func shutdownComponents() {
+func (app *App) shutdownComponents() {
+	comps := app.components()
+
 	// reverse call `BeforeShutdown` hooks
 	length := len(comps)
 	for i := length - 1; i >= 0; i-- {
@@ -65,4 +113,11 @@ func shutdownComponents() {
 	for i := length - 1; i >= 0; i-- {
 		comps[i].comp.Shutdown()
 	}
+
+	// reverse call `AfterShutdown` hooks
+	for i := length - 1; i >= 0; i-- {
+		if c, ok := comps[i].comp.(component.AfterShutdowner); ok {
+			c.AfterShutdown()
+		}
+	}
 }
@@ -34,3 +34,6 @@ func (c *Base) BeforeShutdown() {}
 
 // Shutdown was called to shutdown the component.
 func (c *Base) Shutdown() {}
+
+// AfterShutdown was called after all components are shutdown.
+func (c *Base) AfterShutdown() {}
@@ -27,3 +27,19 @@ type Component interface {
 	BeforeShutdown()
 	Shutdown()
 }
+
+// Reloader is an optional interface of Component, Reload is called with the
+// new configuration of component at runtime, eg: to tune the drop rates or
+// rate limits without restart. Reload could be called concurrently with the
+// handlers of component, and the old configuration should be kept if it
+// returns an error.
+type Reloader interface {
+	Reload(config []byte) error
+}
+
+// AfterShutdowner is an optional interface of Component, AfterShutdown is
+// called after all components are shutdown, eg: to close the connections
+// which are used by other components in Shutdown.
+type AfterShutdowner interface {
+	AfterShutdown()
+}
@@ -4,6 +4,7 @@ type (
 	options struct {
 		name     string              // component name
 		nameFunc func(string) string // rename handler name
+		priority int                 // init order, shutdown in reverse
 	}
 
 	// Option used to customize handler
@@ -24,3 +25,21 @@ func WithNameFunc(fn func(string) string) Option {
 		opt.nameFunc = fn
 	}
 }
+
+// WithPriority set the priority of component, components are initialized in
+// ascending order of priority and shutdown in reverse order, the components
+// with the same priority keep the registration order. Default is zero
+func WithPriority(priority int) Option {
+	return func(opt *options) {
+		opt.priority = priority
+	}
+}
+
+// Priority returns the priority set by WithPriority in opts
+func Priority(opts []Option) int {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o.priority
+}
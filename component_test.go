@@ -0,0 +1,40 @@
+package nano
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kensomanpow/nano/component"
+)
+
+type orderComp struct {
+	component.Base
+	name string
+	log  *[]string
+}
+
+func (c *orderComp) Init()           { *c.log = append(*c.log, c.name+".Init") }
+func (c *orderComp) BeforeShutdown() { *c.log = append(*c.log, c.name+".BeforeShutdown") }
+func (c *orderComp) Shutdown()       { *c.log = append(*c.log, c.name+".Shutdown") }
+func (c *orderComp) AfterShutdown()  { *c.log = append(*c.log, c.name+".AfterShutdown") }
+
+func TestComponentOrder(t *testing.T) {
+	var log []string
+	app := NewApp()
+	app.Register(&orderComp{name: "Game", log: &log}, component.WithName("Game"))
+	app.Register(&orderComp{name: "DB", log: &log}, component.WithName("DB"), component.WithPriority(-1))
+	app.Register(&orderComp{name: "Room", log: &log}, component.WithName("Room"))
+
+	app.startupComponents()
+	app.shutdownComponents()
+
+	expect := []string{
+		"DB.Init", "Game.Init", "Room.Init",
+		"Room.BeforeShutdown", "Game.BeforeShutdown", "DB.BeforeShutdown",
+		"Room.Shutdown", "Game.Shutdown", "DB.Shutdown",
+		"Room.AfterShutdown", "Game.AfterShutdown", "DB.AfterShutdown",
+	}
+	if !reflect.DeepEqual(log, expect) {
+		t.Fatalf("unexpected order %v", log)
+	}
+}
@@ -0,0 +1,46 @@
+package nano
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+	"io/ioutil"
+)
+
+// ErrDecompressExceed represents the decompressed body exceeds the max message
+// size
+var ErrDecompressExceed = errors.New("decompressed message exceeds max size")
+
+// compress compresses the message body with DEFLATE
+func compress(data []byte) ([]byte, error) {
+	buf := bytes.NewBuffer(make([]byte, 0, len(data)/2))
+	w, err := flate.NewWriter(buf, flate.BestSpeed)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decompress decompresses the message body, the decompressed body must not
+// be longer than limit, so that a small malicious body could not exhaust
+// memory
+func decompress(data []byte, limit int) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(data))
+	defer r.Close()
+
+	out, err := ioutil.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(out) > limit {
+		return nil, ErrDecompressExceed
+	}
+	return out, nil
+}
@@ -0,0 +1,29 @@
+package nano
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCompress(t *testing.T) {
+	data := bytes.Repeat([]byte("inventory snapshot "), 100)
+	compressed, err := compress(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(compressed) >= len(data) {
+		t.Fatalf("data should be compressed, %d >= %d", len(compressed), len(data))
+	}
+
+	out, err := decompress(compressed, len(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Fatal("decompressed data mismatch")
+	}
+
+	if _, err := decompress(compressed, len(data)-1); err != ErrDecompressExceed {
+		t.Fatalf("expect %v, got %v", ErrDecompressExceed, err)
+	}
+}
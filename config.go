@@ -26,41 +26,72 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/kensomanpow/nano/cluster"
+	"github.com/kensomanpow/nano/internal/codec"
 	"github.com/kensomanpow/nano/session"
 )
 
 // VERSION returns current nano version
 var VERSION = "0.0.1"
 
-var (
-	// app represents the current server process
-	app = &struct {
-		name    string    // current application name
-		startAt time.Time // startup time
-	}{}
+// environment represents the environment of an application, includes work
+// path and config path etc.
+type environment struct {
+	wd                string                   // working path
+	die               chan bool                // wait for end application
+	heartbeat         time.Duration            // heartbeat internal
+	heartbeatMode     HeartbeatMode            // which side drives heartbeat
+	heartbeatMisses   int                      // missed heartbeats before disconnect
+	heartbeatTimeout  SessionClosedHandler     // called on heartbeat timeout
+	checkOrigin       func(*http.Request) bool // check origin when websocket enabled
+	wsPath            string                   // WebSocket path(eg: ws://127.0.0.1/wsPath)
+	wsUpgrade         WSUpgradeFunc            // validates WebSocket upgrade requests, nil if not set
+	wsSubprotocols    []string                 // WebSocket subprotocols supported by server
+	dict              map[string]uint16
+	authFunc          func(session *session.Session, handshakeData *HandShakeData) interface{}
+	sessionExpireSecs int
+	version           string
+	payload           interface{}
+	nodeID            string              // current node id in cluster
+	nodeLabels        map[string]string   // current node labels
+	registry          cluster.Registry    // cluster UID registry
+	forwarder         cluster.Forwarder   // deliver message to remote node
+	rateLimiter       cluster.RateLimiter // limit inbound messages per uid
+	elector           cluster.Elector     // elect node for singleton cron jobs
+	maxPacketSize     int                 // max inbound packet length
+	maxMessageSize    int                 // max length of reassembled fragments
+	compressThreshold int                 // min body length to compress, zero to disable
+	minProtocol       int                 // min protocol version supported
+	checksum          bool                // packet checksum supported
+	tracer            Tracer              // trace inbound requests
+	bandwidthQuota    *BandwidthQuota     // bandwidth quota of sessions
+	floodControl      *FloodControl       // flood control of sessions
+	connLimiter       atomic.Value        // *connLimiter limits concurrent connections, nil if not limited
+	ipLimiter         *ipLimiter          // limits concurrent connections per IP, nil if not limited
+	ipFilter          *IPFilter           // allow and deny lists of connections
+	replayGuard       *replayGuard        // rejects replayed handshakes, nil if not protected
+	banList           *BanList            // bans checked at handshake, nil if not set
+	challengeSecret   []byte              // shared secret of handshake challenge, nil if disabled
+	securitySink      SecuritySink        // receives security events
+	configWatcher     ConfigWatcher       // watches component configuration
+	shutdownTimeout   time.Duration       // max duration of shutdown hooks
+	handlerTimeout    time.Duration       // max duration of request handlers, zero to disable
+	handshakeTimeout  time.Duration       // max duration before handshake completed, zero to disable
+	kickGrace         time.Duration       // max duration to wait client closing after kicked
+	capabilities      Capability          // capabilities supported besides compression
+	debugAll          int32               // debug logs of all modules enabled for the application
+	debugModules      sync.Map            // debug enabled modules of the application, module map to struct{}
 
-	// env represents the environment of the current process, includes
-	// work path and config path etc.
-	env = &struct {
-		wd                string                   // working path
-		die               chan bool                // wait for end application
-		heartbeat         time.Duration            // heartbeat internal
-		checkOrigin       func(*http.Request) bool // check origin when websocket enabled
-		debug             bool                     // enable debug
-		wsPath            string                   // WebSocket path(eg: ws://127.0.0.1/wsPath)
-		dict              map[string]uint16
-		authFunc          func(session *session.Session, handshakeData *HandShakeData) interface{}
-		sessionExpireSecs int
-		version           string
-		payload           interface{}
+	// session closed handlers
+	muCallbacks sync.RWMutex           // protect callbacks, hooks & checks
+	callbacks   []SessionClosedHandler // callbacks that emitted on session closed
 
-		// session closed handlers
-		muCallbacks sync.RWMutex           // protect callbacks
-		callbacks   []SessionClosedHandler // callbacks that emitted on session closed
-	}{}
-)
+	shutdownHooks   []ShutdownHook   // called in order when application shutdown
+	readinessChecks []ReadinessCheck // called by readiness probe
+}
 
 type (
 	// SessionClosedHandler represents a callback that will be called when a session
@@ -68,13 +99,14 @@ type (
 	SessionClosedHandler func(session *session.Session)
 )
 
-// init default configs
-func init() {
-	// application initialize
-	app.name = strings.TrimLeft(filepath.Base(os.Args[0]), "/")
-	app.startAt = time.Now()
+// processName returns the name of current process
+func processName() string {
+	return strings.TrimLeft(filepath.Base(os.Args[0]), "/")
+}
 
-	// environment initialize
+// newEnvironment returns the environment with default configs
+func newEnvironment() *environment {
+	env := &environment{}
 	if wd, err := os.Getwd(); err != nil {
 		panic(err)
 	} else {
@@ -83,9 +115,15 @@ func init() {
 
 	env.die = make(chan bool)
 	env.heartbeat = 30 * time.Second
-	env.debug = false
+	env.heartbeatMisses = 2
 	env.dict = make(map[string]uint16)
-	env.muCallbacks = sync.RWMutex{}
 	env.checkOrigin = func(_ *http.Request) bool { return true }
 	env.sessionExpireSecs = 60 * 30
+	env.nodeID = processName()
+	env.maxPacketSize = codec.MaxPacketSize
+	env.maxMessageSize = 1024 * 1024
+	env.minProtocol = ProtocolLegacy
+	env.shutdownTimeout = 30 * time.Second
+	env.handshakeTimeout = 10 * time.Second
+	return env
 }
@@ -0,0 +1,164 @@
+package nano
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// RuntimeConfig represents the effective configuration of current node
+	RuntimeConfig struct {
+		Version      string            `json:"version"`
+		NodeID       string            `json:"nodeId"`
+		NodeLabels   map[string]string `json:"nodeLabels,omitempty"`
+		Debug        bool              `json:"debug"`                  // debug logs of all modules enabled
+		DebugModules []string          `json:"debugModules,omitempty"` // debug enabled modules
+		Heartbeat    HeartbeatConfig   `json:"heartbeat"`
+		Serializer   SerializerConfig  `json:"serializer"`
+		Protocol     ProtocolConfig    `json:"protocol"`
+		Limits       LimitsConfig      `json:"limits"`
+		Listener     *ListenerConfig   `json:"listener,omitempty"` // nil if not listening
+		Dictionary   map[string]uint16 `json:"dictionary"`
+	}
+
+	// HeartbeatConfig represents the heartbeat configuration
+	HeartbeatConfig struct {
+		Interval time.Duration `json:"interval"`
+		Mode     string        `json:"mode"`
+		Misses   int           `json:"misses"`
+	}
+
+	// SerializerConfig represents the type names of serializers
+	SerializerConfig struct {
+		Application string `json:"application"`
+		System      string `json:"system"` // empty if system payloads are JSON
+	}
+
+	// ProtocolConfig represents the negotiable protocol features
+	ProtocolConfig struct {
+		MinVersion        int  `json:"minVersion"`
+		MaxVersion        int  `json:"maxVersion"`
+		CompressThreshold int  `json:"compressThreshold"`
+		Checksum          bool `json:"checksum"`
+	}
+
+	// LimitsConfig represents the limits of sessions
+	LimitsConfig struct {
+		MaxPacketSize    int           `json:"maxPacketSize"`
+		MaxMessageSize   int           `json:"maxMessageSize"`
+		SessionExpire    time.Duration `json:"sessionExpire"`
+		HandshakeTimeout time.Duration `json:"handshakeTimeout"`
+		RateLimiter      string        `json:"rateLimiter,omitempty"`
+		BandwidthBytes   int64         `json:"bandwidthBytes,omitempty"`
+		BandwidthWindow  time.Duration `json:"bandwidthWindow,omitempty"`
+		BandwidthPolicy  string        `json:"bandwidthPolicy,omitempty"`
+		MaxConnections   int           `json:"maxConnections,omitempty"`
+		ConnPolicy       string        `json:"connPolicy,omitempty"`
+		MaxConnsPerIP    int           `json:"maxConnsPerIP,omitempty"`
+		SlowHandler      time.Duration `json:"slowHandler"`
+		TimerPrecision   time.Duration `json:"timerPrecision"`
+		HandlerBacklog   int           `json:"handlerBacklog"`
+		AgentSendBacklog int           `json:"agentSendBacklog"`
+	}
+
+	// ListenerConfig represents the options of listener
+	ListenerConfig struct {
+		Addr           string `json:"addr"`
+		WebSocket      bool   `json:"webSocket"`
+		TLS            string `json:"tls,omitempty"` // client auth type if TLS enabled
+		WSPath         string `json:"wsPath,omitempty"`
+		Codec          string `json:"codec"`
+		ReadBufferSize int    `json:"readBufferSize"` // zero if adaptive
+		DebugAddr      string `json:"debugAddr,omitempty"`
+		ConsoleAddr    string `json:"consoleAddr,omitempty"`
+	}
+)
+
+// Configuration returns a snapshot of the effective runtime configuration of
+// current node, eg: for ops to verify what a node is actually running
+func Configuration() *RuntimeConfig {
+	return defaultApp.Configuration()
+}
+
+// Configuration returns a snapshot of the effective runtime configuration of
+// the application
+func (app *App) Configuration() *RuntimeConfig {
+	c := &RuntimeConfig{
+		Version:      app.env.version,
+		NodeID:       app.env.nodeID,
+		NodeLabels:   app.env.nodeLabels,
+		Debug:        atomic.LoadInt32(&debugAll) == 1 || atomic.LoadInt32(&app.env.debugAll) == 1,
+		DebugModules: app.debugModuleNames(),
+		Heartbeat: HeartbeatConfig{
+			Interval: app.env.heartbeat,
+			Mode:     app.env.heartbeatMode.String(),
+			Misses:   app.env.heartbeatMisses,
+		},
+		Serializer: SerializerConfig{
+			Application: typeName(app.serializer),
+			System:      typeName(app.sysSerializer),
+		},
+		Protocol: ProtocolConfig{
+			MinVersion:        app.env.minProtocol,
+			MaxVersion:        ProtocolVersion,
+			CompressThreshold: app.env.compressThreshold,
+			Checksum:          app.env.checksum,
+		},
+		Limits: LimitsConfig{
+			MaxPacketSize:    app.env.maxPacketSize,
+			MaxMessageSize:   app.env.maxMessageSize,
+			SessionExpire:    time.Duration(app.env.sessionExpireSecs) * time.Second,
+			HandshakeTimeout: app.env.handshakeTimeout,
+			RateLimiter:      typeName(app.env.rateLimiter),
+			SlowHandler:      time.Duration(atomic.LoadInt64(&app.slow.threshold)),
+			TimerPrecision:   app.timers.precision,
+			HandlerBacklog:   packetBacklog,
+			AgentSendBacklog: agentWriteBacklog,
+		},
+		Dictionary: app.handler.dictionary(),
+	}
+	if q := app.env.bandwidthQuota; q != nil {
+		c.Limits.BandwidthBytes = q.Bytes
+		c.Limits.BandwidthWindow = q.Window
+		c.Limits.BandwidthPolicy = q.Policy.String()
+	}
+	if l := app.loadConnLimiter(); l != nil {
+		c.Limits.MaxConnections = l.Max
+		c.Limits.ConnPolicy = l.Policy.String()
+	}
+	if l := app.env.ipLimiter; l != nil {
+		c.Limits.MaxConnsPerIP = l.Max
+	}
+	if l, ok := app.listener.Load().(*ListenerConfig); ok {
+		c.Listener = l
+	}
+	return c
+}
+
+// storeListenerConfig records the options of running listener
+func (app *App) storeListenerConfig(addr string, isWs bool, o *options) {
+	l := &ListenerConfig{
+		Addr:           addr,
+		WebSocket:      isWs,
+		Codec:          typeName(o.codec),
+		ReadBufferSize: o.readBufferSize,
+		DebugAddr:      o.debugAddr,
+		ConsoleAddr:    o.consoleAddr,
+	}
+	if isWs {
+		l.WSPath = app.env.wsPath
+	}
+	if o.tlsConfig != nil {
+		l.TLS = o.tlsConfig.ClientAuth.String()
+	}
+	app.listener.Store(l)
+}
+
+// typeName returns the type name of v, empty if v is nil
+func typeName(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprintf("%T", v)
+}
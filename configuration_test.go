@@ -0,0 +1,61 @@
+package nano
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConfiguration(t *testing.T) {
+	defer SetBandwidthQuota(nil)
+	SetBandwidthQuota(&BandwidthQuota{Bytes: 1024, Window: time.Second, Policy: QuotaKick})
+
+	c := Configuration()
+	if c.Heartbeat.Interval != defaultApp.env.heartbeat || c.Heartbeat.Mode != "server" {
+		t.Fatalf("unexpected heartbeat config %+v", c.Heartbeat)
+	}
+	if c.Serializer.Application == "" || c.Serializer.System != "" {
+		t.Fatalf("unexpected serializer config %+v", c.Serializer)
+	}
+	if c.Protocol.MaxVersion != ProtocolVersion {
+		t.Fatalf("unexpected protocol config %+v", c.Protocol)
+	}
+	if c.Limits.BandwidthBytes != 1024 || c.Limits.BandwidthPolicy != "kick" {
+		t.Fatalf("unexpected limits config %+v", c.Limits)
+	}
+
+	defaultApp.storeListenerConfig(":3250", true, &options{codec: DefaultCodec})
+	if l := Configuration().Listener; l == nil || l.Addr != ":3250" || !l.WebSocket || l.Codec == "" {
+		t.Fatalf("unexpected listener config %+v", l)
+	}
+}
+
+func TestConfiguration_PerApp(t *testing.T) {
+	app := NewApp()
+	o := &options{codec: DefaultCodec}
+	WithDebug(LogGroup, LogTimer)(o)
+	if err := app.apply(o); err != nil {
+		t.Fatal(err)
+	}
+	app.SetSlowHandlerThreshold(time.Second)
+
+	c := app.Configuration()
+	if c.Debug || len(c.DebugModules) != 2 || c.DebugModules[0] != LogGroup || c.DebugModules[1] != LogTimer {
+		t.Fatalf("unexpected debug config %v %v", c.Debug, c.DebugModules)
+	}
+	if c.Limits.SlowHandler != time.Second {
+		t.Fatalf("unexpected slow handler threshold %s", c.Limits.SlowHandler)
+	}
+	if d := Configuration(); len(d.DebugModules) != 0 || d.Limits.SlowHandler == time.Second {
+		t.Fatalf("settings of app should not be reported by default app %+v", d)
+	}
+
+	all := NewApp()
+	o = &options{codec: DefaultCodec}
+	WithDebug()(o)
+	if err := all.apply(o); err != nil {
+		t.Fatal(err)
+	}
+	if !all.Configuration().Debug {
+		t.Fatal("debug logs of all modules should be reported")
+	}
+}
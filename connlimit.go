@@ -0,0 +1,169 @@
+package nano
+
+import (
+	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// ConnLimitPolicy represents the action when the connections exceed limit
+type ConnLimitPolicy byte
+
+const (
+	// ConnReject writes a kick packet with ErrServerBusy to the connection
+	// and closes it immediately
+	ConnReject ConnLimitPolicy = iota
+
+	// ConnQueue holds the connection until a connection closed, the
+	// connection is rejected if it waits longer than the queue timeout
+	ConnQueue
+)
+
+func (p ConnLimitPolicy) String() string {
+	switch p {
+	case ConnReject:
+		return "reject"
+	case ConnQueue:
+		return "queue"
+	default:
+		return fmt.Sprintf("ConnLimitPolicy(%d)", p)
+	}
+}
+
+type (
+	// ConnLimit limits the concurrent connections of application, so that a
+	// traffic spike degrades gracefully instead of exhausting the memory
+	ConnLimit struct {
+		Max          int // max concurrent connections
+		Policy       ConnLimitPolicy
+		QueueTimeout time.Duration // max duration in queue, zero waits until a slot released
+	}
+
+	// ConnStats represents the statistics of connection limit
+	ConnStats struct {
+		Active   int   `json:"active"`   // connections being served
+		Max      int   `json:"max"`      // zero if limit not set
+		Queued   int64 `json:"queued"`   // connections waiting in queue
+		Rejected int64 `json:"rejected"` // connections rejected since limit set
+
+		IPRejected int64 `json:"ipRejected"` // connections rejected by IP limit
+	}
+
+	// connLimiter counts the connections by a semaphore
+	connLimiter struct {
+		ConnLimit
+		slots    chan struct{}
+		queued   int64
+		rejected int64
+	}
+)
+
+// SetConnLimit set the limit of concurrent connections, nil disables it. It
+// could be called at runtime, the connections being served are released to
+// the limiter which admitted them
+func SetConnLimit(l *ConnLimit) {
+	defaultApp.SetConnLimit(l)
+}
+
+// SetConnLimit set the limit of concurrent connections of the application
+func (app *App) SetConnLimit(l *ConnLimit) {
+	if l == nil {
+		app.env.connLimiter.Store((*connLimiter)(nil))
+		return
+	}
+	if l.Max < 1 || l.QueueTimeout < 0 {
+		panic("nano: invalid connection limit")
+	}
+	app.env.connLimiter.Store(&connLimiter{ConnLimit: *l, slots: make(chan struct{}, l.Max)})
+}
+
+// loadConnLimiter returns the connection limiter of the application, nil if
+// not limited
+func (app *App) loadConnLimiter() *connLimiter {
+	l, _ := app.env.connLimiter.Load().(*connLimiter)
+	return l
+}
+
+// WithConnLimit set the limit of concurrent connections, see SetConnLimit
+func WithConnLimit(l *ConnLimit) Option {
+	return withSetting(func(app *App) error {
+		if l != nil && l.Max < 1 {
+			return invalidOption("WithConnLimit", "max connections must be positive")
+		}
+		if l != nil && l.QueueTimeout < 0 {
+			return invalidOption("WithConnLimit", "queue timeout can not be negative")
+		}
+		app.SetConnLimit(l)
+		return nil
+	})
+}
+
+// ConnectionStats returns the statistics of connection limit
+func ConnectionStats() ConnStats {
+	return defaultApp.ConnectionStats()
+}
+
+// ConnectionStats returns the statistics of connection limit of the
+// application
+func (app *App) ConnectionStats() ConnStats {
+	stats := ConnStats{Active: app.agents.Count()}
+	if l := app.loadConnLimiter(); l != nil {
+		stats.Active = len(l.slots)
+		stats.Max = l.Max
+		stats.Queued = atomic.LoadInt64(&l.queued)
+		stats.Rejected = atomic.LoadInt64(&l.rejected)
+	}
+	if l := app.env.ipLimiter; l != nil {
+		stats.IPRejected = atomic.LoadInt64(&l.rejected)
+	}
+	return stats
+}
+
+// acquire takes a slot for the connection, and reports whether the
+// connection could be served, the connection is rejected if not
+func (l *connLimiter) acquire(app *App, conn net.Conn, o *options) bool {
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	if l.Policy == ConnQueue {
+		atomic.AddInt64(&l.queued, 1)
+		ok := l.wait(app)
+		atomic.AddInt64(&l.queued, -1)
+		if ok {
+			return true
+		}
+	}
+
+	atomic.AddInt64(&l.rejected, 1)
+	app.log().Println(fmt.Sprintf("nano/conn: too many connections, Remote=%s, Max=%d", conn.RemoteAddr(), l.Max))
+	rejectConn(conn, o, ErrServerBusy)
+	return false
+}
+
+// wait waits in queue until a slot released, the queue timeout exceeded or
+// the application shutdown
+func (l *connLimiter) wait(app *App) bool {
+	var timeout <-chan time.Time
+	if l.QueueTimeout > 0 {
+		timer := time.NewTimer(l.QueueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-timeout:
+	case <-app.env.die:
+	}
+	return false
+}
+
+// release releases the slot of a closed connection
+func (l *connLimiter) release() {
+	<-l.slots
+}
@@ -0,0 +1,105 @@
+package nano
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConnLimit_Reject(t *testing.T) {
+	app := NewApp()
+	app.SetConnLimit(&ConnLimit{Max: 1, Policy: ConnReject})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ln, addr := listenLocal(t)
+	go app.Serve(ctx, ln, WithoutSignals())
+
+	c1 := dialApp(t, addr)
+	defer c1.conn.Close()
+	c1.write(PacketHandshake, []byte(`{"sys":{"protocol":1}}`))
+	c1.read(PacketHandshake)
+
+	c2 := dialApp(t, addr)
+	defer c2.conn.Close()
+	e := &Error{}
+	if err := json.Unmarshal(c2.read(PacketKick).Data, e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Code != CodeServerBusy {
+		t.Fatalf("unexpected kick reason %+v", e)
+	}
+	if s := app.ConnectionStats(); s.Active != 1 || s.Rejected != 1 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
+
+func TestConnLimit_Queue(t *testing.T) {
+	app := NewApp()
+	app.SetConnLimit(&ConnLimit{Max: 1, Policy: ConnQueue})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ln, addr := listenLocal(t)
+	go app.Serve(ctx, ln, WithoutSignals())
+
+	c1 := dialApp(t, addr)
+	c1.write(PacketHandshake, []byte(`{"sys":{"protocol":1}}`))
+	c1.read(PacketHandshake)
+
+	c2 := dialApp(t, addr)
+	defer c2.conn.Close()
+	c2.write(PacketHandshake, []byte(`{"sys":{"protocol":1}}`))
+
+	deadline := time.Now().Add(time.Second)
+	for app.ConnectionStats().Queued != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("connection should be queued")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// the queued connection is served after the first one closed
+	c1.conn.Close()
+	c2.read(PacketHandshake)
+}
+
+func TestConnLimit_RejectBlocked(t *testing.T) {
+	// the client never reads the kick packet
+	client, server := net.Pipe()
+	defer client.Close()
+
+	done := make(chan struct{})
+	go func() {
+		rejectConn(server, &options{codec: DefaultCodec}, ErrServerBusy)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(rejectWriteTimeout + time.Second):
+		t.Fatal("rejecting should not block on a client not reading")
+	}
+}
+
+func TestConnLimit_SetAtRuntime(t *testing.T) {
+	app := NewApp()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			app.SetConnLimit(&ConnLimit{Max: i + 1})
+		}
+		app.SetConnLimit(nil)
+	}()
+	for i := 0; i < 100; i++ {
+		app.ConnectionStats()
+	}
+	wg.Wait()
+	if s := app.ConnectionStats(); s.Max != 0 {
+		t.Fatalf("connection limit should be disabled, got %+v", s)
+	}
+}
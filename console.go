@@ -0,0 +1,153 @@
+package nano
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/kensomanpow/nano/cluster"
+)
+
+// console returns the handler of admin console, all requests must carry
+// `Authorization: Bearer <token>`
+//
+//	GET  /admin/routes                           list registered routes
+//	GET  /admin/session?uid=1                    inspect the session of uid
+//	POST /admin/kick?uid=1&reason=maintenance    kick the session of uid
+//	POST /admin/debug?module=handshake&enabled=1 toggle debug logs, module `all` toggles all modules
+//	POST /admin/ratelimit?limit=100              adjust the limit of rate limiter
+func console(app *App, token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/routes", consoleRoutes(app))
+	mux.HandleFunc("/admin/session", consoleSession(app))
+	mux.HandleFunc("/admin/kick", post(consoleKick(app)))
+	mux.HandleFunc("/admin/debug", post(consoleDebug))
+	mux.HandleFunc("/admin/ratelimit", post(consoleRateLimit(app)))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") ||
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// serveConsole starts the admin console of app
+func serveConsole(app *App, addr, token string) {
+	go func() {
+		app.log().Println(fmt.Sprintf("starting admin console, listen at %s", addr))
+		if err := http.ListenAndServe(addr, console(app, token)); err != nil {
+			app.log().Println(fmt.Sprintf("nano/console: admin console error: %s", err.Error()))
+		}
+	}()
+}
+
+// post allows the POST requests only, the commands change state
+func post(fn http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		fn(w, r)
+	}
+}
+
+func consoleReply(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(v)
+}
+
+func consoleRoutes(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		consoleReply(w, app.handler.routes())
+	}
+}
+
+func consoleSession(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		uid, err := strconv.ParseInt(r.FormValue("uid"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid uid", http.StatusBadRequest)
+			return
+		}
+		s, err := app.agents.Member(uid)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		traffic, _ := SessionTrafficStats(s)
+		consoleReply(w, map[string]interface{}{
+			"id":         s.ID(),
+			"token":      s.Token(),
+			"uid":        s.UID(),
+			"remoteAddr": s.RemoteAddr().String(),
+			"rtt":        s.RTT().String(),
+			"traffic":    traffic,
+			"state":      s.State(),
+		})
+	}
+}
+
+func consoleKick(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		uid, err := strconv.ParseInt(r.FormValue("uid"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid uid", http.StatusBadRequest)
+			return
+		}
+		s, err := app.agents.Member(uid)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err := s.Kick(r.FormValue("reason")); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		consoleReply(w, map[string]bool{"kicked": true})
+	}
+}
+
+func consoleDebug(w http.ResponseWriter, r *http.Request) {
+	module := r.FormValue("module")
+	enabled, err := strconv.ParseBool(r.FormValue("enabled"))
+	if module == "" || err != nil {
+		http.Error(w, "invalid module or enabled", http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case module == "all":
+		setDebug(enabled)
+	case enabled:
+		EnableDebugModules(module)
+	default:
+		DisableDebugModules(module)
+	}
+	consoleReply(w, map[string]interface{}{"module": module, "enabled": enabled})
+}
+
+func consoleRateLimit(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit, err := strconv.Atoi(r.FormValue("limit"))
+		if err != nil || limit < 1 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		l, ok := app.env.rateLimiter.(cluster.AdjustableRateLimiter)
+		if !ok {
+			http.Error(w, "rate limiter is not adjustable", http.StatusNotImplemented)
+			return
+		}
+		l.SetLimit(limit)
+		consoleReply(w, map[string]int{"limit": limit})
+	}
+}
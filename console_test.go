@@ -0,0 +1,111 @@
+package nano
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestConsole(t *testing.T) {
+	srv := httptest.NewServer(console(defaultApp, "secret"))
+	defer srv.Close()
+
+	do := func(method, path, token string) int {
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(""))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := do(http.MethodGet, "/admin/routes", ""); code != http.StatusUnauthorized {
+		t.Fatalf("expect 401, got %d", code)
+	}
+	if code := do(http.MethodGet, "/admin/routes", "wrong"); code != http.StatusUnauthorized {
+		t.Fatalf("expect 401, got %d", code)
+	}
+	if code := do(http.MethodGet, "/admin/routes", "secret"); code != http.StatusOK {
+		t.Fatalf("expect 200, got %d", code)
+	}
+	if code := do(http.MethodGet, "/admin/debug?module=timer&enabled=1", "secret"); code != http.StatusMethodNotAllowed {
+		t.Fatalf("expect 405, got %d", code)
+	}
+
+	defer DisableDebugModules(LogTimer)
+	if code := do(http.MethodPost, "/admin/debug?module=timer&enabled=1", "secret"); code != http.StatusOK {
+		t.Fatalf("expect 200, got %d", code)
+	}
+	if !debugEnabled(LogTimer) {
+		t.Fatal("timer debug logs should be enabled")
+	}
+	if code := do(http.MethodPost, "/admin/kick?uid=404404", "secret"); code != http.StatusNotFound {
+		t.Fatalf("expect 404, got %d", code)
+	}
+}
+
+func TestConsole_BareToken(t *testing.T) {
+	srv := httptest.NewServer(console(defaultApp, "secret"))
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/admin/routes", nil)
+	req.Header.Set("Authorization", "secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("token without Bearer prefix should be rejected, got %d", resp.StatusCode)
+	}
+}
+
+func TestConsole_SessionState(t *testing.T) {
+	app := NewApp()
+	srv := httptest.NewServer(console(app, "secret"))
+	defer srv.Close()
+
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	go io.Copy(ioutil.Discard, c2)
+	a := newAgent(app, c1)
+	defer a.Close()
+	if err := a.session.Bind(10086); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+				a.session.Set(strconv.Itoa(i%16), i)
+			}
+		}
+	}()
+
+	for i := 0; i < 20; i++ {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/admin/session?uid=10086", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expect 200, got %d", resp.StatusCode)
+		}
+	}
+}
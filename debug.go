@@ -0,0 +1,135 @@
+package nano
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The debug server does not import net/http/pprof and expvar, both register
+// their handlers to http.DefaultServeMux, which serves the websocket listener
+// to the public network.
+
+// debugServer returns the handler of debug server
+func debugServer(app *App) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", debugProfile)
+	mux.HandleFunc("/debug/vars", debugJSON(func() interface{} { return debugVars(app) }))
+	mux.HandleFunc("/debug/nano/config", debugJSON(func() interface{} { return app.Configuration() }))
+	mux.HandleFunc("/debug/nano/payloads", debugJSON(func() interface{} { return PayloadSizes() }))
+	mux.HandleFunc("/debug/nano/services", debugJSON(func() interface{} { return app.handler.routes() }))
+	mux.HandleFunc("/debug/nano/sessions", debugJSON(func() interface{} {
+		return map[string]interface{}{
+			"sessions": app.agents.Count(),
+			"traffic":  app.Traffic(),
+			"latency":  Latency(),
+		}
+	}))
+	mux.HandleFunc("/debug/nano/dispatch", debugJSON(func() interface{} {
+		queues := map[string]map[string]int{}
+		for _, q := range app.DispatchQueues() {
+			queues[q.Name] = map[string]int{"len": q.Len, "cap": q.Cap, "max": q.Max}
+		}
+		return queues
+	}))
+	return mux
+}
+
+// serveDebug starts the debug server of app, the address must be a loopback
+// address
+func serveDebug(app *App, addr string) {
+	go func() {
+		app.log().Println(fmt.Sprintf("starting debug server, listen at %s", addr))
+		if err := http.ListenAndServe(addr, debugServer(app)); err != nil {
+			app.log().Println(fmt.Sprintf("nano/debug: debug server error: %s", err.Error()))
+		}
+	}()
+}
+
+// loopback reports whether the host of addr is a loopback address
+func loopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func debugJSON(fn func() interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(fn())
+	}
+}
+
+func debugVars(app *App) interface{} {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return map[string]interface{}{
+		"cmdline":    os.Args,
+		"memstats":   ms,
+		"goroutines": runtime.NumGoroutine(),
+		"uptime":     time.Since(app.startAt).String(),
+	}
+}
+
+// debugProfile serves the runtime profiles, eg: /debug/pprof/heap, and the
+// CPU profile /debug/pprof/profile?seconds=30
+func debugProfile(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/debug/pprof/")
+	debug, _ := strconv.Atoi(r.FormValue("debug"))
+
+	switch name {
+	case "":
+		profiles := pprof.Profiles()
+		sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name() < profiles[j].Name() })
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, p := range profiles {
+			fmt.Fprintf(w, "%d\t%s\n", p.Count(), p.Name())
+		}
+		fmt.Fprintln(w, "-\tprofile")
+
+	case "profile":
+		sec, _ := strconv.Atoi(r.FormValue("seconds"))
+		if sec <= 0 {
+			sec = 30
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		if err := pprof.StartCPUProfile(w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		select {
+		case <-time.After(time.Duration(sec) * time.Second):
+		case <-r.Context().Done():
+		}
+		pprof.StopCPUProfile()
+
+	default:
+		p := pprof.Lookup(name)
+		if p == nil {
+			http.NotFound(w, r)
+			return
+		}
+		if debug > 0 {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		} else {
+			w.Header().Set("Content-Type", "application/octet-stream")
+		}
+		p.WriteTo(w, debug)
+	}
+}
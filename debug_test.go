@@ -0,0 +1,52 @@
+package nano
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLoopback(t *testing.T) {
+	cases := map[string]bool{
+		"127.0.0.1:6060": true,
+		"localhost:6060": true,
+		"[::1]:6060":     true,
+		":6060":          false,
+		"0.0.0.0:6060":   false,
+		"10.0.0.1:6060":  false,
+	}
+	for addr, expect := range cases {
+		if loopback(addr) != expect {
+			t.Fatalf("%s, expect %v", addr, expect)
+		}
+	}
+}
+
+func TestDebugServer(t *testing.T) {
+	srv := httptest.NewServer(debugServer(defaultApp))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/debug/nano/dispatch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	stats := map[string]map[string]int{}
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats["localProcess"]["cap"] != packetBacklog {
+		t.Fatalf("unexpected dispatch stats %v", stats)
+	}
+
+	resp, err = http.Get(srv.URL + "/debug/pprof/goroutine?debug=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %d", resp.StatusCode)
+	}
+}
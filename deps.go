@@ -0,0 +1,63 @@
+package nano
+
+import (
+	"github.com/kensomanpow/nano/cluster"
+	"github.com/kensomanpow/nano/component"
+)
+
+type (
+	// Metrics provides the runtime statistics of an application
+	Metrics interface {
+		Stats() *NodeStats
+	}
+
+	// ClusterClient provides the cluster operations of an application
+	ClusterClient interface {
+		LocalNode() *cluster.Node
+		IsOnline(uid int64) bool
+		PushToUID(uid int64, route string, v interface{}) error
+	}
+
+	// Deps contains the dependencies of the application which the components
+	// created by factory depend on, so that the components do not reach into
+	// the package level globals
+	Deps struct {
+		Logger  LeveledLogger // leveled logger of application
+		Metrics Metrics       // runtime statistics of application
+		Cluster ClusterClient // cluster operations of application
+	}
+
+	// ComponentFactory creates a component with the dependencies
+	ComponentFactory func(deps Deps) component.Component
+)
+
+// Stats returns the runtime statistics of current node
+func Stats() *NodeStats {
+	return defaultApp.Stats()
+}
+
+// Stats returns the runtime statistics of the application
+func (app *App) Stats() *NodeStats {
+	return app.localStats()
+}
+
+// deps returns the dependencies of the application
+func (app *App) deps() Deps {
+	return Deps{
+		Logger:  app.Logger(),
+		Metrics: app,
+		Cluster: app,
+	}
+}
+
+// RegisterFactory creates a component by factory with the dependencies of
+// the default application, and registers it with options, see Register
+func RegisterFactory(factory ComponentFactory, options ...component.Option) {
+	defaultApp.RegisterFactory(factory, options...)
+}
+
+// RegisterFactory creates a component by factory with the dependencies of
+// the application, and registers it with options
+func (app *App) RegisterFactory(factory ComponentFactory, options ...component.Option) {
+	app.Register(factory(app.deps()), options...)
+}
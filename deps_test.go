@@ -0,0 +1,36 @@
+package nano
+
+import (
+	"testing"
+
+	"github.com/kensomanpow/nano/component"
+)
+
+type depsComp struct {
+	component.Base
+	deps Deps
+}
+
+func TestRegisterFactory(t *testing.T) {
+	app := NewApp()
+	app.SetNodeID("node-1")
+
+	var comp *depsComp
+	app.RegisterFactory(func(deps Deps) component.Component {
+		comp = &depsComp{deps: deps}
+		return comp
+	}, component.WithName("Deps"))
+
+	if len(app.comps) != 1 || app.comps[0].comp != comp {
+		t.Fatalf("component created by factory should be registered")
+	}
+	if comp.deps.Logger == nil {
+		t.Fatalf("logger should be injected")
+	}
+	if node := comp.deps.Metrics.Stats().Node; node != "node-1" {
+		t.Fatalf("unexpected metrics of node %s", node)
+	}
+	if comp.deps.Cluster.LocalNode().ID != "node-1" || comp.deps.Cluster.IsOnline(1) {
+		t.Fatalf("unexpected cluster client")
+	}
+}
@@ -20,7 +20,11 @@
 
 package nano
 
-import "errors"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
 
 // Errors that could be occurred during message handling.
 var (
@@ -28,6 +32,107 @@ var (
 	ErrCloseClosedGroup   = errors.New("close closed group")
 	ErrClosedGroup        = errors.New("group closed")
 	ErrMemberNotFound     = errors.New("member not found in the group")
-	ErrCloseClosedSession = errors.New("close closed session")
+	ErrCloseClosedSession = &Error{Code: CodeSessionClosed, Message: "close closed session"}
 	ErrSessionDuplication = errors.New("session has existed in the current group")
+	ErrStageNotFound      = errors.New("pipeline stage not found")
+	ErrStageDuplication   = errors.New("pipeline stage has existed")
+	ErrNilStageHandler    = errors.New("pipeline stage handler can not be nil")
+	ErrReservedPacketType = errors.New("packet type is reserved")
+	ErrNilPacketHandler   = errors.New("packet handler can not be nil")
+	ErrInvalidOption      = errors.New("invalid option")
+	ErrComponentNotFound  = errors.New("component not found")
+	ErrNotReloadable      = errors.New("component does not implement Reloader")
+	ErrInvalidConfig      = errors.New("invalid config")
+	ErrWatcherStarted     = errors.New("config watcher has started")
+)
+
+// ErrorCode classifies the errors returned by public APIs and responded to
+// clients, the codes follow the HTTP status codes
+type ErrorCode int
+
+// Error codes
+const (
+	CodeSerializeError   ErrorCode = 400 // message could not be (de)serialized
+	CodeUnauthorized     ErrorCode = 401 // handshake not authenticated
+	CodePipelineRejected ErrorCode = 403 // message rejected by pipeline
+	CodeRouteNotFound    ErrorCode = 404 // no handler registered for route
+	CodeSessionClosed    ErrorCode = 410 // session or connection closed
+	CodePayloadTooLarge  ErrorCode = 413 // payload exceeds the limit of route
+	CodeTooManyConns     ErrorCode = 429 // too many connections from an IP
+	CodeRateLimited      ErrorCode = 429 // message throttled by bandwidth quota or flood control
+	CodeServerBusy       ErrorCode = 503 // too many connections
+	CodeHandlerTimeout   ErrorCode = 504 // handler not finished in time
+)
+
+// Error is the typed error of nano, errors.Is reports whether an error
+// matches one of the sentinel errors by its code, eg:
+//
+//	if errors.Is(err, nano.ErrSessionClosed) { ... }
+//
+// The error responded to client is encoded as JSON `{"code":404,"msg":"..."}`,
+// which is same with PipelineError
+type Error struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"msg"`
+	Route   string    `json:"route,omitempty"`
+	Err     error     `json:"-"` // underlying error, not sent to client
+}
+
+// Typed errors, compare with errors.Is
+var (
+	ErrRouteNotFound    = &Error{Code: CodeRouteNotFound, Message: "route not found"}
+	ErrSerialize        = &Error{Code: CodeSerializeError, Message: "serialize error"}
+	ErrUnauthorized     = &Error{Code: CodeUnauthorized, Message: "unauthorized"}
+	ErrPipelineRejected = &Error{Code: CodePipelineRejected, Message: "rejected by pipeline"}
+	ErrHandlerTimeout   = &Error{Code: CodeHandlerTimeout, Message: "handler timeout"}
+	ErrSessionClosed    = &Error{Code: CodeSessionClosed, Message: "session closed"}
+	ErrPayloadTooLarge  = &Error{Code: CodePayloadTooLarge, Message: "payload too large"}
+	ErrServerBusy       = &Error{Code: CodeServerBusy, Message: "server busy"}
+	ErrTooManyConns     = &Error{Code: CodeTooManyConns, Message: "too many connections"}
+	ErrRateLimited      = &Error{Code: CodeRateLimited, Message: "rate limited"}
 )
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("nano: %s, Code=%d", e.Message, e.Code)
+	if e.Route != "" {
+		msg += ", Route=" + e.Route
+	}
+	if e.Err != nil {
+		msg += ", Error=" + e.Err.Error()
+	}
+	return msg
+}
+
+// Unwrap returns the underlying error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is an *Error with the same code
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// payload returns the JSON encoded error which will be sent to client
+func (e *Error) payload() []byte {
+	data, _ := json.Marshal(e)
+	return data
+}
+
+// wrapError returns a copy of the typed error kind with route and cause
+func wrapError(kind *Error, route string, err error) *Error {
+	return &Error{Code: kind.Code, Message: kind.Message, Route: route, Err: err}
+}
+
+// replyError responds the typed error to client, notify messages have no
+// response, so the error is dropped
+func replyError(a *agent, mid uint, e *Error) {
+	if mid == 0 {
+		return
+	}
+	if err := a.ResponseMID(mid, e.payload()); err != nil {
+		a.app.log().Println(fmt.Sprintf("nano/handler: reply error failed, ID=%d, UID=%d, Error=%s",
+			a.session.ID(), a.session.UID(), err.Error()))
+	}
+}
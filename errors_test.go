@@ -0,0 +1,84 @@
+package nano
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kensomanpow/nano/component"
+	"github.com/kensomanpow/nano/internal/message"
+	jsonserializer "github.com/kensomanpow/nano/serialize/json"
+	"github.com/kensomanpow/nano/session"
+)
+
+type SlowComp struct {
+	component.Base
+}
+
+func (c *SlowComp) Wait(s *session.Session, _ []byte, respond func(interface{}) error) error {
+	ctx := s.RequestContext()
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestError_Is(t *testing.T) {
+	err := wrapError(ErrSerialize, "Room.Join", errors.New("bad json"))
+	if !errors.Is(err, ErrSerialize) || errors.Is(err, ErrRouteNotFound) {
+		t.Fatalf("unexpected match of %v", err)
+	}
+	if !errors.Is(ErrBrokenPipe, ErrSessionClosed) || !errors.Is(ErrCloseClosedSession, ErrSessionClosed) {
+		t.Fatalf("broken pipe should be a closed session error")
+	}
+	if !errors.Is(&PipelineError{Code: 1}, ErrPipelineRejected) {
+		t.Fatalf("pipeline error should be rejected error")
+	}
+	if _, err := NewApp().serializeOrRaw(make(chan int)); !errors.Is(err, ErrSerialize) {
+		t.Fatalf("unexpected serialize error %v", err)
+	}
+}
+
+func TestError_Response(t *testing.T) {
+	app := NewApp()
+	app.Register(&SlowComp{})
+	app.SetHandlerTimeout(50 * time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ln, addr := listenLocal(t)
+	go app.Serve(ctx, ln, WithSerializer(jsonserializer.NewSerializer()), WithoutSignals())
+
+	c := dialApp(t, addr)
+	defer c.conn.Close()
+	c.write(PacketHandshake, []byte(`{"sys":{"protocol":1}}`))
+	c.read(PacketHandshake)
+	c.write(PacketHandshakeAck, nil)
+
+	request := func(id uint, route string) *Error {
+		data, err := message.NewDictionary().Encode(&message.Message{Type: message.Request, ID: id, Route: route, Data: []byte("{}")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.write(PacketData, data)
+		m, err := app.routes.Decode(c.read(PacketData).Data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Type != message.Response || m.ID != id {
+			t.Fatalf("unexpected message %s", m)
+		}
+		e := &Error{}
+		if err := json.Unmarshal(m.Data, e); err != nil {
+			t.Fatal(err)
+		}
+		return e
+	}
+
+	if e := request(1, "Missing.Route"); e.Code != CodeRouteNotFound || e.Route != "Missing.Route" {
+		t.Fatalf("unexpected error %+v", e)
+	}
+	if e := request(2, "SlowComp.Wait"); e.Code != CodeHandlerTimeout {
+		t.Fatalf("unexpected error %+v", e)
+	}
+}
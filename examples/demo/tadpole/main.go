@@ -48,7 +48,5 @@ func serve(ctx *cli.Context) error {
 	nano.SetCheckOriginFunc(func(_ *http.Request) bool { return true })
 
 	addr := ctx.String("addr")
-	nano.ListenWS(addr)
-
-	return nil
+	return nano.ListenWS(addr)
 }
@@ -0,0 +1,162 @@
+// Copyright (c) nano Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package kafka exports the messages captured by nano message tap and the
+// records of nano audit pipeline stage to Kafka, so analytics and anti-cheat
+// pipelines could consume gameplay events.
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kensomanpow/nano"
+	"github.com/segmentio/kafka-go"
+)
+
+// Exporter settings
+const (
+	DefaultBacklog = 4096
+	batchSize      = 256
+	flushInterval  = time.Second
+)
+
+type (
+	// Exporter implements nano.MessageTap and nano.AuditSink, events are
+	// queued and written to Kafka in batch by a background goroutine, events
+	// are dropped rather than blocking the message processing when the queue
+	// is full.
+	Exporter struct {
+		writer  *kafka.Writer
+		chEvent chan event
+		dropped int64 // dropped events count
+		wg      sync.WaitGroup
+	}
+
+	// event represents a tap event or an audit record
+	event struct {
+		uid   int64
+		route string
+		time  time.Time
+		value interface{}
+	}
+)
+
+// NewExporter returns an exporter which writes events to topic, events of
+// the same UID are written to the same partition
+func NewExporter(brokers []string, topic string, backlog int) *Exporter {
+	if backlog < 1 {
+		backlog = DefaultBacklog
+	}
+
+	e := &Exporter{
+		writer: &kafka.Writer{
+			Addr:     kafka.TCP(brokers...),
+			Topic:    topic,
+			Balancer: &kafka.Hash{},
+		},
+		chEvent: make(chan event, backlog),
+	}
+
+	e.wg.Add(1)
+	go e.run()
+	return e
+}
+
+// Tap implements the nano.MessageTap interface
+func (e *Exporter) Tap(ev *nano.TapEvent) {
+	e.queue(event{uid: ev.UID, route: ev.Route, time: ev.Time, value: ev})
+}
+
+// Audit implements the nano.AuditSink interface
+func (e *Exporter) Audit(r *nano.AuditRecord) {
+	e.queue(event{uid: r.UID, route: r.Route, time: r.Time, value: r})
+}
+
+func (e *Exporter) queue(ev event) {
+	select {
+	case e.chEvent <- ev:
+	default:
+		atomic.AddInt64(&e.dropped, 1)
+	}
+}
+
+// Dropped returns the count of events dropped because of full queue
+func (e *Exporter) Dropped() int64 {
+	return atomic.LoadInt64(&e.dropped)
+}
+
+// Close flushes all queued events and closes the Kafka writer, Tap must not
+// be called after Close
+func (e *Exporter) Close() error {
+	close(e.chEvent)
+	e.wg.Wait()
+	return e.writer.Close()
+}
+
+func (e *Exporter) run() {
+	defer e.wg.Done()
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]kafka.Message, 0, batchSize)
+	flush := func() {
+		if len(batch) < 1 {
+			return
+		}
+		if err := e.writer.WriteMessages(context.Background(), batch...); err != nil {
+			log.Printf("nano/kafka: write %d events failed, Error=%s", len(batch), err.Error())
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case ev, ok := <-e.chEvent:
+			if !ok {
+				flush()
+				return
+			}
+
+			value, err := json.Marshal(ev.value)
+			if err != nil {
+				log.Printf("nano/kafka: marshal event failed, Route=%s, Error=%s", ev.route, err.Error())
+				continue
+			}
+			batch = append(batch, kafka.Message{
+				Key:   []byte(strconv.FormatInt(ev.uid, 10)),
+				Value: value,
+				Time:  ev.time,
+			})
+			if len(batch) >= batchSize {
+				flush()
+			}
+
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright (c) nano Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package otel implements the nano Tracer with OpenTelemetry, a span is
+// created for each inbound request, and the trace context propagated by
+// client is extracted with the global propagator.
+package otel
+
+import (
+	"context"
+
+	"github.com/kensomanpow/nano"
+	"github.com/kensomanpow/nano/session"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentation name of the tracer
+const name = "github.com/kensomanpow/nano"
+
+type (
+	// Tracer traces the nano requests with OpenTelemetry
+	Tracer struct {
+		tracer trace.Tracer
+	}
+
+	span struct {
+		span trace.Span
+	}
+)
+
+// NewTracer returns a nano Tracer, the global tracer provider is used if tp
+// is nil
+func NewTracer(tp trace.TracerProvider) *Tracer {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return &Tracer{tracer: tp.Tracer(name)}
+}
+
+// Start implements the nano.Tracer interface
+func (t *Tracer) Start(ctx context.Context, s *session.Session, meta *nano.PipelineMeta, carrier map[string]string) (context.Context, nano.Span) {
+	ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(carrier))
+	ctx, sp := t.tracer.Start(ctx, meta.Route,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("nano.type", meta.Type),
+			attribute.Int64("nano.id", int64(meta.ID)),
+			attribute.Int64("nano.session", s.ID()),
+			attribute.Int64("nano.uid", s.UID()),
+		))
+	return ctx, &span{span: sp}
+}
+
+func (s *span) End(err error) {
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
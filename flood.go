@@ -0,0 +1,191 @@
+package nano
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	// floodReset is the default duration after which the violations are
+	// forgotten
+	floodReset = 10 * time.Second
+
+	// floodReportInterval is the min interval between the logs and security
+	// events of the violations of a session with same action, the ones in
+	// between are counted as suppressed
+	floodReportInterval = time.Second
+)
+
+type (
+	// FloodControl limits the inbound messages of each session by a token
+	// bucket, the messages exceeding the rate are violations, which are
+	// escalated: warned first, then dropped after DropAfter violations, and
+	// the session is kicked after KickAfter violations. The requests dropped
+	// are responded with ErrRateLimited
+	FloodControl struct {
+		Rate          float64       // messages per second
+		Burst         int           // max messages in a burst
+		HeartbeatRate float64       // heartbeats per second, zero exempts the heartbeats
+		DropAfter     int           // violations before the messages dropped, the earlier ones are warned only
+		KickAfter     int           // violations before the session kicked, zero never kicks
+		Reset         time.Duration // violations are forgotten after no violation in the duration, default 10 seconds
+	}
+
+	// tokenBucket allows rate events per second with burst
+	tokenBucket struct {
+		rate   float64
+		burst  float64
+		tokens float64
+		last   time.Time
+	}
+
+	// floodState is the flood control state of an agent, which is used by
+	// read goroutine only
+	floodState struct {
+		messages      tokenBucket
+		heartbeats    tokenBucket
+		violations    int
+		lastViolation time.Time
+
+		lastAction floodAction // action of last report
+		lastReport time.Time
+		suppressed int // violations not reported since last report
+	}
+
+	floodAction byte
+)
+
+const (
+	floodAllow floodAction = iota
+	floodWarn
+	floodDrop
+	floodKick
+)
+
+// SetFloodControl set the flood control of sessions, nil disables it. It
+// should be called before application running
+func SetFloodControl(fc *FloodControl) {
+	defaultApp.SetFloodControl(fc)
+}
+
+// SetFloodControl set the flood control of the sessions of the application
+func (app *App) SetFloodControl(fc *FloodControl) {
+	if fc != nil && (fc.Rate <= 0 || fc.Burst < 1 || fc.HeartbeatRate < 0 || fc.DropAfter < 0 || fc.KickAfter < 0) {
+		panic("nano: invalid flood control")
+	}
+	app.env.floodControl = fc
+}
+
+// WithFloodControl set the flood control of sessions, see SetFloodControl
+func WithFloodControl(fc *FloodControl) Option {
+	return withSetting(func(app *App) error {
+		if fc != nil && (fc.Rate <= 0 || fc.Burst < 1) {
+			return invalidOption("WithFloodControl", "rate and burst must be positive")
+		}
+		if fc != nil && (fc.HeartbeatRate < 0 || fc.DropAfter < 0 || fc.KickAfter < 0) {
+			return invalidOption("WithFloodControl", "heartbeat rate and violations can not be negative")
+		}
+		app.SetFloodControl(fc)
+		return nil
+	})
+}
+
+func newFloodState(fc *FloodControl, now time.Time) *floodState {
+	return &floodState{
+		messages:   tokenBucket{rate: fc.Rate, burst: float64(fc.Burst), tokens: float64(fc.Burst), last: now},
+		heartbeats: tokenBucket{rate: fc.HeartbeatRate, burst: math.Max(fc.HeartbeatRate, 1), tokens: math.Max(fc.HeartbeatRate, 1), last: now},
+	}
+}
+
+// take reports whether an event is allowed at now
+func (b *tokenBucket) take(now time.Time) bool {
+	if d := now.Sub(b.last); d > 0 {
+		b.tokens += d.Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// check returns the action of a message or heartbeat received at now
+func (f *floodState) check(fc *FloodControl, heartbeat bool, now time.Time) floodAction {
+	bucket := &f.messages
+	if heartbeat {
+		if fc.HeartbeatRate == 0 {
+			return floodAllow
+		}
+		bucket = &f.heartbeats
+	}
+	if bucket.take(now) {
+		return floodAllow
+	}
+
+	reset := fc.Reset
+	if reset <= 0 {
+		reset = floodReset
+	}
+	if now.Sub(f.lastViolation) > reset {
+		f.violations = 0
+	}
+	f.violations++
+	f.lastViolation = now
+
+	switch {
+	case fc.KickAfter > 0 && f.violations > fc.KickAfter:
+		return floodKick
+	case f.violations > fc.DropAfter:
+		return floodDrop
+	default:
+		return floodWarn
+	}
+}
+
+// flooded checks the flood control of agent, and reports whether the
+// message of route should be dropped, the error is returned if the session
+// is kicked
+func (a *agent) flooded(route string, heartbeat bool) (bool, error) {
+	fc := a.app.env.floodControl
+	if fc == nil || a.flood == nil {
+		return false, nil
+	}
+
+	now := a.app.clock.Now()
+	switch action := a.flood.check(fc, heartbeat, now); action {
+	case floodWarn:
+		if suppressed, ok := a.flood.sample(action, now); ok {
+			logSession(a.session).Warn("nano/flood: message rate exceeded", "route", route, "violations", a.flood.violations, "suppressed", suppressed)
+			auditSecurity(a, SecurityFlooded, route, "message rate exceeded")
+		}
+	case floodDrop:
+		if suppressed, ok := a.flood.sample(action, now); ok {
+			logSession(a.session).Debug("nano/flood: message dropped", "route", route, "violations", a.flood.violations, "suppressed", suppressed)
+			auditSecurity(a, SecurityFlooded, route, "message dropped")
+		}
+		return true, nil
+	case floodKick:
+		a.kickPacket("message flood")
+		return true, fmt.Errorf("message flood, session will be closed immediately, remote=%s",
+			a.conn.RemoteAddr().String())
+	}
+	return false, nil
+}
+
+// sample reports whether the violation with action should be reported at
+// now, and returns the number of violations suppressed since last report.
+// The first violation of each action is always reported
+func (f *floodState) sample(action floodAction, now time.Time) (int, bool) {
+	if action == f.lastAction && now.Sub(f.lastReport) < floodReportInterval {
+		f.suppressed++
+		return 0, false
+	}
+	suppressed := f.suppressed
+	f.lastAction, f.lastReport, f.suppressed = action, now, 0
+	return suppressed, true
+}
@@ -0,0 +1,120 @@
+package nano
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/kensomanpow/nano/internal/message"
+	"github.com/kensomanpow/nano/internal/packet"
+)
+
+func TestFloodState_Escalation(t *testing.T) {
+	fc := &FloodControl{Rate: 10, Burst: 2, DropAfter: 1, KickAfter: 2}
+	now := time.Now()
+	f := newFloodState(fc, now)
+
+	expect := []floodAction{floodAllow, floodAllow, floodWarn, floodDrop, floodKick}
+	for i, action := range expect {
+		if a := f.check(fc, false, now); a != action {
+			t.Fatalf("message %d: expect action %d, got %d", i, action, a)
+		}
+	}
+
+	// tokens refilled and violations forgotten
+	now = now.Add(floodReset + time.Second)
+	if a := f.check(fc, false, now); a != floodAllow {
+		t.Fatalf("message should be allowed after refilled, got %d", a)
+	}
+	f.check(fc, false, now)
+	if a := f.check(fc, false, now); a != floodWarn {
+		t.Fatalf("violations should be reset, got %d", a)
+	}
+
+	// heartbeats are exempted
+	for i := 0; i < 10; i++ {
+		if a := f.check(fc, true, now); a != floodAllow {
+			t.Fatalf("heartbeat should be exempted, got %d", a)
+		}
+	}
+}
+
+func TestAgent_Flooded(t *testing.T) {
+	app := NewApp()
+	app.SetClock(NewManualClock(time.Now()))
+	app.SetFloodControl(&FloodControl{Rate: 1, Burst: 1, HeartbeatRate: 1, DropAfter: 1, KickAfter: 2})
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go io.Copy(ioutil.Discard, client)
+
+	a := newAgent(app, server)
+	defer a.Close()
+	if drop, err := a.flooded("Room.Chat", false); drop || err != nil {
+		t.Fatalf("first message should be allowed")
+	}
+	if drop, err := a.flooded("", true); drop || err != nil {
+		t.Fatalf("heartbeat should be limited separately")
+	}
+	if drop, err := a.flooded("Room.Chat", false); drop || err != nil {
+		t.Fatalf("first violation should be warned only")
+	}
+	if drop, err := a.flooded("Room.Chat", false); !drop || err != nil {
+		t.Fatalf("second violation should be dropped")
+	}
+	if drop, err := a.flooded("Room.Chat", false); !drop || err == nil {
+		t.Fatalf("session should be kicked")
+	}
+}
+
+func TestFloodState_Sample(t *testing.T) {
+	now := time.Now()
+	f := &floodState{}
+	if n, ok := f.sample(floodWarn, now); !ok || n != 0 {
+		t.Fatalf("first violation should be reported")
+	}
+	for i := 0; i < 3; i++ {
+		if _, ok := f.sample(floodWarn, now.Add(time.Millisecond)); ok {
+			t.Fatalf("violation within interval should be suppressed")
+		}
+	}
+	if n, ok := f.sample(floodDrop, now.Add(time.Millisecond)); !ok || n != 3 {
+		t.Fatalf("first violation of action should be reported with suppressed, got %d, %t", n, ok)
+	}
+	if n, ok := f.sample(floodDrop, now.Add(floodReportInterval+time.Millisecond)); !ok || n != 0 {
+		t.Fatalf("violation after interval should be reported, got %d, %t", n, ok)
+	}
+}
+
+func TestAgent_FloodedRequest(t *testing.T) {
+	app := NewApp()
+	app.SetClock(NewManualClock(time.Now()))
+	app.SetFloodControl(&FloodControl{Rate: 1, Burst: 1})
+
+	client, server := net.Pipe()
+	defer client.Close()
+	a := newAgent(app, server)
+	defer a.Close()
+	a.setStatus(statusWorking)
+
+	data, err := app.routes.Encode(&message.Message{Type: message.Request, ID: 1, Route: "Room.Chat", Data: []byte("{}")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.handler.processPacket(a, &packet.Packet{Type: packet.Data, Data: data})
+	<-a.chSend // route not found
+
+	// the request dropped is responded with error
+	app.handler.processPacket(a, &packet.Packet{Type: packet.Data, Data: data})
+	m := <-a.chSend
+	e := &Error{}
+	if err := json.Unmarshal(m.payload.([]byte), e); err != nil {
+		t.Fatal(err)
+	}
+	if m.typ != message.Response || m.mid != 1 || e.Code != CodeRateLimited {
+		t.Fatalf("unexpected response %+v, %+v", m, e)
+	}
+}
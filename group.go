@@ -44,14 +44,26 @@ type Group struct {
 	status   int32                      // channel current status
 	name     string                     // channel name
 	sessions map[int64]*session.Session // session id map to session instance
+	app      *App                       // application which group belongs to
 }
 
 // NewGroup returns a new group instance
 func NewGroup(n string) *Group {
+	return newGroup(defaultApp, n)
+}
+
+// NewGroup returns a new group instance of the application, the messages
+// are serialized by the serializer of application
+func (app *App) NewGroup(n string) *Group {
+	return newGroup(app, n)
+}
+
+func newGroup(app *App, n string) *Group {
 	return &Group{
 		status:   groupStatusWorking,
 		name:     n,
 		sessions: make(map[int64]*session.Session),
+		app:      app,
 	}
 }
 
@@ -88,13 +100,13 @@ func (c *Group) Multicast(route string, v interface{}, filter SessionFilter) err
 		return ErrClosedGroup
 	}
 
-	data, err := serializeOrRaw(v)
+	data, err := c.app.serializeOrRaw(v)
 	if err != nil {
 		return err
 	}
 
-	if env.debug {
-		logger.Println(fmt.Sprintf("Type=Multicast Route=%s, Data=%+v", route, v))
+	if c.app.debugEnabled(LogGroup) {
+		c.app.log().Println(fmt.Sprintf("Type=Multicast Route=%s, Data=%+v", route, v))
 	}
 
 	c.mu.RLock()
@@ -105,7 +117,7 @@ func (c *Group) Multicast(route string, v interface{}, filter SessionFilter) err
 			continue
 		}
 		if err = s.Push(route, data); err != nil {
-			logger.Println(err.Error())
+			c.app.log().Println(err.Error())
 		}
 	}
 
@@ -118,13 +130,13 @@ func (c *Group) Broadcast(route string, v interface{}) error {
 		return ErrClosedGroup
 	}
 
-	data, err := serializeOrRaw(v)
+	data, err := c.app.serializeOrRaw(v)
 	if err != nil {
 		return err
 	}
 
-	if env.debug {
-		logger.Println(fmt.Sprintf("Type=Broadcast Route=%s, Data=%+v", route, v))
+	if c.app.debugEnabled(LogGroup) {
+		c.app.log().Println(fmt.Sprintf("Type=Broadcast Route=%s, Data=%+v", route, v))
 	}
 
 	c.mu.RLock()
@@ -132,7 +144,7 @@ func (c *Group) Broadcast(route string, v interface{}) error {
 
 	for _, s := range c.sessions {
 		if err = s.Push(route, data); err != nil {
-			logger.Println(fmt.Sprintf("Session push message error, ID=%d, UID=%d, Error=%s", s.ID(), s.UID(), err.Error()))
+			c.app.log().Println(fmt.Sprintf("Session push message error, ID=%d, UID=%d, Error=%s", s.ID(), s.UID(), err.Error()))
 		}
 	}
 
@@ -151,8 +163,8 @@ func (c *Group) Add(session *session.Session) error {
 		return ErrClosedGroup
 	}
 
-	if env.debug {
-		logger.Println(fmt.Sprintf("Add session to group %s, ID=%d, UID=%d", c.name, session.ID(), session.UID()))
+	if c.app.debugEnabled(LogGroup) {
+		c.app.log().Println(fmt.Sprintf("Add session to group %s, ID=%d, UID=%d", c.name, session.ID(), session.UID()))
 	}
 
 	c.mu.Lock()
@@ -174,8 +186,8 @@ func (c *Group) Leave(s *session.Session) error {
 		return ErrClosedGroup
 	}
 
-	if env.debug {
-		logger.Println(fmt.Sprintf("Remove session from group %s, UID=%d", c.name, s.UID()))
+	if c.app.debugEnabled(LogGroup) {
+		c.app.log().Println(fmt.Sprintf("Remove session from group %s, UID=%d", c.name, s.UID()))
 	}
 
 	c.mu.Lock()
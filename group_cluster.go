@@ -0,0 +1,248 @@
+// Copyright (c) nano Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package nano
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/kensomanpow/nano/cluster"
+	"github.com/kensomanpow/nano/session"
+)
+
+const (
+	groupOpJoin      = "join"
+	groupOpLeave     = "leave"
+	groupOpBroadcast = "broadcast"
+	groupOpSync      = "sync"    // request the local members of other nodes
+	groupOpMembers   = "members" // local members of node, reply of sync
+)
+
+type (
+	// DistributedGroup represents a session group which members could live on
+	// any node of the cluster. Joins and leaves are replicated to all nodes
+	// that hold the same group via the cluster bus, and broadcast is fanned
+	// out once per node rather than once per member.
+	DistributedGroup struct {
+		*Group                  // members in current node
+		mu     sync.RWMutex     // protect remote
+		bus    cluster.Bus      // cluster message bus
+		remote map[int64]string // remote member uid map to node id
+	}
+
+	groupEvent struct {
+		Op    string  `json:"op"`
+		Node  string  `json:"node"`
+		UID   int64   `json:"uid,omitempty"`
+		UIDs  []int64 `json:"uids,omitempty"`
+		Route string  `json:"route,omitempty"`
+		Data  []byte  `json:"data,omitempty"`
+	}
+)
+
+// NewDistributedGroup returns a new distributed group instance, groups that
+// have the same name on different nodes share members
+func NewDistributedGroup(name string, bus cluster.Bus) (*DistributedGroup, error) {
+	return defaultApp.NewDistributedGroup(name, bus)
+}
+
+// NewDistributedGroup returns a new distributed group instance of the
+// application, which is identified by the node id of application in cluster.
+// The members that joined on other nodes before the group created are synced
+// from the nodes which hold the same group
+func (app *App) NewDistributedGroup(name string, bus cluster.Bus) (*DistributedGroup, error) {
+	g := &DistributedGroup{
+		Group:  newGroup(app, name),
+		bus:    bus,
+		remote: make(map[int64]string),
+	}
+
+	if err := bus.Subscribe(g.subject(), g.onEvent); err != nil {
+		return nil, err
+	}
+	if err := bus.Subscribe(g.nodeSubject(app.env.nodeID), g.onEvent); err != nil {
+		return nil, err
+	}
+
+	// remote members are gone with their node
+	cluster.OnNodeLeave(func(node *cluster.Node) {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+
+		for uid, id := range g.remote {
+			if id == node.ID {
+				delete(g.remote, uid)
+			}
+		}
+	})
+
+	if err := g.publish(g.subject(), &groupEvent{Op: groupOpSync}); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// subject returns the subject which membership events published to
+func (g *DistributedGroup) subject() string {
+	return "nano.group." + g.name
+}
+
+// nodeSubject returns the subject which broadcasts of node published to
+func (g *DistributedGroup) nodeSubject(node string) string {
+	return fmt.Sprintf("nano.group.%s.%s", g.name, node)
+}
+
+func (g *DistributedGroup) publish(subject string, e *groupEvent) error {
+	e.Node = g.app.env.nodeID
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return g.bus.Publish(subject, data)
+}
+
+func (g *DistributedGroup) onEvent(data []byte) {
+	e := &groupEvent{}
+	if err := json.Unmarshal(data, e); err != nil {
+		g.app.log().Println(fmt.Sprintf("nano/group: invalid group event, Group=%s, Error=%s", g.name, err.Error()))
+		return
+	}
+
+	// ignore events published by current node
+	if e.Node == g.app.env.nodeID {
+		return
+	}
+
+	switch e.Op {
+	case groupOpJoin:
+		g.mu.Lock()
+		g.remote[e.UID] = e.Node
+		g.mu.Unlock()
+
+	case groupOpLeave:
+		g.mu.Lock()
+		if g.remote[e.UID] == e.Node {
+			delete(g.remote, e.UID)
+		}
+		g.mu.Unlock()
+
+	case groupOpSync:
+		members := g.Group.Members()
+		if len(members) == 0 {
+			return
+		}
+		if err := g.publish(g.nodeSubject(e.Node), &groupEvent{Op: groupOpMembers, UIDs: members}); err != nil {
+			g.app.log().Println(fmt.Sprintf("nano/group: reply members error, Group=%s, Error=%s", g.name, err.Error()))
+		}
+
+	case groupOpMembers:
+		g.mu.Lock()
+		for _, uid := range e.UIDs {
+			g.remote[uid] = e.Node
+		}
+		g.mu.Unlock()
+
+	case groupOpBroadcast:
+		if err := g.Group.Broadcast(e.Route, e.Data); err != nil {
+			g.app.log().Println(fmt.Sprintf("nano/group: broadcast remote message error, Group=%s, Error=%s", g.name, err.Error()))
+		}
+	}
+}
+
+// Add add session to group and replicate the membership to other nodes, the
+// session should bind UID before join the group
+func (g *DistributedGroup) Add(s *session.Session) error {
+	if err := g.Group.Add(s); err != nil {
+		return err
+	}
+	return g.publish(g.subject(), &groupEvent{Op: groupOpJoin, UID: s.UID()})
+}
+
+// Leave remove session from group and replicate the membership to other nodes
+func (g *DistributedGroup) Leave(s *session.Session) error {
+	if err := g.Group.Leave(s); err != nil {
+		return err
+	}
+	return g.publish(g.subject(), &groupEvent{Op: groupOpLeave, UID: s.UID()})
+}
+
+// Members returns all member's UID in the whole cluster
+func (g *DistributedGroup) Members() []int64 {
+	members := g.Group.Members()
+
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	for uid := range g.remote {
+		members = append(members, uid)
+	}
+	return members
+}
+
+// Contains check whether a UID is contained in the group of any node
+func (g *DistributedGroup) Contains(uid int64) bool {
+	if g.Group.Contains(uid) {
+		return true
+	}
+
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	_, ok := g.remote[uid]
+	return ok
+}
+
+// Count get member amount in the whole cluster
+func (g *DistributedGroup) Count() int {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return g.Group.Count() + len(g.remote)
+}
+
+// Broadcast push the message to all members in the cluster, message will be
+// published once for each node which has members
+func (g *DistributedGroup) Broadcast(route string, v interface{}) error {
+	data, err := g.app.serializeOrRaw(v)
+	if err != nil {
+		return err
+	}
+
+	if err := g.Group.Broadcast(route, data); err != nil && err != ErrClosedGroup {
+		g.app.log().Println(fmt.Sprintf("nano/group: broadcast local message error, Group=%s, Error=%s", g.name, err.Error()))
+	}
+
+	g.mu.RLock()
+	nodes := make(map[string]struct{})
+	for _, node := range g.remote {
+		nodes[node] = struct{}{}
+	}
+	g.mu.RUnlock()
+
+	for node := range nodes {
+		e := &groupEvent{Op: groupOpBroadcast, Route: route, Data: data}
+		if err := g.publish(g.nodeSubject(node), e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
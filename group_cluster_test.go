@@ -0,0 +1,83 @@
+package nano
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/kensomanpow/nano/cluster"
+	"github.com/kensomanpow/nano/session"
+)
+
+func TestDistributedGroup(t *testing.T) {
+	bus := cluster.NewMemoryBus()
+	g, err := NewDistributedGroup("test_distributed", bus)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	remote := func(subject string, e *groupEvent) {
+		e.Node = "remote"
+		data, _ := json.Marshal(e)
+		bus.Publish(subject, data)
+	}
+
+	remote(g.subject(), &groupEvent{Op: groupOpJoin, UID: 7})
+	remote(g.subject(), &groupEvent{Op: groupOpJoin, UID: 8})
+	if !g.Contains(7) || g.Count() != 2 {
+		t.Fatalf("remote members should be replicated, members: %v", g.Members())
+	}
+
+	var published []*groupEvent
+	bus.Subscribe(g.nodeSubject("remote"), func(data []byte) {
+		e := &groupEvent{}
+		json.Unmarshal(data, e)
+		published = append(published, e)
+	})
+	if err := g.Broadcast("test.broadcast", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if len(published) != 1 || published[0].Route != "test.broadcast" || string(published[0].Data) != "hello" {
+		t.Fatalf("broadcast should be published once per node, got: %v", published)
+	}
+
+	remote(g.subject(), &groupEvent{Op: groupOpLeave, UID: 7})
+	if g.Contains(7) || g.Count() != 1 {
+		t.Fatal("remote member should leave")
+	}
+
+	cluster.Join(&cluster.Node{ID: "remote"})
+	cluster.Leave("remote")
+	if g.Count() != 0 {
+		t.Fatal("members of left node should be removed")
+	}
+}
+
+func TestDistributedGroup_Sync(t *testing.T) {
+	bus := cluster.NewMemoryBus()
+	a, b := NewApp(), NewApp()
+	if a.env.nodeID == b.env.nodeID {
+		t.Fatalf("applications should have distinct node ids, got %s", a.env.nodeID)
+	}
+
+	ga, err := a.NewDistributedGroup("test_sync", bus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := session.New(nil)
+	s.Bind(5)
+	if err := ga.Add(s); err != nil {
+		t.Fatal(err)
+	}
+
+	// the member joined before the group created on node b is synced
+	gb, err := b.NewDistributedGroup("test_sync", bus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !gb.Contains(5) || gb.Count() != 1 {
+		t.Fatalf("members should be synced, members: %v", gb.Members())
+	}
+	if ga.Count() != 1 {
+		t.Fatalf("member should not be counted twice, members: %v", ga.Members())
+	}
+}
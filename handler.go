@@ -21,14 +21,17 @@
 package nano
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"net"
 	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/kensomanpow/nano/cluster"
 	"github.com/kensomanpow/nano/component"
-	"github.com/kensomanpow/nano/internal/codec"
 	"github.com/kensomanpow/nano/internal/message"
 	"github.com/kensomanpow/nano/internal/packet"
 	"github.com/kensomanpow/nano/session"
@@ -36,69 +39,56 @@ import (
 
 type HandShakeData struct {
 	Token             string
+	DeviceID          string // device ID of client, see BanDevice
 	GameID            uint32
 	FishLaunchVersion string
+	Trace             map[string]string // trace context of session, eg: W3C traceparent
 	Sys               struct {
-		Type    string
-		Version string
+		Type     string
+		Version  string
+		Protocol int  // latest protocol version client supports
+		Fragment bool // client supports packet fragmentation
+		Compress bool // client supports message body compression
+		Checksum bool // client supports packet checksum
+
+		Capabilities Capability // capabilities client supports
+
+		Nonce     string // unique nonce of handshake, see ReplayProtection
+		Timestamp int64  // unix milliseconds when handshake signed
+		Signature string // HMAC of nonce, timestamp and token
 	}
 }
 
 // Unhandled message buffer size
 const packetBacklog = 1024
 
-var (
-	// handler service singleton
-	handler = newHandlerService()
-
-	// serialized data
-	hrd []byte // handshake response data
-	hbd []byte // heartbeat packet data
-)
-
-func hbdEncode() {
-	data, err := json.Marshal(map[string]interface{}{
-		"code": 200,
-		"sys": map[string]interface{}{
-			"heartbeat": env.heartbeat.Seconds(),
-			"dict":      env.dict,
-			"version":   env.version,
-			"payLoad":   env.payload,
-		},
-	})
-	if err != nil {
-		panic(err)
-	}
-
-	hrd, err = codec.Encode(packet.Handshake, data)
-	if err != nil {
-		panic(err)
-	}
-
-	hbd, err = codec.Encode(packet.Heartbeat, nil)
-	if err != nil {
-		panic(err)
-	}
-}
-
 type (
 	handlerService struct {
-		services       map[string]*component.Service // all registered service
-		handlers       map[string]*component.Handler // all handler method
-		chLocalProcess chan unhandledMessage         // packets that process locally
-		chCloseSession chan *session.Session         // closed session
+		app             *App                          // application which the handlers belong to
+		mu              sync.RWMutex                  // protect services & handlers
+		services        map[string]*component.Service // all registered service
+		handlers        map[string]*component.Handler // all handler method
+		chLocalProcess  chan unhandledMessage         // packets that process locally
+		chCloseSession  chan *session.Session         // closed session
+		lastBeat        int64                         // unix nano of last dispatch loop beat
+		maxLocalProcess int64                         // max depth of chLocalProcess
+		maxCloseSession int64                         // max depth of chCloseSession
 	}
 
 	unhandledMessage struct {
 		agent   *agent
 		lastMid uint
+		route   string
 		handler reflect.Method
 		args    []reflect.Value
+		ctx     context.Context // request context
+		span    Span            // nil if not traced
 	}
 )
 
-func newHandlerService() *handlerService {
+func newHandlerService(app *App) *handlerService {
 	h := &handlerService{
+		app:            app,
 		services:       make(map[string]*component.Service),
 		handlers:       make(map[string]*component.Handler),
 		chLocalProcess: make(chan unhandledMessage, packetBacklog),
@@ -108,134 +98,321 @@ func newHandlerService() *handlerService {
 	return h
 }
 
-// call handler with protected
-func pcall(method reflect.Method, args []reflect.Value) {
+// call handler with protected, returns the error returned by handler or
+// recovered from panic, the slow executions are recorded
+func pcall(m unhandledMessage) (err error) {
+	start := time.Now()
 	defer func() {
-		if err := recover(); err != nil {
-			logger.Println(fmt.Sprintf("nano/dispatch: %v", err))
-			println(stack())
+		if e := recover(); e != nil {
+			st := stack()
+			err = fmt.Errorf("nano/dispatch: %v", e)
+			logRequest(m.agent.session, RequestID(m.ctx)).Error("nano/dispatch: handler panic", "route", m.route, "error", err)
+			println(st)
+			m.agent.app.reportError(err, ErrorContext{
+				Source:    ErrorSourceHandler,
+				Route:     m.route,
+				Session:   m.agent.session,
+				RequestID: RequestID(m.ctx),
+				Panic:     true,
+				Stack:     st,
+			})
 		}
+		m.agent.app.recordHandler(m.route, m.agent.session, time.Since(start))
 	}()
 
-	if r := method.Func.Call(args); len(r) > 0 {
-		if err := r[0].Interface(); err != nil {
-			logger.Println(err.(error).Error())
+	if r := m.handler.Func.Call(m.args); len(r) > 0 {
+		if e := r[0].Interface(); e != nil {
+			err = e.(error)
+			logRequest(m.agent.session, RequestID(m.ctx)).Error("nano/dispatch: handler error", "route", m.route, "error", err)
+			m.agent.app.reportError(err, ErrorContext{Source: ErrorSourceHandler, Route: m.route, Session: m.agent.session, RequestID: RequestID(m.ctx)})
 		}
 	}
+	return err
 }
 
-func onSessionClosed(s *session.Session) {
+func (h *handlerService) onSessionClosed(s *session.Session) {
 	defer func() {
 		if err := recover(); err != nil {
-			logger.Println(fmt.Sprintf("nano/onSessionClosed: %v", err))
+			h.app.log().Println(fmt.Sprintf("nano/onSessionClosed: %v", err))
 			println(stack())
 		}
 	}()
 
-	env.muCallbacks.RLock()
-	defer env.muCallbacks.RUnlock()
+	h.app.env.muCallbacks.RLock()
+	defer h.app.env.muCallbacks.RUnlock()
 
-	if len(env.callbacks) < 1 {
+	if len(h.app.env.callbacks) < 1 {
 		return
 	}
 
-	for _, fn := range env.callbacks {
+	for _, fn := range h.app.env.callbacks {
 		fn(s)
 	}
 }
 
 // dispatch message to corresponding logic handler
 func (h *handlerService) dispatch() {
-	// close chLocalProcess & chCloseSession when application quit
-	defer func() {
-		close(h.chLocalProcess)
-		close(h.chCloseSession)
-		globalTicker.Stop()
-	}()
+	// beat periodically to report the dispatch loop alive
+	ticker := time.NewTicker(probeInterval)
+	defer ticker.Stop()
+	h.beat(time.Now())
 
 	// handle packet that sent to chLocalProcess
 	for {
 		select {
 		case m := <-h.chLocalProcess: // logic dispatch
-			if m.agent.status() != statusClosed {
-				m.agent.lastMid = m.lastMid
-				go pcall(m.handler, m.args)
-			}
+			h.process(m, false)
 
 		case s := <-h.chCloseSession: // session closed callback
-			onSessionClosed(s)
-
-		case <-globalTicker.C: // execute cron task
-			cron()
+			h.onSessionClosed(s)
 
-		case t := <-timerManager.chCreatedTimer: // new timers
-			timerManager.timers[t.id] = t
+		case now := <-ticker.C:
+			h.beat(now)
 
-		case id := <-timerManager.chClosingTimer: // closing timers
-			delete(timerManager.timers, id)
+		case <-h.app.env.die: // application quit signal
+			h.discard()
+			return
+		}
+	}
+}
 
-		case <-env.die: // application quit signal
+// discard drops the messages not dispatched when the application quit, and
+// ends their spans
+func (h *handlerService) discard() {
+	for {
+		select {
+		case m := <-h.chLocalProcess:
+			endSpan(m.span, ErrSessionClosed)
+		default:
 			return
 		}
 	}
 }
 
+// process calls the handler of message in a new goroutine, or in current
+// goroutine if sync
+func (h *handlerService) process(m unhandledMessage, sync bool) {
+	if m.agent.status() == statusClosed {
+		endSpan(m.span, ErrSessionClosed)
+		return
+	}
+
+	cancel := context.CancelFunc(func() {})
+	if d := h.app.env.handlerTimeout; d > 0 && m.lastMid > 0 {
+		m.ctx, cancel = context.WithTimeout(m.ctx, d)
+	}
+
+	m.agent.lastMid = m.lastMid
+	m.agent.session.SetRequestContext(m.ctx)
+	m.agent.app.notify(EventDispatched, m.agent.session, m.route)
+	if sync {
+		h.call(m, cancel)
+		return
+	}
+	go h.call(m, cancel)
+}
+
+// call calls the handler of message, the request which handler returns an
+// error after the timeout exceeded is responded with ErrHandlerTimeout
+func (h *handlerService) call(m unhandledMessage, cancel context.CancelFunc) {
+	defer cancel()
+
+	err := pcall(m)
+	if err != nil && m.ctx.Err() == context.DeadlineExceeded {
+		e := wrapError(ErrHandlerTimeout, m.route, err)
+		replyError(m.agent, m.lastMid, e)
+		err = e
+	}
+	endSpan(m.span, err)
+}
+
+// drain dispatches the pending messages and closed sessions without
+// blocking, the handlers are called in current goroutine, and returns the
+// count of messages and sessions processed
+func (h *handlerService) drain() int {
+	for n := 0; ; n++ {
+		select {
+		case m := <-h.chLocalProcess:
+			h.process(m, true)
+		case s := <-h.chCloseSession:
+			h.onSessionClosed(s)
+		default:
+			h.beat(time.Now())
+			return n
+		}
+	}
+}
+
 func (h *handlerService) register(comp component.Component, opts []component.Option) error {
+	_, err := h.registerDict(comp, opts)
+	return err
+}
+
+// registerDict registers the handlers of component, and returns the
+// dictionary of new routes
+func (h *handlerService) registerDict(comp component.Component, opts []component.Option) (map[string]uint16, error) {
+	s, err := h.newService(comp, opts)
+	if err != nil {
+		return nil, err
+	}
+	return h.registerService(s)
+}
+
+// newService extracts the handlers of component without registering them,
+// the service must not be defined
+func (h *handlerService) newService(comp component.Component, opts []component.Option) (*component.Service, error) {
 	s := component.NewService(comp, opts)
 
-	if _, ok := h.services[s.Name]; ok {
-		return fmt.Errorf("handler: service already defined: %s", s.Name)
+	h.mu.RLock()
+	_, ok := h.services[s.Name]
+	h.mu.RUnlock()
+	if ok {
+		return nil, fmt.Errorf("handler: service already defined: %s", s.Name)
 	}
 
 	if err := s.ExtractHandler(); err != nil {
-		return err
+		return nil, err
+	}
+	return s, nil
+}
+
+// registerService registers the handlers of service, and returns the
+// dictionary of new routes
+func (h *handlerService) registerService(s *component.Service) (map[string]uint16, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.services[s.Name]; ok {
+		return nil, fmt.Errorf("handler: service already defined: %s", s.Name)
 	}
 
 	// register all handlers
 	h.services[s.Name] = s
-	for name, handler := range s.Handlers {
+	var last uint16
+	for _, code := range h.app.env.dict {
+		if code > last {
+			last = code
+		}
+	}
+	// assign codes in name order, so that the codes are same across nodes
+	// which register the same components in same order
+	names := make([]string, 0, len(s.Handlers))
+	for name := range s.Handlers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	dict := make(map[string]uint16, len(s.Handlers))
+	assigned := make(map[string]uint16, len(s.Handlers))
+	for _, name := range names {
 		fullName := fmt.Sprintf("%s.%s", s.Name, name)
-		// compressed route start index from 1
-		env.dict[fullName] = uint16(len(env.dict)) + 1
-		h.handlers[fullName] = handler
+		// compressed route start index from 1, the preset codes are kept
+		// and have been set to dictionary
+		code, ok := h.app.env.dict[fullName]
+		if !ok {
+			last++
+			code = last
+			h.app.env.dict[fullName] = code
+			assigned[fullName] = code
+		}
+		dict[fullName] = code
+		h.handlers[fullName] = s.Handlers[name]
 	}
-	message.SetDictionary(env.dict)
+	h.app.routes.Set(assigned)
 
-	return nil
+	return dict, nil
+}
+
+// dictionary returns a copy of route dictionary
+func (h *handlerService) dictionary() map[string]uint16 {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	dict := make(map[string]uint16, len(h.app.env.dict))
+	for route, code := range h.app.env.dict {
+		dict[route] = code
+	}
+	return dict
 }
 
-func (h *handlerService) handle(conn net.Conn) {
+func (h *handlerService) handle(conn net.Conn, o *options) {
+	// take a slot before any resource allocated for the connection
+	if l := h.app.env.ipLimiter; l != nil {
+		if !h.app.acquireIP(l, conn, o) {
+			return
+		}
+		defer l.release(remoteIP(conn))
+	}
+	if l := h.app.loadConnLimiter(); l != nil {
+		if !l.acquire(h.app, conn, o) {
+			return
+		}
+		defer l.release()
+	}
+
+	// the client certificate is verified before the agent created
+	if err := tlsHandshake(conn, h.app.env.handshakeTimeout); err != nil {
+		h.app.log().Println(err.Error())
+		conn.Close()
+		return
+	}
+
 	// create a client agent and startup write gorontine
-	agent := newAgent(conn)
+	agent := newAgentInGroup(h.app, conn, h.app.agents, o.codec)
+	if id := peerIdentity(conn); id != nil {
+		agent.session.Set(PeerIdentityKey, id)
+	}
+	if c, ok := conn.(*wsConn); ok {
+		for k, v := range c.values {
+			agent.session.Set(k, v)
+		}
+		if p := c.conn.Subprotocol(); p != "" {
+			agent.session.Set(WSSubprotocolKey, p)
+		}
+	}
 
 	// startup write goroutine
 	go agent.write()
+	if d := h.app.env.handshakeTimeout; d > 0 {
+		go agent.awaitHandshake(d)
+	}
+	h.app.notify(EventAccepted, agent.session, "")
 
-	if env.debug {
-		logger.Println(fmt.Sprintf("New session established: %s", agent.String()))
+	if h.app.debugEnabled(LogSession) {
+		logSession(agent.session).Debug("New session established", "remote", agent.conn.RemoteAddr())
 	}
 
-	// guarantee agent related resource be destroyed
+	// guarantee agent related resource be destroyed, the kick packet queued
+	// is written before
 	defer func() {
+		if atomic.LoadInt32(&agent.kickQueue) > 0 {
+			agent.awaitKick()
+		}
 		agent.Close()
-		if env.debug {
-			logger.Println(fmt.Sprintf("Session read goroutine exit, SessionID=%d, UID=%d", agent.session.ID(), agent.session.UID()))
+		if h.app.debugEnabled(LogSession) {
+			logSession(agent.session).Debug("Session read goroutine exit")
 		}
 	}()
 
 	// read loop
-	buf := make([]byte, 2048)
+	buf := newReadBuffer(o.readBufferSize)
+	defer buf.release()
 	for {
-		n, err := conn.Read(buf)
+		n, err := conn.Read(buf.bytes())
+		agent.countIn(n)
 		if err != nil {
-			logger.Println(fmt.Sprintf("Read message error: %s, session will be closed immediately", err.Error()))
+			logSession(agent.session).Info("Read message error, session will be closed immediately", "error", err)
 			return
 		}
 
-		// TODO(warning): decoder use slice for performance, packet data should be copy before next Decode
-		packets, err := agent.decoder.Decode(buf[:n])
+		// packets own their data, buf could be reused by next Read
+		packets, err := agent.decoder.Decode(buf.bytes()[:n])
+		buf.adapt(n)
 		if err != nil {
-			logger.Println(err.Error())
+			logSession(agent.session).Warn("Decode packet error", "error", err, "remote", conn.RemoteAddr())
+			if err == ErrPacketSizeExceed {
+				agent.kickPacket(err.Error())
+			}
 			return
 		}
 
@@ -246,7 +423,10 @@ func (h *handlerService) handle(conn net.Conn) {
 		// process all packet
 		for i := range packets {
 			if err := h.processPacket(agent, packets[i]); err != nil {
-				logger.Println(err.Error())
+				logSession(agent.session).Warn("Process packet error", "error", err)
+				if err == errRejected {
+					agent.awaitKick()
+				}
 				return
 			}
 		}
@@ -254,35 +434,109 @@ func (h *handlerService) handle(conn net.Conn) {
 }
 
 func (h *handlerService) processPacket(agent *agent, p *packet.Packet) error {
+	capturePacket(agent, p)
+
 	switch p.Type {
 	case packet.Handshake:
 		var handShakeData *HandShakeData
-		serializer.Unmarshal(p.Data, &handShakeData)
-		if env.authFunc != nil {
-			errMsg := env.authFunc(agent.session, handShakeData)
-			if errMsg != nil {
-				agent.Kick(errMsg)
-			} else {
-				if _, err := agent.conn.Write(hrd); err != nil {
-					return err
-				}
-
-				agent.session.Auth = true
-				agent.setStatus(statusHandshake)
-				if env.debug {
-					logger.Println(fmt.Sprintf("Session handshake Id=%d, Remote=%s", agent.session.ID(), agent.conn.RemoteAddr()))
-				}
+		h.app.unmarshalSystem(p.Data, &handShakeData)
+		version := ProtocolLegacy
+		if handShakeData != nil {
+			version = negotiateProtocol(handShakeData.Sys.Protocol)
+			agent.session.Set(cluster.GameIDKey, handShakeData.GameID)
+			if handShakeData.DeviceID != "" {
+				agent.session.Set(DeviceIDKey, handShakeData.DeviceID)
 			}
-		} else {
-			if _, err := agent.conn.Write(hrd); err != nil {
-				return err
+			if len(handShakeData.Trace) > 0 {
+				agent.session.Set(TraceKey, handShakeData.Trace)
+			}
+		}
+		if version < h.app.env.minProtocol {
+			agent.kickPacket("protocol version not supported")
+			return fmt.Errorf("protocol version %d is not supported, session will be closed immediately, remote=%s",
+				version, agent.conn.RemoteAddr().String())
+		}
+		agent.protocol = version
+		agent.handshake.Store(handShakeData)
+		agent.session.Set(ProtocolKey, version)
+		if version >= ProtocolCapabilities && handShakeData.Sys.Fragment {
+			atomic.StoreInt32(&agent.fragment, 1)
+		}
+		if version >= ProtocolCapabilities {
+			agent.capabilities = h.app.negotiateCapabilities(handShakeData)
+			agent.session.Set(CapabilitiesKey, agent.capabilities)
+		}
+		if agent.capabilities.Has(CapCompress) {
+			atomic.StoreInt32(&agent.compress, 1)
+		}
+		if version >= ProtocolTimestamp {
+			atomic.StoreInt32(&agent.timestamp, 1)
+		}
+		if version >= ProtocolDictionary {
+			atomic.StoreInt32(&agent.dictPush, 1)
+		}
+		if version >= ProtocolCapabilities && handShakeData.Sys.Checksum && h.app.env.checksum {
+			atomic.StoreInt32(&agent.checksum, 1)
+		}
+		if g := h.app.env.replayGuard; g != nil {
+			if err := g.verify(handShakeData, h.app.clock.Now()); err != nil {
+				auditSecurity(agent, SecurityAuthFailed, "", err.Error())
+				return agent.reject(wrapError(ErrUnauthorized, "", err).payload())
+			}
+		}
+		if agent.rejectBanned() {
+			return errRejected
+		}
+		if h.app.env.authFunc != nil {
+			if errMsg := h.app.env.authFunc(agent.session, handShakeData); errMsg != nil {
+				auditSecurity(agent, SecurityAuthFailed, "", errMsg)
+				return agent.reject(errMsg)
+			}
+			// the UID is bound by auth function
+			if agent.rejectBanned() {
+				return errRejected
 			}
+			agent.session.Auth = true
+		}
+		if err := agent.writeHandshake(); err != nil {
+			return err
+		}
+		agent.setStatus(statusHandshake)
+		if h.app.debugEnabled(LogHandshake) {
+			logSession(agent.session).Debug("Session handshake", "remote", agent.conn.RemoteAddr())
 		}
 
 	case packet.HandshakeAck:
+		if agent.status() != statusHandshake {
+			return fmt.Errorf("receive handshake ACK before handshake completed, session will be closed immediately, remote=%s",
+				agent.conn.RemoteAddr().String())
+		}
+		if err := agent.verifyChallenge(p.Data); err != nil {
+			return err
+		}
+		if !atomic.CompareAndSwapInt32(&agent.settled, 0, 1) {
+			return fmt.Errorf("receive handshake ACK after handshake timeout, remote=%s", agent.conn.RemoteAddr().String())
+		}
 		agent.setStatus(statusWorking)
-		if env.debug {
-			logger.Println(fmt.Sprintf("Receive handshake ACK Id=%d, Remote=%s", agent.session.ID(), agent.conn.RemoteAddr()))
+		h.app.notify(EventHandshake, agent.session, "")
+		if h.app.debugEnabled(LogHandshake) {
+			logSession(agent.session).Debug("Receive handshake ACK", "remote", agent.conn.RemoteAddr())
+		}
+
+	case packet.Fragment:
+		if agent.status() < statusWorking {
+			return fmt.Errorf("receive fragment on socket which not yet ACK, session will be closed immediately, remote=%s",
+				agent.conn.RemoteAddr().String())
+		}
+
+		data, err := agent.verifyPacket(p.Data)
+		if err != nil {
+			return err
+		}
+
+		// reassemble fragments until the data packet received
+		if err := agent.appendFragment(data); err != nil {
+			return err
 		}
 
 	case packet.Data:
@@ -290,18 +544,82 @@ func (h *handlerService) processPacket(agent *agent, p *packet.Packet) error {
 			return fmt.Errorf("receive data on socket which not yet ACK, session will be closed immediately, remote=%s",
 				agent.conn.RemoteAddr().String())
 		}
+		if atomic.LoadInt32(&agent.kicked) > 0 {
+			break // the session is closing
+		}
+
+		data, err := agent.verifyPacket(p.Data)
+		if err != nil {
+			return err
+		}
+		if len(agent.fragments) > 0 {
+			if err := agent.appendFragment(data); err != nil {
+				return err
+			}
+			data, agent.fragments = agent.fragments, nil
+		}
 
-		msg, err := message.Decode(p.Data)
+		msg, err := h.app.routes.Decode(data)
 		if err != nil {
 			return err
 		}
+		agent.countMessageIn()
+		if drop, err := agent.flooded(msg.Route, false); err != nil {
+			return err
+		} else if drop {
+			if msg.Type == message.Request {
+				replyError(agent, msg.ID, wrapError(ErrRateLimited, msg.Route, nil))
+			}
+			break
+		}
+		if agent.overQuota() {
+			if h.app.env.bandwidthQuota.Policy == QuotaKick {
+				agent.kickPacket("bandwidth quota exceeded")
+				return fmt.Errorf("bandwidth quota exceeded, session will be closed immediately, remote=%s",
+					agent.conn.RemoteAddr().String())
+			}
+			logSession(agent.session).Debug("nano/bandwidth: message throttled", "route", msg.Route)
+			auditSecurity(agent, SecurityRateLimited, msg.Route, "bandwidth quota exceeded")
+			if msg.Type == message.Request {
+				replyError(agent, msg.ID, wrapError(ErrRateLimited, msg.Route, nil))
+			}
+			break
+		}
+		if msg.Flags&message.Compressed != 0 {
+			if msg.Data, err = decompress(msg.Data, h.app.env.maxMessageSize); err != nil {
+				return err
+			}
+			msg.Flags &^= message.Compressed
+		}
 		h.processMessage(agent, msg)
 
 	case packet.Heartbeat:
-		// expected
+		if drop, err := agent.flooded("", true); err != nil {
+			return err
+		} else if drop {
+			break
+		}
+		if len(p.Data) > 0 {
+			agent.measureRTT(p.Data)
+		}
+		agent.replyHeartbeat()
+
+	default:
+		fn, ok := packetHandler(p.Type)
+		if !ok {
+			return fmt.Errorf("unknown packet type %d, session will be closed immediately, remote=%s",
+				p.Type, agent.conn.RemoteAddr().String())
+		}
+		if agent.status() < statusWorking {
+			return fmt.Errorf("receive custom packet on socket which not yet ACK, session will be closed immediately, remote=%s",
+				agent.conn.RemoteAddr().String())
+		}
+		if err := fn(agent.session, agent, p.Data); err != nil {
+			logSession(agent.session).Error("nano/handler: handle packet error", "type", p.Type, "error", err)
+		}
 	}
 
-	agent.lastAt = time.Now().Unix()
+	agent.lastAt = h.app.clock.Now().Unix()
 	return nil
 }
 
@@ -314,22 +632,59 @@ func (h *handlerService) processMessage(agent *agent, msg *message.Message) {
 		lastMid = 0
 	}
 
+	h.mu.RLock()
 	handler, ok := h.handlers[msg.Route]
+	h.mu.RUnlock()
 	if !ok {
-		logger.Println(fmt.Sprintf("nano/handler: %s not found(forgot registered?)", msg.Route))
+		logSession(agent.session).Warn("nano/handler: route not found(forgot registered?)", "route", msg.Route)
+		replyError(agent, lastMid, wrapError(ErrRouteNotFound, msg.Route, nil))
+		return
+	}
+	if h.app.rateLimited(agent.session) {
+		logSession(agent.session).Warn("nano/handler: rate limited", "route", msg.Route)
+		auditSecurity(agent, SecurityRateLimited, msg.Route, "rate limited")
+		if msg.Type == message.Request {
+			replyError(agent, lastMid, wrapError(ErrRateLimited, msg.Route, nil))
+		}
 		return
 	}
 
-	var payload = msg.Data
-	var err error
-	if len(Pipeline.Inbound.handlers) > 0 {
-		for _, h := range Pipeline.Inbound.handlers {
-			payload, err = h(agent.session, payload)
-			if err != nil {
-				logger.Println(fmt.Sprintf("nano/handler: broken pipeline: %s", err.Error()))
-				return
-			}
+	meta := &PipelineMeta{
+		Route: msg.Route,
+		Type:  msg.Type.String(),
+		ID:    msg.ID,
+		Flags: msg.Flags,
+	}
+	ctx, span, err := h.app.startSpan(agent.session, meta, msg)
+	if err != nil {
+		logSession(agent.session).Warn("nano/handler: start span error", "route", msg.Route, "error", err)
+		return
+	}
+	requestID, err := h.app.identify(meta, msg)
+	if err != nil {
+		logSession(agent.session).Warn("nano/handler: identify request error", "route", msg.Route, "error", err)
+		endSpan(span, err)
+		return
+	}
+	meta.RequestID = requestID
+	ctx = withRequestID(ctx, requestID)
+	log := logRequest(agent.session, requestID)
+
+	h.app.qps.count(msg.Route)
+	observeInbound(msg.Route, len(msg.Data))
+	tapMessage(agent.session, msg.Type, msg.Route, msg.Data)
+
+	payload, err := h.app.Pipeline.Inbound.process(agent.session, meta, msg.Data)
+	if err != nil {
+		log.Warn("nano/handler: broken pipeline", "route", msg.Route, "error", err)
+		h.app.reportError(err, ErrorContext{Source: ErrorSourceInbound, Route: msg.Route, Session: agent.session, RequestID: requestID})
+		if e, ok := err.(*PipelineError); ok {
+			abortMessage(agent, lastMid, e)
+		} else {
+			replyError(agent, lastMid, wrapError(ErrPipelineRejected, msg.Route, err))
 		}
+		endSpan(span, err)
+		return
 	}
 
 	var data interface{}
@@ -337,31 +692,62 @@ func (h *handlerService) processMessage(agent *agent, msg *message.Message) {
 		data = payload
 	} else {
 		data = reflect.New(handler.Type.Elem()).Interface()
-		err := serializer.Unmarshal(payload, data)
+		err := h.app.serializer.Unmarshal(payload, data)
 		if err != nil {
-			logger.Println("deserialize error", err.Error())
+			log.Warn("nano/handler: deserialize error", "route", msg.Route, "error", err)
+			replyError(agent, lastMid, wrapError(ErrSerialize, msg.Route, err))
+			endSpan(span, err)
 			return
 		}
 	}
 
-	if env.debug {
-		logger.Println(fmt.Sprintf("UID=%d, Message={%s}, Data=%+v", agent.session.UID(), msg.String(), data))
+	if h.app.debugEnabled(LogDispatch) {
+		log.Debug("nano/handler: dispatch message", "route", msg.Route, "message", msg.String(), "data", data)
 	}
 
-	agent.session.LastHandlerAccessTime = time.Now()
+	agent.session.LastHandlerAccessTime = h.app.clock.Now()
 	resFunc := func(v interface{}) error {
 		return agent.session.ResponseMID(lastMid, v)
 	}
 	args := []reflect.Value{handler.Receiver, agent.srv, reflect.ValueOf(data)}
 	if msg.Type == message.Request {
 		args = append(args, reflect.ValueOf(resFunc))
+
+		// the route of request is removed when the response written, the
+		// requests dropped before dispatching are never tracked
+		agent.requests.Store(msg.ID, msg.Route)
+	}
+	select {
+	case h.chLocalProcess <- unhandledMessage{agent, lastMid, msg.Route, handler.Method, args, ctx, span}:
+		observeDepth(&h.maxLocalProcess, len(h.chLocalProcess))
+	case <-agent.chDie:
+		agent.requests.Delete(msg.ID)
+		endSpan(span, ErrSessionClosed)
+	case <-h.app.env.die:
+		agent.requests.Delete(msg.ID)
+		endSpan(span, ErrSessionClosed)
+	}
+}
+
+// routes returns all registered routes in order
+func (h *handlerService) routes() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	routes := make([]string, 0, len(h.handlers))
+	for name := range h.handlers {
+		routes = append(routes, name)
 	}
-	h.chLocalProcess <- unhandledMessage{agent, lastMid, handler.Method, args}
+	sort.Strings(routes)
+	return routes
 }
 
 // DumpServices outputs all registered services
 func (h *handlerService) DumpServices() {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
 	for name := range h.handlers {
-		logger.Println("registered service", name)
+		h.app.log().Println("registered service", name)
 	}
 }
@@ -1,8 +1,11 @@
 package nano
 
 import (
+	encjson "encoding/json"
+	"net"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/golang/protobuf/proto"
 	"github.com/kensomanpow/nano/component"
@@ -109,10 +112,10 @@ func (t *TestComp) RawData(s *session.Session, _ []byte) error {
 
 func TestHandlerCallJSON(t *testing.T) {
 	SetSerializer(json.NewSerializer())
-	handler.register(&TestComp{}, nil)
+	defaultApp.handler.register(&TestComp{}, nil)
 
 	m := JSONMessage{Code: 1, Data: "hello world"}
-	data, err := serializeOrRaw(m)
+	data, err := defaultApp.serializeOrRaw(m)
 	if err != nil {
 		t.Fail()
 	}
@@ -122,16 +125,16 @@ func TestHandlerCallJSON(t *testing.T) {
 	msg.Type = message.Request
 	msg.Data = data
 
-	agent := newAgent(nil)
-	handler.processMessage(agent, msg)
+	agent := newAgent(defaultApp, nil)
+	defaultApp.handler.processMessage(agent, msg)
 }
 
 func TestHandlerCallProtobuf(t *testing.T) {
 	SetSerializer(protobuf.NewSerializer())
-	handler.register(&TestComp{}, nil)
+	defaultApp.handler.register(&TestComp{}, nil)
 
 	m := &ProtoMessage{Data: proto.String("hello world")}
-	data, err := serializeOrRaw(m)
+	data, err := defaultApp.serializeOrRaw(m)
 	if err != nil {
 		t.Error(err)
 	}
@@ -141,16 +144,16 @@ func TestHandlerCallProtobuf(t *testing.T) {
 	msg.Type = message.Request
 	msg.Data = data
 
-	agent := newAgent(nil)
-	handler.processMessage(agent, msg)
+	agent := newAgent(defaultApp, nil)
+	defaultApp.handler.processMessage(agent, msg)
 }
 
 func BenchmarkHandlerCallJSON(b *testing.B) {
 	SetSerializer(json.NewSerializer())
-	handler.register(&TestComp{}, nil)
+	defaultApp.handler.register(&TestComp{}, nil)
 
 	m := JSONMessage{Code: 1, Data: "hello world"}
-	data, err := serializeOrRaw(m)
+	data, err := defaultApp.serializeOrRaw(m)
 	if err != nil {
 		b.Fail()
 	}
@@ -160,11 +163,11 @@ func BenchmarkHandlerCallJSON(b *testing.B) {
 	msg.Type = message.Request
 	msg.Data = data
 
-	agent := newAgent(nil)
+	agent := newAgent(defaultApp, nil)
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		handler.processMessage(agent, msg)
+		defaultApp.handler.processMessage(agent, msg)
 	}
 
 	b.ReportAllocs()
@@ -172,10 +175,10 @@ func BenchmarkHandlerCallJSON(b *testing.B) {
 
 func BenchmarkHandlerCallProtobuf(b *testing.B) {
 	SetSerializer(protobuf.NewSerializer())
-	handler.register(&TestComp{}, nil)
+	defaultApp.handler.register(&TestComp{}, nil)
 
 	m := &ProtoMessage{Data: proto.String("hello world")}
-	data, err := serializeOrRaw(m)
+	data, err := defaultApp.serializeOrRaw(m)
 	if err != nil {
 		b.Fail()
 	}
@@ -185,21 +188,21 @@ func BenchmarkHandlerCallProtobuf(b *testing.B) {
 	msg.Type = message.Request
 	msg.Data = data
 
-	agent := newAgent(nil)
+	agent := newAgent(defaultApp, nil)
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		handler.processMessage(agent, msg)
+		defaultApp.handler.processMessage(agent, msg)
 	}
 	b.ReportAllocs()
 }
 
 func BenchmarkHandlerCallRawData(b *testing.B) {
 	SetSerializer(protobuf.NewSerializer())
-	handler.register(&TestComp{}, nil)
+	defaultApp.handler.register(&TestComp{}, nil)
 
 	m := &ProtoMessage{Data: proto.String("hello world")}
-	data, err := serializeOrRaw(m)
+	data, err := defaultApp.serializeOrRaw(m)
 	if err != nil {
 		b.Fail()
 	}
@@ -209,11 +212,70 @@ func BenchmarkHandlerCallRawData(b *testing.B) {
 	msg.Type = message.Request
 	msg.Data = data
 
-	agent := newAgent(nil)
+	agent := newAgent(defaultApp, nil)
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		handler.processMessage(agent, msg)
+		defaultApp.handler.processMessage(agent, msg)
 	}
 	b.ReportAllocs()
 }
+
+func TestProcessMessage_Closed(t *testing.T) {
+	app := NewApp()
+	app.SetSerializer(json.NewSerializer())
+	app.handler.register(&TestComp{}, nil)
+	for i := 0; i < packetBacklog; i++ {
+		app.handler.chLocalProcess <- unhandledMessage{}
+	}
+
+	client, server := net.Pipe()
+	defer client.Close()
+	agent := newAgent(app, server)
+
+	// the message is dropped if the session closed while the queue is full
+	done := make(chan struct{})
+	go func() {
+		msg := &message.Message{Type: message.Request, ID: 1, Route: "TestComp.HandleJSON", Data: []byte("{}")}
+		app.handler.processMessage(agent, msg)
+		close(done)
+	}()
+	agent.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("processing should not block after session closed")
+	}
+	if _, ok := agent.requests.Load(uint(1)); ok {
+		t.Fatalf("request dropped should not be tracked")
+	}
+}
+
+// denyLimiter denies all events
+type denyLimiter struct{}
+
+func (denyLimiter) Allow(string) (bool, error) { return false, nil }
+
+func TestProcessMessage_RateLimited(t *testing.T) {
+	app := NewApp()
+	app.SetSerializer(json.NewSerializer())
+	app.handler.register(&TestComp{}, nil)
+	app.SetRateLimiter(denyLimiter{})
+
+	client, server := net.Pipe()
+	defer client.Close()
+	agent := newAgent(app, server)
+	defer agent.Close()
+
+	// the request dropped by the rate limiter is responded with error
+	msg := &message.Message{Type: message.Request, ID: 1, Route: "TestComp.HandleJSON", Data: []byte("{}")}
+	app.handler.processMessage(agent, msg)
+	m := <-agent.chSend
+	e := &Error{}
+	if err := encjson.Unmarshal(m.payload.([]byte), e); err != nil {
+		t.Fatal(err)
+	}
+	if m.typ != message.Response || m.mid != 1 || e.Code != CodeRateLimited {
+		t.Fatalf("unexpected response %+v, %+v", m, e)
+	}
+}
@@ -0,0 +1,113 @@
+package nano
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/kensomanpow/nano/internal/packet"
+)
+
+// HeartbeatMode represents which side drives the heartbeat
+type HeartbeatMode byte
+
+const (
+	// HeartbeatServer represents the server sends heartbeat every interval,
+	// and the client responds
+	HeartbeatServer HeartbeatMode = iota
+
+	// HeartbeatClient represents the client sends heartbeat every interval,
+	// and the server responds, the clients must send heartbeat actively
+	HeartbeatClient
+)
+
+func (m HeartbeatMode) String() string {
+	if m == HeartbeatClient {
+		return "client"
+	}
+	return "server"
+}
+
+// heartbeat timestamps are big endian unix milliseconds, the server heartbeat
+// carries the server timestamp, and the client echoes the server timestamp
+// followed by the client timestamp optionally
+const timestampSize = 8
+
+// heartbeatPacket returns the heartbeat packet, which carries server
+// timestamp if the client supports
+func (a *agent) heartbeatPacket() []byte {
+	if atomic.LoadInt32(&a.timestamp) == 0 {
+		return a.hbd
+	}
+
+	data := make([]byte, timestampSize)
+	binary.BigEndian.PutUint64(data, uint64(unixMilli(a.app.clock.Now())))
+	p, err := a.codec.Encode(packet.Heartbeat, data)
+	if err != nil {
+		return a.hbd
+	}
+	return p
+}
+
+// replyHeartbeat responds the heartbeat of client in client driven mode
+func (a *agent) replyHeartbeat() {
+	if a.app.env.heartbeatMode != HeartbeatClient || len(a.chSend) >= agentWriteBacklog {
+		return
+	}
+	a.chSend <- pendingMessage{packet: a.heartbeatPacket()}
+}
+
+// timeout reports whether the client missed too many heartbeats
+func (a *agent) timeout(now time.Time) bool {
+	deadline := now.Add(-time.Duration(a.app.env.heartbeatMisses) * a.app.env.heartbeat).Unix()
+	if a.lastAt >= deadline {
+		return false
+	}
+
+	logSession(a.session).Info("Session heartbeat timeout", "lastTime", a.lastAt, "deadline", deadline)
+	if fn := a.app.env.heartbeatTimeout; fn != nil {
+		func() {
+			defer func() {
+				if err := recover(); err != nil {
+					a.app.log().Println(fmt.Sprintf("nano/onHeartbeatTimeout: %v", err))
+					println(stack())
+				}
+			}()
+			fn(a.session)
+		}()
+	}
+	return true
+}
+
+// measureRTT measures round trip time and clock offset by the heartbeat echo
+func (a *agent) measureRTT(data []byte) {
+	if rtt, offset, ok := parseEcho(data, a.app.clock.Now()); ok {
+		a.session.SetRTT(rtt, offset)
+	}
+}
+
+// parseEcho returns the round trip time and clock offset by the heartbeat
+// echo received at now, the clock offset is zero if the client timestamp is
+// absent
+func parseEcho(data []byte, now time.Time) (rtt, offset time.Duration, ok bool) {
+	if len(data) < timestampSize {
+		return 0, 0, false
+	}
+
+	sent := int64(binary.BigEndian.Uint64(data))
+	rtt = time.Duration(unixMilli(now)-sent) * time.Millisecond
+	if rtt < 0 {
+		return 0, 0, false
+	}
+
+	if len(data) >= 2*timestampSize {
+		client := int64(binary.BigEndian.Uint64(data[timestampSize:]))
+		offset = time.Duration(client-sent)*time.Millisecond - rtt/2
+	}
+	return rtt, offset, true
+}
+
+func unixMilli(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
@@ -0,0 +1,61 @@
+package nano
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/kensomanpow/nano/session"
+)
+
+func TestParseEcho(t *testing.T) {
+	now := time.Now()
+	sent := now.Add(-100 * time.Millisecond)
+
+	data := make([]byte, 2*timestampSize)
+	binary.BigEndian.PutUint64(data, uint64(unixMilli(sent)))
+	// client clock is 1s ahead, the echo is sent at the middle of round trip
+	binary.BigEndian.PutUint64(data[timestampSize:], uint64(unixMilli(sent.Add(time.Second+50*time.Millisecond))))
+
+	rtt, offset, ok := parseEcho(data, now)
+	if !ok {
+		t.Fatal("parse echo failed")
+	}
+	if rtt < 99*time.Millisecond || rtt > 101*time.Millisecond {
+		t.Fatalf("unexpected rtt %v", rtt)
+	}
+	if offset < 999*time.Millisecond || offset > 1001*time.Millisecond {
+		t.Fatalf("unexpected offset %v", offset)
+	}
+
+	// without client timestamp
+	if _, offset, ok := parseEcho(data[:timestampSize], now); !ok || offset != 0 {
+		t.Fatalf("unexpected echo, offset=%v, ok=%v", offset, ok)
+	}
+
+	// empty heartbeat of legacy clients
+	if _, _, ok := parseEcho(nil, now); ok {
+		t.Fatal("empty heartbeat should be ignored")
+	}
+}
+
+func TestAgent_Timeout(t *testing.T) {
+	a := newAgent(defaultApp, nil)
+	a.lastAt = time.Now().Add(-90 * time.Second).Unix()
+	defer func(misses int, fn SessionClosedHandler) {
+		defaultApp.env.heartbeatMisses, defaultApp.env.heartbeatTimeout = misses, fn
+	}(defaultApp.env.heartbeatMisses, defaultApp.env.heartbeatTimeout)
+
+	called := false
+	OnHeartbeatTimeout(func(s *session.Session) { called = true })
+
+	SetHeartbeatMisses(4)
+	if a.timeout(time.Now()) || called {
+		t.Fatal("session should be alive in 4 heartbeats")
+	}
+
+	SetHeartbeatMisses(2)
+	if !a.timeout(time.Now()) || !called {
+		t.Fatal("session should timeout after 2 missed heartbeats")
+	}
+}
@@ -21,60 +21,244 @@
 package nano
 
 import (
+	"context"
+	"net"
 	"net/http"
+	"sync/atomic"
 	"time"
 
 	"github.com/kensomanpow/nano/component"
+	"github.com/kensomanpow/nano/service"
 	"github.com/kensomanpow/nano/session"
 )
 
 // Listen listens on the TCP network address addr
 // and then calls Serve with handler to handle requests
-// on incoming connections.
-func Listen(addr string) {
-	listen(addr, false)
+// on incoming connections. It blocks until the application
+// shutdown, and returns the error if the address can not
+// be listened or the server failed.
+func Listen(addr string, opts ...Option) error {
+	return defaultApp.Listen(addr, opts...)
+}
+
+// Serve likes ListenContext, but accepts the connections from ln, eg: an
+// in-memory listener for tests
+func Serve(ctx context.Context, ln net.Listener, opts ...Option) error {
+	return defaultApp.Serve(ctx, ln, opts...)
+}
+
+// ListenContext likes Listen, but the application will be
+// shutdown when the ctx is cancelled, eg: run nano in an
+// errgroup with other services.
+func ListenContext(ctx context.Context, addr string, opts ...Option) error {
+	return defaultApp.ListenContext(ctx, addr, opts...)
 }
 
 // ListenWS listens on the TCP network address addr
 // and then upgrades the HTTP server connection to the WebSocket protocol
 // to handle requests on incoming connections.
-func ListenWS(addr string) {
-	listen(addr, true)
+func ListenWS(addr string, opts ...Option) error {
+	return defaultApp.ListenWS(addr, opts...)
 }
 
-// Register register a component with options
+// ListenWSContext likes ListenWS, but the application will be
+// shutdown when the ctx is cancelled.
+func ListenWSContext(ctx context.Context, addr string, opts ...Option) error {
+	return defaultApp.ListenWSContext(ctx, addr, opts...)
+}
+
+// Register register a component with options, the component registered
+// after application running is initialized immediately, and the routes of
+// its handlers are pushed to connected clients
 func Register(c component.Component, options ...component.Option) {
-	comps = append(comps, regComp{c, options})
+	defaultApp.Register(c, options...)
+}
+
+// Register register a component with options to the application
+func (app *App) Register(c component.Component, options ...component.Option) {
+	if atomic.LoadInt32(&app.running) == 1 {
+		app.registerRuntime(c, options)
+		return
+	}
+	app.muComps.Lock()
+	defer app.muComps.Unlock()
+	app.comps = append(app.comps, regComp{c, options})
 }
 
 // SetHeartbeatInterval set heartbeat time interval
 func SetHeartbeatInterval(d time.Duration) {
-	env.heartbeat = d
+	defaultApp.SetHeartbeatInterval(d)
+}
+
+// SetHeartbeatInterval set heartbeat time interval of the application
+func (app *App) SetHeartbeatInterval(d time.Duration) {
+	app.env.heartbeat = d
+}
+
+// SetHeartbeatMode set which side drives the heartbeat, the mode is
+// advertised to client in handshake response. Default is HeartbeatServer
+func SetHeartbeatMode(mode HeartbeatMode) {
+	defaultApp.SetHeartbeatMode(mode)
+}
+
+// SetHeartbeatMode set which side drives the heartbeat of the application
+func (app *App) SetHeartbeatMode(mode HeartbeatMode) {
+	app.env.heartbeatMode = mode
+}
+
+// SetHeartbeatMisses set the number of heartbeat intervals without any packet
+// received before the connection closed, eg: a larger one for the mobile apps
+// which are backgrounded frequently. Default is 2
+func SetHeartbeatMisses(n int) {
+	defaultApp.SetHeartbeatMisses(n)
+}
+
+// SetHeartbeatMisses set the number of missed heartbeat intervals before the
+// connections of the application closed
+func (app *App) SetHeartbeatMisses(n int) {
+	if n < 1 {
+		panic("heartbeat misses must be positive")
+	}
+	app.env.heartbeatMisses = n
+}
+
+// SetHandshakeTimeout set the max duration from a connection accepted to the
+// handshake completed, the connection which does not complete handshake in
+// time is kicked, so that the idle sockets do not hold the resources. Default
+// is 10 seconds, zero disables the timeout
+func SetHandshakeTimeout(d time.Duration) {
+	defaultApp.SetHandshakeTimeout(d)
+}
+
+// SetHandshakeTimeout set the handshake timeout of the application
+func (app *App) SetHandshakeTimeout(d time.Duration) {
+	if d < 0 {
+		panic("handshake timeout must not be negative")
+	}
+	app.env.handshakeTimeout = d
+}
+
+// SetSessionIDGenerator set the generator of session ids of all
+// applications, eg: service.RandomSessionID generates the unguessable ids
+// instead of the sequential ones. nil restores the sequential ids, it should
+// be called before any session created
+func SetSessionIDGenerator(gen service.SessionIDGenerator) {
+	service.Connections.SetSessionIDGenerator(gen)
+}
+
+// SetHandlerTimeout set the max duration of request handlers, the request
+// context is canceled when the timeout exceeded, and the client is responded
+// with ErrHandlerTimeout if the handler returns an error after that. Default
+// is zero, which means no timeout
+func SetHandlerTimeout(d time.Duration) {
+	defaultApp.SetHandlerTimeout(d)
+}
+
+// SetHandlerTimeout set the max duration of request handlers of the
+// application
+func (app *App) SetHandlerTimeout(d time.Duration) {
+	if d < 0 {
+		panic("handler timeout must not be negative")
+	}
+	app.env.handlerTimeout = d
+}
+
+// OnHeartbeatTimeout set the callback which will be called when a session
+// closed due to heartbeat timeout, before the session closed callbacks
+func OnHeartbeatTimeout(fn SessionClosedHandler) {
+	defaultApp.OnHeartbeatTimeout(fn)
+}
+
+// OnHeartbeatTimeout set the heartbeat timeout callback of the application
+func (app *App) OnHeartbeatTimeout(fn SessionClosedHandler) {
+	app.env.heartbeatTimeout = fn
+}
+
+// SetMaxPacketSize set the max length of inbound packets, the connection will
+// be kicked when a packet exceeds the limit, and the limit is advertised to
+// client in handshake response. The default size is 64KB
+func SetMaxPacketSize(size int) {
+	defaultApp.SetMaxPacketSize(size)
+}
+
+// SetMaxPacketSize set the max length of inbound packets of the application
+func (app *App) SetMaxPacketSize(size int) {
+	app.env.maxPacketSize = size
+}
+
+// SetMaxMessageSize set the max length of a message which is fragmented into
+// multiple packets, the connection will be kicked when the reassembled
+// fragments exceed the limit. The default size is 1MB
+func SetMaxMessageSize(size int) {
+	defaultApp.SetMaxMessageSize(size)
+}
+
+// SetMaxMessageSize set the max length of reassembled messages of the
+// application
+func (app *App) SetMaxMessageSize(size int) {
+	app.env.maxMessageSize = size
+}
+
+// SetCompression enables the message body compression, the body of outbound
+// messages not shorter than threshold will be compressed with DEFLATE and
+// flagged as compressed in message header if client supports compression,
+// which is negotiated in handshake. Compressed inbound messages are always
+// decompressed. Zero threshold disables the compression
+func SetCompression(threshold int) {
+	defaultApp.SetCompression(threshold)
+}
+
+// SetCompression enables the message body compression of the application
+func (app *App) SetCompression(threshold int) {
+	app.env.compressThreshold = threshold
+}
+
+// SetChecksum enables the packet checksum, a CRC32 checksum trails the data
+// of data and fragment packets if client supports checksum, which is
+// negotiated in handshake, so that the packets corrupted by broken middleboxes
+// are detected. The connection sending a corrupted packet will be kicked
+func SetChecksum(enabled bool) {
+	defaultApp.SetChecksum(enabled)
+}
+
+// SetChecksum enables the packet checksum of the application
+func (app *App) SetChecksum(enabled bool) {
+	app.env.checksum = enabled
 }
 
 // SetCheckOriginFunc set the function that check `Origin` in http headers
 func SetCheckOriginFunc(fn func(*http.Request) bool) {
-	env.checkOrigin = fn
+	defaultApp.SetCheckOriginFunc(fn)
+}
+
+// SetCheckOriginFunc set the function that check `Origin` of the application
+func (app *App) SetCheckOriginFunc(fn func(*http.Request) bool) {
+	app.env.checkOrigin = fn
 }
 
 // Shutdown send a signal to let 'nano' shutdown itself.
 func Shutdown() {
-	env.die <- true
-	// close(env.die)
+	defaultApp.Shutdown()
 }
 
 // EnableDebug let 'nano' to run under debug mode.
 func EnableDebug() {
-	env.debug = true
+	setDebug(true)
 }
 
 // OnSessionClosed set the Callback which will be called when session is closed
 // Waring: session has closed,
 func OnSessionClosed(cb SessionClosedHandler) {
-	env.muCallbacks.Lock()
-	defer env.muCallbacks.Unlock()
+	defaultApp.OnSessionClosed(cb)
+}
+
+// OnSessionClosed set the Callback which will be called when a session of the
+// application is closed
+func (app *App) OnSessionClosed(cb SessionClosedHandler) {
+	app.env.muCallbacks.Lock()
+	defer app.env.muCallbacks.Unlock()
 
-	env.callbacks = append(env.callbacks, cb)
+	app.env.callbacks = append(app.env.callbacks, cb)
 }
 
 // SetDictionary set routes map, TODO(warning): set dictionary in runtime would be a dangerous operation!!!!!!
@@ -84,30 +268,51 @@ func OnSessionClosed(cb SessionClosedHandler) {
 // }
 
 func SetWSPath(path string) {
-	env.wsPath = path
+	defaultApp.SetWSPath(path)
+}
+
+// SetWSPath set the WebSocket path of the application
+func (app *App) SetWSPath(path string) {
+	app.env.wsPath = path
 }
 
 func SetAuthFunc(authFunc func(session *session.Session, handshakeData *HandShakeData) interface{}) {
+	defaultApp.SetAuthFunc(authFunc)
+}
+
+// SetAuthFunc set the function which authenticates the handshake of the
+// application, the session is kicked with the returned value if not nil
+func (app *App) SetAuthFunc(authFunc func(session *session.Session, handshakeData *HandShakeData) interface{}) {
 	if authFunc != nil {
-		env.authFunc = authFunc
-		// Pipeline.Inbound.PushBack(func(s *session.Session, in []byte) (out []byte, err error) {
-		// 	if !s.Auth {
-		// 		s.Close()
-		// 		return nil, errors.New("the session is not authed")
-		// 	}
-		// 	return in, nil
-		// })
+		app.env.authFunc = authFunc
 	}
 }
 
 func SetSessionExpireSecs(secs int) {
-	env.sessionExpireSecs = secs
+	defaultApp.SetSessionExpireSecs(secs)
+}
+
+// SetSessionExpireSecs set the idle seconds before the sessions of the
+// application expired
+func (app *App) SetSessionExpireSecs(secs int) {
+	app.env.sessionExpireSecs = secs
 }
 
 func SetVersion(version string) {
-	env.version = version
+	defaultApp.SetVersion(version)
+}
+
+// SetVersion set the version of the application in handshake response
+func (app *App) SetVersion(version string) {
+	app.env.version = version
 }
 
 func SetHandShakePayload(payload interface{}) {
-	env.payload = payload
+	defaultApp.SetHandShakePayload(payload)
+}
+
+// SetHandShakePayload set the payload of the application in handshake
+// response
+func (app *App) SetHandShakePayload(payload interface{}) {
+	app.env.payload = payload
 }
@@ -23,6 +23,7 @@ package codec
 import (
 	"bytes"
 	"errors"
+	"sync"
 
 	"github.com/kensomanpow/nano/internal/packet"
 )
@@ -31,43 +32,87 @@ import (
 const (
 	HeadLength    = 4
 	MaxPacketSize = 64 * 1024
+
+	// maxLength is the max length that can be represented by packet header
+	maxLength = 1<<24 - 1
 )
 
 // ErrPacketSizeExcced is the error used for encode/decode.
 var ErrPacketSizeExcced = errors.New("codec: packet size exceed")
 
+var (
+	muCustom sync.RWMutex
+
+	// custom packet types registered by application
+	custom [256]bool
+)
+
+// RegisterType registers a custom packet type, so that the packets of the
+// type could be encoded and decoded
+func RegisterType(typ packet.Type) {
+	muCustom.Lock()
+	defer muCustom.Unlock()
+
+	custom[typ] = true
+}
+
+// valid reports whether typ is a built-in or registered packet type
+func valid(typ packet.Type) bool {
+	if typ >= packet.Handshake && typ <= packet.Dictionary {
+		return true
+	}
+	muCustom.RLock()
+	defer muCustom.RUnlock()
+
+	return custom[typ]
+}
+
 // A Decoder reads and decodes network data slice
 type Decoder struct {
-	buf  *bytes.Buffer
-	size int  // last packet length
-	typ  byte // last packet type
+	buf     *bytes.Buffer
+	size    int  // last packet length
+	typ     byte // last packet type
+	maxSize int  // max packet length
 }
 
 // NewDecoder returns a new decoder that used for decode network bytes slice.
 func NewDecoder() *Decoder {
 	return &Decoder{
-		buf:  bytes.NewBuffer(nil),
-		size: -1,
+		buf:     bytes.NewBuffer(nil),
+		size:    -1,
+		maxSize: MaxPacketSize,
 	}
 }
 
+// SetMaxPacketSize set the max packet length, Decode returns
+// ErrPacketSizeExcced once a packet header declares a greater length, so
+// that a malicious length could not make decoder buffer forever.
+func (c *Decoder) SetMaxPacketSize(size int) {
+	if size <= 0 || size > maxLength {
+		size = maxLength
+	}
+	c.maxSize = size
+}
+
 func (c *Decoder) forward() error {
 	header := c.buf.Next(HeadLength)
 	c.typ = header[0]
-	if c.typ < packet.Handshake || c.typ > packet.Kick {
+	if !valid(packet.Type(c.typ)) {
 		return packet.ErrWrongPacketType
 	}
 	c.size = bytesToInt(header[1:])
 
 	// packet length limitation
-	if c.size > MaxPacketSize {
+	if c.size > c.maxSize {
 		return ErrPacketSizeExcced
 	}
 	return nil
 }
 
-// Decode decode the network bytes slice to packet.Packet(s)
-// TODO(Warning): shared slice
+// Decode decode the network bytes slice to packet.Packet(s), the returned
+// packets own their data, which will never be reused by decoder, so that the
+// packets could be processed asynchronously after next Decode. The data of
+// packets decoded in one call share one allocation.
 func (c *Decoder) Decode(data []byte) ([]*packet.Packet, error) {
 	c.buf.Write(data)
 
@@ -104,9 +149,25 @@ func (c *Decoder) Decode(data []byte) ([]*packet.Packet, error) {
 
 	}
 
+	own(packets)
 	return packets, nil
 }
 
+// own copies the data of packets, which alias the buffer of decoder, to a
+// new allocation
+func own(packets []*packet.Packet) {
+	size := 0
+	for _, p := range packets {
+		size += len(p.Data)
+	}
+
+	buf := make([]byte, size)
+	for _, p := range packets {
+		n := copy(buf, p.Data)
+		p.Data, buf = buf[:n:n], buf[n:]
+	}
+}
+
 // Encode create a packet.Packet from  the raw bytes slice and then encode to network bytes slice
 // Protocol refs: https://github.com/NetEase/pomelo/wiki/Communication-Protocol
 //
@@ -114,9 +175,12 @@ func (c *Decoder) Decode(data []byte) ([]*packet.Packet, error) {
 // --------|------------------------|--------
 // 1 byte packet type, 3 bytes packet data length(big end), and data segment
 func Encode(typ packet.Type, data []byte) ([]byte, error) {
-	if typ < packet.Handshake || typ > packet.Kick {
+	if !valid(typ) {
 		return nil, packet.ErrWrongPacketType
 	}
+	if len(data) > maxLength {
+		return nil, ErrPacketSizeExcced
+	}
 
 	p := &packet.Packet{Type: typ, Length: len(data)}
 	buf := make([]byte, p.Length+HeadLength)
@@ -1,6 +1,7 @@
 package codec
 
 import (
+	"bytes"
 	"reflect"
 	"testing"
 
@@ -50,8 +51,8 @@ func TestPack(t *testing.T) {
 		t.Error("should err")
 	}
 
-	_ = &Packet{Type: Type(6), Data: data, Length: len(data)}
-	if _, err = Encode(Type(6), data); err == nil {
+	_ = &Packet{Type: Type(8), Data: data, Length: len(data)}
+	if _, err = Encode(Type(8), data); err == nil {
 		t.Error("should err")
 	}
 
@@ -93,3 +94,64 @@ func BenchmarkDecoder_Decode(b *testing.B) {
 		}
 	}
 }
+
+func TestDecoder_MaxPacketSize(t *testing.T) {
+	d := NewDecoder()
+	d.SetMaxPacketSize(8)
+
+	p, err := Encode(Data, []byte("12345678"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if packets, err := d.Decode(p); err != nil || len(packets) != 1 {
+		t.Fatalf("packet within limit should be decoded, err=%v", err)
+	}
+
+	// header declares a huge length
+	if _, err := d.Decode([]byte{Data, 0xFF, 0xFF, 0xFF}); err != ErrPacketSizeExcced {
+		t.Fatalf("expect %v, got %v", ErrPacketSizeExcced, err)
+	}
+}
+
+func TestRegisterType(t *testing.T) {
+	typ := Type(0x10)
+	if _, err := Encode(typ, nil); err != ErrWrongPacketType {
+		t.Fatalf("expect %v, got %v", ErrWrongPacketType, err)
+	}
+
+	RegisterType(typ)
+	p, err := Encode(typ, []byte("ping"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	packets, err := NewDecoder().Decode(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packets) != 1 || packets[0].Type != typ || string(packets[0].Data) != "ping" {
+		t.Fatalf("unexpected packets: %v", packets)
+	}
+}
+
+func TestDecoder_Ownership(t *testing.T) {
+	first := bytes.Repeat([]byte("1"), 60)
+	p1, _ := Encode(Data, first)
+	p2, _ := Encode(Data, bytes.Repeat([]byte("2"), 60))
+
+	d := NewDecoder()
+	packets, err := d.Decode(p1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packets) != 1 {
+		t.Fatalf("expect 1 packet, got %d", len(packets))
+	}
+
+	// decoder buffer is reused by next Decode
+	if _, err := d.Decode(p2); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(packets[0].Data, first) {
+		t.Fatalf("packet data should not be affected, got %q", packets[0].Data)
+	}
+}
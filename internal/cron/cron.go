@@ -0,0 +1,260 @@
+// Copyright (c) nano Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package cron parses cron expressions and calculates the activation times.
+//
+// An expression has 6 space separated fields, the seconds field is optional:
+//
+//	Field        | Allowed values  | Allowed special characters
+//	------------ | --------------- | --------------------------
+//	Seconds      | 0-59            | * / , -
+//	Minutes      | 0-59            | * / , -
+//	Hours        | 0-23            | * / , -
+//	Day of month | 1-31            | * / , - ?
+//	Month        | 1-12 or JAN-DEC | * / , -
+//	Day of week  | 0-6 or SUN-SAT  | * / , - ?
+//
+// The predefined descriptors @yearly, @monthly, @weekly, @daily and @hourly
+// are also supported.
+package cron
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidSpec represents a malformed cron expression.
+var ErrInvalidSpec = errors.New("cron: invalid spec")
+
+// starBit marks the field was declared by `*` or `?`
+const starBit = 1 << 63
+
+type bounds struct {
+	min, max uint
+	names    map[string]uint
+}
+
+var (
+	seconds = bounds{0, 59, nil}
+	minutes = bounds{0, 59, nil}
+	hours   = bounds{0, 23, nil}
+	dom     = bounds{1, 31, nil}
+	months  = bounds{1, 12, map[string]uint{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	dow = bounds{0, 6, map[string]uint{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 0 1 1 *",
+	"@annually": "0 0 0 1 1 *",
+	"@monthly":  "0 0 0 1 * *",
+	"@weekly":   "0 0 0 * * 0",
+	"@daily":    "0 0 0 * * *",
+	"@midnight": "0 0 0 * * *",
+	"@hourly":   "0 0 * * * *",
+}
+
+// Schedule represents a parsed cron expression, each field is a bit set
+// of the allowed values.
+type Schedule struct {
+	second, minute, hour, dom, month, dow uint64
+}
+
+// Parse parses the cron expression
+func Parse(spec string) (*Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if d, ok := descriptors[strings.ToLower(spec)]; ok {
+		spec = d
+	}
+
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, fmt.Errorf("%v: expected 5 or 6 fields, found %d: %s", ErrInvalidSpec, len(fields), spec)
+	}
+
+	s := &Schedule{}
+	var err error
+	for i, f := range []struct {
+		bits *uint64
+		b    bounds
+	}{
+		{&s.second, seconds},
+		{&s.minute, minutes},
+		{&s.hour, hours},
+		{&s.dom, dom},
+		{&s.month, months},
+		{&s.dow, dow},
+	} {
+		if *f.bits, err = parseField(fields[i], f.b); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// parseField parses a comma separated list of ranges
+func parseField(field string, b bounds) (uint64, error) {
+	var bits uint64
+	for _, expr := range strings.Split(field, ",") {
+		r, err := parseRange(expr, b)
+		if err != nil {
+			return 0, err
+		}
+		bits |= r
+	}
+	return bits, nil
+}
+
+// parseRange parses the expression like: *, */2, 1-5, 1-10/3, 5, mon-fri
+func parseRange(expr string, b bounds) (uint64, error) {
+	var (
+		start, end, step uint = 0, 0, 1
+		extra            uint64
+		err              error
+	)
+
+	rangeAndStep := strings.Split(expr, "/")
+	lowAndHigh := strings.Split(rangeAndStep[0], "-")
+	if len(rangeAndStep) > 2 || len(lowAndHigh) > 2 {
+		return 0, fmt.Errorf("%v: %s", ErrInvalidSpec, expr)
+	}
+
+	if lowAndHigh[0] == "*" || lowAndHigh[0] == "?" {
+		if len(lowAndHigh) > 1 {
+			return 0, fmt.Errorf("%v: %s", ErrInvalidSpec, expr)
+		}
+		start, end = b.min, b.max
+		if len(rangeAndStep) == 1 {
+			extra = starBit
+		}
+	} else {
+		if start, err = parseValue(lowAndHigh[0], b); err != nil {
+			return 0, err
+		}
+		end = start
+		if len(lowAndHigh) == 2 {
+			if end, err = parseValue(lowAndHigh[1], b); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if len(rangeAndStep) == 2 {
+		if step, err = parseUint(rangeAndStep[1]); err != nil || step == 0 {
+			return 0, fmt.Errorf("%v: invalid step: %s", ErrInvalidSpec, expr)
+		}
+		// `N/step` means from N to max
+		if len(lowAndHigh) == 1 && lowAndHigh[0] != "*" && lowAndHigh[0] != "?" {
+			end = b.max
+		}
+	}
+
+	if start < b.min || end > b.max || start > end {
+		return 0, fmt.Errorf("%v: out of range: %s", ErrInvalidSpec, expr)
+	}
+
+	var bits uint64
+	for i := start; i <= end; i += step {
+		bits |= 1 << i
+	}
+	return bits | extra, nil
+}
+
+func parseValue(v string, b bounds) (uint, error) {
+	if b.names != nil {
+		if n, ok := b.names[strings.ToLower(v)]; ok {
+			return n, nil
+		}
+	}
+
+	n, err := parseUint(v)
+	if err != nil {
+		return 0, fmt.Errorf("%v: %s", ErrInvalidSpec, v)
+	}
+	// both 0 and 7 are sunday
+	if b.max == dow.max && b.min == dow.min && n == 7 {
+		n = 0
+	}
+	return n, nil
+}
+
+func parseUint(v string) (uint, error) {
+	n, err := strconv.ParseUint(v, 10, 8)
+	return uint(n), err
+}
+
+func has(bits uint64, v int) bool {
+	return bits&(1<<uint(v)) > 0
+}
+
+// dayMatches follows the traditional cron: if both day of month and day of
+// week are restricted, the day matches either one of them.
+func (s *Schedule) dayMatches(t time.Time) bool {
+	domMatch := has(s.dom, t.Day())
+	dowMatch := has(s.dow, int(t.Weekday()))
+	if s.dom&starBit > 0 || s.dow&starBit > 0 {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// Next returns the next activation time after t, in the location of t. It
+// returns zero time if no time satisfies the schedule in five years.
+func (s *Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Add(time.Second - time.Duration(t.Nanosecond()))
+	limit := t.Year() + 5
+
+	for t.Year() <= limit {
+		if !has(s.month, int(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !has(s.hour, t.Hour()) {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if !has(s.minute, t.Minute()) {
+			t = t.Truncate(time.Minute).Add(time.Minute)
+			continue
+		}
+		if !has(s.second, t.Second()) {
+			t = t.Add(time.Second)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
@@ -0,0 +1,62 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse_Invalid(t *testing.T) {
+	specs := []string{
+		"",
+		"* * *",
+		"60 * * * * *",
+		"* * 24 * * *",
+		"*/0 * * * * *",
+		"5-1 * * * * *",
+		"* * * * foo *",
+	}
+	for _, spec := range specs {
+		if _, err := Parse(spec); err == nil {
+			t.Fatalf("spec %q should be invalid", spec)
+		}
+	}
+}
+
+func TestSchedule_Next(t *testing.T) {
+	cases := []struct {
+		spec   string
+		from   string
+		expect string
+	}{
+		{"0 */5 * * * *", "2018-01-01T10:02:30Z", "2018-01-01T10:05:00Z"},
+		{"0 */5 * * * *", "2018-01-01T10:55:00Z", "2018-01-01T11:00:00Z"},
+		{"30 0 20 * * *", "2018-01-01T20:00:30Z", "2018-01-02T20:00:30Z"},
+		{"0 0 * * mon-fri", "2018-01-06T10:00:00Z", "2018-01-08T00:00:00Z"},
+		{"@monthly", "2018-01-31T10:00:00Z", "2018-02-01T00:00:00Z"},
+		{"0 0 0 29 2 *", "2018-03-01T00:00:00Z", "2020-02-29T00:00:00Z"},
+		{"0 0 0 1 * sun", "2018-01-02T00:00:00Z", "2018-01-07T00:00:00Z"},
+		{"15,45 * * * * *", "2018-01-01T00:00:15Z", "2018-01-01T00:00:45Z"},
+	}
+
+	for _, c := range cases {
+		s, err := Parse(c.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		from, _ := time.Parse(time.RFC3339, c.from)
+		expect, _ := time.Parse(time.RFC3339, c.expect)
+		if got := s.Next(from); !got.Equal(expect) {
+			t.Fatalf("spec: %s, from: %s, expect: %s, got: %s", c.spec, c.from, expect, got)
+		}
+	}
+}
+
+func TestSchedule_NextLocation(t *testing.T) {
+	loc := time.FixedZone("UTC+8", 8*3600)
+	s, _ := Parse("@daily")
+	from := time.Date(2018, 1, 1, 12, 0, 0, 0, loc)
+	expect := time.Date(2018, 1, 2, 0, 0, 0, 0, loc)
+	if got := s.Next(from); !got.Equal(expect) {
+		t.Fatalf("expect: %s, got: %s", expect, got)
+	}
+}
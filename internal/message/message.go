@@ -26,21 +26,44 @@ import (
 	"fmt"
 	"log"
 	"strings"
+	"sync"
 )
 
 // Type represents the type of message, which could be Request/Notify/Response/Push
 type Type byte
 
+// Flag represents the flag bits of message header which indicate the state of
+// message body, the lower 4 bits of flag field are reserved for message type
+// and route compression
+type Flag byte
+
+// Message flags
+const (
+	// Compressed indicates the message body is compressed
+	Compressed Flag = 0x10
+
+	// Encrypted indicates the message body is encrypted
+	Encrypted Flag = 0x20
+
+	// Traced indicates the message body is prefixed with trace context
+	Traced Flag = 0x40
+
+	// Identified indicates the message body is prefixed with request id,
+	// which follows the trace context if traced
+	Identified Flag = 0x80
+)
+
 // Message types
 const (
 	Request  Type = 0x00
-	Notify        = 0x01
-	Response      = 0x02
-	Push          = 0x03
+	Notify   Type = 0x01
+	Response Type = 0x02
+	Push     Type = 0x03
 )
 
 const (
 	msgRouteCompressMask = 0x01
+	msgFlagMask          = 0xF0
 	msgTypeMask          = 0x07
 	msgRouteLengthMask   = 0xFF
 	msgHeadLength        = 0x02
@@ -53,10 +76,37 @@ var types = map[Type]string{
 	Push:     "Push",
 }
 
-var (
-	routes = make(map[string]uint16) // route map to code
-	codes  = make(map[uint16]string) // code map to route
-)
+// String returns the name of message type
+func (t Type) String() string {
+	return types[t]
+}
+
+// Dictionary represents the routes map which be used to compress route, each
+// application has its own dictionary, so that the codes of applications in
+// same process never conflict
+type Dictionary struct {
+	mu     sync.RWMutex      // protect routes & codes
+	routes map[string]uint16 // route map to code
+	codes  map[uint16]string // code map to route
+}
+
+// defaultDictionary is used by the package level Encode, Decode and
+// SetDictionary
+var defaultDictionary = NewDictionary()
+
+// NewDictionary returns an empty dictionary
+func NewDictionary() *Dictionary {
+	return &Dictionary{
+		routes: make(map[string]uint16),
+		codes:  make(map[uint16]string),
+	}
+}
+
+// DefaultDictionary returns the dictionary used by the package level
+// functions
+func DefaultDictionary() *Dictionary {
+	return defaultDictionary
+}
 
 // Errors that could be occurred in message codec
 var (
@@ -71,6 +121,7 @@ type Message struct {
 	ID         uint   // unique id, zero while notify mode
 	Route      string // route for locating service
 	Data       []byte // payload
+	Flags      Flag   // body state flags
 	compressed bool   // is message compressed
 }
 
@@ -115,16 +166,36 @@ func invalidType(t Type) bool {
 // | push     |----011-|<route>             |
 // ------------------------------------------
 // The figure above indicates that the bit does not affect the type of message.
+// The higher 4 bits are the flags of message body, eg: compressed.
 // See ref: https://github.com/kensomanpow/nano/blob/master/docs/communication_protocol.md
 func Encode(m *Message) ([]byte, error) {
+	return defaultDictionary.Encode(m)
+}
+
+// Encode marshals message to binary format, the route is compressed if it is
+// in the dictionary
+func (d *Dictionary) Encode(m *Message) ([]byte, error) {
+	return d.EncodeUpTo(m, -1)
+}
+
+// EncodeUpTo likes Encode, but the route is compressed only if its code is
+// not greater than maxCode, eg: the routes known by a client which does not
+// receive dictionary updates. All routes in the dictionary are compressed if
+// maxCode is negative
+func (d *Dictionary) EncodeUpTo(m *Message, maxCode int) ([]byte, error) {
 	if invalidType(m.Type) {
 		return nil, ErrWrongMessageType
 	}
 
 	buf := make([]byte, 0)
-	flag := byte(m.Type) << 1
+	flag := byte(m.Type)<<1 | byte(m.Flags)&msgFlagMask
 
-	code, compressed := routes[m.Route]
+	d.mu.RLock()
+	code, compressed := d.routes[m.Route]
+	d.mu.RUnlock()
+	if maxCode >= 0 && int(code) > maxCode {
+		compressed = false
+	}
 	if compressed {
 		flag |= msgRouteCompressMask
 	}
@@ -162,6 +233,12 @@ func Encode(m *Message) ([]byte, error) {
 // Decode unmarshal the bytes slice to a message
 // See ref: https://github.com/kensomanpow/nano/blob/master/docs/communication_protocol.md
 func Decode(data []byte) (*Message, error) {
+	return defaultDictionary.Decode(data)
+}
+
+// Decode unmarshal the bytes slice to a message, the compressed route is
+// looked up in the dictionary
+func (d *Dictionary) Decode(data []byte) (*Message, error) {
 	if len(data) < msgHeadLength {
 		return nil, ErrInvalidMessage
 	}
@@ -169,6 +246,7 @@ func Decode(data []byte) (*Message, error) {
 	flag := data[0]
 	offset := 1
 	m.Type = Type((flag >> 1) & msgTypeMask)
+	m.Flags = Flag(flag & msgFlagMask)
 
 	if invalidType(m.Type) {
 		return nil, ErrWrongMessageType
@@ -194,7 +272,9 @@ func Decode(data []byte) (*Message, error) {
 		if flag&msgRouteCompressMask == 1 {
 			m.compressed = true
 			code := binary.BigEndian.Uint16(data[offset:(offset + 2)])
-			route, ok := codes[code]
+			d.mu.RLock()
+			route, ok := d.codes[code]
+			d.mu.RUnlock()
 			if !ok {
 				return nil, ErrRouteInfoNotFound
 			}
@@ -213,23 +293,31 @@ func Decode(data []byte) (*Message, error) {
 	return m, nil
 }
 
-// SetDictionary set routes map which be used to compress route.
-// TODO(warning): set dictionary in runtime would be a dangerous operation!!!!!!
+// SetDictionary set routes map which be used to compress route, the routes
+// are merged into the dictionary, so that it could be updated at runtime.
 func SetDictionary(dict map[string]uint16) {
+	defaultDictionary.Set(dict)
+}
+
+// Set merges the routes into the dictionary
+func (d *Dictionary) Set(dict map[string]uint16) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
 	for route, code := range dict {
 		r := strings.TrimSpace(route)
 
 		// duplication check
-		if _, ok := routes[r]; ok {
+		if _, ok := d.routes[r]; ok {
 			log.Printf("duplicated route(route: %s, code: %d)\n", r, code)
 		}
 
-		if _, ok := codes[code]; ok {
+		if _, ok := d.codes[code]; ok {
 			log.Printf("duplicated route(route: %s, code: %d)\n", r, code)
 		}
 
 		// update map, using last value when key duplicated
-		routes[r] = code
-		codes[code] = r
+		d.routes[r] = code
+		d.codes[code] = r
 	}
 }
@@ -162,3 +162,23 @@ func TestEncode(t *testing.T) {
 		t.Error("not equal")
 	}
 }
+
+func TestEncodeFlags(t *testing.T) {
+	m := &Message{
+		Type:  Push,
+		Route: "test.flags",
+		Data:  []byte(`compressed`),
+		Flags: Compressed,
+	}
+	em, err := m.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dm, err := Decode(em)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dm.Type != Push || dm.Flags != Compressed || dm.Route != m.Route {
+		t.Fatalf("unexpected message: %s", dm)
+	}
+}
@@ -44,6 +44,15 @@ const (
 
 	// Kick represents a kick off packet
 	Kick = 0x05 // disconnect message from server
+
+	// Fragment represents a fragment of a data packet, the data of
+	// consecutive fragments and the following data packet are concatenated
+	// as the data of the data packet
+	Fragment = 0x06
+
+	// Dictionary represents an incremental route dictionary update from
+	// server to client
+	Dictionary = 0x07
 )
 
 // ErrWrongPacketType represents a wrong packet type.
@@ -0,0 +1,153 @@
+package nano
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+)
+
+type (
+	// IPFilter checks the remote IP of connections against the allow and deny
+	// lists at accept time, before the agent created, so that the blocked
+	// ranges do not consume the handshake resources. The entries are CIDRs,
+	// eg: 10.0.0.0/8, or single IPs. The deny list takes precedence, and an
+	// empty allow list allows all IPs not denied. The lists could be updated
+	// at runtime by Update or Reload
+	IPFilter struct {
+		rules atomic.Value // *ipRules
+	}
+
+	// IPFilterConfig represents the configuration of IPFilter, which is
+	// decoded from JSON by Reload
+	IPFilterConfig struct {
+		Allow []string `json:"allow"`
+		Deny  []string `json:"deny"`
+	}
+
+	ipRules struct {
+		allow []*net.IPNet
+		deny  []*net.IPNet
+	}
+)
+
+// NewIPFilter returns an IPFilter with the allow and deny lists
+func NewIPFilter(allow, deny []string) (*IPFilter, error) {
+	f := &IPFilter{}
+	if err := f.Update(allow, deny); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Update replaces the allow and deny lists, the lists are kept if any entry
+// is invalid
+func (f *IPFilter) Update(allow, deny []string) error {
+	rules := &ipRules{}
+	var err error
+	if rules.allow, err = parseIPNets(allow); err != nil {
+		return err
+	}
+	if rules.deny, err = parseIPNets(deny); err != nil {
+		return err
+	}
+	f.rules.Store(rules)
+	return nil
+}
+
+// Reload replaces the lists with the JSON encoded IPFilterConfig, eg: called
+// by a ConfigWatcher, it implements component.Reloader
+func (f *IPFilter) Reload(config []byte) error {
+	c := IPFilterConfig{}
+	if err := json.Unmarshal(config, &c); err != nil {
+		return err
+	}
+	return f.Update(c.Allow, c.Deny)
+}
+
+// Allowed reports whether the connections from ip are allowed
+func (f *IPFilter) Allowed(ip net.IP) bool {
+	rules, _ := f.rules.Load().(*ipRules)
+	if rules == nil {
+		return true
+	}
+	if containsIP(rules.deny, ip) {
+		return false
+	}
+	return len(rules.allow) < 1 || containsIP(rules.allow, ip)
+}
+
+// parseIPNets parses the CIDRs or single IPs
+func parseIPNets(entries []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("nano/ipfilter: invalid IP %s", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("nano/ipfilter: invalid CIDR %s", entry)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetIPFilter set the filter of connections, nil disables it
+func SetIPFilter(f *IPFilter) {
+	defaultApp.SetIPFilter(f)
+}
+
+// SetIPFilter set the filter of connections of the application
+func (app *App) SetIPFilter(f *IPFilter) {
+	app.env.ipFilter = f
+}
+
+// WithIPFilter set the filter of connections, see SetIPFilter
+func WithIPFilter(f *IPFilter) Option {
+	return withSetting(func(app *App) error {
+		app.SetIPFilter(f)
+		return nil
+	})
+}
+
+// allowAddr reports whether the connection from remote address addr is
+// allowed by the IP filter of application
+func (app *App) allowAddr(addr string) bool {
+	f := app.env.ipFilter
+	if f == nil {
+		return true
+	}
+	host := addr
+	if h, _, err := net.SplitHostPort(addr); err == nil {
+		host = h
+	}
+	if f.Allowed(net.ParseIP(host)) {
+		return true
+	}
+
+	if app.debugEnabled(LogSession) {
+		app.log().Println(fmt.Sprintf("nano/ipfilter: connection denied, Remote=%s", addr))
+	}
+	return false
+}
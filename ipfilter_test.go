@@ -0,0 +1,44 @@
+package nano
+
+import (
+	"net"
+	"testing"
+)
+
+func TestIPFilter(t *testing.T) {
+	f, err := NewIPFilter([]string{"10.0.0.0/8", "192.168.1.1"}, []string{"10.1.0.0/16"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]bool{
+		"10.0.0.1":    true,
+		"10.1.2.3":    false,
+		"192.168.1.1": true,
+		"192.168.1.2": false,
+	}
+	for ip, expect := range cases {
+		if f.Allowed(net.ParseIP(ip)) != expect {
+			t.Fatalf("%s: expect allowed %t", ip, expect)
+		}
+	}
+
+	if err := f.Update([]string{"bad"}, nil); err == nil {
+		t.Fatalf("invalid entry should fail")
+	}
+	if !f.Allowed(net.ParseIP("10.0.0.1")) {
+		t.Fatalf("lists should be kept if update failed")
+	}
+
+	if err := f.Reload([]byte(`{"deny":["::1", "127.0.0.0/8"]}`)); err != nil {
+		t.Fatal(err)
+	}
+	if f.Allowed(net.ParseIP("127.0.0.1")) || f.Allowed(net.ParseIP("::1")) || !f.Allowed(net.ParseIP("192.168.1.2")) {
+		t.Fatalf("unexpected lists after reload")
+	}
+
+	app := NewApp()
+	app.SetIPFilter(f)
+	if app.allowAddr("127.0.0.1:3250") || !app.allowAddr("10.0.0.1:3250") {
+		t.Fatalf("unexpected filter of remote address")
+	}
+}
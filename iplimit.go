@@ -0,0 +1,156 @@
+package nano
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ipSweepThreshold is the count of cooldown entries which triggers sweeping
+// the expired ones
+const ipSweepThreshold = 1024
+
+// rejectWriteTimeout is the max duration of writing the kick packet to a
+// rejected connection, so that a client not reading does not hold the
+// accepting goroutine
+const rejectWriteTimeout = time.Second
+
+type (
+	// IPConnLimit limits the concurrent connections from a single IP, the IP
+	// exceeding the limit is rejected in cooldown, eg: to blunt the simple
+	// connection flood from a single host
+	IPConnLimit struct {
+		Max      int           // max concurrent connections per IP
+		Cooldown time.Duration // duration to reject the IP after exceeding limit, zero rejects the exceeded connections only
+	}
+
+	// ipLimiter counts the connections of each IP
+	ipLimiter struct {
+		IPConnLimit
+		mu       sync.Mutex
+		conns    map[string]int       // IP map to connections
+		cooldown map[string]time.Time // IP map to end of cooldown
+		rejected int64
+	}
+)
+
+// SetIPConnLimit set the limit of concurrent connections per IP, nil disables
+// it. It should be called before application running
+func SetIPConnLimit(l *IPConnLimit) {
+	defaultApp.SetIPConnLimit(l)
+}
+
+// SetIPConnLimit set the limit of concurrent connections per IP of the
+// application
+func (app *App) SetIPConnLimit(l *IPConnLimit) {
+	if l == nil {
+		app.env.ipLimiter = nil
+		return
+	}
+	if l.Max < 1 || l.Cooldown < 0 {
+		panic("nano: invalid IP connection limit")
+	}
+	app.env.ipLimiter = &ipLimiter{
+		IPConnLimit: *l,
+		conns:       make(map[string]int),
+		cooldown:    make(map[string]time.Time),
+	}
+}
+
+// WithIPConnLimit set the limit of concurrent connections per IP, see
+// SetIPConnLimit
+func WithIPConnLimit(l *IPConnLimit) Option {
+	return withSetting(func(app *App) error {
+		if l != nil && l.Max < 1 {
+			return invalidOption("WithIPConnLimit", "max connections must be positive")
+		}
+		if l != nil && l.Cooldown < 0 {
+			return invalidOption("WithIPConnLimit", "cooldown can not be negative")
+		}
+		app.SetIPConnLimit(l)
+		return nil
+	})
+}
+
+// remoteIP returns the IP of remote address of conn
+func remoteIP(conn net.Conn) string {
+	addr := conn.RemoteAddr().String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// acquire counts the connection of ip, and reports whether the connection
+// could be served
+func (l *ipLimiter) acquire(ip string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if until, ok := l.cooldown[ip]; ok {
+		if now.Before(until) {
+			atomic.AddInt64(&l.rejected, 1)
+			return false
+		}
+		delete(l.cooldown, ip)
+	}
+
+	if l.conns[ip] >= l.Max {
+		atomic.AddInt64(&l.rejected, 1)
+		if l.Cooldown > 0 {
+			l.cooldown[ip] = now.Add(l.Cooldown)
+			if len(l.cooldown) > ipSweepThreshold {
+				l.sweep(now)
+			}
+		}
+		return false
+	}
+	l.conns[ip]++
+	return true
+}
+
+// release releases the connection of ip
+func (l *ipLimiter) release(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.conns[ip] <= 1 {
+		delete(l.conns, ip)
+		return
+	}
+	l.conns[ip]--
+}
+
+// sweep deletes the expired cooldown entries
+func (l *ipLimiter) sweep(now time.Time) {
+	for ip, until := range l.cooldown {
+		if !now.Before(until) {
+			delete(l.cooldown, ip)
+		}
+	}
+}
+
+// rejectConn writes a kick packet with reason to the connection which is
+// rejected before agent created, and closes it
+func rejectConn(conn net.Conn, o *options, reason *Error) {
+	if p, err := o.codec.Encode(PacketKick, reason.payload()); err == nil {
+		conn.SetWriteDeadline(time.Now().Add(rejectWriteTimeout))
+		conn.Write(p)
+	}
+	conn.Close()
+}
+
+// acquireIP reports whether the connection could be served by the IP limit
+// of application
+func (app *App) acquireIP(l *ipLimiter, conn net.Conn, o *options) bool {
+	ip := remoteIP(conn)
+	if l.acquire(ip, app.clock.Now()) {
+		return true
+	}
+
+	app.log().Println(fmt.Sprintf("nano/conn: too many connections from IP, Remote=%s, Max=%d", conn.RemoteAddr(), l.Max))
+	rejectConn(conn, o, ErrTooManyConns)
+	return false
+}
@@ -0,0 +1,42 @@
+package nano
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIPLimiter(t *testing.T) {
+	app := NewApp()
+	app.SetIPConnLimit(&IPConnLimit{Max: 2, Cooldown: time.Minute})
+	l := app.env.ipLimiter
+
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		if !l.acquire("10.0.0.1", now) {
+			t.Fatalf("connection %d should be accepted", i)
+		}
+	}
+	if l.acquire("10.0.0.1", now) {
+		t.Fatalf("connection exceeds limit should be rejected")
+	}
+	if !l.acquire("10.0.0.2", now) {
+		t.Fatalf("connection of other IP should be accepted")
+	}
+
+	// rejected in cooldown even if the connections released
+	l.release("10.0.0.1")
+	if l.acquire("10.0.0.1", now.Add(time.Second)) {
+		t.Fatalf("connection in cooldown should be rejected")
+	}
+	if !l.acquire("10.0.0.1", now.Add(time.Minute)) {
+		t.Fatalf("connection after cooldown should be accepted")
+	}
+	if s := app.ConnectionStats(); s.IPRejected != 2 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+
+	l.release("10.0.0.2")
+	if _, ok := l.conns["10.0.0.2"]; ok {
+		t.Fatalf("released IP should be deleted")
+	}
+}
@@ -0,0 +1,43 @@
+package nano
+
+import "time"
+
+// KickReason is the structured reason of kick, which is serialized by the
+// serializer of session and pushed on route `error` before the session
+// closed, so that the clients could show the reason instead of a bare
+// disconnect, eg: session.Kick(&nano.KickReason{Code: 403, Reason: "banned",
+// Until: until})
+type KickReason struct {
+	Code   int         `json:"code"`
+	Reason string      `json:"reason"`
+	Until  *time.Time  `json:"until,omitempty"` // the time when the client could reconnect, nil if not limited
+	Data   interface{} `json:"data,omitempty"`
+}
+
+// SetKickGrace set the max duration to wait the client closing the
+// connection after the kick reason written, the messages queued before the
+// kick are always flushed. Default is zero, which closes the connection
+// immediately, the reason might be lost by the clients which do not read the
+// socket before it closed
+func SetKickGrace(d time.Duration) {
+	defaultApp.SetKickGrace(d)
+}
+
+// SetKickGrace set the kick grace delay of the application
+func (app *App) SetKickGrace(d time.Duration) {
+	if d < 0 {
+		panic("kick grace must not be negative")
+	}
+	app.env.kickGrace = d
+}
+
+// WithKickGrace set the kick grace delay, see SetKickGrace
+func WithKickGrace(d time.Duration) Option {
+	return withSetting(func(app *App) error {
+		if d < 0 {
+			return invalidOption("WithKickGrace", "kick grace must not be negative")
+		}
+		app.SetKickGrace(d)
+		return nil
+	})
+}
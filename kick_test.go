@@ -0,0 +1,102 @@
+package nano
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/kensomanpow/nano/internal/message"
+)
+
+func TestAgent_KickReason(t *testing.T) {
+	app := NewApp()
+	c := NewManualClock(time.Now())
+	app.SetClock(c)
+	app.SetKickGrace(time.Second)
+
+	client, server := net.Pipe()
+	defer client.Close()
+
+	a := newAgent(app, server)
+	go a.write()
+
+	until := time.Unix(1700000000, 0).UTC()
+	if err := a.Push("chat.message", []byte("bye")); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Kick(&KickReason{Code: 403, Reason: "banned", Until: &until}); err != nil {
+		t.Fatal(err)
+	}
+
+	decoder := DefaultCodec.NewDecoder()
+	var msgs []*message.Message
+	kicked := false
+	buf := make([]byte, 256)
+	for !kicked {
+		n, err := client.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		packets, err := decoder.Decode(buf[:n])
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range packets {
+			if p.Type == PacketKick {
+				kicked = true
+				continue
+			}
+			m, err := message.Decode(p.Data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			msgs = append(msgs, m)
+		}
+	}
+	if len(msgs) != 2 {
+		t.Fatalf("expect 2 messages before kick packet, got %d", len(msgs))
+	}
+	if msgs[0].Route != "chat.message" || msgs[1].Route != "error" {
+		t.Fatalf("pending messages should be flushed before kick, got %s, %s", msgs[0].Route, msgs[1].Route)
+	}
+	reason := KickReason{}
+	if err := json.Unmarshal(msgs[1].Data, &reason); err != nil {
+		t.Fatal(err)
+	}
+	if reason.Code != 403 || reason.Reason != "banned" || reason.Until == nil || !reason.Until.Equal(until) {
+		t.Fatalf("unexpected kick reason %+v", reason)
+	}
+
+	go io.Copy(ioutil.Discard, client)
+	time.Sleep(10 * time.Millisecond)
+	if a.status() == statusClosed {
+		t.Fatalf("session should not be closed within kick grace")
+	}
+	for deadline := time.Now().Add(time.Second); a.status() != statusClosed; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("session should be closed after kick grace")
+		}
+		c.Advance(time.Second)
+	}
+}
+
+func TestAgent_KickUnserializable(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	go io.Copy(ioutil.Discard, client)
+
+	a := newAgent(NewApp(), server)
+	go a.write()
+
+	if err := a.Kick(make(chan int)); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(time.Second); a.status() != statusClosed; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("session should be closed even if kick reason not serialized")
+		}
+	}
+}
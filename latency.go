@@ -0,0 +1,96 @@
+package nano
+
+import (
+	"sort"
+	"time"
+)
+
+type (
+	// LatencyStats represents the RTT percentiles of the living sessions
+	// which have been measured by heartbeat
+	LatencyStats struct {
+		Sessions int           `json:"sessions"` // measured sessions
+		P50      time.Duration `json:"p50"`
+		P95      time.Duration `json:"p95"`
+		P99      time.Duration `json:"p99"`
+		Max      time.Duration `json:"max"`
+	}
+
+	// SessionLatency represents the RTT of a session
+	SessionLatency struct {
+		SessionID  int64         `json:"sessionId"`
+		UID        int64         `json:"uid"`
+		RemoteAddr string        `json:"remoteAddr,omitempty"`
+		RTT        time.Duration `json:"rtt"`
+	}
+)
+
+// Latency returns the RTT percentiles of the living sessions of current node,
+// the sessions that have not measured RTT are excluded
+func Latency() LatencyStats {
+	sessions := measuredSessions()
+	if len(sessions) < 1 {
+		return LatencyStats{}
+	}
+
+	rtts := make([]time.Duration, len(sessions))
+	for i := range sessions {
+		rtts[i] = sessions[i].RTT
+	}
+	sort.Slice(rtts, func(i, j int) bool { return rtts[i] < rtts[j] })
+
+	return LatencyStats{
+		Sessions: len(rtts),
+		P50:      percentile(rtts, 50),
+		P95:      percentile(rtts, 95),
+		P99:      percentile(rtts, 99),
+		Max:      rtts[len(rtts)-1],
+	}
+}
+
+// WorstLatencySessions returns the n living sessions which have the largest
+// RTT, in descending order, nil if n is not positive
+func WorstLatencySessions(n int) []SessionLatency {
+	if n <= 0 {
+		return nil
+	}
+
+	sessions := measuredSessions()
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].RTT > sessions[j].RTT })
+	if len(sessions) > n {
+		sessions = sessions[:n]
+	}
+	return sessions
+}
+
+func measuredSessions() []SessionLatency {
+	var sessions []SessionLatency
+	agents.Range(func(_, v interface{}) bool {
+		a := v.(*agent)
+		rtt := a.session.RTT()
+		if rtt <= 0 {
+			return true
+		}
+		l := SessionLatency{
+			SessionID: a.session.ID(),
+			UID:       a.session.UID(),
+			RTT:       rtt,
+		}
+		if a.conn != nil {
+			l.RemoteAddr = a.conn.RemoteAddr().String()
+		}
+		sessions = append(sessions, l)
+		return true
+	})
+	return sessions
+}
+
+// percentile returns the p-th percentile of sorted durations with the
+// nearest-rank method
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (len(sorted)*p + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
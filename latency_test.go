@@ -0,0 +1,37 @@
+package nano
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatency(t *testing.T) {
+	var list []*agent
+	for i := 1; i <= 100; i++ {
+		a := newAgent(defaultApp, nil)
+		a.session.SetRTT(time.Duration(i)*time.Millisecond, 0)
+		list = append(list, a)
+	}
+	unmeasured := newAgent(defaultApp, nil)
+	defer func() {
+		for _, a := range append(list, unmeasured) {
+			agents.Delete(a.session.ID())
+		}
+	}()
+
+	stats := Latency()
+	if stats.Sessions != 100 || stats.P50 != 50*time.Millisecond || stats.P95 != 95*time.Millisecond ||
+		stats.P99 != 99*time.Millisecond || stats.Max != 100*time.Millisecond {
+		t.Fatalf("unexpected latency stats %+v", stats)
+	}
+
+	worst := WorstLatencySessions(2)
+	if len(worst) != 2 || worst[0].RTT != 100*time.Millisecond || worst[1].RTT != 99*time.Millisecond {
+		t.Fatalf("unexpected worst sessions %+v", worst)
+	}
+	for _, n := range []int{0, -1} {
+		if worst := WorstLatencySessions(n); worst != nil {
+			t.Fatalf("expect no sessions for n=%d, got %+v", n, worst)
+		}
+	}
+}
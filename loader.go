@@ -0,0 +1,462 @@
+package nano
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kensomanpow/nano/internal/codec"
+)
+
+// configEnvPrefix is the prefix of environment variables which override the
+// configuration files, eg: NANO_HEARTBEAT_INTERVAL=10s
+const configEnvPrefix = "NANO"
+
+type (
+	// Config represents the options of application which are loaded from
+	// configuration files and environment variables, so that deployments
+	// could tune the application without code changes, see LoadConfig
+	Config struct {
+		Debug           []string        `json:"debug" yaml:"debug" env:"DEBUG"` // debug modules, "all" enables all modules
+		TimerPrecision  Duration        `json:"timerPrecision" yaml:"timerPrecision" env:"TIMER_PRECISION"`
+		ShutdownTimeout Duration        `json:"shutdownTimeout" yaml:"shutdownTimeout" env:"SHUTDOWN_TIMEOUT"`
+		Heartbeat       ConfigHeartbeat `json:"heartbeat" yaml:"heartbeat" env:"HEARTBEAT"`
+		Limits          ConfigLimits    `json:"limits" yaml:"limits" env:"LIMITS"`
+		Listener        ConfigListener  `json:"listener" yaml:"listener" env:"LISTENER"`
+		Cluster         ConfigCluster   `json:"cluster" yaml:"cluster" env:"CLUSTER"`
+	}
+
+	// ConfigHeartbeat represents the heartbeat options, see WithHeartbeat
+	ConfigHeartbeat struct {
+		Interval Duration `json:"interval" yaml:"interval" env:"INTERVAL"`
+		Mode     string   `json:"mode" yaml:"mode" env:"MODE"` // server or client
+		Misses   int      `json:"misses" yaml:"misses" env:"MISSES"`
+	}
+
+	// ConfigLimits represents the limits of connections and messages, see
+	// WithLimits
+	ConfigLimits struct {
+		MaxPacketSize  int      `json:"maxPacketSize" yaml:"maxPacketSize" env:"MAX_PACKET_SIZE"`
+		MaxMessageSize int      `json:"maxMessageSize" yaml:"maxMessageSize" env:"MAX_MESSAGE_SIZE"`
+		SessionExpire  Duration `json:"sessionExpire" yaml:"sessionExpire" env:"SESSION_EXPIRE"`
+		MinProtocol    int      `json:"minProtocol" yaml:"minProtocol" env:"MIN_PROTOCOL"`
+
+		HandshakeTimeout Duration `json:"handshakeTimeout" yaml:"handshakeTimeout" env:"HANDSHAKE_TIMEOUT"` // zero disables
+	}
+
+	// ConfigListener represents the options of listener and the servers
+	// started with it
+	ConfigListener struct {
+		Addr           string `json:"addr" yaml:"addr" env:"ADDR"`
+		WebSocket      bool   `json:"webSocket" yaml:"webSocket" env:"WEBSOCKET"`
+		WSPath         string `json:"wsPath" yaml:"wsPath" env:"WS_PATH"`
+		ReadBufferSize int    `json:"readBufferSize" yaml:"readBufferSize" env:"READ_BUFFER_SIZE"` // zero if adaptive
+		DebugAddr      string `json:"debugAddr" yaml:"debugAddr" env:"DEBUG_ADDR"`
+		ConsoleAddr    string `json:"consoleAddr" yaml:"consoleAddr" env:"CONSOLE_ADDR"`
+		ConsoleToken   string `json:"consoleToken" yaml:"consoleToken" env:"CONSOLE_TOKEN" secret:"true"`
+		ProbeAddr      string `json:"probeAddr" yaml:"probeAddr" env:"PROBE_ADDR"`
+	}
+
+	// ConfigCluster represents the options of current node in cluster
+	ConfigCluster struct {
+		NodeID     string            `json:"nodeId" yaml:"nodeId" env:"NODE_ID"`
+		NodeLabels map[string]string `json:"nodeLabels" yaml:"nodeLabels" env:"NODE_LABELS"` // k1=v1,k2=v2 in environment
+	}
+
+	// Duration is a time.Duration which is written as "30s" in configuration
+	Duration time.Duration
+
+	// ConfigDecoder decodes the content of a configuration file into v
+	ConfigDecoder func(data []byte, v interface{}) error
+)
+
+var (
+	muConfigDecoders sync.RWMutex
+
+	// configuration file extension map to decoder
+	configDecoders = map[string]ConfigDecoder{
+		".json": decodeJSONConfig,
+	}
+)
+
+// String implements fmt.Stringer
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// RegisterConfigFormat registers the decoder of configuration files with the
+// extension, only JSON is supported by default so that nano does not depend
+// on the parsers of other formats, the fields of Config are tagged for YAML,
+// eg: RegisterConfigFormat(".yaml", yaml.Unmarshal)
+func RegisterConfigFormat(ext string, dec ConfigDecoder) {
+	if dec == nil {
+		panic("nano/config: nil config decoder")
+	}
+	muConfigDecoders.Lock()
+	defer muConfigDecoders.Unlock()
+
+	configDecoders[strings.ToLower(ext)] = dec
+}
+
+func decodeJSONConfig(data []byte, v interface{}) error {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.DisallowUnknownFields()
+	return d.Decode(v)
+}
+
+// DefaultConfig returns the configuration of the default options
+func DefaultConfig() *Config {
+	return &Config{
+		TimerPrecision:  Duration(time.Second),
+		ShutdownTimeout: Duration(30 * time.Second),
+		Heartbeat: ConfigHeartbeat{
+			Interval: Duration(30 * time.Second),
+			Mode:     HeartbeatServer.String(),
+			Misses:   2,
+		},
+		Limits: ConfigLimits{
+			MaxPacketSize:  codec.MaxPacketSize,
+			MaxMessageSize: 1024 * 1024,
+			SessionExpire:  Duration(30 * time.Minute),
+			MinProtocol:    ProtocolLegacy,
+
+			HandshakeTimeout: Duration(10 * time.Second),
+		},
+		Cluster: ConfigCluster{
+			NodeID: processName(),
+		},
+	}
+}
+
+// LoadConfig loads the configuration from files in order over the default
+// configuration, the latter file overrides the former, then overrides it
+// with the environment variables named NANO_<SECTION>_<KEY>, eg:
+// NANO_LIMITS_MAX_PACKET_SIZE. The format of files is decided by extension,
+// and the unknown keys of JSON are rejected. The configuration is validated
+func LoadConfig(files ...string) (*Config, error) {
+	c := DefaultConfig()
+	for _, file := range files {
+		if err := c.loadFile(file); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.loadEnv(); err != nil {
+		return nil, err
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Config) loadFile(file string) error {
+	ext := strings.ToLower(filepath.Ext(file))
+	muConfigDecoders.RLock()
+	dec, ok := configDecoders[ext]
+	muConfigDecoders.RUnlock()
+	if !ok {
+		return fmt.Errorf("nano/config: unsupported config format %s", file)
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if err := dec(data, c); err != nil {
+		return fmt.Errorf("nano/config: decode %s failed, %s", file, err.Error())
+	}
+	return nil
+}
+
+func (c *Config) loadEnv() error {
+	return walkConfig(reflect.ValueOf(c).Elem(), "", configEnvPrefix,
+		func(key, env string, f reflect.StructField, v reflect.Value) error {
+			s, ok := os.LookupEnv(env)
+			if !ok {
+				return nil
+			}
+			if err := setConfigValue(v, s); err != nil {
+				return fmt.Errorf("nano/config: invalid environment variable %s, %s", env, err.Error())
+			}
+			return nil
+		})
+}
+
+// Validate reports the first invalid value of configuration, which wraps
+// ErrInvalidConfig
+func (c *Config) Validate() error {
+	invalid := func(key, reason string) error {
+		return fmt.Errorf("%w: %s, %s", ErrInvalidConfig, key, reason)
+	}
+
+	switch {
+	case c.TimerPrecision < Duration(time.Millisecond):
+		return invalid("timerPrecision", "time precision can not less than a Millisecond")
+	case c.ShutdownTimeout <= 0:
+		return invalid("shutdownTimeout", "shutdown timeout must be positive")
+	case c.Heartbeat.Interval <= 0:
+		return invalid("heartbeat.interval", "heartbeat interval must be positive")
+	case c.Heartbeat.Mode != HeartbeatServer.String() && c.Heartbeat.Mode != HeartbeatClient.String():
+		return invalid("heartbeat.mode", "heartbeat mode must be server or client")
+	case c.Heartbeat.Misses < 1:
+		return invalid("heartbeat.misses", "heartbeat misses must be positive")
+	case c.Limits.MaxPacketSize < 0:
+		return invalid("limits.maxPacketSize", "max packet size can not be negative")
+	case c.Limits.MaxMessageSize < 0:
+		return invalid("limits.maxMessageSize", "max message size can not be negative")
+	case c.Limits.SessionExpire < 0:
+		return invalid("limits.sessionExpire", "session expire can not be negative")
+	case c.Limits.MinProtocol != 0 && (c.Limits.MinProtocol < ProtocolLegacy || c.Limits.MinProtocol > ProtocolVersion):
+		return invalid("limits.minProtocol", fmt.Sprintf("min protocol must be in range [%d, %d]", ProtocolLegacy, ProtocolVersion))
+	case c.Limits.HandshakeTimeout < 0:
+		return invalid("limits.handshakeTimeout", "handshake timeout can not be negative")
+	case c.Listener.ReadBufferSize < 0:
+		return invalid("listener.readBufferSize", "read buffer size can not be negative")
+	case c.Listener.DebugAddr != "" && !loopback(c.Listener.DebugAddr):
+		return invalid("listener.debugAddr", "debug server must listen at a loopback address")
+	case c.Listener.ConsoleAddr != "" && c.Listener.ConsoleToken == "":
+		return invalid("listener.consoleToken", "admin console token can not be empty")
+	case c.Cluster.NodeID == "":
+		return invalid("cluster.nodeId", "node id can not be empty")
+	}
+	return nil
+}
+
+// Options returns the options of configuration, which logs the values
+// different from the default configuration at startup. Only the values
+// different from the default configuration are applied, so that the options
+// set before are not overridden by the defaults
+func (c *Config) Options() []Option {
+	d := DefaultConfig()
+	opts := []Option{
+		withSetting(func(app *App) error {
+			c.logDiff(app)
+			return nil
+		}),
+	}
+
+	if c.TimerPrecision != d.TimerPrecision {
+		opts = append(opts, WithTimerPrecision(time.Duration(c.TimerPrecision)))
+	}
+	if c.ShutdownTimeout != d.ShutdownTimeout {
+		opts = append(opts, WithShutdownTimeout(time.Duration(c.ShutdownTimeout)))
+	}
+	if c.Heartbeat != d.Heartbeat {
+		opts = append(opts, WithHeartbeat(time.Duration(c.Heartbeat.Interval), heartbeatMode(c.Heartbeat.Mode), c.Heartbeat.Misses))
+	}
+
+	// the zero limits keep the values of application
+	var l Limits
+	if c.Limits.MaxPacketSize != d.Limits.MaxPacketSize {
+		l.MaxPacketSize = c.Limits.MaxPacketSize
+	}
+	if c.Limits.MaxMessageSize != d.Limits.MaxMessageSize {
+		l.MaxMessageSize = c.Limits.MaxMessageSize
+	}
+	if c.Limits.SessionExpire != d.Limits.SessionExpire {
+		l.SessionExpire = time.Duration(c.Limits.SessionExpire)
+	}
+	if c.Limits.MinProtocol != d.Limits.MinProtocol {
+		l.MinProtocol = c.Limits.MinProtocol
+	}
+	if l != (Limits{}) {
+		opts = append(opts, WithLimits(l))
+	}
+
+	opts = append(opts, withSetting(func(app *App) error {
+		if c.Limits.HandshakeTimeout != d.Limits.HandshakeTimeout {
+			app.SetHandshakeTimeout(time.Duration(c.Limits.HandshakeTimeout))
+		}
+		if c.Cluster.NodeID != d.Cluster.NodeID {
+			app.SetNodeID(c.Cluster.NodeID)
+		}
+		if len(c.Cluster.NodeLabels) > 0 {
+			app.SetNodeLabels(c.Cluster.NodeLabels)
+		}
+		if c.Listener.WSPath != "" {
+			app.SetWSPath(c.Listener.WSPath)
+		}
+		return nil
+	}))
+
+	if len(c.Debug) > 0 {
+		modules := c.Debug
+		for _, m := range c.Debug {
+			if m == "all" {
+				modules = nil
+				break
+			}
+		}
+		opts = append(opts, WithDebug(modules...))
+	}
+	if c.Listener.ReadBufferSize > 0 {
+		opts = append(opts, WithReadBufferSize(c.Listener.ReadBufferSize))
+	}
+	if c.Listener.DebugAddr != "" {
+		opts = append(opts, WithDebugServer(c.Listener.DebugAddr))
+	}
+	if c.Listener.ConsoleAddr != "" {
+		opts = append(opts, WithAdminConsole(c.Listener.ConsoleAddr, c.Listener.ConsoleToken))
+	}
+	if c.Listener.ProbeAddr != "" {
+		opts = append(opts, WithProbeServer(c.Listener.ProbeAddr))
+	}
+	return opts
+}
+
+// logDiff logs the values of configuration which are different from the
+// default configuration, the secret values are masked
+func (c *Config) logDiff(app *App) {
+	defaults := DefaultConfig().values()
+	values := c.values()
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if values[k] != defaults[k] {
+			app.log().Println(fmt.Sprintf("nano/config: %s=%s (default %s)", k, values[k], defaults[k]))
+		}
+	}
+}
+
+// values returns the formatted values of configuration, key map to value
+func (c *Config) values() map[string]string {
+	values := map[string]string{}
+	walkConfig(reflect.ValueOf(c).Elem(), "", "", func(key, env string, f reflect.StructField, v reflect.Value) error {
+		s := fmt.Sprint(v.Interface())
+		if f.Tag.Get("secret") == "true" && s != "" {
+			s = "******"
+		}
+		values[key] = s
+		return nil
+	})
+	return values
+}
+
+// ListenConfig listens on the address of configuration with the options of
+// configuration, the opts override the configuration, the WebSocket listener
+// is used if configured
+func ListenConfig(ctx context.Context, c *Config, opts ...Option) error {
+	return defaultApp.ListenConfig(ctx, c, opts...)
+}
+
+// ListenConfig listens on the address of configuration with the options of
+// configuration
+func (app *App) ListenConfig(ctx context.Context, c *Config, opts ...Option) error {
+	opts = append(c.Options(), opts...)
+	if c.Listener.WebSocket {
+		return app.ListenWSContext(ctx, c.Listener.Addr, opts...)
+	}
+	return app.ListenContext(ctx, c.Listener.Addr, opts...)
+}
+
+func heartbeatMode(mode string) HeartbeatMode {
+	if mode == HeartbeatClient.String() {
+		return HeartbeatClient
+	}
+	return HeartbeatServer
+}
+
+// walkConfig calls fn with the key and environment variable name of each
+// leaf field of the struct v
+func walkConfig(v reflect.Value, key, env string, fn func(key, env string, f reflect.StructField, v reflect.Value) error) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		k := strings.Split(f.Tag.Get("json"), ",")[0]
+		if key != "" {
+			k = key + "." + k
+		}
+		e := env + "_" + f.Tag.Get("env")
+
+		if f.Type.Kind() == reflect.Struct {
+			if err := walkConfig(v.Field(i), k, e, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := fn(k, e, f, v.Field(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setConfigValue parses s into the leaf field v of configuration
+func setConfigValue(v reflect.Value, s string) error {
+	switch v.Interface().(type) {
+	case Duration:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+	case string:
+		v.SetString(s)
+	case int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(n))
+	case bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case []string:
+		var items []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	case map[string]string:
+		m := map[string]string{}
+		for _, pair := range strings.Split(s, ",") {
+			if pair = strings.TrimSpace(pair); pair == "" {
+				continue
+			}
+			kv := strings.SplitN(pair, "=", 2)
+			if len(kv) != 2 {
+				return fmt.Errorf("%s is not key=value", pair)
+			}
+			m[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+		v.Set(reflect.ValueOf(m))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
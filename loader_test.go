@@ -0,0 +1,128 @@
+package nano
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, name, content string) string {
+	dir, err := ioutil.TempDir("", "nano-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	file := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestLoadConfig(t *testing.T) {
+	file := writeConfig(t, "nano.json", `{
+	"heartbeat": {"interval": "10s", "mode": "client"},
+	"limits": {"maxPacketSize": 4096, "handshakeTimeout": "0s"},
+	"listener": {"addr": "127.0.0.1:3250"},
+	"cluster": {"nodeId": "gate-1"}
+}`)
+	os.Setenv("NANO_HEARTBEAT_MISSES", "5")
+	os.Setenv("NANO_CLUSTER_NODE_LABELS", "zone=eu, role=gate")
+	defer os.Unsetenv("NANO_HEARTBEAT_MISSES")
+	defer os.Unsetenv("NANO_CLUSTER_NODE_LABELS")
+
+	c, err := LoadConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Heartbeat.Interval != Duration(10*time.Second) || c.Heartbeat.Mode != "client" || c.Heartbeat.Misses != 5 {
+		t.Fatalf("unexpected heartbeat %+v", c.Heartbeat)
+	}
+	if c.Limits.MaxPacketSize != 4096 || c.Limits.MaxMessageSize != DefaultConfig().Limits.MaxMessageSize {
+		t.Fatalf("unexpected limits %+v", c.Limits)
+	}
+	if c.Cluster.NodeLabels["zone"] != "eu" || c.Cluster.NodeLabels["role"] != "gate" {
+		t.Fatalf("unexpected labels %v", c.Cluster.NodeLabels)
+	}
+
+	app := NewApp()
+	o := &options{}
+	for _, opt := range c.Options() {
+		opt(o)
+	}
+	if err := app.apply(o); err != nil {
+		t.Fatal(err)
+	}
+	rc := app.Configuration()
+	if rc.NodeID != "gate-1" || rc.Heartbeat.Interval != 10*time.Second || rc.Heartbeat.Mode != "client" ||
+		rc.Heartbeat.Misses != 5 || rc.Limits.MaxPacketSize != 4096 || rc.Limits.HandshakeTimeout != 0 {
+		t.Fatalf("options of config should be applied, %+v", rc)
+	}
+}
+
+func TestLoadConfig_Invalid(t *testing.T) {
+	cases := []struct {
+		name    string
+		content string
+	}{
+		{"unknown.json", `{"heartbeat": {"interval": "10s", "timeout": "10s"}}`},
+		{"mode.json", `{"heartbeat": {"mode": "both"}}`},
+		{"negative.json", `{"limits": {"maxPacketSize": -1}}`},
+		{"console.json", `{"listener": {"consoleAddr": "127.0.0.1:9000"}}`},
+		{"nano.yaml", "heartbeat:\n  interval: 10s\n"},
+		{"nano.ini", "heartbeat=10s"},
+	}
+	for _, c := range cases {
+		if _, err := LoadConfig(writeConfig(t, c.name, c.content)); err == nil {
+			t.Fatalf("%s should be invalid", c.name)
+		}
+	}
+
+	_, err := LoadConfig(writeConfig(t, "misses.json", `{"heartbeat": {"misses": 0}}`))
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("expect ErrInvalidConfig, got %v", err)
+	}
+
+	os.Setenv("NANO_LIMITS_SESSION_EXPIRE", "forever")
+	defer os.Unsetenv("NANO_LIMITS_SESSION_EXPIRE")
+	if _, err := LoadConfig(); err == nil {
+		t.Fatalf("invalid environment variable should be rejected")
+	}
+}
+
+func TestConfigValues(t *testing.T) {
+	c := DefaultConfig()
+	c.Listener.ConsoleToken = "secret"
+	c.Heartbeat.Interval = Duration(time.Minute)
+
+	values := c.values()
+	if values["listener.consoleToken"] != "******" {
+		t.Fatalf("secret should be masked")
+	}
+	if values["heartbeat.interval"] != "1m0s" {
+		t.Fatalf("unexpected interval %s", values["heartbeat.interval"])
+	}
+}
+
+func TestConfigOptions_Defaults(t *testing.T) {
+	app := NewApp()
+	o := &options{}
+	WithHeartbeat(5*time.Second, HeartbeatServer, 2)(o)
+	WithLimits(Limits{MaxPacketSize: 2048})(o)
+	for _, opt := range DefaultConfig().Options() {
+		opt(o)
+	}
+	if err := app.apply(o); err != nil {
+		t.Fatal(err)
+	}
+
+	// the defaults of config do not override the options set before
+	rc := app.Configuration()
+	if rc.Heartbeat.Interval != 5*time.Second || rc.Limits.MaxPacketSize != 2048 {
+		t.Fatalf("options set before should be kept, %+v", rc)
+	}
+}
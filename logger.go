@@ -1,22 +1,306 @@
 package nano
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/kensomanpow/nano/session"
 )
 
-//Logger represents  the log interface
+// Logger represents  the log interface
 type Logger interface {
 	Println(v ...interface{})
 	Fatal(v ...interface{})
 }
 
+// LeveledLogger represents the structured leveled log interface, args are
+// alternating keys and values, it is compatible with *slog.Logger
+type LeveledLogger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
 // Default logger
 var logger Logger = log.New(os.Stderr, "", log.LstdFlags|log.Llongfile)
 
-// SetLogger rewrites the default logger
+// Default leveled logger, which writes to logger
+var slogger LeveledLogger = printLogger{}
+
+// SetLogger rewrites the default logger, which is used by the applications
+// without their own logger, see WithLogger
 func SetLogger(l Logger) {
 	if l != nil {
 		logger = l
 	}
 }
+
+// SetLeveledLogger rewrites the default leveled logger, eg: slog.Default(),
+// the logs written by Println are written as Info level
+func SetLeveledLogger(l LeveledLogger) {
+	if l != nil {
+		slogger = l
+		logger = leveledLogger{l}
+	}
+}
+
+// SetLeveledLogger set the leveled logger of the application, so that the
+// logs of applications in one process are isolated, eg: a test writes the
+// logs of its application to a buffer. The application writes to the default
+// loggers if not set
+func (app *App) SetLeveledLogger(l LeveledLogger) {
+	if l != nil {
+		app.logs.Store(&appLogger{logger: leveledLogger{l}, slogger: l})
+	}
+}
+
+// WithLogger set the leveled logger of the application, which accepts any
+// slog compatible logger, eg: slog.New(handler), see App.SetLeveledLogger
+func WithLogger(l LeveledLogger) Option {
+	return withSetting(func(app *App) error {
+		if l == nil {
+			return invalidOption("WithLogger", "logger can not be nil")
+		}
+		app.SetLeveledLogger(l)
+		return nil
+	})
+}
+
+// Logger returns the leveled logger of the application, which always writes
+// to the current logger of application, so it could be held before the
+// logger set at startup
+func (app *App) Logger() LeveledLogger {
+	return appSlogger{app}
+}
+
+// log returns the logger of application
+func (app *App) log() Logger {
+	if l, ok := app.logs.Load().(*appLogger); ok {
+		return l.logger
+	}
+	return logger
+}
+
+// slog returns the leveled logger of application
+func (app *App) slog() LeveledLogger {
+	if l, ok := app.logs.Load().(*appLogger); ok {
+		return l.slogger
+	}
+	return slogger
+}
+
+type (
+	// appLogger represents the loggers of an application
+	appLogger struct {
+		logger  Logger
+		slogger LeveledLogger
+	}
+
+	// appSlogger writes leveled logs to the logger of application
+	appSlogger struct {
+		app *App
+	}
+
+	// printLogger writes leveled logs to logger
+	printLogger struct{}
+
+	// leveledLogger adapts a leveled logger to Logger
+	leveledLogger struct {
+		LeveledLogger
+	}
+
+	// sessionLogger attaches the session fields and request id to the
+	// leveled logs
+	sessionLogger struct {
+		s         *session.Session
+		requestID string // empty if not in a request
+	}
+)
+
+func (printLogger) Debug(msg string, args ...interface{}) { printLog("DEBUG", msg, args) }
+func (printLogger) Info(msg string, args ...interface{})  { printLog("INFO", msg, args) }
+func (printLogger) Warn(msg string, args ...interface{})  { printLog("WARN", msg, args) }
+func (printLogger) Error(msg string, args ...interface{}) { printLog("ERROR", msg, args) }
+
+func printLog(level, msg string, args []interface{}) {
+	line := fmt.Sprintf("level=%s msg=%q", level, msg)
+	for i := 0; i+1 < len(args); i += 2 {
+		line += fmt.Sprintf(" %v=%v", args[i], args[i+1])
+	}
+	logger.Println(line)
+}
+
+func (l appSlogger) Debug(msg string, args ...interface{}) { l.app.slog().Debug(msg, args...) }
+func (l appSlogger) Info(msg string, args ...interface{})  { l.app.slog().Info(msg, args...) }
+func (l appSlogger) Warn(msg string, args ...interface{})  { l.app.slog().Warn(msg, args...) }
+func (l appSlogger) Error(msg string, args ...interface{}) { l.app.slog().Error(msg, args...) }
+
+func (l leveledLogger) Println(v ...interface{}) {
+	l.Info(fmt.Sprint(v...))
+}
+
+func (l leveledLogger) Fatal(v ...interface{}) {
+	l.Error(fmt.Sprint(v...))
+	os.Exit(1)
+}
+
+// logSession returns a leveled logger which attaches sessionID and uid
+func logSession(s *session.Session) LeveledLogger {
+	return sessionLogger{s: s}
+}
+
+// logRequest returns a leveled logger which attaches sessionID, uid and
+// requestID
+func logRequest(s *session.Session, requestID string) LeveledLogger {
+	return sessionLogger{s: s, requestID: requestID}
+}
+
+func (l sessionLogger) Debug(msg string, args ...interface{}) {
+	if sampled(msg) {
+		appOf(l.s).slog().Debug(msg, l.args(args)...)
+	}
+}
+
+func (l sessionLogger) Info(msg string, args ...interface{}) {
+	if sampled(msg) {
+		appOf(l.s).slog().Info(msg, l.args(args)...)
+	}
+}
+
+func (l sessionLogger) Warn(msg string, args ...interface{}) {
+	if sampled(msg) {
+		appOf(l.s).slog().Warn(msg, l.args(args)...)
+	}
+}
+
+func (l sessionLogger) Error(msg string, args ...interface{}) {
+	if sampled(msg) {
+		appOf(l.s).slog().Error(msg, l.args(args)...)
+	}
+}
+
+func (l sessionLogger) args(args []interface{}) []interface{} {
+	fields := []interface{}{"sessionID", l.s.ID(), "uid", l.s.UID()}
+	if l.requestID != "" {
+		fields = append(fields, "requestID", l.requestID)
+	}
+	return append(fields, args...)
+}
+
+// Log modules, the debug logs of each module could be enabled separately
+const (
+	LogSession   = "session"   // connection established and closed
+	LogHandshake = "handshake" // handshake and handshake ack
+	LogDispatch  = "dispatch"  // messages dispatched to handlers
+	LogPush      = "push"      // pushes and responses
+	LogGroup     = "group"     // group membership and broadcasts
+	LogTimer     = "timer"     // timer functions called
+)
+
+var (
+	// debug logs of all modules enabled
+	debugAll int32
+
+	// debug enabled modules, module map to struct{}
+	debugModules sync.Map
+
+	// log samplers, message map to *sampler
+	samplers sync.Map
+)
+
+// sampler samples one log in n
+type sampler struct {
+	n     int64
+	count int64
+}
+
+// EnableDebugModules enables the debug logs of the modules only, eg:
+// LogHandshake, so that the production logs are not flooded like
+// EnableDebug. It could be called at runtime
+func EnableDebugModules(modules ...string) {
+	for _, m := range modules {
+		debugModules.Store(m, struct{}{})
+	}
+}
+
+// DisableDebugModules disables the debug logs of the modules
+func DisableDebugModules(modules ...string) {
+	for _, m := range modules {
+		debugModules.Delete(m)
+	}
+}
+
+// SetLogSampling samples the structured logs of msg, only one in n logs will
+// be written, eg: 1-in-100 "route not found" warnings, n less than 2 disables
+// the sampling
+func SetLogSampling(msg string, n int) {
+	if n < 2 {
+		samplers.Delete(msg)
+		return
+	}
+	samplers.Store(msg, &sampler{n: int64(n)})
+}
+
+// setDebug enables or disables the debug logs of all modules
+func setDebug(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&debugAll, v)
+}
+
+// debugEnabled reports whether the debug logs of module enabled
+func debugEnabled(module string) bool {
+	if atomic.LoadInt32(&debugAll) == 1 {
+		return true
+	}
+	_, ok := debugModules.Load(module)
+	return ok
+}
+
+// debugEnabled reports whether the debug logs of module enabled globally or
+// for the application only, see WithDebug
+func (app *App) debugEnabled(module string) bool {
+	if debugEnabled(module) || atomic.LoadInt32(&app.env.debugAll) == 1 {
+		return true
+	}
+	_, ok := app.env.debugModules.Load(module)
+	return ok
+}
+
+// debugModuleNames returns the debug enabled modules of the application,
+// includes the modules enabled globally, in sorted order
+func (app *App) debugModuleNames() []string {
+	var modules []string
+	collect := func(k, _ interface{}) bool {
+		modules = append(modules, k.(string))
+		return true
+	}
+	debugModules.Range(collect)
+	app.env.debugModules.Range(collect)
+
+	sort.Strings(modules)
+	names := modules[:0]
+	for i, m := range modules {
+		if i == 0 || m != modules[i-1] {
+			names = append(names, m)
+		}
+	}
+	return names
+}
+
+// sampled reports whether the log of msg should be written
+func sampled(msg string) bool {
+	v, ok := samplers.Load(msg)
+	if !ok {
+		return true
+	}
+	s := v.(*sampler)
+	return (atomic.AddInt64(&s.count, 1)-1)%s.n == 0
+}
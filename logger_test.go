@@ -0,0 +1,101 @@
+package nano
+
+import (
+	"bytes"
+	"log"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/kensomanpow/nano/session"
+)
+
+func TestLogSession(t *testing.T) {
+	defer func(l Logger, sl LeveledLogger) { logger, slogger = l, sl }(logger, slogger)
+
+	buf := &bytes.Buffer{}
+	SetLogger(log.New(buf, "", 0))
+	s := session.New(nil)
+	logSession(s).Warn("rate limited", "route", "room.join")
+	if line := buf.String(); !strings.Contains(line, "level=WARN") || !strings.Contains(line, "route=room.join") {
+		t.Fatalf("unexpected log: %s", line)
+	}
+
+	buf.Reset()
+	SetLeveledLogger(slog.New(slog.NewTextHandler(buf, nil)))
+	logSession(s).Info("hello", "route", "room.join")
+	if line := buf.String(); !strings.Contains(line, "sessionID=") || !strings.Contains(line, "uid=0") {
+		t.Fatalf("unexpected log: %s", line)
+	}
+
+	buf.Reset()
+	logger.Println("legacy")
+	if line := buf.String(); !strings.Contains(line, "level=INFO") || !strings.Contains(line, "legacy") {
+		t.Fatalf("unexpected log: %s", line)
+	}
+}
+
+func TestLogFiltering(t *testing.T) {
+	if debugEnabled(LogHandshake) {
+		t.Fatal("debug logs should be disabled by default")
+	}
+	EnableDebugModules(LogHandshake)
+	if !debugEnabled(LogHandshake) || debugEnabled(LogDispatch) {
+		t.Fatal("only handshake debug logs should be enabled")
+	}
+	DisableDebugModules(LogHandshake)
+	if debugEnabled(LogHandshake) {
+		t.Fatal("handshake debug logs should be disabled")
+	}
+
+	defer SetLogSampling("sampled", 0)
+	SetLogSampling("sampled", 100)
+	n := 0
+	for i := 0; i < 1000; i++ {
+		if sampled("sampled") {
+			n++
+		}
+	}
+	if n != 10 {
+		t.Fatalf("expect 10 logs, got %d", n)
+	}
+	if !sampled("not sampled") {
+		t.Fatal("logs without sampler should be written")
+	}
+}
+
+func TestAppLogger(t *testing.T) {
+	defer func(l Logger, sl LeveledLogger) { logger, slogger = l, sl }(logger, slogger)
+
+	global := &bytes.Buffer{}
+	SetLogger(log.New(global, "", 0))
+
+	bufs := []*bytes.Buffer{{}, {}}
+	apps := []*App{NewApp(), NewApp()}
+	held := apps[0].Logger() // held before the logger set
+	for i, app := range apps {
+		o := &options{}
+		WithLogger(slog.New(slog.NewTextHandler(bufs[i], nil)))(o)
+		if err := app.apply(o); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	held.Warn("from app0")
+	apps[1].log().Println("from app1")
+	if line := bufs[0].String(); !strings.Contains(line, "level=WARN") || !strings.Contains(line, "from app0") {
+		t.Fatalf("unexpected log of app0: %s", line)
+	}
+	if line := bufs[1].String(); !strings.Contains(line, "level=INFO") || strings.Contains(line, "app0") {
+		t.Fatalf("unexpected log of app1: %s", line)
+	}
+	if global.Len() > 0 {
+		t.Fatalf("logs of applications should not be written to default logger: %s", global.String())
+	}
+
+	o := &options{}
+	WithLogger(nil)(o)
+	if err := NewApp().apply(o); err == nil {
+		t.Fatalf("nil logger should be invalid")
+	}
+}
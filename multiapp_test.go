@@ -0,0 +1,171 @@
+package nano
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/kensomanpow/nano/cluster"
+	"github.com/kensomanpow/nano/component"
+	"github.com/kensomanpow/nano/internal/message"
+	"github.com/kensomanpow/nano/serialize/json"
+	"github.com/kensomanpow/nano/session"
+)
+
+type LoginComp struct {
+	component.Base
+}
+
+func (c *LoginComp) Login(s *session.Session, _ []byte) error {
+	return s.Bind(42)
+}
+
+// listenLocal returns a listener on a free loopback port and its address,
+// which is passed to the application, so that the port is never reused
+func listenLocal(t *testing.T) (net.Listener, string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ln, ln.Addr().String()
+}
+
+// serveWS likes ListenWSContext, but accepts the connections from ln
+func serveWS(ctx context.Context, app *App, ln net.Listener, opts ...Option) error {
+	o, err := app.options(opts)
+	if err != nil {
+		ln.Close()
+		return err
+	}
+	return app.run(ctx, ln, true, o)
+}
+
+// testClient is a minimal client speaks the default codec
+type testClient struct {
+	t       *testing.T
+	conn    net.Conn
+	decoder PacketDecoder
+}
+
+func dialApp(t *testing.T, addr string) *testClient {
+	var conn net.Conn
+	var err error
+	for i := 0; i < 50; i++ {
+		if conn, err = net.Dial("tcp", addr); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testClient{t: t, conn: conn, decoder: DefaultCodec.NewDecoder()}
+}
+
+func (c *testClient) write(typ PacketType, data []byte) {
+	p, err := DefaultCodec.Encode(typ, data)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if _, err := c.conn.Write(p); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// read returns the next packet of type typ
+func (c *testClient) read(typ PacketType) *Packet {
+	c.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 4096)
+	for {
+		n, err := c.conn.Read(buf)
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		packets, err := c.decoder.Decode(buf[:n])
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		for _, p := range packets {
+			if p.Type == typ {
+				return p
+			}
+		}
+	}
+}
+
+func TestMultipleApps(t *testing.T) {
+	registry, bus := cluster.NewMemoryRegistry(), cluster.NewMemoryBus()
+	newNode := func(id string) *App {
+		app := NewApp()
+		app.SetNodeID(id)
+		app.SetUIDRegistry(registry)
+		if err := app.SetForwardBus(bus); err != nil {
+			t.Fatal(err)
+		}
+		return app
+	}
+
+	gate, backend := newNode("gate"), newNode("backend")
+	backend.Register(&LoginComp{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	gateLn, _ := listenLocal(t)
+	backendLn, backendAddr := listenLocal(t)
+	go serveWS(ctx, gate, gateLn, WithSerializer(json.NewSerializer()), WithoutSignals())
+	go backend.Serve(ctx, backendLn, WithSerializer(json.NewSerializer()), WithoutSignals())
+
+	c := dialApp(t, backendAddr)
+	defer c.conn.Close()
+	c.write(PacketHandshake, []byte(`{"sys":{"protocol":1}}`))
+	c.read(PacketHandshake)
+	c.write(PacketHandshakeAck, nil)
+
+	data, err := message.NewDictionary().Encode(&message.Message{Type: message.Notify, Route: "LoginComp.Login"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.write(PacketData, data)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !gate.IsOnline(42) {
+		if time.Now().After(deadline) {
+			t.Fatalf("uid should be online in cluster")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if gate.agents.Contains(42) || AgentGroup.Contains(42) {
+		t.Fatalf("session should only belong to backend")
+	}
+
+	// gate forwards the push to backend via bus
+	if err := gate.PushToUID(42, "hello", []byte("hi")); err != nil {
+		t.Fatal(err)
+	}
+	p := c.read(PacketData)
+	m, err := backend.routes.Decode(p.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Route != "hello" || string(m.Data) != "hi" {
+		t.Fatalf("unexpected push %s", m)
+	}
+}
+
+func TestMultipleApps_WebSocket(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		ln, _ := listenLocal(t)
+		go func() { done <- serveWS(ctx, NewApp(), ln, WithoutSignals()) }()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	for i := 0; i < 2; i++ {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,393 @@
+// Copyright (c) nano Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package nanotest boots an application on an in-memory transport, and
+// provides a programmatic client which speaks the nano protocol, so the
+// protocol integration tests run in milliseconds without real sockets.
+package nanotest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/kensomanpow/nano"
+	"github.com/kensomanpow/nano/internal/message"
+	"github.com/kensomanpow/nano/serialize"
+	jsonserialize "github.com/kensomanpow/nano/serialize/json"
+)
+
+const (
+	// DefaultTimeout is the default duration which a client waits for the
+	// responses and pushes
+	DefaultTimeout = 2 * time.Second
+
+	// kickRoute is the route of the push which Session.Kick sends before
+	// the connection closed
+	kickRoute = "error"
+)
+
+// Errors returned by client
+var (
+	ErrTimeout = errors.New("nanotest: timeout")
+	ErrKicked  = errors.New("nanotest: client kicked")
+	ErrClosed  = errors.New("nanotest: listener closed")
+)
+
+type (
+	// Server runs an application on an in-memory transport
+	Server struct {
+		App *nano.App
+
+		ln     *pipeListener
+		cancel context.CancelFunc
+		done   chan error
+	}
+
+	// pipeListener is a net.Listener accepts the server side of net.Pipe
+	pipeListener struct {
+		conns chan net.Conn
+		die   chan struct{}
+		once  sync.Once
+	}
+
+	// pipeAddr is the address of in-memory transport
+	pipeAddr struct{}
+
+	// Client is a programmatic client connected to Server
+	Client struct {
+		// Timeout is the duration which the client waits for the responses
+		// and pushes, DefaultTimeout by default
+		Timeout time.Duration
+
+		conn       net.Conn
+		serializer serialize.Serializer
+		dict       *message.Dictionary
+
+		mu      sync.Mutex
+		mid     uint                           // last request id
+		pending map[uint]chan *message.Message // request id map to response
+		kicked  []byte                         // kick payload, nil if not kicked
+
+		chHandshake chan []byte
+		chPush      chan *message.Message
+		pushes      []*message.Message // received pushes not awaited
+		die         chan struct{}      // closed when read goroutine exited
+	}
+)
+
+func (pipeAddr) Network() string { return "pipe" }
+func (pipeAddr) String() string  { return "pipe" }
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.die:
+		return nil, ErrClosed
+	}
+}
+
+func (l *pipeListener) Close() error {
+	l.once.Do(func() { close(l.die) })
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return pipeAddr{}
+}
+
+// NewServer starts the application on an in-memory transport with the
+// options, the OS signals are not handled. The server should be closed after
+// test
+func NewServer(app *nano.App, opts ...nano.Option) *Server {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Server{
+		App:    app,
+		ln:     &pipeListener{conns: make(chan net.Conn), die: make(chan struct{})},
+		cancel: cancel,
+		done:   make(chan error, 1),
+	}
+
+	opts = append([]nano.Option{nano.WithoutSignals()}, opts...)
+	go func() { s.done <- app.Serve(ctx, s.ln, opts...) }()
+	return s
+}
+
+// Close shutdowns the application, and returns the error of Serve
+func (s *Server) Close() error {
+	s.cancel()
+	return <-s.done
+}
+
+// Dial returns the client side of a new connection
+func (s *Server) Dial() (net.Conn, error) {
+	client, server := net.Pipe()
+	select {
+	case s.ln.conns <- server:
+		return client, nil
+	case err := <-s.done:
+		s.done <- err
+		if err == nil {
+			err = ErrClosed
+		}
+		return nil, err
+	}
+}
+
+// Connect dials the server and completes the handshake, the payloads are
+// marshaled by serializer, nil serializer is JSON
+func (s *Server) Connect(serializer serialize.Serializer) (*Client, error) {
+	conn, err := s.Dial()
+	if err != nil {
+		return nil, err
+	}
+	if serializer == nil {
+		serializer = jsonserialize.NewSerializer()
+	}
+
+	c := &Client{
+		Timeout:     DefaultTimeout,
+		conn:        conn,
+		serializer:  serializer,
+		dict:        message.NewDictionary(),
+		pending:     map[uint]chan *message.Message{},
+		chHandshake: make(chan []byte, 1),
+		chPush:      make(chan *message.Message, 256),
+		die:         make(chan struct{}),
+	}
+	go c.read()
+
+	if err := c.handshake(); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Client) handshake() error {
+	if err := c.write(nano.PacketHandshake, []byte(`{"sys":{"protocol":1}}`)); err != nil {
+		return err
+	}
+
+	var data []byte
+	select {
+	case data = <-c.chHandshake:
+	case <-c.die:
+		return c.closedErr()
+	case <-time.After(c.Timeout):
+		return ErrTimeout
+	}
+
+	resp := &nano.HandshakeResponse{}
+	if err := json.Unmarshal(data, resp); err != nil {
+		return err
+	}
+	if resp.Code != 200 {
+		return fmt.Errorf("nanotest: handshake failed, Code=%d", resp.Code)
+	}
+	c.dict.Set(resp.Sys.Dict)
+
+	return c.write(nano.PacketHandshakeAck, nil)
+}
+
+// read reads and dispatches the packets until the connection closed
+func (c *Client) read() {
+	defer close(c.die)
+
+	decoder := nano.DefaultCodec.NewDecoder()
+	buf := make([]byte, 4096)
+	for {
+		n, err := c.conn.Read(buf)
+		if err != nil {
+			return
+		}
+		packets, err := decoder.Decode(buf[:n])
+		if err != nil {
+			return
+		}
+
+		for _, p := range packets {
+			switch p.Type {
+			case nano.PacketHandshake:
+				c.chHandshake <- p.Data
+
+			case nano.PacketHeartbeat:
+				go c.write(nano.PacketHeartbeat, nil)
+
+			case nano.PacketKick:
+				c.kick(p.Data)
+				return
+
+			case nano.PacketData:
+				m, err := c.dict.Decode(p.Data)
+				if err != nil {
+					continue
+				}
+				if m.Type == message.Response {
+					c.mu.Lock()
+					ch, ok := c.pending[m.ID]
+					delete(c.pending, m.ID)
+					c.mu.Unlock()
+					if ok {
+						ch <- m
+					}
+					continue
+				}
+				if m.Route == kickRoute {
+					c.kick(m.Data)
+					return
+				}
+				c.chPush <- m
+			}
+		}
+	}
+}
+
+// kick records the kick payload and closes the connection
+func (c *Client) kick(data []byte) {
+	c.mu.Lock()
+	c.kicked = append([]byte{}, data...)
+	c.mu.Unlock()
+	c.conn.Close()
+}
+
+func (c *Client) write(typ nano.PacketType, data []byte) error {
+	p, err := nano.DefaultCodec.Encode(typ, data)
+	if err != nil {
+		return err
+	}
+	_, err = c.conn.Write(p)
+	return err
+}
+
+func (c *Client) send(typ message.Type, mid uint, route string, v interface{}) error {
+	data, err := c.marshal(v)
+	if err != nil {
+		return err
+	}
+	m, err := c.dict.Encode(&message.Message{Type: typ, ID: mid, Route: route, Data: data})
+	if err != nil {
+		return err
+	}
+	return c.write(nano.PacketData, m)
+}
+
+func (c *Client) marshal(v interface{}) ([]byte, error) {
+	if data, ok := v.([]byte); ok {
+		return data, nil
+	}
+	return c.serializer.Marshal(v)
+}
+
+func (c *Client) unmarshal(data []byte, v interface{}) error {
+	if v == nil {
+		return nil
+	}
+	if p, ok := v.(*[]byte); ok {
+		*p = data
+		return nil
+	}
+	return c.serializer.Unmarshal(data, v)
+}
+
+func (c *Client) closedErr() error {
+	if c.Kicked() != nil {
+		return ErrKicked
+	}
+	return ErrClosed
+}
+
+// Request sends a request to route, and waits for the response which is
+// unmarshaled into resp, resp could be nil to discard the response, or a
+// *[]byte to receive the raw payload
+func (c *Client) Request(route string, req, resp interface{}) error {
+	ch := make(chan *message.Message, 1)
+	c.mu.Lock()
+	c.mid++
+	mid := c.mid
+	c.pending[mid] = ch
+	c.mu.Unlock()
+
+	if err := c.send(message.Request, mid, route, req); err != nil {
+		return err
+	}
+
+	select {
+	case m := <-ch:
+		return c.unmarshal(m.Data, resp)
+	case <-c.die:
+		return c.closedErr()
+	case <-time.After(c.Timeout):
+		c.mu.Lock()
+		delete(c.pending, mid)
+		c.mu.Unlock()
+		return ErrTimeout
+	}
+}
+
+// Notify sends a notify to route
+func (c *Client) Notify(route string, v interface{}) error {
+	return c.send(message.Notify, 0, route, v)
+}
+
+// AwaitPush waits for the next push of route, which is unmarshaled into v,
+// the pushes of other routes received meanwhile are kept for later awaits
+func (c *Client) AwaitPush(route string, v interface{}) error {
+	for i, m := range c.pushes {
+		if m.Route == route {
+			c.pushes = append(c.pushes[:i], c.pushes[i+1:]...)
+			return c.unmarshal(m.Data, v)
+		}
+	}
+
+	timeout := time.After(c.Timeout)
+	for {
+		select {
+		case m := <-c.chPush:
+			if m.Route == route {
+				return c.unmarshal(m.Data, v)
+			}
+			c.pushes = append(c.pushes, m)
+		case <-c.die:
+			return c.closedErr()
+		case <-timeout:
+			return ErrTimeout
+		}
+	}
+}
+
+// Kicked returns the payload of Session.Kick or the kick packet, nil if not
+// kicked
+func (c *Client) Kicked() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.kicked
+}
+
+// Close closes the connection
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
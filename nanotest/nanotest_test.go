@@ -0,0 +1,79 @@
+package nanotest
+
+import (
+	"testing"
+
+	"github.com/kensomanpow/nano"
+	"github.com/kensomanpow/nano/component"
+	"github.com/kensomanpow/nano/serialize/json"
+	"github.com/kensomanpow/nano/session"
+)
+
+type (
+	Room struct {
+		component.Base
+	}
+
+	JoinRequest struct {
+		Name string `json:"name"`
+	}
+
+	JoinResponse struct {
+		Code int    `json:"code"`
+		Name string `json:"name"`
+	}
+)
+
+func (r *Room) Join(s *session.Session, req *JoinRequest, respond func(interface{}) error) error {
+	if err := s.Push("onJoined", &JoinResponse{Name: req.Name}); err != nil {
+		return err
+	}
+	return respond(&JoinResponse{Name: req.Name})
+}
+
+func (r *Room) Leave(s *session.Session, _ []byte) error {
+	return s.Kick("bye")
+}
+
+func TestServer(t *testing.T) {
+	app := nano.NewApp()
+	app.Register(&Room{})
+	srv := NewServer(app, nano.WithSerializer(json.NewSerializer()))
+	defer func() {
+		if err := srv.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	c, err := srv.Connect(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	resp := &JoinResponse{}
+	if err := c.Request("Room.Join", &JoinRequest{Name: "alice"}, resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Name != "alice" {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+
+	push := &JoinResponse{}
+	if err := c.AwaitPush("onJoined", push); err != nil {
+		t.Fatal(err)
+	}
+	if push.Name != "alice" {
+		t.Fatalf("unexpected push %+v", push)
+	}
+
+	if err := c.Notify("Room.Leave", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AwaitPush("onJoined", nil); err != ErrKicked {
+		t.Fatalf("expect kicked, got %v", err)
+	}
+	if string(c.Kicked()) != `"bye"` {
+		t.Fatalf("unexpected kick payload %s", c.Kicked())
+	}
+}
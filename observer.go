@@ -0,0 +1,114 @@
+package nano
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/kensomanpow/nano/session"
+)
+
+// EventType represents the type of lifecycle events
+type EventType byte
+
+const (
+	// EventAccepted represents a connection accepted
+	EventAccepted EventType = iota
+
+	// EventHandshake represents a session handshake done, which is
+	// acknowledged by client
+	EventHandshake
+
+	// EventBound represents a session bound UID
+	EventBound
+
+	// EventDispatched represents a message dispatched to handler
+	EventDispatched
+
+	// EventClosed represents a session closed
+	EventClosed
+
+	// EventDraining represents the node is stopping
+	EventDraining
+)
+
+var eventNames = [...]string{
+	EventAccepted:   "accepted",
+	EventHandshake:  "handshake",
+	EventBound:      "bound",
+	EventDispatched: "dispatched",
+	EventClosed:     "closed",
+	EventDraining:   "draining",
+}
+
+func (t EventType) String() string {
+	if int(t) < len(eventNames) {
+		return eventNames[t]
+	}
+	return fmt.Sprintf("EventType(%d)", t)
+}
+
+type (
+	// Event represents a lifecycle event
+	Event struct {
+		Type    EventType
+		Time    time.Time
+		Session *session.Session // nil for EventDraining
+		Route   string           // route of EventDispatched
+	}
+
+	// Observer receives all lifecycle events, Observe is called in the
+	// connection and dispatch goroutines and must not block
+	Observer interface {
+		Observe(e *Event)
+	}
+
+	// ObserverFunc is an adapter to allow the use of ordinary functions
+	// as observers
+	ObserverFunc func(e *Event)
+)
+
+// Observe implements the Observer interface
+func (fn ObserverFunc) Observe(e *Event) {
+	fn(e)
+}
+
+var observers = &struct {
+	sync.RWMutex
+	list []Observer
+}{}
+
+func init() {
+	session.OnBind(func(s *session.Session) {
+		appOf(s).notify(EventBound, s, "")
+	})
+}
+
+// AddObserver adds an observer which receives all lifecycle events
+func AddObserver(o Observer) {
+	observers.Lock()
+	defer observers.Unlock()
+
+	observers.list = append(observers.list, o)
+}
+
+func (app *App) notify(typ EventType, s *session.Session, route string) {
+	observers.RLock()
+	defer observers.RUnlock()
+
+	if len(observers.list) < 1 {
+		return
+	}
+
+	defer func() {
+		if err := recover(); err != nil {
+			app.log().Println(fmt.Sprintf("nano/observer: %v", err))
+			println(stack())
+		}
+	}()
+
+	e := &Event{Type: typ, Time: time.Now(), Session: s, Route: route}
+	for _, o := range observers.list {
+		o.Observe(e)
+	}
+}
@@ -0,0 +1,34 @@
+package nano
+
+import (
+	"testing"
+
+	"github.com/kensomanpow/nano/session"
+)
+
+func TestObserver(t *testing.T) {
+	defer func() { observers.list = nil }()
+
+	var events []EventType
+	AddObserver(ObserverFunc(func(e *Event) {
+		events = append(events, e.Type)
+	}))
+
+	s := session.New(nil)
+	defaultApp.notify(EventAccepted, s, "")
+	s.Bind(1)
+	defaultApp.notify(EventDispatched, s, "observer.test")
+
+	expect := []EventType{EventAccepted, EventBound, EventDispatched}
+	if len(events) != len(expect) {
+		t.Fatalf("expect events %v, got %v", expect, events)
+	}
+	for i := range expect {
+		if events[i] != expect[i] {
+			t.Fatalf("expect events %v, got %v", expect, events)
+		}
+	}
+	if EventDraining.String() != "draining" {
+		t.Fatalf("unexpected event name %s", EventDraining)
+	}
+}
@@ -0,0 +1,373 @@
+package nano
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/kensomanpow/nano/serialize"
+	"github.com/kensomanpow/nano/session"
+)
+
+type (
+	options struct {
+		timerPrecision time.Duration // application ticker interval
+		codec          Codec         // wire codec of listener
+		readBufferSize int           // fixed read buffer size of connections
+		debugAddr      string        // address of debug server
+		consoleAddr    string        // address of admin console
+		consoleToken   string        // bearer token of admin console
+		probeAddr      string        // address of probe server
+		tlsConfig      *tls.Config   // serve over TLS if not nil
+		signals        []os.Signal   // signals to shutdown, nil to disable
+		signalHook     SignalHook    // decide whether to shutdown on signal
+		settings       []setting     // application settings
+		err            error         // first invalid option
+	}
+
+	// SignalHook is called when the application receives a signal, the
+	// application shutdown if it returns true, otherwise the signal is
+	// ignored, eg: reload configuration on SIGHUP
+	SignalHook func(sig os.Signal) bool
+
+	// setting validates and applies an option to application at startup
+	setting func(app *App) error
+
+	// Option used to customize application, the options are validated when
+	// the application startup, and Listen returns the error of the first
+	// invalid option, which wraps ErrInvalidOption
+	Option func(opts *options)
+)
+
+// invalidOption returns the error of an invalid option
+func invalidOption(name, reason string) error {
+	return fmt.Errorf("%w: %s, %s", ErrInvalidOption, name, reason)
+}
+
+// invalid records the error of an invalid option
+func (o *options) invalid(name, reason string) {
+	if o.err == nil {
+		o.err = invalidOption(name, reason)
+	}
+}
+
+// withSetting returns the option which applies fn at startup
+func withSetting(fn setting) Option {
+	return func(opts *options) {
+		opts.settings = append(opts.settings, fn)
+	}
+}
+
+// apply validates the options and applies them to application
+func (app *App) apply(o *options) error {
+	if o.err != nil {
+		return o.err
+	}
+
+	for _, fn := range o.settings {
+		if err := fn(app); err != nil {
+			return err
+		}
+	}
+	if o.timerPrecision > 0 {
+		app.SetTimerPrecision(o.timerPrecision)
+	}
+	return nil
+}
+
+// WithTimerPrecision set the interval of the application ticker which all
+// timers of the application are executed in, eg: 100ms for game ticks, or a
+// minute for idle lobby servers. The timers of other applications in the
+// process are not affected. The precision can not less than a Millisecond,
+// default is time.Second
+func WithTimerPrecision(precision time.Duration) Option {
+	return func(opts *options) {
+		if precision < time.Millisecond {
+			opts.invalid("WithTimerPrecision", "time precision can not less than a Millisecond")
+			return
+		}
+		opts.timerPrecision = precision
+	}
+}
+
+// WithCodec set the wire codec of listener, DefaultCodec is used by default
+func WithCodec(c Codec) Option {
+	return func(opts *options) {
+		if c == nil {
+			opts.invalid("WithCodec", "codec can not be nil")
+			return
+		}
+		opts.codec = c
+	}
+}
+
+// WithReadBufferSize set a fixed read buffer size for each connection of the
+// listener, eg: a larger one for upload-heavy routes to save syscalls. By
+// default the read buffer is pooled and adaptively sized with the traffic
+func WithReadBufferSize(size int) Option {
+	return func(opts *options) {
+		if size <= 0 {
+			opts.invalid("WithReadBufferSize", "read buffer size must be positive")
+			return
+		}
+		opts.readBufferSize = size
+	}
+}
+
+// WithDebugServer starts a debug HTTP server at addr, which exposes runtime
+// profiles, memory statistics, registered routes, session counts and dispatch
+// queues. The address must be a loopback address, eg: 127.0.0.1:6060, for
+// production safety
+func WithDebugServer(addr string) Option {
+	return func(opts *options) {
+		if !loopback(addr) {
+			opts.invalid("WithDebugServer", "debug server must listen at a loopback address")
+			return
+		}
+		opts.debugAddr = addr
+	}
+}
+
+// WithAdminConsole starts an admin console at addr, which lists routes,
+// inspects sessions, kicks UIDs, toggles debug logs and adjusts rate limits
+// at runtime. The requests must carry `Authorization: Bearer <token>`
+func WithAdminConsole(addr, token string) Option {
+	return func(opts *options) {
+		if token == "" {
+			opts.invalid("WithAdminConsole", "admin console token can not be empty")
+			return
+		}
+		opts.consoleAddr = addr
+		opts.consoleToken = token
+	}
+}
+
+// defaultSignals are the signals which shutdown application by default
+var defaultSignals = []os.Signal{syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM}
+
+// WithSignals set the signals which shutdown application, default are
+// SIGINT, SIGQUIT and SIGTERM
+func WithSignals(sigs ...os.Signal) Option {
+	return func(opts *options) {
+		if len(sigs) == 0 {
+			opts.invalid("WithSignals", "signals can not be empty, use WithoutSignals to disable")
+			return
+		}
+		opts.signals = sigs
+	}
+}
+
+// WithoutSignals disables the built-in signal handling, eg: the parent
+// process orchestrates the shutdown, the application should be shutdown
+// by Shutdown or cancelling the context of ListenContext
+func WithoutSignals() Option {
+	return func(opts *options) {
+		opts.signals = nil
+	}
+}
+
+// WithSignalHook set the hook which is called when the application receives
+// one of the signals, the signal is ignored if the hook returns false
+func WithSignalHook(hook SignalHook) Option {
+	return func(opts *options) {
+		opts.signalHook = hook
+	}
+}
+
+// WithHandlerTimeout set the max duration of request handlers, see
+// SetHandlerTimeout
+func WithHandlerTimeout(d time.Duration) Option {
+	return withSetting(func(app *App) error {
+		if d < 0 {
+			return invalidOption("WithHandlerTimeout", "handler timeout must not be negative")
+		}
+		app.SetHandlerTimeout(d)
+		return nil
+	})
+}
+
+// WithHeartbeat set the heartbeat interval, which side drives the heartbeat,
+// and the number of missed intervals before the connection closed, see
+// SetHeartbeatInterval, SetHeartbeatMode and SetHeartbeatMisses
+func WithHeartbeat(interval time.Duration, mode HeartbeatMode, misses int) Option {
+	return withSetting(func(app *App) error {
+		if interval <= 0 {
+			return invalidOption("WithHeartbeat", "heartbeat interval must be positive")
+		}
+		if misses < 1 {
+			return invalidOption("WithHeartbeat", "heartbeat misses must be positive")
+		}
+		app.SetHeartbeatInterval(interval)
+		app.SetHeartbeatMode(mode)
+		app.SetHeartbeatMisses(misses)
+		return nil
+	})
+}
+
+// WithSerializer set the application serializer, which automatically Marshal
+// and UnMarshal handler payload, see SetSerializer
+func WithSerializer(seri serialize.Serializer) Option {
+	return withSetting(func(app *App) error {
+		if seri == nil {
+			return invalidOption("WithSerializer", "serializer can not be nil")
+		}
+		app.SetSerializer(seri)
+		return nil
+	})
+}
+
+// WithSystemSerializer set the serializer of system payloads, see
+// SetSystemSerializer
+func WithSystemSerializer(seri serialize.Serializer) Option {
+	return withSetting(func(app *App) error {
+		app.SetSystemSerializer(seri)
+		return nil
+	})
+}
+
+// WithInboundStage adds the stage to inbound pipeline of the application, the
+// duplicated stage name or nil handler is reported at startup
+func WithInboundStage(stage PipelineStage) Option {
+	return withSetting(func(app *App) error {
+		if err := app.Pipeline.Inbound.Add(stage); err != nil {
+			return invalidOption("WithInboundStage", err.Error())
+		}
+		return nil
+	})
+}
+
+// WithOutboundStage adds the stage to outbound pipeline of the application,
+// the duplicated stage name or nil handler is reported at startup
+func WithOutboundStage(stage PipelineStage) Option {
+	return withSetting(func(app *App) error {
+		if err := app.Pipeline.Outbound.Add(stage); err != nil {
+			return invalidOption("WithOutboundStage", err.Error())
+		}
+		return nil
+	})
+}
+
+// WithDebug let the application to run under debug mode, or only enables the
+// debug logs of modules if any. Unlike EnableDebug and EnableDebugModules, the
+// debug logs of other applications in the process are not affected
+func WithDebug(modules ...string) Option {
+	return withSetting(func(app *App) error {
+		if len(modules) == 0 {
+			atomic.StoreInt32(&app.env.debugAll, 1)
+		}
+		for _, m := range modules {
+			app.env.debugModules.Store(m, struct{}{})
+		}
+		return nil
+	})
+}
+
+// WithDictionary presets the codes of routes, so that the codes are stable
+// across deployments and could be compiled into clients. The routes not in
+// dictionary are assigned with the codes after the max preset code
+func WithDictionary(dict map[string]uint16) Option {
+	return withSetting(func(app *App) error {
+		codes := make(map[uint16]string, len(dict))
+		for route, code := range dict {
+			if code == 0 {
+				return invalidOption("WithDictionary", fmt.Sprintf("route %s has zero code", route))
+			}
+			if r, ok := codes[code]; ok {
+				return invalidOption("WithDictionary", fmt.Sprintf("routes %s and %s have same code %d", r, route, code))
+			}
+			codes[code] = route
+		}
+
+		app.handler.mu.Lock()
+		defer app.handler.mu.Unlock()
+		for route, code := range app.env.dict {
+			if c, ok := dict[route]; ok && c != code {
+				return invalidOption("WithDictionary", fmt.Sprintf("route %s has been assigned code %d", route, code))
+			}
+			if r, ok := codes[code]; ok && r != route {
+				return invalidOption("WithDictionary", fmt.Sprintf("code %d has been assigned to route %s", code, route))
+			}
+		}
+		for route, code := range dict {
+			app.env.dict[route] = code
+		}
+		// the preset routes which are not handlers, eg: push routes, are
+		// compressed as well
+		app.routes.Set(dict)
+		return nil
+	})
+}
+
+// WithAuthFunc set the function which authenticates the handshake, the
+// session is kicked with the returned value if not nil, see SetAuthFunc
+func WithAuthFunc(fn func(session *session.Session, handshakeData *HandShakeData) interface{}) Option {
+	return withSetting(func(app *App) error {
+		if fn == nil {
+			return invalidOption("WithAuthFunc", "auth func can not be nil")
+		}
+		app.SetAuthFunc(fn)
+		return nil
+	})
+}
+
+// Limits represents the limits of the connections and messages, the zero
+// fields keep the defaults
+type Limits struct {
+	MaxPacketSize  int           // see SetMaxPacketSize
+	MaxMessageSize int           // see SetMaxMessageSize
+	SessionExpire  time.Duration // idle duration before session expired, rounded up to seconds
+	MinProtocol    int           // see SetMinProtocolVersion
+
+	HandshakeTimeout time.Duration // see SetHandshakeTimeout, zero keeps the default, SetHandshakeTimeout(0) disables it
+}
+
+// WithLimits set the limits of the connections and messages
+func WithLimits(l Limits) Option {
+	return withSetting(func(app *App) error {
+		switch {
+		case l.MaxPacketSize < 0:
+			return invalidOption("WithLimits", "max packet size can not be negative")
+		case l.MaxMessageSize < 0:
+			return invalidOption("WithLimits", "max message size can not be negative")
+		case l.SessionExpire < 0:
+			return invalidOption("WithLimits", "session expire can not be negative")
+		case l.MinProtocol != 0 && (l.MinProtocol < ProtocolLegacy || l.MinProtocol > ProtocolVersion):
+			return invalidOption("WithLimits", fmt.Sprintf("min protocol must be in range [%d, %d]", ProtocolLegacy, ProtocolVersion))
+		case l.HandshakeTimeout < 0:
+			return invalidOption("WithLimits", "handshake timeout can not be negative")
+		}
+		if l.MaxPacketSize > 0 {
+			app.SetMaxPacketSize(l.MaxPacketSize)
+		}
+		if l.MaxMessageSize > 0 {
+			app.SetMaxMessageSize(l.MaxMessageSize)
+		}
+		if l.SessionExpire > 0 {
+			app.SetSessionExpireSecs(int((l.SessionExpire + time.Second - 1) / time.Second))
+		}
+		if l.MinProtocol > 0 {
+			app.SetMinProtocolVersion(l.MinProtocol)
+		}
+		if l.HandshakeTimeout > 0 {
+			app.SetHandshakeTimeout(l.HandshakeTimeout)
+		}
+		return nil
+	})
+}
+
+// WithWebSocket set the WebSocket path and the function that check `Origin`
+// in http headers of ListenWS, nil checkOrigin accepts all origins
+func WithWebSocket(path string, checkOrigin func(*http.Request) bool) Option {
+	return withSetting(func(app *App) error {
+		if checkOrigin == nil {
+			checkOrigin = func(_ *http.Request) bool { return true }
+		}
+		app.SetWSPath(path)
+		app.SetCheckOriginFunc(checkOrigin)
+		return nil
+	})
+}
@@ -0,0 +1,117 @@
+package nano
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kensomanpow/nano/internal/message"
+	"github.com/kensomanpow/nano/serialize/json"
+)
+
+func TestOptions_Invalid(t *testing.T) {
+	cases := []Option{
+		WithTimerPrecision(time.Microsecond),
+		WithReadBufferSize(0),
+		WithDebugServer("0.0.0.0:6060"),
+		WithAdminConsole("127.0.0.1:6061", ""),
+		WithHeartbeat(0, HeartbeatServer, 2),
+		WithSerializer(nil),
+		WithDictionary(map[string]uint16{"A.B": 1, "A.C": 1}),
+		WithLimits(Limits{MinProtocol: ProtocolVersion + 1}),
+		WithLimits(Limits{MinProtocol: -1}),
+	}
+	for i, opt := range cases {
+		if err := NewApp().Listen("127.0.0.1:0", opt); !errors.Is(err, ErrInvalidOption) {
+			t.Fatalf("case %d: expect invalid option error, got %v", i, err)
+		}
+	}
+}
+
+func TestOptions_Apply(t *testing.T) {
+	app := NewApp()
+	o := &options{codec: DefaultCodec}
+	opts := []Option{
+		WithHeartbeat(10*time.Second, HeartbeatClient, 3),
+		WithSerializer(json.NewSerializer()),
+		WithLimits(Limits{MaxPacketSize: 1024, SessionExpire: time.Minute}),
+		WithDictionary(map[string]uint16{"AppComp.Hello": 100}),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if err := app.apply(o); err != nil {
+		t.Fatal(err)
+	}
+
+	c := app.Configuration()
+	if c.Heartbeat.Interval != 10*time.Second || c.Heartbeat.Misses != 3 || c.Heartbeat.Mode != HeartbeatClient.String() {
+		t.Fatalf("unexpected heartbeat %+v", c.Heartbeat)
+	}
+	if c.Limits.MaxPacketSize != 1024 || c.Limits.SessionExpire != time.Minute {
+		t.Fatalf("unexpected limits %+v", c.Limits)
+	}
+	if c.Serializer.Application != typeName(json.NewSerializer()) {
+		t.Fatalf("unexpected serializer %s", c.Serializer.Application)
+	}
+
+	app.Register(&AppComp{})
+	app.startupComponents()
+	if code := app.handler.dictionary()["AppComp.Hello"]; code != 100 {
+		t.Fatalf("preset route code should be kept, got %d", code)
+	}
+}
+
+func TestOptions_Dictionary(t *testing.T) {
+	app := NewApp()
+	o := &options{codec: DefaultCodec}
+	WithDictionary(map[string]uint16{"onChat": 7})(o)
+	if err := app.apply(o); err != nil {
+		t.Fatal(err)
+	}
+
+	// preset push route is compressed
+	data, err := app.routes.Encode(&message.Message{Type: message.Push, Route: "onChat"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := message.NewDictionary().Decode(data); err != message.ErrRouteInfoNotFound {
+		t.Fatalf("preset route should be compressed, got %v", err)
+	}
+
+	app.Register(&AppComp{})
+	app.startupComponents()
+	if code := app.handler.dictionary()["AppComp.Hello"]; code != 8 {
+		t.Fatalf("route should be assigned after preset codes, got %d", code)
+	}
+
+	o = &options{codec: DefaultCodec}
+	WithDictionary(map[string]uint16{"Other.Route": 8})(o)
+	if err := app.apply(o); !errors.Is(err, ErrInvalidOption) {
+		t.Fatalf("expect conflict error, got %v", err)
+	}
+}
+
+func TestOptions_PerApp(t *testing.T) {
+	app, other := NewApp(), NewApp()
+	o := &options{codec: DefaultCodec}
+	WithDebug(LogGroup)(o)
+	WithTimerPrecision(100 * time.Millisecond)(o)
+	WithLimits(Limits{SessionExpire: 1500 * time.Millisecond})(o)
+	if err := app.apply(o); err != nil {
+		t.Fatal(err)
+	}
+
+	if !app.debugEnabled(LogGroup) || app.debugEnabled(LogTimer) {
+		t.Fatal("only group debug logs of app should be enabled")
+	}
+	if other.debugEnabled(LogGroup) || debugEnabled(LogGroup) {
+		t.Fatal("debug logs of other apps should not be enabled")
+	}
+	if app.timers.precision != 100*time.Millisecond || other.timers.precision != timerPrecision {
+		t.Fatalf("timer precision should be set for app only, got %s and %s", app.timers.precision, other.timers.precision)
+	}
+	if app.env.sessionExpireSecs != 2 {
+		t.Fatalf("session expire should be rounded up, got %d", app.env.sessionExpireSecs)
+	}
+}
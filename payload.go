@@ -0,0 +1,123 @@
+package nano
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// PayloadSizeBuckets are the upper bounds of payload size histogram buckets,
+// the payloads larger than the last bound are counted in an extra bucket
+var PayloadSizeBuckets = [...]int{64, 256, 1024, 4096, 16384, 65536, 262144, 1048576}
+
+type (
+	// SizeHistogram represents the distribution of payload sizes, Buckets[i]
+	// counts the payloads not larger than PayloadSizeBuckets[i], and the last
+	// bucket counts the larger ones
+	SizeHistogram struct {
+		Count   int64   `json:"count"`
+		Sum     int64   `json:"sum"` // total bytes
+		Max     int64   `json:"max"`
+		Buckets []int64 `json:"buckets"`
+	}
+
+	// RoutePayloadSizes represents the inbound and outbound payload size
+	// distributions of a route
+	RoutePayloadSizes struct {
+		Route    string        `json:"route"`
+		Inbound  SizeHistogram `json:"inbound"`
+		Outbound SizeHistogram `json:"outbound"`
+	}
+
+	sizeHistogram struct {
+		count   int64
+		sum     int64
+		max     int64
+		buckets [len(PayloadSizeBuckets) + 1]int64
+	}
+
+	routeSizes struct {
+		inbound  sizeHistogram
+		outbound sizeHistogram
+	}
+)
+
+// payloadSizes holds the histograms of each route
+var payloadSizes = &struct {
+	sync.RWMutex
+	routes map[string]*routeSizes
+}{
+	routes: map[string]*routeSizes{},
+}
+
+// PayloadSizes returns the payload size distributions of all routes in order,
+// the sizes are measured before pipeline, so that they reflect the protocol
+// payloads rather than the wire format
+func PayloadSizes() []RoutePayloadSizes {
+	payloadSizes.RLock()
+	defer payloadSizes.RUnlock()
+
+	sizes := make([]RoutePayloadSizes, 0, len(payloadSizes.routes))
+	for route, r := range payloadSizes.routes {
+		sizes = append(sizes, RoutePayloadSizes{
+			Route:    route,
+			Inbound:  r.inbound.snapshot(),
+			Outbound: r.outbound.snapshot(),
+		})
+	}
+	sort.Slice(sizes, func(i, j int) bool { return sizes[i].Route < sizes[j].Route })
+	return sizes
+}
+
+func routePayloadSizes(route string) *routeSizes {
+	payloadSizes.RLock()
+	r, ok := payloadSizes.routes[route]
+	payloadSizes.RUnlock()
+	if ok {
+		return r
+	}
+
+	payloadSizes.Lock()
+	defer payloadSizes.Unlock()
+	if r, ok = payloadSizes.routes[route]; !ok {
+		r = &routeSizes{}
+		payloadSizes.routes[route] = r
+	}
+	return r
+}
+
+// observeInbound records the size of inbound payload of route
+func observeInbound(route string, size int) {
+	routePayloadSizes(route).inbound.observe(size)
+}
+
+// observeOutbound records the size of outbound payload of route
+func observeOutbound(route string, size int) {
+	routePayloadSizes(route).outbound.observe(size)
+}
+
+func (h *sizeHistogram) observe(size int) {
+	i := sort.SearchInts(PayloadSizeBuckets[:], size)
+	atomic.AddInt64(&h.buckets[i], 1)
+	atomic.AddInt64(&h.count, 1)
+	atomic.AddInt64(&h.sum, int64(size))
+	for {
+		max := atomic.LoadInt64(&h.max)
+		if int64(size) <= max || atomic.CompareAndSwapInt64(&h.max, max, int64(size)) {
+			return
+		}
+	}
+}
+
+func (h *sizeHistogram) snapshot() SizeHistogram {
+	s := SizeHistogram{
+		Count:   atomic.LoadInt64(&h.count),
+		Sum:     atomic.LoadInt64(&h.sum),
+		Max:     atomic.LoadInt64(&h.max),
+		Buckets: make([]int64, len(h.buckets)),
+	}
+	for i := range h.buckets {
+		s.Buckets[i] = atomic.LoadInt64(&h.buckets[i])
+	}
+	return s
+}
@@ -0,0 +1,58 @@
+package nano
+
+import (
+	"testing"
+
+	"github.com/kensomanpow/nano/internal/message"
+	"github.com/kensomanpow/nano/serialize/json"
+)
+
+func TestPayloadSizes(t *testing.T) {
+	observeInbound("payload.test", 10)
+	observeInbound("payload.test", 64)
+	observeInbound("payload.test", 2000)
+	observeOutbound("payload.test", 2<<20)
+
+	var sizes *RoutePayloadSizes
+	for _, s := range PayloadSizes() {
+		if s.Route == "payload.test" {
+			sizes = &s
+		}
+	}
+	if sizes == nil {
+		t.Fatalf("route payload sizes not found")
+	}
+
+	in := sizes.Inbound
+	if in.Count != 3 || in.Sum != 2074 || in.Max != 2000 {
+		t.Fatalf("unexpected inbound histogram %+v", in)
+	}
+	if in.Buckets[0] != 2 || in.Buckets[3] != 1 {
+		t.Fatalf("unexpected inbound buckets %v", in.Buckets)
+	}
+	out := sizes.Outbound
+	if out.Count != 1 || out.Buckets[len(PayloadSizeBuckets)] != 1 {
+		t.Fatalf("unexpected outbound histogram %+v", out)
+	}
+}
+
+func TestPayloadSizes_Requests(t *testing.T) {
+	app := NewApp()
+	app.SetSerializer(json.NewSerializer())
+	app.handler.register(&TestComp{}, nil)
+
+	// the requests failed before dispatching are not tracked
+	agent := newAgent(app, nil)
+	msg := &message.Message{Type: message.Request, ID: 1, Route: "TestComp.HandleJSON", Data: []byte("{")}
+	app.handler.processMessage(agent, msg)
+	agent.requests.Range(func(k, _ interface{}) bool {
+		t.Fatalf("request %v should not be tracked", k)
+		return false
+	})
+
+	msg = &message.Message{Type: message.Request, ID: 2, Route: "TestComp.HandleJSON", Data: []byte("{}")}
+	app.handler.processMessage(agent, msg)
+	if r, ok := agent.requests.Load(uint(2)); !ok || r != "TestComp.HandleJSON" {
+		t.Fatalf("dispatched request should be tracked")
+	}
+}
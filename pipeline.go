@@ -1,28 +1,331 @@
 package nano
 
-import "github.com/kensomanpow/nano/session"
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
 
-var Pipeline = struct {
-	Outbound, Inbound *pipelineChannel
-}{&pipelineChannel{}, &pipelineChannel{}}
+	"github.com/kensomanpow/nano/internal/message"
+	"github.com/kensomanpow/nano/session"
+)
+
+// Message flags, FlagCompressed, FlagTraced and FlagIdentified are managed by
+// nano and they are never visible to pipeline stages, the body of traced
+// message is prefixed with the W3C traceparent, and the body of identified
+// message is prefixed with the request id following the traceparent, both as
+// 1 byte length followed by the string
+const (
+	FlagCompressed MessageFlag = message.Compressed
+	FlagEncrypted  MessageFlag = message.Encrypted
+	FlagTraced     MessageFlag = message.Traced
+	FlagIdentified MessageFlag = message.Identified
+)
+
+// Pipeline contains the handlers which process the payload of every message
+// of the default App, Inbound handlers are applied to the request/notify
+// payload before it is deserialized, Outbound handlers are applied to every
+// Response/Push payload, including the pushes of Group.Broadcast/Multicast,
+// after it is serialized, eg: compression, encryption, audit logging.
+var Pipeline = defaultApp.Pipeline
 
 type (
+	// Pipelines contains the inbound and outbound pipeline channels
+	Pipelines struct {
+		Outbound, Inbound *pipelineChannel
+	}
+
 	pipelineHandler func(s *session.Session, in []byte) (out []byte, err error)
 
+	// PipelineMeta represents the metadata of the message which is processed
+	// by pipeline, so that handlers could make route dependent decisions
+	PipelineMeta struct {
+		Route     string      // route of Response is the route of its Request
+		Type      string      // Request/Notify/Response/Push
+		ID        uint        // message id of Request/Response
+		Flags     MessageFlag // flag bits of message header
+		RequestID string      // request id of Request/Notify
+	}
+
+	// MessageFlag represents the flag bits of message header which indicate
+	// the state of message body, the inbound stages read the flags of the
+	// received message, and the outbound stages set the flags of the message
+	// to send, so that plain and encrypted messages could coexist in one
+	// session. The flags are only available since protocol version 2
+	MessageFlag = message.Flag
+
+	// PipelineFunc represents a pipeline handler which processes the payload
+	// with the message metadata
+	PipelineFunc func(s *session.Session, meta *PipelineMeta, in []byte) (out []byte, err error)
+
+	// PipelineStage represents a named pipeline handler, stages are applied in
+	// ascending order of priority, and in registration order for the stages
+	// with the same priority
+	PipelineStage struct {
+		Name     string // unique name in the pipeline channel, optional
+		Route    string // empty matches all routes, `Room.*` matches prefix
+		Priority int
+		Handler  PipelineFunc
+	}
+
+	// PipelineError aborts a message with a client visible error when it is
+	// returned by a pipeline handler, rather than dropping the message
+	// silently. An aborted Request is responded with the error, and the
+	// session is kicked with the error if Kick is true. The error is always
+	// encoded as JSON, eg: {"code":413,"msg":"payload too large"}
+	PipelineError struct {
+		Code    int    `json:"code"`
+		Message string `json:"msg"`
+		Kick    bool   `json:"-"` // kick the session
+	}
+
+	// pipelineChannel contains the ordered stages, stages could be added,
+	// removed or replaced at runtime
 	pipelineChannel struct {
-		handlers []pipelineHandler
+		mu     sync.RWMutex
+		stages []PipelineStage // ordered by priority, copied on write
 	}
 )
 
-// PushFront should not be used after nano running
+// PushFront adds the handler to the front of pipeline
 func (p *pipelineChannel) PushFront(h pipelineHandler) {
-	handlers := make([]pipelineHandler, len(p.handlers)+1)
-	handlers[0] = h
-	copy(handlers[1:], p.handlers)
-	p.handlers = handlers
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stage := PipelineStage{Handler: h.withMeta()}
+	if len(p.stages) > 0 && p.stages[0].Priority < 0 {
+		stage.Priority = p.stages[0].Priority
+	}
+	p.insert(0, stage)
 }
 
-// PushBack should not be used after nano running
+// PushBack adds the handler to the back of pipeline
 func (p *pipelineChannel) PushBack(h pipelineHandler) {
-	p.handlers = append(p.handlers, h)
+	p.PushBackRoute("", h)
+}
+
+// PushBackRoute is like PushBack but the handler is only applied to the
+// messages of the route, a route ends with `*` matches all routes that have
+// the prefix, eg: `Room.*`. Responses have no route, so outbound route
+// handlers are only applied to pushes.
+func (p *pipelineChannel) PushBackRoute(route string, h pipelineHandler) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stage := PipelineStage{Route: route, Handler: h.withMeta()}
+	if n := len(p.stages); n > 0 && p.stages[n-1].Priority > 0 {
+		stage.Priority = p.stages[n-1].Priority
+	}
+	p.insert(len(p.stages), stage)
+}
+
+// Add adds the stage after all stages which priority are not greater than
+// the stage's, so that the order does not depend on the registration order
+// of stages with different priorities.
+func (p *pipelineChannel) Add(stage PipelineStage) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.check(stage); err != nil {
+		return err
+	}
+
+	i := len(p.stages)
+	for i > 0 && p.stages[i-1].Priority > stage.Priority {
+		i--
+	}
+	p.insert(i, stage)
+	return nil
+}
+
+// InsertBefore inserts the stage before the stage named name, the stage
+// will have the same priority as the named stage.
+func (p *pipelineChannel) InsertBefore(name string, stage PipelineStage) error {
+	return p.insertAt(name, 0, stage)
+}
+
+// InsertAfter inserts the stage after the stage named name, the stage will
+// have the same priority as the named stage.
+func (p *pipelineChannel) InsertAfter(name string, stage PipelineStage) error {
+	return p.insertAt(name, 1, stage)
+}
+
+// Remove removes the stage named name, eg: turn off a debug stage on a live
+// server. The messages being processed may still be applied to the stage.
+func (p *pipelineChannel) Remove(name string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	i := p.index(name)
+	if i < 0 {
+		return ErrStageNotFound
+	}
+
+	stages := make([]PipelineStage, 0, len(p.stages)-1)
+	stages = append(stages, p.stages[:i]...)
+	p.stages = append(stages, p.stages[i+1:]...)
+	return nil
+}
+
+// Replace replaces the stage named name with stage in the same position,
+// the stage will have the same priority as the replaced stage.
+func (p *pipelineChannel) Replace(name string, stage PipelineStage) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	i := p.index(name)
+	if i < 0 {
+		return ErrStageNotFound
+	}
+	if stage.Handler == nil {
+		return ErrNilStageHandler
+	}
+	if stage.Name != name && stage.Name != "" && p.index(stage.Name) >= 0 {
+		return ErrStageDuplication
+	}
+
+	stage.Priority = p.stages[i].Priority
+	stages := make([]PipelineStage, len(p.stages))
+	copy(stages, p.stages)
+	stages[i] = stage
+	p.stages = stages
+	return nil
+}
+
+// Stages returns the names of all stages in order, unnamed stages are
+// returned as empty string
+func (p *pipelineChannel) Stages() []string {
+	stages := p.snapshot()
+	names := make([]string, 0, len(stages))
+	for _, stage := range stages {
+		names = append(names, stage.Name)
+	}
+	return names
+}
+
+func (p *pipelineChannel) check(stage PipelineStage) error {
+	if stage.Handler == nil {
+		return ErrNilStageHandler
+	}
+	if stage.Name != "" && p.index(stage.Name) >= 0 {
+		return ErrStageDuplication
+	}
+	return nil
+}
+
+func (p *pipelineChannel) index(name string) int {
+	for i, stage := range p.stages {
+		if stage.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (p *pipelineChannel) insertAt(name string, offset int, stage PipelineStage) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	i := p.index(name)
+	if i < 0 {
+		return ErrStageNotFound
+	}
+	if err := p.check(stage); err != nil {
+		return err
+	}
+
+	stage.Priority = p.stages[i].Priority
+	p.insert(i+offset, stage)
+	return nil
+}
+
+// insert inserts stage at i, stages are copied on write, so that the
+// messages being processed are not affected
+func (p *pipelineChannel) insert(i int, stage PipelineStage) {
+	stages := make([]PipelineStage, len(p.stages)+1)
+	copy(stages, p.stages[:i])
+	stages[i] = stage
+	copy(stages[i+1:], p.stages[i:])
+	p.stages = stages
+}
+
+// snapshot returns current stages, which must not be modified
+func (p *pipelineChannel) snapshot() []PipelineStage {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.stages
+}
+
+// withMeta adapts the handler to PipelineFunc which ignores the metadata
+func (h pipelineHandler) withMeta() PipelineFunc {
+	if h == nil {
+		return nil
+	}
+	return func(s *session.Session, _ *PipelineMeta, in []byte) ([]byte, error) {
+		return h(s, in)
+	}
+}
+
+// matchRoute reports whether route matches the pattern of a stage
+func matchRoute(pattern, route string) bool {
+	if pattern == "" {
+		return true
+	}
+	if strings.HasSuffix(pattern, "*") {
+		return strings.HasPrefix(route, strings.TrimSuffix(pattern, "*"))
+	}
+	return pattern == route
+}
+
+// process applies the handlers that match the route of message to data in
+// order, the message should be dropped if any handler returns an error
+func (p *pipelineChannel) process(s *session.Session, meta *PipelineMeta, data []byte) ([]byte, error) {
+	var err error
+	for _, stage := range p.snapshot() {
+		if !matchRoute(stage.Route, meta.Route) {
+			continue
+		}
+		data, err = stage.Handler(s, meta, data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+func (e *PipelineError) Error() string {
+	return fmt.Sprintf("pipeline aborted, Code=%d, Message=%s", e.Code, e.Message)
+}
+
+// Is reports whether target is ErrPipelineRejected or the typed error with
+// the same code, eg: ErrPayloadTooLarge
+func (e *PipelineError) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && (t.Code == CodePipelineRejected || t.Code == ErrorCode(e.Code))
+}
+
+// payload returns the JSON encoded error which will be sent to client
+func (e *PipelineError) payload() []byte {
+	data, _ := json.Marshal(e)
+	return data
+}
+
+// abortMessage notifies the client that a inbound message has been aborted
+// by pipeline, notify messages have no response, so they are aborted
+// silently unless the session should be kicked
+func abortMessage(a *agent, mid uint, e *PipelineError) {
+	var err error
+	switch {
+	case e.Kick:
+		err = a.Kick(e.payload())
+	case mid > 0:
+		err = a.ResponseMID(mid, e.payload())
+	default:
+		return
+	}
+
+	if err != nil {
+		a.app.log().Println(fmt.Sprintf("nano/pipeline: abort message failed, ID=%d, UID=%d, Error=%s",
+			a.session.ID(), a.session.UID(), err.Error()))
+	}
 }
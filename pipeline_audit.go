@@ -0,0 +1,171 @@
+package nano
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/kensomanpow/nano/internal/message"
+	"github.com/kensomanpow/nano/session"
+)
+
+// auditExpire indicates the duration that a sampled request waits for its
+// response, the request will be audited without latency after expired
+const auditExpire = time.Minute
+
+type (
+	// AuditRecord represents an audited message
+	AuditRecord struct {
+		Time      time.Time     `json:"time"`
+		Route     string        `json:"route"`
+		Type      string        `json:"type"` // Request/Notify
+		SessionID int64         `json:"sessionId"`
+		UID       int64         `json:"uid"`
+		Size      int           `json:"size"`              // request payload size
+		Latency   time.Duration `json:"latency,omitempty"` // elapsed until response, zero for Notify
+	}
+
+	// AuditSink receives the audit records, Audit is called in the message
+	// processing path and must not block
+	AuditSink interface {
+		Audit(r *AuditRecord)
+	}
+
+	// writerSink writes audit records and security events to writer as
+	// JSON lines
+	writerSink struct {
+		mu sync.Mutex
+		w  io.Writer
+	}
+
+	// auditor tracks the sampled requests until they are responded
+	auditor struct {
+		sink AuditSink
+		rate float64
+
+		mu      sync.Mutex
+		pending map[pendingKey]*AuditRecord
+		gcAt    time.Time
+	}
+
+	pendingKey struct {
+		sid int64
+		mid uint
+	}
+)
+
+// NewWriterAuditSink returns an AuditSink which writes audit records to w as
+// JSON lines, eg: a log file
+func NewWriterAuditSink(w io.Writer) AuditSink {
+	return &writerSink{w: w}
+}
+
+func (ws *writerSink) Audit(r *AuditRecord) {
+	ws.write(r)
+}
+
+func (ws *writerSink) write(v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if _, err := ws.w.Write(append(data, '\n')); err != nil {
+		logger.Println(fmt.Sprintf("nano/audit: write record failed, Error=%s", err.Error()))
+	}
+}
+
+// AuditStages returns the inbound and outbound pipeline stages named `audit`
+// which audit the route, UID, payload size and latency of the inbound
+// messages, sampleRate indicates the fraction of messages to audit, in range
+// (0, 1]. The stages should be added to Pipeline.Inbound and
+// Pipeline.Outbound respectively, they have the lowest inbound and highest
+// outbound priority, so that the payload size is measured on wire.
+//
+//	in, out := nano.AuditStages(nano.NewWriterAuditSink(file), 0.1)
+//	nano.Pipeline.Inbound.Add(in)
+//	nano.Pipeline.Outbound.Add(out)
+func AuditStages(sink AuditSink, sampleRate float64) (inbound, outbound PipelineStage) {
+	if sink == nil {
+		panic("nano/audit: nil audit sink")
+	}
+
+	a := &auditor{
+		sink:    sink,
+		rate:    sampleRate,
+		pending: make(map[pendingKey]*AuditRecord),
+		gcAt:    time.Now(),
+	}
+
+	inbound = PipelineStage{Name: "audit", Priority: math.MinInt32, Handler: a.inbound}
+	outbound = PipelineStage{Name: "audit", Priority: math.MaxInt32, Handler: a.outbound}
+	return
+}
+
+func (a *auditor) inbound(s *session.Session, meta *PipelineMeta, in []byte) ([]byte, error) {
+	if a.rate < 1 && rand.Float64() >= a.rate {
+		return in, nil
+	}
+
+	r := &AuditRecord{
+		Time:      time.Now(),
+		Route:     meta.Route,
+		Type:      meta.Type,
+		SessionID: s.ID(),
+		UID:       s.UID(),
+		Size:      len(in),
+	}
+
+	// audit request when it is responded
+	if meta.Type == message.Request.String() && meta.ID > 0 {
+		a.mu.Lock()
+		a.pending[pendingKey{sid: s.ID(), mid: meta.ID}] = r
+		a.gc(r.Time)
+		a.mu.Unlock()
+		return in, nil
+	}
+
+	a.sink.Audit(r)
+	return in, nil
+}
+
+func (a *auditor) outbound(s *session.Session, meta *PipelineMeta, out []byte) ([]byte, error) {
+	if meta.Type != message.Response.String() {
+		return out, nil
+	}
+
+	key := pendingKey{sid: s.ID(), mid: meta.ID}
+	a.mu.Lock()
+	r, ok := a.pending[key]
+	delete(a.pending, key)
+	a.mu.Unlock()
+
+	if ok {
+		r.UID = s.UID() // UID may be bound in handler
+		r.Latency = time.Since(r.Time)
+		a.sink.Audit(r)
+	}
+	return out, nil
+}
+
+// gc audits the expired requests which have not been responded, eg: session
+// closed before response
+func (a *auditor) gc(now time.Time) {
+	if now.Sub(a.gcAt) < auditExpire {
+		return
+	}
+	a.gcAt = now
+
+	for key, r := range a.pending {
+		if now.Sub(r.Time) > auditExpire {
+			delete(a.pending, key)
+			a.sink.Audit(r)
+		}
+	}
+}
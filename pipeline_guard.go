@@ -0,0 +1,119 @@
+package nano
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/kensomanpow/nano/session"
+)
+
+const (
+	// RolesKey is the session key of the roles of session, []string, eg: set
+	// by the auth function
+	RolesKey = "nano.roles"
+
+	// ClaimsKey is the session key of the claims of authenticated token,
+	// which implements SessionClaims, eg: auth.Claims stored by auth.JWT
+	ClaimsKey = "nano.claims"
+)
+
+type (
+	// SessionClaims represents the claims of authenticated session, the
+	// `roles` claim is merged into the roles of session
+	SessionClaims interface {
+		Strings(name string) []string
+	}
+
+	// RouteGuard represents the permissions required by a route, the session
+	// must have any of Roles, and all of Claims, a claim is matched if the
+	// value is one of the claim values of session
+	RouteGuard struct {
+		Roles  []string
+		Claims map[string]string
+	}
+)
+
+// GuardStage returns an inbound pipeline stage named `guard` which rejects
+// the messages of guarded routes if the session does not have the required
+// permissions, so that the handlers do not check the permissions one by one.
+// A route ends with `*` matches all routes that have the prefix, the longest
+// matched route takes precedence. The roles of session are the RolesKey
+// value and the `roles` claim of ClaimsKey value. The message is aborted with
+// ErrPipelineRejected code.
+//
+//	nano.Pipeline.Inbound.Add(nano.GuardStage(map[string]nano.RouteGuard{
+//		"GM.*": {Roles: []string{"gm", "admin"}},
+//	}))
+func GuardStage(guards map[string]RouteGuard) PipelineStage {
+	rules := make(map[string]RouteGuard, len(guards))
+	for route, guard := range guards {
+		rules[route] = guard
+	}
+
+	return PipelineStage{
+		Name:     "guard",
+		Priority: math.MinInt32,
+		Handler: func(s *session.Session, meta *PipelineMeta, in []byte) ([]byte, error) {
+			guard, ok := routeGuard(rules, meta.Route)
+			if !ok || guard.permit(s) {
+				return in, nil
+			}
+
+			return nil, &PipelineError{
+				Code:    int(CodePipelineRejected),
+				Message: fmt.Sprintf("permission denied, Route=%s", meta.Route),
+			}
+		},
+	}
+}
+
+// routeGuard returns the guard of route, exactly matched route takes
+// precedence over prefix
+func routeGuard(rules map[string]RouteGuard, route string) (RouteGuard, bool) {
+	if guard, ok := rules[route]; ok {
+		return guard, true
+	}
+
+	matched, guard := -1, RouteGuard{}
+	for pattern, g := range rules {
+		if !strings.HasSuffix(pattern, "*") || !matchRoute(pattern, route) {
+			continue
+		}
+		if len(pattern) > matched {
+			matched, guard = len(pattern), g
+		}
+	}
+	return guard, matched >= 0
+}
+
+// permit reports whether session s has the permissions of guard
+func (g RouteGuard) permit(s *session.Session) bool {
+	claims, _ := s.Value(ClaimsKey).(SessionClaims)
+	if len(g.Roles) > 0 {
+		roles, _ := s.Value(RolesKey).([]string)
+		if claims != nil {
+			roles = append(roles[:len(roles):len(roles)], claims.Strings("roles")...)
+		}
+		if !containsAny(roles, g.Roles) {
+			return false
+		}
+	}
+	for name, value := range g.Claims {
+		if claims == nil || !containsAny(claims.Strings(name), []string{value}) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsAny(values, targets []string) bool {
+	for _, v := range values {
+		for _, t := range targets {
+			if v == t {
+				return true
+			}
+		}
+	}
+	return false
+}
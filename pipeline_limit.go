@@ -0,0 +1,77 @@
+package nano
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/kensomanpow/nano/session"
+)
+
+// SizeLimitPolicy indicates how to handle the message which exceeds the size
+// limit
+type SizeLimitPolicy int
+
+const (
+	// SizeLimitDrop drops the message, and responds an error if the message
+	// is a Request
+	SizeLimitDrop SizeLimitPolicy = iota
+
+	// SizeLimitKick kicks the session
+	SizeLimitKick
+)
+
+// SizeLimitStage returns an inbound pipeline stage named `size-limit` which
+// limits the payload size of messages, max is the default limit, and routes
+// overrides the limit of specific routes, a route ends with `*` matches all
+// routes that have the prefix, the longest matched route takes precedence.
+// A limit not greater than zero means unlimited. The stage has the lowest
+// priority, so that the payload is checked before other stages and the
+// deserialization. The message is aborted with ErrPayloadTooLarge code.
+//
+//	nano.Pipeline.Inbound.Add(nano.SizeLimitStage(4096, map[string]int{
+//		"Chat.*": 512,
+//	}, nano.SizeLimitKick))
+func SizeLimitStage(max int, routes map[string]int, policy SizeLimitPolicy) PipelineStage {
+	limits := make(map[string]int, len(routes))
+	for route, limit := range routes {
+		limits[route] = limit
+	}
+
+	return PipelineStage{
+		Name:     "size-limit",
+		Priority: math.MinInt32,
+		Handler: func(s *session.Session, meta *PipelineMeta, in []byte) ([]byte, error) {
+			limit := sizeLimit(max, limits, meta.Route)
+			if limit <= 0 || len(in) <= limit {
+				return in, nil
+			}
+
+			return nil, &PipelineError{
+				Code:    int(CodePayloadTooLarge),
+				Message: fmt.Sprintf("payload too large, Route=%s, Size=%d, Limit=%d", meta.Route, len(in), limit),
+				Kick:    policy == SizeLimitKick,
+			}
+		},
+	}
+}
+
+// sizeLimit returns the limit of route, exactly matched route takes
+// precedence over prefix
+func sizeLimit(max int, limits map[string]int, route string) int {
+	if limit, ok := limits[route]; ok {
+		return limit
+	}
+
+	matched := -1
+	for pattern, limit := range limits {
+		if !strings.HasSuffix(pattern, "*") || !matchRoute(pattern, route) {
+			continue
+		}
+		if len(pattern) > matched {
+			matched = len(pattern)
+			max = limit
+		}
+	}
+	return max
+}
@@ -0,0 +1,300 @@
+package nano
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/kensomanpow/nano/internal/message"
+	"github.com/kensomanpow/nano/session"
+)
+
+func TestPipelineChannel_Process(t *testing.T) {
+	p := &pipelineChannel{}
+	p.PushBack(func(s *session.Session, in []byte) ([]byte, error) {
+		return append(in, 'b'), nil
+	})
+	p.PushFront(func(s *session.Session, in []byte) ([]byte, error) {
+		return append(in, 'a'), nil
+	})
+
+	out, err := p.process(nil, &PipelineMeta{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "ab" {
+		t.Fatalf("handlers should be applied in order, got %s", out)
+	}
+
+	p.PushBack(func(s *session.Session, in []byte) ([]byte, error) {
+		return in, errors.New("broken")
+	})
+	if out, err := p.process(nil, &PipelineMeta{}, nil); err == nil || out != nil {
+		t.Fatal("message should be dropped when pipeline broken")
+	}
+}
+
+func TestPipelineChannel_Route(t *testing.T) {
+	p := &pipelineChannel{}
+	p.PushBackRoute("Room.*", func(s *session.Session, in []byte) ([]byte, error) {
+		return append(in, 'r'), nil
+	})
+	p.PushBackRoute("Chat.Send", func(s *session.Session, in []byte) ([]byte, error) {
+		return append(in, 'c'), nil
+	})
+
+	cases := map[string]string{
+		"Room.Join":  "r",
+		"Chat.Send":  "c",
+		"Chat.Leave": "",
+		"":           "",
+	}
+	for route, expect := range cases {
+		out, err := p.process(nil, &PipelineMeta{Route: route}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != expect {
+			t.Fatalf("route %s, expect %q, got %q", route, expect, out)
+		}
+	}
+}
+
+func TestPipelineChannel_Stages(t *testing.T) {
+	nop := func(s *session.Session, meta *PipelineMeta, in []byte) ([]byte, error) { return in, nil }
+
+	p := &pipelineChannel{}
+	p.PushBack(func(s *session.Session, in []byte) ([]byte, error) { return in, nil })
+	if err := p.Add(PipelineStage{Name: "audit", Priority: 100, Handler: nop}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Add(PipelineStage{Name: "decrypt", Priority: -100, Handler: nop}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Add(PipelineStage{Name: "auth", Handler: nop}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.InsertAfter("decrypt", PipelineStage{Name: "decompress", Handler: nop}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.InsertBefore("audit", PipelineStage{Name: "quota", Handler: nop}); err != nil {
+		t.Fatal(err)
+	}
+	p.PushBack(func(s *session.Session, in []byte) ([]byte, error) { return in, nil })
+
+	expect := []string{"decrypt", "decompress", "", "auth", "quota", "audit", ""}
+	if names := p.Stages(); !reflect.DeepEqual(names, expect) {
+		t.Fatalf("expect %v, got %v", expect, names)
+	}
+
+	if err := p.Add(PipelineStage{Name: "auth", Handler: nop}); err != ErrStageDuplication {
+		t.Fatalf("expect %v, got %v", ErrStageDuplication, err)
+	}
+	if err := p.InsertBefore("none", PipelineStage{Handler: nop}); err != ErrStageNotFound {
+		t.Fatalf("expect %v, got %v", ErrStageNotFound, err)
+	}
+	if err := p.Add(PipelineStage{Name: "nil"}); err != ErrNilStageHandler {
+		t.Fatalf("expect %v, got %v", ErrNilStageHandler, err)
+	}
+	if err := p.Replace("auth", PipelineStage{Name: "auth"}); err != ErrNilStageHandler {
+		t.Fatalf("expect %v, got %v", ErrNilStageHandler, err)
+	}
+
+	o := &options{codec: DefaultCodec}
+	WithInboundStage(PipelineStage{Name: "nil"})(o)
+	if err := NewApp().apply(o); !errors.Is(err, ErrInvalidOption) {
+		t.Fatalf("expect invalid option, got %v", err)
+	}
+}
+
+func TestAbortMessage(t *testing.T) {
+	agent := newAgent(defaultApp, nil)
+	e := &PipelineError{Code: 413, Message: "payload too large"}
+
+	abortMessage(agent, 3, e)
+	m := <-agent.chSend
+	if m.typ != message.Response || m.mid != 3 || m.kick {
+		t.Fatalf("request should be responded with error, got %+v", m)
+	}
+	if string(m.payload.([]byte)) != `{"code":413,"msg":"payload too large"}` {
+		t.Fatalf("unexpected error payload: %s", m.payload)
+	}
+
+	abortMessage(agent, 0, e)
+	if len(agent.chSend) != 0 {
+		t.Fatal("notify should be aborted silently")
+	}
+
+	e.Kick = true
+	abortMessage(agent, 0, e)
+	m = <-agent.chSend
+	if m.typ != message.Push || m.route != "error" || !m.kick {
+		t.Fatalf("session should be kicked, got %+v", m)
+	}
+}
+
+func TestPipelineChannel_Meta(t *testing.T) {
+	p := &pipelineChannel{}
+	p.Add(PipelineStage{Handler: func(s *session.Session, meta *PipelineMeta, in []byte) ([]byte, error) {
+		if meta.Type == message.Request.String() && meta.ID > 0 {
+			return []byte(meta.Route), nil
+		}
+		return in, nil
+	}})
+
+	out, err := p.process(nil, &PipelineMeta{Route: "Room.Join", Type: message.Request.String(), ID: 1}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "Room.Join" {
+		t.Fatalf("handler should receive message metadata, got %s", out)
+	}
+}
+
+func TestSizeLimitStage(t *testing.T) {
+	stage := SizeLimitStage(8, map[string]int{
+		"Chat.*":        4,
+		"Chat.Private*": 6,
+		"Upload.Avatar": 0,
+	}, SizeLimitKick)
+
+	cases := []struct {
+		route string
+		size  int
+		ok    bool
+	}{
+		{"Room.Join", 8, true},
+		{"Room.Join", 9, false},
+		{"Chat.Send", 4, true},
+		{"Chat.Send", 5, false},
+		{"Chat.PrivateSend", 6, true},
+		{"Upload.Avatar", 1 << 20, true},
+	}
+	for _, c := range cases {
+		_, err := stage.Handler(nil, &PipelineMeta{Route: c.route}, make([]byte, c.size))
+		if c.ok != (err == nil) {
+			t.Fatalf("route %s, size %d, unexpected result: %v", c.route, c.size, err)
+		}
+		if e, ok := err.(*PipelineError); err != nil && (!ok || !e.Kick) {
+			t.Fatalf("session should be kicked, got %v", err)
+		}
+		if err != nil && !errors.Is(err, ErrPayloadTooLarge) {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+}
+
+type testClaims map[string][]string
+
+func (c testClaims) Strings(name string) []string {
+	return c[name]
+}
+
+func TestGuardStage(t *testing.T) {
+	stage := GuardStage(map[string]RouteGuard{
+		"GM.*":         {Roles: []string{"gm", "admin"}},
+		"GM.Shutdown":  {Roles: []string{"admin"}},
+		"Shop.Premium": {Claims: map[string]string{"tier": "gold"}},
+	})
+
+	player, gm, admin := session.New(nil), session.New(nil), session.New(nil)
+	gm.Set(RolesKey, []string{"gm"})
+	admin.Set(ClaimsKey, testClaims{"roles": {"admin"}, "tier": {"silver", "gold"}})
+
+	cases := []struct {
+		s     *session.Session
+		route string
+		ok    bool
+	}{
+		{player, "Room.Join", true},
+		{player, "GM.Broadcast", false},
+		{gm, "GM.Broadcast", true},
+		{gm, "GM.Shutdown", false},
+		{admin, "GM.Shutdown", true},
+		{gm, "Shop.Premium", false},
+		{admin, "Shop.Premium", true},
+	}
+	for _, c := range cases {
+		_, err := stage.Handler(c.s, &PipelineMeta{Route: c.route}, nil)
+		if c.ok != (err == nil) {
+			t.Fatalf("route %s, roles %v, unexpected result: %v", c.route, c.s.Value(RolesKey), err)
+		}
+		if err != nil && !errors.Is(err, ErrPipelineRejected) {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+}
+
+type testAuditSink struct {
+	records []*AuditRecord
+}
+
+func (s *testAuditSink) Audit(r *AuditRecord) {
+	s.records = append(s.records, r)
+}
+
+func TestAuditStages(t *testing.T) {
+	sink := &testAuditSink{}
+	in, out := AuditStages(sink, 1)
+	s := session.New(nil)
+
+	in.Handler(s, &PipelineMeta{Route: "Room.Chat", Type: message.Notify.String()}, []byte("hi"))
+	if len(sink.records) != 1 || sink.records[0].Route != "Room.Chat" || sink.records[0].Size != 2 {
+		t.Fatalf("notify should be audited immediately, got %+v", sink.records)
+	}
+
+	in.Handler(s, &PipelineMeta{Route: "Room.Join", Type: message.Request.String(), ID: 7}, []byte("join"))
+	if len(sink.records) != 1 {
+		t.Fatal("request should be audited when responded")
+	}
+
+	out.Handler(s, &PipelineMeta{Type: message.Push.String()}, nil)
+	out.Handler(s, &PipelineMeta{Type: message.Response.String(), ID: 7}, nil)
+	if len(sink.records) != 2 {
+		t.Fatalf("request should be audited after response, got %d records", len(sink.records))
+	}
+	if r := sink.records[1]; r.Route != "Room.Join" || r.Size != 4 || r.Latency <= 0 {
+		t.Fatalf("unexpected audit record: %+v", r)
+	}
+
+	sink.records = nil
+	in, _ = AuditStages(sink, 0)
+	in.Handler(s, &PipelineMeta{Route: "Room.Chat", Type: message.Notify.String()}, nil)
+	if len(sink.records) != 0 {
+		t.Fatal("message should not be sampled")
+	}
+}
+
+func TestPipelineChannel_Mutation(t *testing.T) {
+	stage := func(name string, b byte) PipelineStage {
+		return PipelineStage{Name: name, Handler: func(s *session.Session, meta *PipelineMeta, in []byte) ([]byte, error) {
+			return append(in, b), nil
+		}}
+	}
+
+	p := &pipelineChannel{}
+	p.Add(stage("decode", 'd'))
+	p.Add(stage("capture", 'c'))
+	p.Add(stage("audit", 'a'))
+
+	if err := p.Replace("capture", stage("capture-v2", 'C')); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Remove("audit"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Remove("audit"); err != ErrStageNotFound {
+		t.Fatalf("expect %v, got %v", ErrStageNotFound, err)
+	}
+	if err := p.Replace("decode", stage("capture-v2", 'x')); err != ErrStageDuplication {
+		t.Fatalf("expect %v, got %v", ErrStageDuplication, err)
+	}
+
+	out, err := p.process(nil, &PipelineMeta{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "dC" {
+		t.Fatalf("expect dC, got %s", out)
+	}
+}
@@ -0,0 +1,117 @@
+package nano
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// probeInterval is the interval of dispatch loop beats
+	probeInterval = time.Second
+
+	// probeTimeout is the duration without beats after which the dispatch
+	// loop is considered dead
+	probeTimeout = 5 * probeInterval
+)
+
+// ReadinessCheck reports whether a dependency of application is ready, eg:
+// the database is connected, a non-nil error marks the application not ready
+type ReadinessCheck func() error
+
+// beat records the dispatch loop is alive at now
+func (h *handlerService) beat(now time.Time) {
+	atomic.StoreInt64(&h.lastBeat, now.UnixNano())
+}
+
+// Ready reports whether the application is listening and all components are
+// started, and all readiness checks passed
+func Ready() error {
+	return defaultApp.Ready()
+}
+
+// Ready reports whether the application is ready to serve
+func (app *App) Ready() error {
+	if atomic.LoadInt32(&app.ready) == 0 {
+		return fmt.Errorf("application %s is not listening", app.name)
+	}
+
+	app.env.muCallbacks.RLock()
+	checks := app.env.readinessChecks
+	app.env.muCallbacks.RUnlock()
+	for _, check := range checks {
+		if err := check(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Alive reports whether the dispatch loop of application is alive
+func Alive() error {
+	return defaultApp.Alive()
+}
+
+// Alive reports whether the dispatch loop of the application is alive
+func (app *App) Alive() error {
+	last := atomic.LoadInt64(&app.handler.lastBeat)
+	if last == 0 {
+		return fmt.Errorf("dispatch loop of %s is not started", app.name)
+	}
+	if d := time.Since(time.Unix(0, last)); d > probeTimeout {
+		return fmt.Errorf("dispatch loop of %s has no beat for %s", app.name, d)
+	}
+	return nil
+}
+
+// AddReadinessCheck adds a check which is called by Ready
+func AddReadinessCheck(check ReadinessCheck) {
+	defaultApp.AddReadinessCheck(check)
+}
+
+// AddReadinessCheck adds a readiness check of the application
+func (app *App) AddReadinessCheck(check ReadinessCheck) {
+	app.env.muCallbacks.Lock()
+	defer app.env.muCallbacks.Unlock()
+
+	app.env.readinessChecks = append(app.env.readinessChecks, check)
+}
+
+// ProbeHandler returns the handler serves `/readyz` and `/livez`, which
+// respond 200 if the application is ready or alive, otherwise 503 with the
+// reason, eg: mount it to an existing HTTP server for the Kubernetes probes
+func (app *App) ProbeHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/readyz", probe(app.Ready))
+	mux.HandleFunc("/livez", probe(app.Alive))
+	return mux
+}
+
+func probe(check func() error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := check(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}
+}
+
+// serveProbe starts the probe server of app
+func serveProbe(app *App, addr string) {
+	go func() {
+		app.log().Println(fmt.Sprintf("starting probe server, listen at %s", addr))
+		if err := http.ListenAndServe(addr, app.ProbeHandler()); err != nil {
+			app.log().Println(fmt.Sprintf("nano/probe: probe server error: %s", err.Error()))
+		}
+	}()
+}
+
+// WithProbeServer starts a probe server at addr, which serves `/readyz` and
+// `/livez` for the Kubernetes readiness and liveness probes
+func WithProbeServer(addr string) Option {
+	return func(opts *options) {
+		opts.probeAddr = addr
+	}
+}
@@ -0,0 +1,56 @@
+package nano
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestProbe(t *testing.T) {
+	app := NewApp()
+	h := app.ProbeHandler()
+	status := func(path string) int {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code
+	}
+
+	if status("/readyz") != http.StatusServiceUnavailable || status("/livez") != http.StatusServiceUnavailable {
+		t.Fatalf("application should not be ready or alive before listening")
+	}
+
+	var dbErr error
+	app.AddReadinessCheck(func() error { return dbErr })
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- app.ListenContext(ctx, "127.0.0.1:0", WithoutSignals()) }()
+
+	deadline := time.Now().Add(time.Second)
+	for status("/readyz") != http.StatusOK {
+		if time.Now().After(deadline) {
+			t.Fatalf("application should be ready after listening")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if status("/livez") != http.StatusOK {
+		t.Fatalf("application should be alive")
+	}
+
+	dbErr = errors.New("database disconnected")
+	if status("/readyz") != http.StatusServiceUnavailable {
+		t.Fatalf("readiness check should fail")
+	}
+
+	cancel()
+	<-done
+	if app.Ready() == nil {
+		t.Fatalf("application should not be ready after shutdown")
+	}
+	app.handler.beat(time.Now().Add(-probeTimeout - time.Second))
+	if app.Alive() == nil {
+		t.Fatalf("application should not be alive without beats")
+	}
+}
@@ -0,0 +1,152 @@
+package nano
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// Protocol versions, the version is negotiated in handshake, a client
+// declares the latest version it supports in `sys.protocol` of handshake
+// request, and the negotiated version is responded in `sys.protocol` of
+// handshake response, so that the wire format could evolve without breaking
+// the deployed clients.
+const (
+	// ProtocolLegacy is the version of clients which do not declare a
+	// version, the features depend on message flags and new packet types,
+	// eg: fragmentation and compression, are disabled.
+	ProtocolLegacy = 1
+
+	// ProtocolCapabilities is the version since which the limits and
+	// capabilities are negotiated in handshake, eg: fragmentation,
+	// compression and checksum
+	ProtocolCapabilities = 2
+
+	// ProtocolTimestamp is the version since which the heartbeat carries
+	// server timestamp
+	ProtocolTimestamp = 3
+
+	// ProtocolDictionary is the version since which the route dictionary
+	// updates are pushed
+	ProtocolDictionary = 4
+
+	// ProtocolVersion is the latest version supported by server
+	ProtocolVersion = ProtocolDictionary
+)
+
+// ProtocolKey is the session key of negotiated protocol version, eg:
+// s.Int(nano.ProtocolKey)
+const ProtocolKey = "nano.protocol"
+
+// SetMinProtocolVersion set the min protocol version supported by server, the
+// connection of a client with an older version will be kicked in handshake.
+// The default min version is ProtocolLegacy
+func SetMinProtocolVersion(version int) {
+	defaultApp.SetMinProtocolVersion(version)
+}
+
+// SetMinProtocolVersion set the min protocol version supported by the
+// application
+func (app *App) SetMinProtocolVersion(version int) {
+	app.env.minProtocol = version
+}
+
+// negotiateProtocol returns the version both client and server support
+func negotiateProtocol(client int) int {
+	switch {
+	case client <= 0:
+		return ProtocolLegacy
+	case client > ProtocolVersion:
+		return ProtocolVersion
+	default:
+		return client
+	}
+}
+
+type (
+	// HandshakeResponse represents the handshake response, which is
+	// marshaled by system serializer
+	HandshakeResponse struct {
+		Code int          `json:"code"`
+		Sys  HandshakeSys `json:"sys"`
+	}
+
+	// HandshakeSys represents the system settings in handshake response, the
+	// features of newer protocol are omitted for older clients
+	HandshakeSys struct {
+		Heartbeat      float64           `json:"heartbeat"`
+		HeartbeatMode  string            `json:"heartbeatMode"`
+		Dict           map[string]uint16 `json:"dict"`
+		Version        string            `json:"version"`
+		Payload        interface{}       `json:"payLoad"`
+		Protocol       int               `json:"protocol"`
+		MaxPacketSize  int               `json:"maxPacketSize,omitempty"`
+		MaxMessageSize int               `json:"maxMessageSize,omitempty"`
+		Compress       bool              `json:"compress,omitempty"`
+		Checksum       bool              `json:"checksum,omitempty"`
+		Capabilities   Capability        `json:"capabilities,omitempty"`
+		Challenge      string            `json:"challenge,omitempty"` // see SetHandshakeChallenge
+	}
+
+	// DictionaryUpdate represents the route dictionary update pushed to
+	// clients, which is marshaled by system serializer
+	DictionaryUpdate struct {
+		Dict map[string]uint16 `json:"dict"`
+	}
+)
+
+// handshakeResponse returns the handshake response of negotiated version and
+// capabilities
+func (app *App) handshakeResponse(version int, caps Capability) ([]byte, error) {
+	return app.marshalSystem(app.newHandshakeResponse(version, caps))
+}
+
+func (app *App) newHandshakeResponse(version int, caps Capability) *HandshakeResponse {
+	resp := &HandshakeResponse{
+		Code: 200,
+		Sys: HandshakeSys{
+			Heartbeat:     app.env.heartbeat.Seconds(),
+			HeartbeatMode: app.env.heartbeatMode.String(),
+			Dict:          app.handler.dictionary(),
+			Version:       app.env.version,
+			Payload:       app.env.payload,
+			Protocol:      version,
+		},
+	}
+
+	// the features of newer protocol
+	if version >= ProtocolCapabilities {
+		resp.Sys.MaxPacketSize = app.env.maxPacketSize
+		resp.Sys.MaxMessageSize = app.env.maxMessageSize
+		resp.Sys.Compress = app.env.compressThreshold > 0
+		resp.Sys.Checksum = app.env.checksum
+		resp.Sys.Capabilities = caps
+	}
+
+	return resp
+}
+
+// pushDictionary pushes the dictionary of new routes to the connected clients
+// which support dictionary updates, the clients merge the routes into the
+// dictionary received in handshake
+func (app *App) pushDictionary(dict map[string]uint16) {
+	if len(dict) < 1 {
+		return
+	}
+
+	data, err := app.marshalSystem(&DictionaryUpdate{Dict: dict})
+	if err != nil {
+		app.log().Println(err.Error())
+		return
+	}
+
+	agents.Range(func(_, v interface{}) bool {
+		a := v.(*agent)
+		if a.app != app || atomic.LoadInt32(&a.dictPush) == 0 {
+			return true
+		}
+		if err := a.WritePacket(PacketDictionary, data); err != nil {
+			app.log().Println(fmt.Sprintf("nano/dictionary: push dictionary error, ID=%d, Error=%s", a.session.ID(), err.Error()))
+		}
+		return true
+	})
+}
@@ -0,0 +1,153 @@
+package nano
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"github.com/kensomanpow/nano/component"
+	"github.com/kensomanpow/nano/internal/message"
+	"github.com/kensomanpow/nano/session"
+)
+
+func TestNegotiateProtocol(t *testing.T) {
+	cases := map[int]int{
+		0:                   ProtocolLegacy,
+		1:                   1,
+		ProtocolVersion:     ProtocolVersion,
+		ProtocolVersion + 1: ProtocolVersion,
+	}
+	for client, expect := range cases {
+		if v := negotiateProtocol(client); v != expect {
+			t.Fatalf("client %d, expect %d, got %d", client, expect, v)
+		}
+	}
+}
+
+func TestHandshakeResponse(t *testing.T) {
+	sys := func(version int) map[string]interface{} {
+		data, err := defaultApp.handshakeResponse(version, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp := struct {
+			Sys map[string]interface{} `json:"sys"`
+		}{}
+		if err := json.Unmarshal(data, &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Sys
+	}
+
+	if legacy := sys(ProtocolLegacy); legacy["protocol"] != float64(ProtocolLegacy) || legacy["maxPacketSize"] != nil {
+		t.Fatalf("unexpected legacy handshake: %v", legacy)
+	}
+	if latest := sys(ProtocolVersion); latest["maxPacketSize"] == nil {
+		t.Fatalf("unexpected handshake: %v", latest)
+	}
+}
+
+type DictComp struct {
+	component.Base
+}
+
+func (d *DictComp) Hello(s *session.Session, _ []byte) error {
+	return nil
+}
+
+type BrokenComp struct {
+	component.Base
+	inited bool
+}
+
+func (b *BrokenComp) Init() { b.inited = true }
+
+func TestPushDictionary(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+
+	app := NewApp()
+	a := newAgent(app, server)
+	defer a.Close()
+	a.dictPush = 1
+
+	legacy := newAgent(app, nil)
+	defer agents.Delete(legacy.session.ID())
+	legacy.dictMax = 0
+
+	atomic.StoreInt32(&app.running, 1)
+	app.Register(&DictComp{})
+
+	code, ok := app.handler.dictionary()["DictComp.Hello"]
+	if !ok {
+		t.Fatal("route should be registered")
+	}
+
+	m := <-a.chSend
+	packets, err := DefaultCodec.NewDecoder().Decode(m.packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if packets[0].Type != PacketDictionary {
+		t.Fatalf("expect dictionary packet, got %v", packets[0].Type)
+	}
+	resp := struct {
+		Dict map[string]uint16 `json:"dict"`
+	}{}
+	if err := json.Unmarshal(packets[0].Data, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Dict) != 1 || resp.Dict["DictComp.Hello"] != code {
+		t.Fatalf("unexpected dictionary %v", resp.Dict)
+	}
+	if len(legacy.chSend) > 0 {
+		t.Fatal("dictionary should not be pushed to legacy clients")
+	}
+
+	// the route unknown to legacy client is not compressed
+	push := &message.Message{Type: message.Push, Route: "DictComp.Hello"}
+	data, err := app.routes.EncodeUpTo(push, int(legacy.dictMax))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data[0]&0x01 != 0 || !bytes.Contains(data, []byte("DictComp.Hello")) {
+		t.Fatalf("route should not be compressed, got %v", data)
+	}
+
+	// the component with invalid handlers is not initialized
+	broken := &BrokenComp{}
+	app.Register(broken, component.WithName("DictComp"))
+	if broken.inited {
+		t.Fatal("component failed to register should not be initialized")
+	}
+}
+
+type testSystemSerializer struct{}
+
+func (testSystemSerializer) Marshal(v interface{}) ([]byte, error) {
+	resp, ok := v.(*HandshakeResponse)
+	if !ok {
+		return nil, errors.New("unexpected payload")
+	}
+	return []byte{byte(resp.Sys.Protocol)}, nil
+}
+
+func (testSystemSerializer) Unmarshal(data []byte, v interface{}) error {
+	return errors.New("not implemented")
+}
+
+func TestSetSystemSerializer(t *testing.T) {
+	defer SetSystemSerializer(nil)
+	SetSystemSerializer(testSystemSerializer{})
+
+	data, err := defaultApp.handshakeResponse(ProtocolVersion, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 1 || data[0] != ProtocolVersion {
+		t.Fatalf("unexpected handshake response %v", data)
+	}
+}
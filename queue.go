@@ -0,0 +1,153 @@
+package nano
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Names of dispatch queues
+const (
+	QueueLocalProcess = "localProcess" // messages wait for dispatching to handlers
+	QueueCloseSession = "closeSession" // closed sessions wait for callbacks
+)
+
+// queueCheckInterval is the interval of checking saturation of dispatch queues
+const queueCheckInterval = time.Second
+
+type (
+	// QueueStats represents the depth of a dispatch queue
+	QueueStats struct {
+		Name string `json:"name"`
+		Len  int    `json:"len"`
+		Cap  int    `json:"cap"`
+		Max  int    `json:"max"` // max depth since application started
+	}
+
+	// SaturationHandler represents a callback that will be called when a
+	// dispatch queue keeps saturated
+	SaturationHandler func(q QueueStats, since time.Time)
+
+	// saturationAlarm is the saturation alarm of the dispatch queues of an
+	// application
+	saturationAlarm struct {
+		sync.Mutex
+		threshold float64
+		duration  time.Duration
+		fn        SaturationHandler
+		since     map[string]time.Time // saturated since
+		alarmed   map[string]bool      // alarmed during current saturation
+	}
+)
+
+func newSaturationAlarm() *saturationAlarm {
+	return &saturationAlarm{since: map[string]time.Time{}, alarmed: map[string]bool{}}
+}
+
+// DispatchQueues returns the depth of dispatch queues
+func DispatchQueues() []QueueStats {
+	return defaultApp.DispatchQueues()
+}
+
+// DispatchQueues returns the depth of dispatch queues of the application
+func (app *App) DispatchQueues() []QueueStats {
+	h := app.handler
+	return []QueueStats{
+		{
+			Name: QueueLocalProcess,
+			Len:  len(h.chLocalProcess),
+			Cap:  cap(h.chLocalProcess),
+			Max:  int(atomic.LoadInt64(&h.maxLocalProcess)),
+		},
+		{
+			Name: QueueCloseSession,
+			Len:  len(h.chCloseSession),
+			Cap:  cap(h.chCloseSession),
+			Max:  int(atomic.LoadInt64(&h.maxCloseSession)),
+		},
+	}
+}
+
+// SetSaturationAlarm set the callback which will be called when the depth of
+// a dispatch queue of the default App keeps exceeding threshold, the fraction
+// of its capacity, for the duration, eg: to page before the read loops start
+// blocking. The callback is called once during each saturation, nil disables
+// the alarm
+func SetSaturationAlarm(threshold float64, duration time.Duration, fn SaturationHandler) {
+	defaultApp.SetSaturationAlarm(threshold, duration, fn)
+}
+
+// SetSaturationAlarm set the saturation alarm of the dispatch queues of the
+// application, see SetSaturationAlarm
+func (app *App) SetSaturationAlarm(threshold float64, duration time.Duration, fn SaturationHandler) {
+	if fn != nil && (threshold <= 0 || threshold > 1) {
+		panic("saturation threshold must be in range (0, 1]")
+	}
+
+	alarm := app.alarm
+	alarm.Lock()
+	defer alarm.Unlock()
+
+	alarm.threshold = threshold
+	alarm.duration = duration
+	alarm.fn = fn
+	alarm.since = map[string]time.Time{}
+	alarm.alarmed = map[string]bool{}
+}
+
+// observeDepth records the max depth of a queue
+func observeDepth(max *int64, depth int) {
+	for {
+		m := atomic.LoadInt64(max)
+		if int64(depth) <= m || atomic.CompareAndSwapInt64(max, m, int64(depth)) {
+			return
+		}
+	}
+}
+
+// monitorQueues checks the saturation of dispatch queues periodically until
+// application shutdown
+func (app *App) monitorQueues() {
+	ticker := time.NewTicker(queueCheckInterval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				app.checkSaturation(now)
+			case <-app.env.die:
+				return
+			}
+		}
+	}()
+}
+
+func (app *App) checkSaturation(now time.Time) {
+	alarm := app.alarm
+	alarm.Lock()
+	defer alarm.Unlock()
+
+	if alarm.fn == nil {
+		return
+	}
+
+	for _, q := range app.DispatchQueues() {
+		if float64(q.Len) < alarm.threshold*float64(q.Cap) {
+			delete(alarm.since, q.Name)
+			delete(alarm.alarmed, q.Name)
+			continue
+		}
+
+		since, ok := alarm.since[q.Name]
+		if !ok {
+			alarm.since[q.Name] = now
+			since = now
+		}
+		if now.Sub(since) >= alarm.duration && !alarm.alarmed[q.Name] {
+			alarm.alarmed[q.Name] = true
+			app.log().Println(fmt.Sprintf("nano/queue: dispatch queue saturated, Name=%s, Len=%d, Cap=%d", q.Name, q.Len, q.Cap))
+			alarm.fn(q, since)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package nano
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSaturationAlarm(t *testing.T) {
+	app := NewApp()
+	var alarmed []QueueStats
+	app.SetSaturationAlarm(0.5, 2*time.Second, func(q QueueStats, since time.Time) {
+		alarmed = append(alarmed, q)
+	})
+
+	h := app.handler
+	for i := 0; i < packetBacklog/2; i++ {
+		h.chLocalProcess <- unhandledMessage{}
+		observeDepth(&h.maxLocalProcess, len(h.chLocalProcess))
+	}
+
+	now := time.Now()
+	app.checkSaturation(now)
+	app.checkSaturation(now.Add(time.Second))
+	if len(alarmed) != 0 {
+		t.Fatalf("expect no alarm before duration")
+	}
+	app.checkSaturation(now.Add(2 * time.Second))
+	app.checkSaturation(now.Add(3 * time.Second))
+	if len(alarmed) != 1 || alarmed[0].Name != QueueLocalProcess || alarmed[0].Len != packetBacklog/2 {
+		t.Fatalf("unexpected alarms %+v", alarmed)
+	}
+
+	// the queues and max depths are of the application
+	if queues := app.DispatchQueues(); queues[0].Max != packetBacklog/2 {
+		t.Fatalf("unexpected max depth %+v", queues[0])
+	}
+	if queues := NewApp().DispatchQueues(); queues[0].Max != 0 {
+		t.Fatalf("max depth should not be shared, got %+v", queues[0])
+	}
+}
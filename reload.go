@@ -0,0 +1,190 @@
+package nano
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/kensomanpow/nano/component"
+)
+
+type (
+	// ConfigHandler is called with the name of component and its new
+	// configuration when the configuration changed
+	ConfigHandler func(name string, config []byte)
+
+	// ConfigWatcher watches the configuration source of components, eg: files,
+	// etcd or consul, and calls the handler when a configuration changed.
+	// The configuration is pushed to the component which implements
+	// component.Reloader and registered with the name
+	ConfigWatcher interface {
+		// Watch starts watching, it should not block
+		Watch(fn ConfigHandler) error
+		// Close stops watching
+		Close() error
+	}
+)
+
+// ReloadConfig pushes the configuration to the component named name, the
+// component must implement component.Reloader
+func ReloadConfig(name string, config []byte) error {
+	return defaultApp.ReloadConfig(name, config)
+}
+
+// ReloadConfig pushes the configuration to the component of the application
+// named name, the component must implement component.Reloader
+func (app *App) ReloadConfig(name string, config []byte) error {
+	app.muComps.RLock()
+	var comp component.Component
+	for _, c := range app.comps {
+		if component.NewService(c.comp, c.opts).Name == name {
+			comp = c.comp
+			break
+		}
+	}
+	app.muComps.RUnlock()
+
+	if comp == nil {
+		return ErrComponentNotFound
+	}
+	r, ok := comp.(component.Reloader)
+	if !ok {
+		return ErrNotReloadable
+	}
+	if err := r.Reload(config); err != nil {
+		return err
+	}
+
+	app.log().Println(fmt.Sprintf("nano/reload: component configuration reloaded, Name=%s", name))
+	return nil
+}
+
+// SetConfigWatcher set the watcher of component configuration, the watcher
+// starts after components initialized and stops when application shutdown
+func SetConfigWatcher(w ConfigWatcher) {
+	defaultApp.SetConfigWatcher(w)
+}
+
+// SetConfigWatcher set the watcher of component configuration of the
+// application
+func (app *App) SetConfigWatcher(w ConfigWatcher) {
+	app.env.configWatcher = w
+}
+
+// WithConfigWatcher set the watcher of component configuration, see
+// SetConfigWatcher
+func WithConfigWatcher(w ConfigWatcher) Option {
+	return withSetting(func(app *App) error {
+		app.SetConfigWatcher(w)
+		return nil
+	})
+}
+
+func (app *App) watchConfig() {
+	w := app.env.configWatcher
+	if w == nil {
+		return
+	}
+
+	err := w.Watch(func(name string, config []byte) {
+		if err := app.ReloadConfig(name, config); err != nil {
+			app.log().Println(fmt.Sprintf("nano/reload: reload component configuration failed, Name=%s, Error=%s", name, err.Error()))
+		}
+	})
+	if err != nil {
+		app.log().Println(fmt.Sprintf("nano/reload: watch component configuration failed, Error=%s", err.Error()))
+	}
+}
+
+func (app *App) unwatchConfig() {
+	if w := app.env.configWatcher; w != nil {
+		w.Close()
+	}
+}
+
+// fileWatcher polls the modification of configuration files
+type fileWatcher struct {
+	interval time.Duration
+	files    map[string]string // component name => file path
+
+	mu  sync.Mutex
+	die chan struct{} // closed when watching stopped, nil if not watching
+}
+
+// NewFileWatcher returns a watcher which polls the configuration files every
+// interval, files maps the component names to the paths of their
+// configuration files. The content of a file is pushed once it is changed and
+// kept unchanged for an interval, so that a partially written file is not
+// applied. The watcher could be watched again after closed
+func NewFileWatcher(interval time.Duration, files map[string]string) (ConfigWatcher, error) {
+	if interval <= 0 {
+		return nil, invalidOption("NewFileWatcher", "interval must be positive")
+	}
+	return &fileWatcher{
+		interval: interval,
+		files:    files,
+	}, nil
+}
+
+func (w *fileWatcher) Watch(fn ConfigHandler) error {
+	// the contents at startup are treated as loaded
+	last := make(map[string][]byte, len(w.files))
+	for name, path := range w.files {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		last[name] = data
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.die != nil {
+		return ErrWatcherStarted
+	}
+	die := make(chan struct{})
+	w.die = die
+
+	go func() {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		// changed contents wait for the next poll to be settled
+		pending := make(map[string][]byte, len(w.files))
+		for {
+			select {
+			case <-ticker.C:
+				for name, path := range w.files {
+					data, err := ioutil.ReadFile(path)
+					if err != nil || bytes.Equal(data, last[name]) {
+						delete(pending, name)
+						continue // keep the last configuration until file fixed
+					}
+					if p, ok := pending[name]; !ok || !bytes.Equal(data, p) {
+						pending[name] = data
+						continue
+					}
+					delete(pending, name)
+					last[name] = data
+					fn(name, data)
+				}
+
+			case <-die:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (w *fileWatcher) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.die != nil {
+		close(w.die)
+		w.die = nil
+	}
+	return nil
+}
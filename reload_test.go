@@ -0,0 +1,103 @@
+package nano
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kensomanpow/nano/component"
+)
+
+type reloadComp struct {
+	component.Base
+	mu     sync.Mutex
+	config string
+}
+
+func (c *reloadComp) Reload(config []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.config = string(config)
+	return nil
+}
+
+func (c *reloadComp) current() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.config
+}
+
+func TestReloadConfig(t *testing.T) {
+	app := NewApp()
+	comp := &reloadComp{}
+	app.Register(comp, component.WithName("Room"))
+	app.Register(&AppComp{})
+
+	if err := app.ReloadConfig("Room", []byte("drop=0.1")); err != nil {
+		t.Fatal(err)
+	}
+	if comp.current() != "drop=0.1" {
+		t.Fatalf("unexpected config %s", comp.current())
+	}
+	if err := app.ReloadConfig("AppComp", nil); err != ErrNotReloadable {
+		t.Fatalf("expect ErrNotReloadable, got %v", err)
+	}
+	if err := app.ReloadConfig("Lobby", nil); err != ErrComponentNotFound {
+		t.Fatalf("expect ErrComponentNotFound, got %v", err)
+	}
+}
+
+func TestFileWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nano-reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "room.json")
+	if err := ioutil.WriteFile(path, []byte(`{"drop":0.1}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewFileWatcher(0, nil); !errors.Is(err, ErrInvalidOption) {
+		t.Fatalf("expect invalid option error, got %v", err)
+	}
+	w, err := NewFileWatcher(10*time.Millisecond, map[string]string{"Room": path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := NewApp()
+	comp := &reloadComp{}
+	app.Register(comp, component.WithName("Room"))
+	app.SetConfigWatcher(w)
+
+	reload := func(config string) {
+		if err := ioutil.WriteFile(path, []byte(config), 0644); err != nil {
+			t.Fatal(err)
+		}
+		deadline := time.Now().Add(time.Second)
+		for comp.current() != config {
+			if time.Now().After(deadline) {
+				t.Fatalf("configuration should be reloaded, got %s", comp.current())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	app.watchConfig()
+	if err := w.Watch(func(string, []byte) {}); err != ErrWatcherStarted {
+		t.Fatalf("expect watcher started error, got %v", err)
+	}
+	reload(`{"drop":0.2}`)
+
+	// watch again after closed
+	app.unwatchConfig()
+	app.watchConfig()
+	defer app.unwatchConfig()
+	reload(`{"drop":0.3}`)
+}
@@ -0,0 +1,127 @@
+package nano
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Errors of handshake replay protection
+var (
+	ErrHandshakeSignature = errors.New("invalid handshake signature")
+	ErrHandshakeExpired   = errors.New("handshake timestamp out of window")
+	ErrHandshakeReplayed  = errors.New("handshake nonce replayed")
+)
+
+type (
+	// ReplayProtection requires the clients sign the handshake with a shared
+	// secret, the handshake carries `sys.nonce`, `sys.timestamp` in unix
+	// milliseconds and `sys.signature`, which is the hex encoded HMAC-SHA256
+	// of `nonce:timestamp:token`, see SignHandshake. The handshake out of
+	// the time window or with a nonce seen in the window is rejected, so that
+	// the captured handshake packets could not be replayed
+	ReplayProtection struct {
+		Secret []byte
+		Window time.Duration // max clock skew of timestamp, default 30 seconds
+	}
+
+	// replayGuard remembers the nonces in two generations, which are rotated
+	// every two windows, so that a nonce is remembered for the whole span
+	// its timestamp accepted
+	replayGuard struct {
+		ReplayProtection
+		mu       sync.Mutex
+		current  map[string]struct{}
+		previous map[string]struct{}
+		rotateAt time.Time
+	}
+)
+
+// defaultReplayWindow is the default time window of handshake timestamp
+const defaultReplayWindow = 30 * time.Second
+
+// SetReplayProtection set the replay protection of handshake, nil disables
+// it. It should be called before application running
+func SetReplayProtection(p *ReplayProtection) {
+	defaultApp.SetReplayProtection(p)
+}
+
+// SetReplayProtection set the replay protection of handshake of the
+// application
+func (app *App) SetReplayProtection(p *ReplayProtection) {
+	if p == nil {
+		app.env.replayGuard = nil
+		return
+	}
+	if len(p.Secret) < 1 || p.Window < 0 {
+		panic("nano: invalid replay protection")
+	}
+	g := &replayGuard{ReplayProtection: *p}
+	if g.Window == 0 {
+		g.Window = defaultReplayWindow
+	}
+	app.env.replayGuard = g
+}
+
+// WithReplayProtection set the replay protection of handshake, see
+// SetReplayProtection
+func WithReplayProtection(p *ReplayProtection) Option {
+	return withSetting(func(app *App) error {
+		if p != nil && len(p.Secret) < 1 {
+			return invalidOption("WithReplayProtection", "secret is required")
+		}
+		if p != nil && p.Window < 0 {
+			return invalidOption("WithReplayProtection", "window can not be negative")
+		}
+		app.SetReplayProtection(p)
+		return nil
+	})
+}
+
+// SignHandshake sets the nonce, timestamp and signature of handshake data
+// with secret, eg: called by a Go client
+func SignHandshake(secret []byte, data *HandShakeData, nonce string, now time.Time) {
+	data.Sys.Nonce = nonce
+	data.Sys.Timestamp = unixMilli(now)
+	data.Sys.Signature = handshakeSignature(secret, data)
+}
+
+func handshakeSignature(secret []byte, data *HandShakeData) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(fmt.Sprintf("%s:%d:%s", data.Sys.Nonce, data.Sys.Timestamp, data.Token)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verify checks the signature, timestamp and nonce of handshake data at now
+func (g *replayGuard) verify(data *HandShakeData, now time.Time) error {
+	if data == nil || data.Sys.Nonce == "" {
+		return ErrHandshakeSignature
+	}
+	expect := handshakeSignature(g.Secret, data)
+	if !hmac.Equal([]byte(expect), []byte(data.Sys.Signature)) {
+		return ErrHandshakeSignature
+	}
+	if d := now.Sub(time.Unix(0, data.Sys.Timestamp*int64(time.Millisecond))); d > g.Window || d < -g.Window {
+		return ErrHandshakeExpired
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if !now.Before(g.rotateAt) {
+		g.previous, g.current = g.current, make(map[string]struct{})
+		g.rotateAt = now.Add(2 * g.Window)
+	}
+	if _, ok := g.current[data.Sys.Nonce]; ok {
+		return ErrHandshakeReplayed
+	}
+	if _, ok := g.previous[data.Sys.Nonce]; ok {
+		return ErrHandshakeReplayed
+	}
+	g.current[data.Sys.Nonce] = struct{}{}
+	return nil
+}
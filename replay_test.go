@@ -0,0 +1,48 @@
+package nano
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReplayGuard(t *testing.T) {
+	app := NewApp()
+	secret := []byte("secret")
+	app.SetReplayProtection(&ReplayProtection{Secret: secret, Window: time.Minute})
+	g := app.env.replayGuard
+
+	now := time.Now()
+	signed := func(nonce string, at time.Time) *HandShakeData {
+		data := &HandShakeData{Token: "token"}
+		SignHandshake(secret, data, nonce, at)
+		return data
+	}
+
+	if err := g.verify(signed("n1", now), now); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.verify(signed("n1", now), now.Add(time.Second)); err != ErrHandshakeReplayed {
+		t.Fatalf("expect replayed, got %v", err)
+	}
+	if err := g.verify(signed("n2", now.Add(-2*time.Minute)), now); err != ErrHandshakeExpired {
+		t.Fatalf("expect expired, got %v", err)
+	}
+
+	tampered := signed("n3", now)
+	tampered.Token = "other"
+	if err := g.verify(tampered, now); err != ErrHandshakeSignature {
+		t.Fatalf("expect invalid signature, got %v", err)
+	}
+	if err := g.verify(nil, now); err != ErrHandshakeSignature {
+		t.Fatalf("expect invalid signature, got %v", err)
+	}
+
+	// the nonce is remembered across rotation while its timestamp accepted
+	later := now.Add(2*time.Minute + time.Second)
+	if err := g.verify(signed("n4", later), later); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.verify(signed("n4", later), later.Add(30*time.Second)); err != ErrHandshakeReplayed {
+		t.Fatalf("expect replayed, got %v", err)
+	}
+}
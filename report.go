@@ -0,0 +1,53 @@
+package nano
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/kensomanpow/nano/session"
+)
+
+// Sources of reported errors
+const (
+	ErrorSourceHandler  = "handler"  // handler returned error or panicked
+	ErrorSourceInbound  = "inbound"  // inbound pipeline failed
+	ErrorSourceOutbound = "outbound" // outbound pipeline failed
+)
+
+type (
+	// ErrorContext describes where a reported error occurred
+	ErrorContext struct {
+		Source    string // one of ErrorSourceXxx
+		Route     string
+		Session   *session.Session
+		RequestID string // empty for outbound pipeline errors
+		Panic     bool   // the error is recovered from panic
+		Stack     string // stack of the panicked goroutine, empty if not panic
+	}
+
+	// ErrorHandler represents a callback that will be called when a handler
+	// or pipeline fails, eg: to report errors to Sentry
+	ErrorHandler func(err error, ctx ErrorContext)
+)
+
+var errorHandler atomic.Value // ErrorHandler
+
+// OnError set the callback which will be called when a handler returns error
+// or panics, or a pipeline fails, nil disables it
+func OnError(fn ErrorHandler) {
+	errorHandler.Store(fn)
+}
+
+func (app *App) reportError(err error, ctx ErrorContext) {
+	fn, _ := errorHandler.Load().(ErrorHandler)
+	if fn == nil {
+		return
+	}
+
+	defer func() {
+		if e := recover(); e != nil {
+			app.log().Println(fmt.Sprintf("nano/report: %v", e))
+		}
+	}()
+	fn(err, ctx)
+}
@@ -0,0 +1,43 @@
+package nano
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestOnError(t *testing.T) {
+	defer OnError(nil)
+
+	var reported []ErrorContext
+	OnError(func(err error, ctx ErrorContext) {
+		reported = append(reported, ctx)
+	})
+
+	a := newAgent(defaultApp, nil)
+	defer agents.Delete(a.session.ID())
+
+	panicked := unhandledMessage{agent: a, route: "report.panic", handler: reflect.Method{
+		Func: reflect.ValueOf(func() { panic("boom") }),
+	}}
+	if err := pcall(panicked); err == nil {
+		t.Fatalf("expect error recovered from panic")
+	}
+
+	failed := unhandledMessage{agent: a, route: "report.fail", handler: reflect.Method{
+		Func: reflect.ValueOf(func() error { return errors.New("fail") }),
+	}}
+	if err := pcall(failed); err == nil {
+		t.Fatalf("expect error returned by handler")
+	}
+
+	if len(reported) != 2 {
+		t.Fatalf("expect 2 errors reported, got %+v", reported)
+	}
+	if c := reported[0]; c.Route != "report.panic" || !c.Panic || c.Stack == "" || c.Session != a.session {
+		t.Fatalf("unexpected panic context %+v", c)
+	}
+	if c := reported[1]; c.Route != "report.fail" || c.Panic || c.Source != ErrorSourceHandler {
+		t.Fatalf("unexpected error context %+v", c)
+	}
+}
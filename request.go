@@ -0,0 +1,72 @@
+package nano
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/kensomanpow/nano/internal/message"
+	"github.com/kensomanpow/nano/session"
+)
+
+// ErrInvalidRequestID represents the request id in message body is malformed
+var ErrInvalidRequestID = errors.New("invalid request id")
+
+type requestIDKey struct{}
+
+var (
+	// sequence of generated request ids
+	requestSeq uint64
+
+	// distinguishes the request ids generated before and after restarts
+	requestEpoch = strconv.FormatInt(time.Now().UnixNano(), 36)
+)
+
+// RequestID returns the request id of the request context, empty if ctx is
+// not a request context. Each inbound message has a unique request id, which
+// is propagated by client or generated by nano
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// RequestLogger returns a leveled logger which attaches the session fields
+// and the request id of the message last dispatched to the session, so that
+// the logs of handler could be correlated with nano and other services
+func RequestLogger(s *session.Session) LeveledLogger {
+	return logRequest(s, RequestID(s.RequestContext()))
+}
+
+// identify returns the request id of msg, the request id prefixed to the
+// body is stripped from msg, and a request id is generated if client does
+// not propagate one
+func (app *App) identify(meta *PipelineMeta, msg *message.Message) (string, error) {
+	if msg.Flags&message.Identified == 0 {
+		return nextRequestID(app.env.nodeID), nil
+	}
+
+	id, data, err := splitTrace(msg.Data)
+	if err != nil || id == "" {
+		return "", ErrInvalidRequestID
+	}
+	msg.Data = data
+	msg.Flags &^= message.Identified
+	meta.Flags = msg.Flags
+	return id, nil
+}
+
+// nextRequestID generates a request id, which is unique in cluster if the
+// node ids are unique
+func nextRequestID(nodeID string) string {
+	seq := atomic.AddUint64(&requestSeq, 1)
+	return nodeID + "-" + requestEpoch + "-" + strconv.FormatUint(seq, 36)
+}
+
+func withRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
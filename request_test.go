@@ -0,0 +1,63 @@
+package nano
+
+import (
+	"bytes"
+	"log"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kensomanpow/nano/internal/message"
+	"github.com/kensomanpow/nano/session"
+)
+
+func TestIdentify(t *testing.T) {
+	msg := &message.Message{Flags: message.Identified | message.Encrypted, Data: append([]byte{3}, "abcbody"...)}
+	meta := &PipelineMeta{Flags: msg.Flags}
+	id, err := defaultApp.identify(meta, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "abc" || string(msg.Data) != "body" || meta.Flags != message.Encrypted {
+		t.Fatalf("unexpected request id %s, body %s, flags %v", id, msg.Data, meta.Flags)
+	}
+
+	a, _ := defaultApp.identify(&PipelineMeta{}, &message.Message{})
+	b, _ := defaultApp.identify(&PipelineMeta{}, &message.Message{})
+	if a == "" || a == b {
+		t.Fatalf("expect unique request ids, got %s and %s", a, b)
+	}
+
+	if _, err := defaultApp.identify(&PipelineMeta{}, &message.Message{Flags: message.Identified, Data: []byte{0}}); err != ErrInvalidRequestID {
+		t.Fatalf("expect ErrInvalidRequestID, got %v", err)
+	}
+}
+
+func TestRequestEpoch(t *testing.T) {
+	// the epoch is the process start time, so that the request ids do not
+	// collide across restarts
+	ns, err := strconv.ParseInt(requestEpoch, 36, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if epoch := time.Unix(0, ns); epoch.Before(time.Now().Add(-time.Hour)) || epoch.After(time.Now()) {
+		t.Fatalf("unexpected request epoch %v", epoch)
+	}
+	if id := nextRequestID("node"); !strings.HasPrefix(id, "node-"+requestEpoch+"-") {
+		t.Fatalf("unexpected request id %s", id)
+	}
+}
+
+func TestRequestLogger(t *testing.T) {
+	defer func(l Logger) { logger = l }(logger)
+
+	buf := &bytes.Buffer{}
+	SetLogger(log.New(buf, "", 0))
+	s := session.New(nil)
+	s.SetRequestContext(withRequestID(s.Context(), "req-1"))
+	RequestLogger(s).Info("handled")
+	if line := buf.String(); !strings.Contains(line, "requestID=req-1") {
+		t.Fatalf("unexpected log: %s", line)
+	}
+}
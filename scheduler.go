@@ -0,0 +1,72 @@
+package nano
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Scheduler executes the timers, cron jobs and dispatches the messages of an
+// application in deterministic mode, nothing runs in background, the timers
+// fire only when the virtual clock advanced, and the handlers are called in
+// the goroutine which steps the Scheduler, so that the tests of timing
+// dependent handlers do not rely on sleeps.
+type Scheduler struct {
+	app   *App
+	clock *ManualClock
+}
+
+// Deterministic switches the application to deterministic mode with a
+// virtual clock starts at start, and returns the Scheduler which steps the
+// application. It should be called before any timer created, and can not be
+// called after application running
+func (app *App) Deterministic(start time.Time) *Scheduler {
+	if atomic.LoadInt32(&app.running) == 1 {
+		panic("nano/scheduler: deterministic mode can not be enabled after application running")
+	}
+	if app.scheduler != nil {
+		return app.scheduler
+	}
+
+	c := NewManualClock(start)
+	app.SetClock(c)
+	app.scheduler = &Scheduler{app: app, clock: c}
+	return app.scheduler
+}
+
+// Now returns the current time of virtual clock
+func (s *Scheduler) Now() time.Time {
+	return s.clock.Now()
+}
+
+// Step applies the pending timer changes, dispatches the pending messages,
+// and executes the timers expired at current virtual time, until nothing is
+// pending
+func (s *Scheduler) Step() {
+	s.flush()
+	s.app.timers.cron()
+	s.flush()
+}
+
+// Advance moves the virtual clock forward by d, and steps at every tick of
+// timer precision, so the timers fire in order as the time passes
+func (s *Scheduler) Advance(d time.Duration) {
+	target := s.clock.Now().Add(d)
+	for {
+		next := s.clock.Now().Add(s.app.timers.precision)
+		if next.After(target) {
+			next = target
+		}
+		s.clock.Set(next)
+		s.Step()
+		if !next.Before(target) {
+			return
+		}
+	}
+}
+
+// flush applies timer changes and dispatches messages until nothing pending,
+// the handlers and timer functions may create timers or messages
+func (s *Scheduler) flush() {
+	for s.app.timers.drain()+s.app.handler.drain() > 0 {
+	}
+}
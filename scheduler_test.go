@@ -0,0 +1,46 @@
+package nano
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestScheduler(t *testing.T) {
+	app := NewApp()
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := app.Deterministic(start)
+
+	var fired []string
+	a := newAgent(app, nil)
+	defer agents.Delete(a.session.ID())
+	app.handler.chLocalProcess <- unhandledMessage{agent: a, route: "room.start", ctx: context.Background(), handler: reflect.Method{
+		Func: reflect.ValueOf(func() {
+			fired = append(fired, "handler")
+			app.NewAfterTimer(5*time.Second, func() { fired = append(fired, "countdown") })
+		}),
+	}}
+	app.NewCountTimer(2*time.Second, 2, func() { fired = append(fired, "tick") })
+	if _, err := app.NewCronInLocation("*/10 * * * * *", time.UTC, func() { fired = append(fired, "cron") }); err != nil {
+		t.Fatal(err)
+	}
+
+	s.Step()
+	if !reflect.DeepEqual(fired, []string{"handler"}) {
+		t.Fatalf("handler should be dispatched in step, got %v", fired)
+	}
+
+	s.Advance(4 * time.Second)
+	if !reflect.DeepEqual(fired, []string{"handler", "tick", "tick"}) {
+		t.Fatalf("unexpected timers fired %v", fired)
+	}
+
+	s.Advance(6 * time.Second)
+	if !reflect.DeepEqual(fired, []string{"handler", "tick", "tick", "countdown", "cron"}) {
+		t.Fatalf("unexpected timers fired %v", fired)
+	}
+	if now := s.Now(); !now.Equal(start.Add(10 * time.Second)) {
+		t.Fatalf("unexpected virtual time %s", now)
+	}
+}
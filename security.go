@@ -0,0 +1,101 @@
+package nano
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// Types of security events
+const (
+	SecurityAuthFailed  = "auth_failed"  // handshake rejected by auth function
+	SecurityKicked      = "kicked"       // session kicked
+	SecurityRateLimited = "rate_limited" // message dropped by rate limiter or bandwidth quota
+	SecurityFlooded     = "flooded"      // message rate exceeded flood control
+	SecurityBanned      = "banned"       // handshake rejected by ban list
+)
+
+type (
+	// SecurityEvent represents a security relevant event of a session, eg:
+	// for abuse detection
+	SecurityEvent struct {
+		Time       time.Time      `json:"time"`
+		Type       string         `json:"type"` // one of SecurityXxx
+		SessionID  int64          `json:"sessionId"`
+		UID        int64          `json:"uid"`
+		RemoteAddr string         `json:"remoteAddr,omitempty"`
+		Route      string         `json:"route,omitempty"`
+		Reason     string         `json:"reason,omitempty"`
+		Handshake  *HandShakeData `json:"handshake,omitempty"` // nil if not handshake yet, the token is redacted
+	}
+
+	// SecuritySink receives the security events, Security is called in the
+	// connection goroutines and must not block
+	SecuritySink interface {
+		Security(e *SecurityEvent)
+	}
+)
+
+// SetSecuritySink set the sink which receives the security events, nil
+// disables it
+func SetSecuritySink(sink SecuritySink) {
+	defaultApp.SetSecuritySink(sink)
+}
+
+// SetSecuritySink set the sink which receives the security events of the
+// application
+func (app *App) SetSecuritySink(sink SecuritySink) {
+	app.env.securitySink = sink
+}
+
+// NewWriterSecuritySink returns a SecuritySink which writes security events
+// to w as JSON lines
+func NewWriterSecuritySink(w io.Writer) SecuritySink {
+	return &writerSink{w: w}
+}
+
+func (ws *writerSink) Security(e *SecurityEvent) {
+	ws.write(e)
+}
+
+// auditSecurity emits a security event of agent
+func auditSecurity(a *agent, typ, route string, reason interface{}) {
+	sink := a.app.env.securitySink
+	if sink == nil {
+		return
+	}
+
+	e := &SecurityEvent{
+		Time:      time.Now(),
+		Type:      typ,
+		SessionID: a.session.ID(),
+		UID:       a.session.UID(),
+		Route:     route,
+		Reason:    reasonString(reason),
+	}
+	if hs := a.handshakeData(); hs != nil {
+		// the token is a credential, which must not be sent to audit sinks
+		data := *hs
+		data.Token = ""
+		e.Handshake = &data
+	}
+	if a.conn != nil {
+		e.RemoteAddr = a.conn.RemoteAddr().String()
+	}
+	sink.Security(e)
+}
+
+func reasonString(v interface{}) string {
+	switch r := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return r
+	case []byte:
+		return string(r)
+	case error:
+		return r.Error()
+	default:
+		return fmt.Sprint(r)
+	}
+}
@@ -0,0 +1,85 @@
+package nano
+
+import (
+	"bytes"
+	encjson "encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+
+	"github.com/kensomanpow/nano/internal/packet"
+	"github.com/kensomanpow/nano/serialize/json"
+	"github.com/kensomanpow/nano/session"
+)
+
+type testSecuritySink []*SecurityEvent
+
+func (s *testSecuritySink) Security(e *SecurityEvent) {
+	*s = append(*s, e)
+}
+
+func TestSecuritySink(t *testing.T) {
+	defer SetSecuritySink(nil)
+
+	sink := &testSecuritySink{}
+	SetSecuritySink(sink)
+
+	a := newAgent(defaultApp, nil)
+	defer agents.Delete(a.session.ID())
+	a.handshake.Store(&HandShakeData{Token: "secret", GameID: 7})
+
+	if err := a.Kick("cheating"); err != nil {
+		t.Fatal(err)
+	}
+	auditSecurity(a, SecurityRateLimited, "security.test", errors.New("rate limited"))
+
+	if len(*sink) != 2 {
+		t.Fatalf("expect 2 events, got %d", len(*sink))
+	}
+	if e := (*sink)[0]; e.Type != SecurityKicked || e.Reason != "cheating" || e.Handshake.GameID != 7 || e.Handshake.Token != "" {
+		t.Fatalf("unexpected kick event %+v", e)
+	}
+	if e := (*sink)[1]; e.Type != SecurityRateLimited || e.Route != "security.test" || e.Reason != "rate limited" {
+		t.Fatalf("unexpected rate limit event %+v", e)
+	}
+}
+
+func TestWriterSecuritySink(t *testing.T) {
+	buf := &bytes.Buffer{}
+	NewWriterSecuritySink(buf).Security(&SecurityEvent{Type: SecurityAuthFailed, Reason: "invalid token"})
+
+	e := &SecurityEvent{}
+	if err := encjson.Unmarshal(buf.Bytes(), e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Type != SecurityAuthFailed || e.Reason != "invalid token" {
+		t.Fatalf("unexpected event %+v", e)
+	}
+}
+
+func TestSecuritySink_AuthFailed(t *testing.T) {
+	sink := &testSecuritySink{}
+	app := NewApp()
+	app.SetSerializer(json.NewSerializer())
+	app.SetSecuritySink(sink)
+	app.SetAuthFunc(func(_ *session.Session, _ *HandShakeData) interface{} { return "invalid token" })
+
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	go io.Copy(ioutil.Discard, c2)
+	a := newAgent(app, c1)
+	defer a.Close()
+
+	p := &packet.Packet{Type: packet.Handshake, Data: []byte(`{"token":"secret","sys":{"protocol":1}}`)}
+	if err := app.handler.processPacket(a, p); err != errRejected {
+		t.Fatalf("expect errRejected, got %v", err)
+	}
+	if len(*sink) != 1 {
+		t.Fatalf("expect 1 event, got %d", len(*sink))
+	}
+	if e := (*sink)[0]; e.Type != SecurityAuthFailed || e.Handshake == nil || e.Handshake.Token != "" {
+		t.Fatalf("unexpected auth failed event %+v", e)
+	}
+}
@@ -21,15 +21,61 @@
 package nano
 
 import (
+	"encoding/json"
+
 	"github.com/kensomanpow/nano/serialize"
-	"github.com/kensomanpow/nano/serialize/protobuf"
 )
 
-// Default serializer
-var serializer serialize.Serializer = protobuf.NewSerializer()
-
 // SetSerializer customize application serializer, which automatically Marshal
 // and UnMarshal handler payload
 func SetSerializer(seri serialize.Serializer) {
-	serializer = seri
+	defaultApp.SetSerializer(seri)
+}
+
+// SetSerializer customize the serializer of the application
+func (app *App) SetSerializer(seri serialize.Serializer) {
+	app.serializer = seri
+}
+
+// SetSystemSerializer customize the serializer of system payloads, includes
+// HandShakeData, HandshakeResponse and DictionaryUpdate, so that the pure
+// binary clients never need JSON, eg: the application serializer, or a
+// serializer maps the payloads to a proprietary binary format. The handshake
+// request is unmarshaled by application serializer and the responses are
+// marshaled as JSON if not set
+func SetSystemSerializer(seri serialize.Serializer) {
+	defaultApp.SetSystemSerializer(seri)
+}
+
+// SetSystemSerializer customize the serializer of system payloads of the
+// application
+func (app *App) SetSystemSerializer(seri serialize.Serializer) {
+	app.sysSerializer = seri
+}
+
+func (app *App) marshalSystem(v interface{}) ([]byte, error) {
+	if app.sysSerializer != nil {
+		return app.sysSerializer.Marshal(v)
+	}
+	return json.Marshal(v)
+}
+
+func (app *App) unmarshalSystem(data []byte, v interface{}) error {
+	if app.sysSerializer != nil {
+		return app.sysSerializer.Unmarshal(data, v)
+	}
+	return app.serializer.Unmarshal(data, v)
+}
+
+// serializeOrRaw marshals v by application serializer unless v is []byte,
+// the error is an ErrSerialize
+func (app *App) serializeOrRaw(v interface{}) ([]byte, error) {
+	if data, ok := v.([]byte); ok {
+		return data, nil
+	}
+	data, err := app.serializer.Marshal(v)
+	if err != nil {
+		return nil, wrapError(ErrSerialize, "", err)
+	}
+	return data, nil
 }
@@ -21,15 +21,22 @@
 package service
 
 import (
+	"crypto/rand"
+	"encoding/binary"
 	"sync/atomic"
 )
 
 // Connections is a global variable which is used by session.
 var Connections = newConnectionService()
 
+// SessionIDGenerator generates the session ids, the ids must be unique and
+// positive
+type SessionIDGenerator func() int64
+
 type connectionService struct {
-	count int64
-	sid   int64
+	count     int64
+	sid       int64
+	generator atomic.Value // SessionIDGenerator
 }
 
 func newConnectionService() *connectionService {
@@ -57,7 +64,32 @@ func (c *connectionService) Reset() {
 	atomic.StoreInt64(&c.sid, 0)
 }
 
+// SetSessionIDGenerator set the generator of session ids, nil restores the
+// sequential ids. It should be called before any session created
+func (c *connectionService) SetSessionIDGenerator(gen SessionIDGenerator) {
+	c.generator.Store(gen)
+}
+
 // SessionID returns the session id
 func (c *connectionService) SessionID() int64 {
+	if gen, _ := c.generator.Load().(SessionIDGenerator); gen != nil {
+		return gen()
+	}
 	return atomic.AddInt64(&c.sid, 1)
 }
+
+// RandomSessionID returns a cryptographically random positive session id,
+// which is a SessionIDGenerator. The random ids do not leak the number of
+// connections and could not be guessed from the others, the probability of
+// collision is negligible in the 63 bits space
+func RandomSessionID() int64 {
+	var b [8]byte
+	for {
+		if _, err := rand.Read(b[:]); err != nil {
+			panic(err)
+		}
+		if id := int64(binary.BigEndian.Uint64(b[:]) >> 1); id > 0 {
+			return id
+		}
+	}
+}
@@ -29,3 +29,22 @@ func TestNewConnectionService(t *testing.T) {
 		t.Error("wrong session id")
 	}
 }
+
+func TestRandomSessionID(t *testing.T) {
+	service := newConnectionService()
+	service.SetSessionIDGenerator(RandomSessionID)
+
+	ids := map[int64]bool{}
+	for i := 0; i < 1000; i++ {
+		id := service.SessionID()
+		if id <= 0 || ids[id] {
+			t.Fatalf("unexpected session id %d", id)
+		}
+		ids[id] = true
+	}
+
+	service.SetSessionIDGenerator(nil)
+	if service.SessionID() != 1 {
+		t.Error("nil generator should restore sequential ids")
+	}
+}
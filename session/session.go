@@ -21,6 +21,9 @@
 package session
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"net"
 	"sync"
@@ -46,6 +49,52 @@ var (
 	ErrIllegalUID = errors.New("illegal uid")
 )
 
+var (
+	muHooks   sync.RWMutex     // protect bindHooks
+	bindHooks []func(*Session) // callbacks that emitted after uid bound
+)
+
+// loopForever represents the timer executes until stopped
+const loopForever = -1
+
+type (
+	// Timer represents a timer created by session
+	Timer interface {
+		Stop()
+	}
+
+	// TimerFactory creates a timer which will be stopped when ctx done, the
+	// timer executes fn count times, or forever when count is -1
+	TimerFactory func(ctx context.Context, interval time.Duration, count int, fn func()) Timer
+
+	// TimerEntity represents a network entity which creates the timers of
+	// its session, the timer factory is used if the entity is not a
+	// TimerEntity
+	TimerEntity interface {
+		CreateTimer(ctx context.Context, interval time.Duration, count int, fn func()) Timer
+	}
+)
+
+var timerFactory TimerFactory
+
+// SetTimerFactory set the factory of session timers, nano set it on init
+func SetTimerFactory(factory TimerFactory) {
+	timerFactory = factory
+}
+
+// OnBind registers a callback which will be called after a session bind UID
+func OnBind(fn func(s *Session)) {
+	muHooks.Lock()
+	defer muHooks.Unlock()
+
+	bindHooks = append(bindHooks, fn)
+}
+
+// requestContext wraps the context, atomic.Value requires consistent type
+type requestContext struct {
+	ctx context.Context
+}
+
 // Session represents a client session which could storage temp data during low-level
 // keep connected, all data will be released when the low-level connection was broken.
 // Session instance related to the client will be passed to Handler method as the first
@@ -53,27 +102,46 @@ var (
 type Session struct {
 	sync.RWMutex                                 // protect data
 	id                    int64                  // session global unique id
+	token                 string                 // public token of session
 	uid                   int64                  // binding user id
 	lastTime              int64                  // last heartbeat time
 	entity                NetworkEntity          // low-level network entity
 	data                  map[string]interface{} // session data store
 	Auth                  bool
 	LastHandlerAccessTime time.Time
+	ctx                   context.Context    // done when session closed
+	cancel                context.CancelFunc // cancel ctx
+	rtt                   int64              // round trip time in nanoseconds
+	reqCtx                atomic.Value       // context of last dispatched request
+	clockOffset           int64              // client clock offset in nanoseconds
 }
 
 // New returns a new session instance
 // a NetworkEntity is a low-level network instance
 func New(entity NetworkEntity) *Session {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Session{
-		id:       service.Connections.SessionID(),
-		entity:   entity,
-		data:     make(map[string]interface{}),
-		lastTime: time.Now().Unix(),
-		Auth:     false,
+		id:                    service.Connections.SessionID(),
+		token:                 newToken(),
+		entity:                entity,
+		data:                  make(map[string]interface{}),
+		lastTime:              time.Now().Unix(),
+		Auth:                  false,
 		LastHandlerAccessTime: time.Now(),
+		ctx:                   ctx,
+		cancel:                cancel,
 	}
 }
 
+// newToken returns a random token of 128 bits
+func newToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
 // Push message to client
 func (s *Session) Push(route string, v interface{}) error {
 	return s.entity.Push(route, v)
@@ -94,6 +162,13 @@ func (s *Session) ResponseMID(mid uint, v interface{}) error {
 	return s.entity.ResponseMID(mid, v)
 }
 
+// Token returns the public token of session, which is random and distinct
+// from the session id, so that it could be exposed to the clients and
+// admin APIs without leaking the internal id
+func (s *Session) Token() string {
+	return s.token
+}
+
 // ID returns the session id
 func (s *Session) ID() int64 {
 	return s.id
@@ -116,6 +191,13 @@ func (s *Session) Bind(uid int64) error {
 	}
 
 	atomic.StoreInt64(&s.uid, uid)
+
+	muHooks.RLock()
+	defer muHooks.RUnlock()
+
+	for _, fn := range bindHooks {
+		fn(s)
+	}
 	return nil
 }
 
@@ -125,6 +207,80 @@ func (s *Session) Close() {
 	s.entity.Close()
 }
 
+// RTT returns the round trip time measured by heartbeat, zero if the client
+// does not echo the heartbeat timestamp
+func (s *Session) RTT() time.Duration {
+	return time.Duration(atomic.LoadInt64(&s.rtt))
+}
+
+// ClockOffset returns the offset of client clock against server clock, eg:
+// server time of a client timestamp is ts.Add(-s.ClockOffset())
+func (s *Session) ClockOffset() time.Duration {
+	return time.Duration(atomic.LoadInt64(&s.clockOffset))
+}
+
+// SetRTT set the round trip time and clock offset, it's called by nano when
+// the heartbeat echo received
+func (s *Session) SetRTT(rtt, offset time.Duration) {
+	atomic.StoreInt64(&s.rtt, int64(rtt))
+	atomic.StoreInt64(&s.clockOffset, int64(offset))
+}
+
+// RequestContext returns the context of the last dispatched request, eg: the
+// trace of request, it returns the session context if no request
+// dispatched. Like MID, it is unreliable for concurrent requests
+func (s *Session) RequestContext() context.Context {
+	if v := s.reqCtx.Load(); v != nil {
+		return v.(requestContext).ctx
+	}
+	return s.ctx
+}
+
+// SetRequestContext set the context of the last dispatched request, it's
+// called by nano before dispatching a request to handler
+func (s *Session) SetRequestContext(ctx context.Context) {
+	if ctx == nil {
+		ctx = s.ctx
+	}
+	s.reqCtx.Store(requestContext{ctx})
+}
+
+// Context returns the context of session, which is done when the session
+// closed
+func (s *Session) Context() context.Context {
+	return s.ctx
+}
+
+// Cancel cancels the session context, all timers created by the session will
+// be stopped, it's called by nano when the low-level connection closed
+func (s *Session) Cancel() {
+	s.cancel()
+}
+
+// NewTimer returns a new timer which calls fn periodically until stopped or
+// the session closed
+func (s *Session) NewTimer(interval time.Duration, fn func()) Timer {
+	return s.NewCountTimer(interval, loopForever, fn)
+}
+
+// NewCountTimer returns a new timer which calls fn count times, the timer is
+// stopped automatically when the session closed
+func (s *Session) NewCountTimer(interval time.Duration, count int, fn func()) Timer {
+	if e, ok := s.entity.(TimerEntity); ok {
+		return e.CreateTimer(s.ctx, interval, count, fn)
+	}
+	if timerFactory == nil {
+		panic("session: timer factory not set")
+	}
+	return timerFactory(s.ctx, interval, count, fn)
+}
+
+// NewAfterTimer returns a new timer which calls fn once after duration, the
+// timer is stopped automatically when the session closed
+func (s *Session) NewAfterTimer(duration time.Duration, fn func()) Timer {
+	return s.NewCountTimer(duration, 1, fn)
+}
+
 // RemoteAddr returns the remote network address.
 func (s *Session) RemoteAddr() net.Addr {
 	return s.entity.RemoteAddr()
@@ -384,12 +540,17 @@ func (s *Session) Value(key string) interface{} {
 	return s.data[key]
 }
 
-// State returns all session state
+// State returns a copy of all session state, so that it could be used
+// while the session is being modified
 func (s *Session) State() map[string]interface{} {
 	s.RLock()
 	defer s.RUnlock()
 
-	return s.data
+	state := make(map[string]interface{}, len(s.data))
+	for k, v := range s.data {
+		state[k] = v
+	}
+	return state
 }
 
 // Restore session state after reconnect
@@ -1,6 +1,10 @@
 package session
 
-import "testing"
+import (
+	"context"
+	"testing"
+	"time"
+)
 
 func TestNewSession(t *testing.T) {
 	s := New(nil)
@@ -9,6 +13,13 @@ func TestNewSession(t *testing.T) {
 	}
 }
 
+func TestSession_Token(t *testing.T) {
+	s1, s2 := New(nil), New(nil)
+	if len(s1.Token()) != 32 || s1.Token() == s2.Token() {
+		t.Fatalf("unexpected tokens %s, %s", s1.Token(), s2.Token())
+	}
+}
+
 func TestSession_Bind(t *testing.T) {
 	s := New(nil)
 	uids := []int64{100, 1000, 10000000}
@@ -173,3 +184,29 @@ func TestSession_Restore(t *testing.T) {
 		t.Fail()
 	}
 }
+
+type testTimer struct {
+	ctx   context.Context
+	count int
+}
+
+func (t *testTimer) Stop() {}
+
+func TestSession_NewTimer(t *testing.T) {
+	SetTimerFactory(func(ctx context.Context, interval time.Duration, count int, fn func()) Timer {
+		return &testTimer{ctx: ctx, count: count}
+	})
+	defer SetTimerFactory(nil)
+
+	s := New(nil)
+	forever := s.NewTimer(time.Second, func() {}).(*testTimer)
+	once := s.NewAfterTimer(time.Second, func() {}).(*testTimer)
+	if forever.count != loopForever || once.count != 1 {
+		t.Fatalf("unexpected timer count, forever: %d, once: %d", forever.count, once.count)
+	}
+
+	s.Cancel()
+	if forever.ctx.Err() == nil || once.ctx.Err() == nil {
+		t.Fatal("timers context should be done after session cancelled")
+	}
+}
@@ -0,0 +1,286 @@
+// Copyright (c) nano Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package sessiontest provides the in-memory sessions for handler unit
+// tests, the messages pushed or responded to the sessions are captured for
+// assertions, and the session timers are fired manually, so the handlers
+// could be tested without a real connection.
+package sessiontest
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/kensomanpow/nano"
+	"github.com/kensomanpow/nano/session"
+)
+
+// Types of captured messages
+const (
+	Push     = "push"
+	Response = "response"
+	Kick     = "kick"
+)
+
+type (
+	// Message represents a message sent to the session
+	Message struct {
+		Type  string      // one of Push, Response and Kick
+		Route string      // empty if not a push
+		MID   uint        // request message id of response
+		Data  interface{} // the value passed to Push, Response or Kick
+	}
+
+	// Entity is an in-memory session.NetworkEntity which captures the
+	// messages sent to the session
+	Entity struct {
+		mu       sync.Mutex
+		mid      uint      // message id of current request
+		messages []Message // captured messages
+		timers   []*Timer  // timers created by session
+		closed   bool      // session closed
+		addr     net.Addr  // remote address
+		session  *session.Session
+	}
+
+	// Timer represents a timer created by the session, which is fired by
+	// tests explicitly
+	Timer struct {
+		ctx      context.Context
+		Interval time.Duration
+		count    int // remaining executions, -1 is forever
+		fn       func()
+		stopped  bool
+	}
+)
+
+// NewSession returns a session backed by a new Entity, the session context
+// is cancelled when the entity closed
+func NewSession() (*session.Session, *Entity) {
+	e := NewEntity()
+	e.session = session.New(e)
+	return e.session, e
+}
+
+// NewEntity returns a new Entity
+func NewEntity() *Entity {
+	return &Entity{addr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}}
+}
+
+// SetMID set the message id of current request, the Response calls respond
+// to it
+func (e *Entity) SetMID(mid uint) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.mid = mid
+}
+
+// SetRemoteAddr set the remote address of the session
+func (e *Entity) SetRemoteAddr(addr net.Addr) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.addr = addr
+}
+
+// Push implements the session.NetworkEntity interface
+func (e *Entity) Push(route string, v interface{}) error {
+	return e.capture(Message{Type: Push, Route: route, Data: v})
+}
+
+// MID implements the session.NetworkEntity interface
+func (e *Entity) MID() uint {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.mid
+}
+
+// Response implements the session.NetworkEntity interface
+func (e *Entity) Response(v interface{}) error {
+	return e.ResponseMID(e.MID(), v)
+}
+
+// ResponseMID implements the session.NetworkEntity interface
+func (e *Entity) ResponseMID(mid uint, v interface{}) error {
+	return e.capture(Message{Type: Response, MID: mid, Data: v})
+}
+
+// Kick implements the session.NetworkEntity interface
+func (e *Entity) Kick(v interface{}) error {
+	if err := e.capture(Message{Type: Kick, Data: v}); err != nil {
+		return err
+	}
+	return e.Close()
+}
+
+// Close implements the session.NetworkEntity interface
+func (e *Entity) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.closed {
+		return nano.ErrCloseClosedSession
+	}
+	e.closed = true
+	if e.session != nil {
+		e.session.Cancel()
+	}
+	return nil
+}
+
+// RemoteAddr implements the session.NetworkEntity interface
+func (e *Entity) RemoteAddr() net.Addr {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.addr
+}
+
+// CreateTimer implements the session.TimerEntity interface
+func (e *Entity) CreateTimer(ctx context.Context, interval time.Duration, count int, fn func()) session.Timer {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	t := &Timer{ctx: ctx, Interval: interval, count: count, fn: fn}
+	e.timers = append(e.timers, t)
+	return t
+}
+
+func (e *Entity) capture(m Message) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.closed {
+		return nano.ErrBrokenPipe
+	}
+	e.messages = append(e.messages, m)
+	return nil
+}
+
+// Closed reports whether the session closed or kicked
+func (e *Entity) Closed() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.closed
+}
+
+// Messages returns all captured messages in order
+func (e *Entity) Messages() []Message {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return append([]Message(nil), e.messages...)
+}
+
+// Pushes returns the captured pushes of route, all pushes if route is empty
+func (e *Entity) Pushes(route string) []Message {
+	var pushes []Message
+	for _, m := range e.Messages() {
+		if m.Type == Push && (route == "" || m.Route == route) {
+			pushes = append(pushes, m)
+		}
+	}
+	return pushes
+}
+
+// Responses returns the captured responses in order
+func (e *Entity) Responses() []Message {
+	var responses []Message
+	for _, m := range e.Messages() {
+		if m.Type == Response {
+			responses = append(responses, m)
+		}
+	}
+	return responses
+}
+
+// LastResponse returns the last captured response, false if no response
+func (e *Entity) LastResponse() (Message, bool) {
+	responses := e.Responses()
+	if len(responses) < 1 {
+		return Message{}, false
+	}
+	return responses[len(responses)-1], true
+}
+
+// Reset clears the captured messages
+func (e *Entity) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.messages = nil
+}
+
+// Timers returns the timers created by the session which are not stopped
+func (e *Entity) Timers() []*Timer {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var timers []*Timer
+	for _, t := range e.timers {
+		if !t.Stopped() {
+			timers = append(timers, t)
+		}
+	}
+	return timers
+}
+
+// Decode decodes the data of message into v via JSON, eg: the response
+// struct of handler into a map
+func (m Message) Decode(v interface{}) error {
+	data, ok := m.Data.([]byte)
+	if !ok {
+		var err error
+		if data, err = json.Marshal(m.Data); err != nil {
+			return err
+		}
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Fire calls the timer function once as the interval elapsed, it returns
+// false if the timer stopped
+func (t *Timer) Fire() bool {
+	if t.Stopped() {
+		return false
+	}
+	t.fn()
+	if t.count > 0 {
+		t.count--
+	}
+	return true
+}
+
+// Stop implements the session.Timer interface
+func (t *Timer) Stop() {
+	t.stopped = true
+}
+
+// Stopped reports whether the timer stopped, executed count times or the
+// session closed
+func (t *Timer) Stopped() bool {
+	return t.stopped || t.count == 0 || t.ctx.Err() != nil
+}
@@ -0,0 +1,69 @@
+package sessiontest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kensomanpow/nano/session"
+)
+
+type joinRequest struct {
+	Room string `json:"room"`
+}
+
+type joinResponse struct {
+	Code    int    `json:"code"`
+	Members int    `json:"members"`
+	Room    string `json:"room"`
+}
+
+// join is a handler under test
+func join(s *session.Session, req *joinRequest) error {
+	s.Set("room", req.Room)
+	s.NewCountTimer(time.Second, 3, func() {
+		s.Push("onCountdown", map[string]string{"room": req.Room})
+	})
+	return s.Response(&joinResponse{Members: 1, Room: req.Room})
+}
+
+func TestEntity(t *testing.T) {
+	s, e := NewSession()
+	e.SetMID(7)
+
+	if err := join(s, &joinRequest{Room: "lobby"}); err != nil {
+		t.Fatal(err)
+	}
+
+	res, ok := e.LastResponse()
+	if !ok || res.MID != 7 {
+		t.Fatalf("unexpected response %+v", res)
+	}
+	var body joinResponse
+	if err := res.Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Room != "lobby" || body.Members != 1 {
+		t.Fatalf("unexpected response body %+v", body)
+	}
+
+	timers := e.Timers()
+	if len(timers) != 1 || timers[0].Interval != time.Second {
+		t.Fatalf("unexpected timers %+v", timers)
+	}
+	for timers[0].Fire() {
+	}
+	if pushes := e.Pushes("onCountdown"); len(pushes) != 3 {
+		t.Fatalf("expect 3 pushes, got %d", len(pushes))
+	}
+
+	s.NewTimer(time.Second, func() {})
+	if err := s.Kick("bye"); err != nil {
+		t.Fatal(err)
+	}
+	if !e.Closed() || len(e.Timers()) != 0 {
+		t.Fatalf("session should be closed and timers stopped after kick")
+	}
+	if err := s.Push("onCountdown", nil); err == nil {
+		t.Fatalf("push to closed session should fail")
+	}
+}
@@ -0,0 +1,92 @@
+package nano
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ShutdownHook is called when application shutdown, after the listener
+// closed and before the components shutdown, eg: to persist world state or
+// deregister from service discovery. The ctx is done when the shutdown
+// timeout exceeded
+type ShutdownHook func(ctx context.Context) error
+
+// OnShutdown registers a hook which will be called when application shutdown,
+// the hooks are called one by one in registration order
+func OnShutdown(fn ShutdownHook) {
+	defaultApp.OnShutdown(fn)
+}
+
+// OnShutdown registers a shutdown hook of the application
+func (app *App) OnShutdown(fn ShutdownHook) {
+	app.env.muCallbacks.Lock()
+	defer app.env.muCallbacks.Unlock()
+
+	app.env.shutdownHooks = append(app.env.shutdownHooks, fn)
+}
+
+// SetShutdownTimeout set the max duration of all shutdown hooks, the hooks
+// not finished in time are abandoned. Default is 30 seconds
+func SetShutdownTimeout(d time.Duration) {
+	defaultApp.SetShutdownTimeout(d)
+}
+
+// SetShutdownTimeout set the max duration of shutdown hooks of the
+// application
+func (app *App) SetShutdownTimeout(d time.Duration) {
+	if d <= 0 {
+		panic("shutdown timeout must be positive")
+	}
+	app.env.shutdownTimeout = d
+}
+
+// WithShutdownTimeout set the max duration of shutdown hooks, see
+// SetShutdownTimeout
+func WithShutdownTimeout(d time.Duration) Option {
+	return withSetting(func(app *App) error {
+		if d <= 0 {
+			return invalidOption("WithShutdownTimeout", "shutdown timeout must be positive")
+		}
+		app.SetShutdownTimeout(d)
+		return nil
+	})
+}
+
+// runShutdownHooks calls the shutdown hooks in order until all hooks done or
+// the timeout exceeded
+func (app *App) runShutdownHooks() {
+	app.env.muCallbacks.RLock()
+	hooks := make([]ShutdownHook, len(app.env.shutdownHooks))
+	copy(hooks, app.env.shutdownHooks)
+	app.env.muCallbacks.RUnlock()
+
+	if len(hooks) < 1 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), app.env.shutdownTimeout)
+	defer cancel()
+
+	for i, fn := range hooks {
+		done := make(chan error, 1)
+		go func(fn ShutdownHook) {
+			defer func() {
+				if e := recover(); e != nil {
+					done <- fmt.Errorf("panic: %v", e)
+				}
+			}()
+			done <- fn(ctx)
+		}(fn)
+
+		select {
+		case err := <-done:
+			if err != nil {
+				app.log().Println(fmt.Sprintf("nano/shutdown: shutdown hook failed, Index=%d, Error=%s", i, err.Error()))
+			}
+		case <-ctx.Done():
+			app.log().Println(fmt.Sprintf("nano/shutdown: shutdown hooks timeout, %d hooks abandoned", len(hooks)-i))
+			return
+		}
+	}
+}
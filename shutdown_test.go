@@ -0,0 +1,46 @@
+package nano
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestShutdownHooks(t *testing.T) {
+	app := NewApp()
+	app.SetShutdownTimeout(100 * time.Millisecond)
+
+	called := make(chan int, 4)
+	app.OnShutdown(func(ctx context.Context) error {
+		called <- 1
+		return errors.New("deregister failed")
+	})
+	app.OnShutdown(func(ctx context.Context) error {
+		called <- 2
+		panic("persist failed")
+	})
+	app.OnShutdown(func(ctx context.Context) error {
+		called <- 3
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	app.OnShutdown(func(ctx context.Context) error {
+		called <- 4
+		return nil
+	})
+
+	start := time.Now()
+	app.runShutdownHooks()
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("shutdown hooks should timeout, took %s", d)
+	}
+	var order []int
+	for len(called) > 0 {
+		order = append(order, <-called)
+	}
+	if !reflect.DeepEqual(order, []int{1, 2, 3}) {
+		t.Fatalf("unexpected hooks called %v", order)
+	}
+}
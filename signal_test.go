@@ -0,0 +1,54 @@
+//go:build !windows
+// +build !windows
+
+package nano
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSignalHook(t *testing.T) {
+	app := NewApp()
+	hooked := make(chan os.Signal, 2)
+	done := make(chan error, 1)
+	go func() {
+		n := 0
+		done <- app.Listen("127.0.0.1:0", WithSignals(syscall.SIGUSR1), WithSignalHook(func(sig os.Signal) bool {
+			hooked <- sig
+			n++
+			return n > 1 // ignore the first signal
+		}))
+	}()
+
+	// the signals are handled once ready
+	for deadline := time.Now().Add(time.Second); app.Ready() != nil; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("application should be ready")
+		}
+	}
+
+	syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+	select {
+	case <-hooked:
+	case <-time.After(time.Second):
+		t.Fatalf("the first signal should be hooked")
+	}
+	select {
+	case <-done:
+		t.Fatalf("the first signal should be ignored")
+	default:
+	}
+
+	syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("application should shutdown on the second signal")
+	}
+	if len(hooked) != 1 {
+		t.Fatalf("expect the second signal hooked")
+	}
+}
@@ -0,0 +1,94 @@
+package nano
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kensomanpow/nano/session"
+)
+
+// SlowHandler represents the slow executions of a handler
+type SlowHandler struct {
+	Route string        `json:"route"`
+	Count int64         `json:"count"` // slow executions
+	Max   time.Duration `json:"max"`   // max execution time
+	UID   int64         `json:"uid"`   // uid of the slowest execution
+}
+
+// slowHandlers records the slow handlers of an application
+type slowHandlers struct {
+	sync.Mutex
+	threshold int64                   // duration that a handler is considered slow
+	routes    map[string]*SlowHandler // route map to *SlowHandler
+}
+
+func newSlowHandlers() *slowHandlers {
+	return &slowHandlers{
+		threshold: int64(100 * time.Millisecond),
+		routes:    map[string]*SlowHandler{},
+	}
+}
+
+// SetSlowHandlerThreshold set the duration that a handler execution of the
+// default App is considered slow, see App.SetSlowHandlerThreshold
+func SetSlowHandlerThreshold(d time.Duration) {
+	defaultApp.SetSlowHandlerThreshold(d)
+}
+
+// SetSlowHandlerThreshold set the duration that a handler execution is
+// considered slow, the slow executions will be logged and recorded, zero to
+// disable it. The default threshold is 100ms
+func (app *App) SetSlowHandlerThreshold(d time.Duration) {
+	atomic.StoreInt64(&app.slow.threshold, int64(d))
+}
+
+// SlowHandlers returns the n worst handlers of the default App, see
+// App.SlowHandlers
+func SlowHandlers(n int) []SlowHandler {
+	return defaultApp.SlowHandlers(n)
+}
+
+// SlowHandlers returns the n worst handlers, in descending order of max
+// execution time
+func (app *App) SlowHandlers(n int) []SlowHandler {
+	app.slow.Lock()
+	handlers := make([]SlowHandler, 0, len(app.slow.routes))
+	for _, h := range app.slow.routes {
+		handlers = append(handlers, *h)
+	}
+	app.slow.Unlock()
+
+	sort.Slice(handlers, func(i, j int) bool {
+		return handlers[i].Max > handlers[j].Max
+	})
+	if len(handlers) > n {
+		handlers = handlers[:n]
+	}
+	return handlers
+}
+
+// recordHandler records the execution time of handler, the slow executions
+// are logged and recorded
+func (app *App) recordHandler(route string, s *session.Session, cost time.Duration) {
+	threshold := atomic.LoadInt64(&app.slow.threshold)
+	if threshold <= 0 || int64(cost) <= threshold {
+		return
+	}
+
+	logSession(s).Warn("nano/dispatch: slow handler", "route", route, "cost", cost)
+
+	app.slow.Lock()
+	defer app.slow.Unlock()
+
+	h, ok := app.slow.routes[route]
+	if !ok {
+		h = &SlowHandler{Route: route}
+		app.slow.routes[route] = h
+	}
+	h.Count++
+	if cost > h.Max {
+		h.Max, h.UID = cost, s.UID()
+	}
+}
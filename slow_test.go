@@ -0,0 +1,33 @@
+package nano
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kensomanpow/nano/session"
+)
+
+func TestRecordHandler(t *testing.T) {
+	app := NewApp()
+	app.SetSlowHandlerThreshold(10 * time.Millisecond)
+
+	s := session.New(nil)
+	app.recordHandler("slow.fast", s, time.Millisecond)
+	app.recordHandler("slow.a", s, 20*time.Millisecond)
+	app.recordHandler("slow.a", s, 50*time.Millisecond)
+	app.recordHandler("slow.b", s, 30*time.Millisecond)
+
+	if handlers := SlowHandlers(10); len(handlers) != 0 {
+		t.Fatalf("expect slow handlers recorded by application, got %+v", handlers)
+	}
+	handlers := app.SlowHandlers(2)
+	if len(handlers) != 2 {
+		t.Fatalf("expect 2 slow handlers, got %+v", handlers)
+	}
+	if h := handlers[0]; h.Route != "slow.a" || h.Count != 2 || h.Max != 50*time.Millisecond {
+		t.Fatalf("unexpected slowest handler %+v", h)
+	}
+	if handlers[1].Route != "slow.b" {
+		t.Fatalf("unexpected slow handler %+v", handlers[1])
+	}
+}
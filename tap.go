@@ -0,0 +1,113 @@
+// Copyright (c) nano Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package nano
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kensomanpow/nano/internal/message"
+	"github.com/kensomanpow/nano/session"
+)
+
+type (
+	// TapEvent represents a message captured by the message tap
+	TapEvent struct {
+		Time       time.Time `json:"time"`
+		Route      string    `json:"route"`
+		Type       string    `json:"type"` // Request/Notify/Push
+		SessionID  int64     `json:"sessionId"`
+		UID        int64     `json:"uid"`
+		RemoteAddr string    `json:"remoteAddr,omitempty"`
+		Data       []byte    `json:"data"` // copy of payload, could be kept by tap
+	}
+
+	// MessageTap receives the messages of the tapped routes, Tap is called in
+	// the message processing path and must not block
+	MessageTap interface {
+		Tap(e *TapEvent)
+	}
+)
+
+var tap = &struct {
+	sync.RWMutex
+	tap    MessageTap
+	routes map[string]bool // exactly matched routes
+	prefix []string        // route prefixes, declared as `Room.*`
+}{}
+
+// SetMessageTap set the tap which receives inbound and pushed messages of the
+// routes in allowlist, a route ends with `*` matches all routes that have
+// the prefix, eg: `Room.*`. The tap captures nothing when allowlist is empty.
+func SetMessageTap(t MessageTap, allowlist ...string) {
+	tap.Lock()
+	defer tap.Unlock()
+
+	tap.tap = t
+	tap.routes = make(map[string]bool)
+	tap.prefix = nil
+	for _, route := range allowlist {
+		if strings.HasSuffix(route, "*") {
+			tap.prefix = append(tap.prefix, strings.TrimSuffix(route, "*"))
+		} else {
+			tap.routes[route] = true
+		}
+	}
+}
+
+func tapped(route string) MessageTap {
+	tap.RLock()
+	defer tap.RUnlock()
+
+	if tap.tap == nil {
+		return nil
+	}
+	if tap.routes[route] {
+		return tap.tap
+	}
+	for _, p := range tap.prefix {
+		if strings.HasPrefix(route, p) {
+			return tap.tap
+		}
+	}
+	return nil
+}
+
+func tapMessage(s *session.Session, typ message.Type, route string, data []byte) {
+	t := tapped(route)
+	if t == nil {
+		return
+	}
+
+	e := &TapEvent{
+		Time:      time.Now(),
+		Route:     route,
+		Type:      typ.String(),
+		SessionID: s.ID(),
+		UID:       s.UID(),
+		Data:      append([]byte(nil), data...),
+	}
+	if addr := s.RemoteAddr(); addr != nil {
+		e.RemoteAddr = addr.String()
+	}
+	t.Tap(e)
+}
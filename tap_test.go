@@ -0,0 +1,52 @@
+package nano
+
+import (
+	"net"
+	"testing"
+
+	"github.com/kensomanpow/nano/internal/message"
+)
+
+type testTap struct {
+	events []*TapEvent
+}
+
+func (t *testTap) Tap(e *TapEvent) {
+	t.events = append(t.events, e)
+}
+
+func TestTapped(t *testing.T) {
+	tt := &testTap{}
+	SetMessageTap(tt, "Room.Chat", "Battle.*")
+	defer SetMessageTap(nil)
+
+	cases := map[string]bool{
+		"Room.Chat":    true,
+		"Room.Join":    false,
+		"Battle.Move":  true,
+		"Battle.Skill": true,
+	}
+	for route, expect := range cases {
+		if got := tapped(route) != nil; got != expect {
+			t.Fatalf("route: %s, expect: %t, got: %t", route, expect, got)
+		}
+	}
+}
+
+func TestTapMessage_Copy(t *testing.T) {
+	tt := &testTap{}
+	SetMessageTap(tt, "Room.Chat")
+	defer SetMessageTap(nil)
+
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	a := newAgent(NewApp(), c1)
+	defer a.Close()
+
+	data := []byte("hello")
+	tapMessage(a.session, message.Notify, "Room.Chat", data)
+	copy(data, "world")
+	if len(tt.events) != 1 || string(tt.events[0].Data) != "hello" {
+		t.Fatalf("tapped data should not alias the payload")
+	}
+}
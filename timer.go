@@ -1,11 +1,15 @@
 package nano
 
 import (
+	"context"
 	"fmt"
-	"log"
 	"math"
+	"math/rand"
 	"sync/atomic"
 	"time"
+
+	cronexpr "github.com/kensomanpow/nano/internal/cron"
+	"github.com/kensomanpow/nano/session"
 )
 
 const (
@@ -16,27 +20,38 @@ var (
 	// default timer backlog
 	timerBacklog = 128
 
-	// timerManager manager for all timers
-	timerManager = &struct {
-		incrementID    int64            // auto increment id
-		timers         map[int64]*Timer // all timers
-		chClosingTimer chan int64       // timer for closing
-		chCreatedTimer chan *Timer
-	}{}
+	// auto increment id of timers
+	timerIncrementID int64
 
-	// timerPrecision indicates the precision of timer, default is time.Second
+	// timerPrecision indicates the default precision of timer
 	timerPrecision = time.Second
-
-	// globalTicker represents global ticker that all cron job will be executed
-	// in globalTicker.
-	globalTicker *time.Ticker
 )
 
 type (
-	// TimerFunc represents a function which will be called periodically in main
-	// logic gorontine.
+	// timerManager manages the timers of an application, all timers are
+	// executed in the scheduler goroutine
+	timerManager struct {
+		app            *App             // application which owns the timers
+		precision      time.Duration    // ticker interval
+		clock          Clock            // current time of timers
+		timers         map[int64]*Timer // all timers
+		conditions     map[int64]*Timer // condition timers, checked every tick
+		wheel          *timingWheel     // schedules interval timers
+		chClosingTimer chan int64       // timer for closing
+		chCreatedTimer chan *Timer
+		chPausingTimer chan *Timer // timer paused or resumed
+		pausing        int32       // set if pausing timers dropped by full backlog
+		slowThreshold  int64       // duration that a timer function is considered slow
+		slowCount      int64       // slow timer function executions
+	}
+
+	// TimerFunc represents a function which will be called periodically in the
+	// scheduler gorontine.
 	TimerFunc func()
 
+	// TimerOption configures a Timer when it is created
+	TimerOption func(t *Timer)
+
 	// TimerCondition represents a checker that returns true when cron job needs
 	// to execute
 	TimerCondition interface {
@@ -45,21 +60,58 @@ type (
 
 	// Timer represents a cron job
 	Timer struct {
-		id        int64          // timer id
-		fn        TimerFunc      // function that execute
-		createAt  int64          // timer create time
-		interval  time.Duration  // execution interval
-		condition TimerCondition // condition to cron job execution
-		elapse    int64          // total elapse time
-		closed    int32          // is timer closed
-		counter   int            // counter
+		id        int64           // timer id
+		fn        TimerFunc       // function that execute
+		createAt  int64           // timer create time
+		interval  time.Duration   // execution interval
+		condition TimerCondition  // condition to cron job execution
+		elapse    int64           // total elapse time
+		closed    int32           // is timer closed
+		counter   int             // counter
+		ctx       context.Context // timer will be stopped when ctx done
+		expire    uint64          // wheel tick of next execution
+		slot      slot            // wheel slot which contains the timer
+		paused    int32           // is timer paused
+		frozen    bool            // pause has been applied by scheduler
+		remaining int64           // time remaining to next execution when paused
+		manager   *timerManager   // manager which the timer added to
+	}
+
+	// cronCondition implements TimerCondition which satisfied at the activation
+	// times of a cron expression
+	cronCondition struct {
+		schedule *cronexpr.Schedule
+		loc      *time.Location
+		next     time.Time // next activation time
+		last     time.Time // last activation time
+	}
+
+	// atCondition implements TimerCondition which satisfied at a wall clock
+	// time
+	atCondition struct {
+		at time.Time
 	}
 )
 
 func init() {
-	timerManager.timers = map[int64]*Timer{}
-	timerManager.chClosingTimer = make(chan int64, timerBacklog)
-	timerManager.chCreatedTimer = make(chan *Timer, timerBacklog)
+	session.SetTimerFactory(func(ctx context.Context, interval time.Duration, count int, fn func()) session.Timer {
+		return NewCountTimerContext(ctx, interval, count, fn)
+	})
+}
+
+func newTimerManager(app *App) *timerManager {
+	return &timerManager{
+		app:            app,
+		precision:      timerPrecision,
+		clock:          realClock{},
+		timers:         map[int64]*Timer{},
+		conditions:     map[int64]*Timer{},
+		wheel:          newTimingWheel(time.Now(), timerPrecision),
+		chClosingTimer: make(chan int64, timerBacklog),
+		chCreatedTimer: make(chan *Timer, timerBacklog),
+		chPausingTimer: make(chan *Timer, timerBacklog),
+		slowThreshold:  int64(100 * time.Millisecond),
+	}
 }
 
 // ID returns id of current timer
@@ -74,62 +126,231 @@ func (t *Timer) Stop() {
 	}
 
 	// guarantee that logic is not blocked
-	if len(timerManager.chClosingTimer) < timerBacklog {
-		timerManager.chClosingTimer <- t.id
+	if len(t.manager.chClosingTimer) < timerBacklog {
+		t.manager.chClosingTimer <- t.id
 		atomic.StoreInt32(&t.closed, 1)
 	} else {
 		t.counter = 0 // automatically closed in next Cron
 	}
 }
 
+// Pause suspends a timer, fn will not be called until the timer resumed, and
+// the time remaining to next execution is preserved, eg: game paused or
+// maintenance freezes.
+func (t *Timer) Pause() {
+	if atomic.CompareAndSwapInt32(&t.paused, 0, 1) {
+		t.notifyPause()
+	}
+}
+
+// Resume resumes a paused timer, the next execution will be after the time
+// remaining when the timer paused
+func (t *Timer) Resume() {
+	if atomic.CompareAndSwapInt32(&t.paused, 1, 0) {
+		t.notifyPause()
+	}
+}
+
+// notifyPause informs the scheduler that the timer paused or resumed, it never
+// blocks so that a timer function could pause timers, all timers are
+// synchronized in next cron if the backlog is full
+func (t *Timer) notifyPause() {
+	select {
+	case t.manager.chPausingTimer <- t:
+	default:
+		atomic.StoreInt32(&t.manager.pausing, 1)
+	}
+}
+
+// Paused reports whether the timer is paused
+func (t *Timer) Paused() bool {
+	return atomic.LoadInt32(&t.paused) > 0
+}
+
 // execute job function with protection
-func pexec(id int64, fn TimerFunc) {
+func (tm *timerManager) pexec(id int64, fn TimerFunc) {
+	if tm.app.debugEnabled(LogTimer) {
+		tm.app.log().Println(fmt.Sprintf("Call timer function, TimerID=%d", id))
+	}
+
+	start := time.Now()
 	defer func() {
 		if err := recover(); err != nil {
-			log.Println(fmt.Sprintf("Call timer function error, TimerID=%d, Error=%v", id, err))
+			tm.app.log().Println(fmt.Sprintf("Call timer function error, TimerID=%d, Error=%v", id, err))
 			println(stack())
 		}
+
+		// slow timer function delays all other timers
+		cost := time.Since(start)
+		if threshold := atomic.LoadInt64(&tm.slowThreshold); threshold > 0 && int64(cost) > threshold {
+			atomic.AddInt64(&tm.slowCount, 1)
+			tm.app.log().Println(fmt.Sprintf("Slow timer function, TimerID=%d, Cost=%v", id, cost))
+		}
 	}()
 
 	fn()
 }
 
-// TODO: if closing timers'count in single cron call more than timerBacklog will case problem.
-func cron() {
-	if len(timerManager.timers) < 1 {
+// schedule executes all timers in a dedicated goroutine rather than the
+// message dispatch goroutine, so that a slow timer function can not delay
+// message dispatch
+func (tm *timerManager) schedule(die chan bool) {
+	// all cron jobs will be executed in the ticker
+	ticker := tm.clock.NewTicker(tm.precision)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C(): // execute cron task
+			tm.cron()
+
+		case t := <-tm.chCreatedTimer: // new timers
+			tm.created(t)
+
+		case id := <-tm.chClosingTimer: // closing timers
+			tm.remove(id)
+
+		case t := <-tm.chPausingTimer: // paused or resumed timers
+			tm.syncPause(t)
+
+		case <-die: // application quit signal
+			return
+		}
+	}
+}
+
+// drain applies the pending timer changes without blocking, and returns the
+// count of changes applied
+func (tm *timerManager) drain() int {
+	for n := 0; ; n++ {
+		select {
+		case t := <-tm.chCreatedTimer:
+			tm.created(t)
+		case id := <-tm.chClosingTimer:
+			tm.remove(id)
+		case t := <-tm.chPausingTimer:
+			tm.syncPause(t)
+		default:
+			return n
+		}
+	}
+}
+
+// created schedules the new timer
+func (tm *timerManager) created(t *Timer) {
+	tm.timers[t.id] = t
+	if t.condition != nil {
+		tm.conditions[t.id] = t
+	} else {
+		tm.wheel.add(t)
+	}
+	tm.syncPause(t)
+}
+
+// remove removes timer from manager
+func (tm *timerManager) remove(id int64) {
+	t, ok := tm.timers[id]
+	if !ok {
 		return
 	}
 
-	now := time.Now()
-	unn := now.UnixNano()
-	for id, t := range timerManager.timers {
-		// prevent chClosingTimer exceed
-		if t.counter == 0 {
-			if len(timerManager.chClosingTimer) < timerBacklog {
-				t.Stop()
-			}
+	atomic.StoreInt32(&t.closed, 1)
+	delete(tm.timers, id)
+	delete(tm.conditions, id)
+	tm.wheel.remove(t)
+}
+
+// syncPause applies the pause state of timer to scheduler, paused interval
+// timers are removed from wheel and added back with the remaining time when
+// resumed, paused condition timers are skipped
+func (tm *timerManager) syncPause(t *Timer) {
+	if _, ok := tm.timers[t.id]; !ok {
+		return
+	}
+
+	paused := atomic.LoadInt32(&t.paused) > 0
+	if paused == t.frozen {
+		return
+	}
+	t.frozen = paused
+
+	if t.condition != nil {
+		return
+	}
+
+	now := tm.clock.Now().UnixNano()
+	if paused {
+		t.remaining = t.createAt + t.elapse - now
+		if t.remaining < 0 {
+			t.remaining = 0
+		}
+		tm.wheel.remove(t)
+	} else {
+		t.elapse = now - t.createAt + t.remaining
+		tm.wheel.add(t)
+	}
+}
+
+// stopped reports whether the timer should be removed without execution
+func (t *Timer) stopped() bool {
+	return t.counter == 0 || (t.ctx != nil && t.ctx.Err() != nil)
+}
+
+// cron checks all condition timers and executes the expired interval timers
+func (tm *timerManager) cron() {
+	now := tm.clock.Now()
+	if atomic.CompareAndSwapInt32(&tm.pausing, 1, 0) {
+		for _, t := range tm.timers {
+			tm.syncPause(t)
+		}
+	}
+	if len(tm.timers) < 1 {
+		tm.wheel.current = tm.wheel.elapsed(now)
+		return
+	}
+
+	for id, t := range tm.conditions {
+		if t.stopped() {
+			tm.remove(id)
 			continue
 		}
 
-		// condition timer
-		if t.condition != nil {
-			if t.condition.Check(now) {
-				pexec(id, t.fn)
-			}
+		if t.frozen {
 			continue
 		}
 
-		// execute job
-		if t.createAt+t.elapse <= unn {
-			pexec(id, t.fn)
-			t.elapse += int64(t.interval)
+		if t.condition.Check(now) {
+			tm.pexec(id, t.fn)
 
-			// update timer counter
 			if t.counter != loopForever && t.counter > 0 {
 				t.counter--
 			}
+			if t.counter == 0 {
+				tm.remove(id)
+			}
 		}
 	}
+
+	tm.wheel.advance(tm.wheel.elapsed(now), func(t *Timer) {
+		if t.stopped() {
+			tm.remove(t.id)
+			return
+		}
+
+		tm.pexec(t.id, t.fn)
+		t.elapse += int64(t.interval)
+
+		// update timer counter
+		if t.counter != loopForever && t.counter > 0 {
+			t.counter--
+		}
+
+		if t.counter == 0 {
+			tm.remove(t.id)
+			return
+		}
+		tm.wheel.add(t)
+	})
 }
 
 // NewTimer returns a new Timer containing a function that will be called
@@ -137,8 +358,8 @@ func cron() {
 // for slow receivers.
 // The duration d must be greater than zero; if not, NewTimer will panic.
 // Stop the timer to release associated resources.
-func NewTimer(interval time.Duration, fn TimerFunc) *Timer {
-	return NewCountTimer(interval, loopForever, fn)
+func NewTimer(interval time.Duration, fn TimerFunc, opts ...TimerOption) *Timer {
+	return NewCountTimer(interval, loopForever, fn, opts...)
 }
 
 // NewCountTimer returns a new Timer containing a function that will be called
@@ -146,7 +367,30 @@ func NewTimer(interval time.Duration, fn TimerFunc) *Timer {
 // will be stopped automatically, It adjusts the intervals for slow receivers.
 // The duration d must be greater than zero; if not, NewCountTimer will panic.
 // Stop the timer to release associated resources.
-func NewCountTimer(interval time.Duration, count int, fn TimerFunc) *Timer {
+func NewCountTimer(interval time.Duration, count int, fn TimerFunc, opts ...TimerOption) *Timer {
+	return defaultApp.NewCountTimer(interval, count, fn, opts...)
+}
+
+// NewTimer is like the package level NewTimer but the timer is executed by
+// the application
+func (app *App) NewTimer(interval time.Duration, fn TimerFunc, opts ...TimerOption) *Timer {
+	return app.NewCountTimer(interval, loopForever, fn, opts...)
+}
+
+// NewCountTimer is like the package level NewCountTimer but the timer is
+// executed by the application
+func (app *App) NewCountTimer(interval time.Duration, count int, fn TimerFunc, opts ...TimerOption) *Timer {
+	return app.timers.add(newTimer(interval, count, fn, opts...))
+}
+
+// NewAfterTimer is like the package level NewAfterTimer but the timer is
+// executed by the application
+func (app *App) NewAfterTimer(duration time.Duration, fn TimerFunc, opts ...TimerOption) *Timer {
+	return app.NewCountTimer(duration, 1, fn, opts...)
+}
+
+// newTimer returns a new Timer which has not been added to timer manager
+func newTimer(interval time.Duration, count int, fn TimerFunc, opts ...TimerOption) *Timer {
 	if fn == nil {
 		panic("nano/timer: nil timer function")
 	}
@@ -154,7 +398,7 @@ func NewCountTimer(interval time.Duration, count int, fn TimerFunc) *Timer {
 		panic("non-positive interval for NewTimer")
 	}
 
-	id := atomic.AddInt64(&timerManager.incrementID, 1)
+	id := atomic.AddInt64(&timerIncrementID, 1)
 	t := &Timer{
 		id:       id,
 		fn:       fn,
@@ -163,9 +407,31 @@ func NewCountTimer(interval time.Duration, count int, fn TimerFunc) *Timer {
 		elapse:   int64(interval), // first execution will be after interval
 		counter:  count,
 	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// WithJitter delays the first execution of a timer by a random duration in
+// [0, d), so that a large number of timers created at the same time, eg: the
+// per-player timers created at login, do not fire on the same tick. The
+// following executions keep the same phase.
+func WithJitter(d time.Duration) TimerOption {
+	return func(t *Timer) {
+		if d <= 0 {
+			return
+		}
+		t.elapse += rand.Int63n(int64(d))
+	}
+}
 
-	// add to manager
-	timerManager.chCreatedTimer <- t
+// add adds the timer to timer manager, timer must not be modified after
+// added
+func (tm *timerManager) add(t *Timer) *Timer {
+	t.manager = tm
+	t.createAt = tm.clock.Now().UnixNano()
+	tm.chCreatedTimer <- t
 	return t
 }
 
@@ -173,8 +439,8 @@ func NewCountTimer(interval time.Duration, count int, fn TimerFunc) *Timer {
 // after duration that specified by the duration argument.
 // The duration d must be greater than zero; if not, NewAfterTimer will panic.
 // Stop the timer to release associated resources.
-func NewAfterTimer(duration time.Duration, fn TimerFunc) *Timer {
-	return NewCountTimer(duration, 1, fn)
+func NewAfterTimer(duration time.Duration, fn TimerFunc, opts ...TimerOption) *Timer {
+	return NewCountTimer(duration, 1, fn, opts...)
 }
 
 // NewCondTimer returns a new Timer containing a function that will be called
@@ -182,29 +448,238 @@ func NewAfterTimer(duration time.Duration, fn TimerFunc) *Timer {
 // The duration d must be greater than zero; if not, NewCondTimer will panic.
 // Stop the timer to release associated resources.
 func NewCondTimer(condition TimerCondition, fn TimerFunc) *Timer {
+	return defaultApp.NewCondTimer(condition, fn)
+}
+
+// NewCondTimer is like the package level NewCondTimer but the timer is
+// executed by the application
+func (app *App) NewCondTimer(condition TimerCondition, fn TimerFunc) *Timer {
 	if condition == nil {
 		panic("nano/timer: nil condition")
 	}
 
-	t := NewCountTimer(time.Duration(math.MaxInt64), loopForever, fn)
+	t := newTimer(time.Duration(math.MaxInt64), loopForever, fn)
 	t.condition = condition
 
-	return t
+	return app.timers.add(t)
+}
+
+// NewAtTimer returns a new Timer containing a function that will be called
+// once at the wall clock time specified by the at argument, eg: an event
+// starts at 20:00 server time. The time is checked against wall clock in
+// every tick, so the timer still fires on time when system clock adjusted
+// by NTP, and fires in next tick if the time has passed.
+// Stop the timer to release associated resources.
+func NewAtTimer(at time.Time, fn TimerFunc) *Timer {
+	return defaultApp.NewAtTimer(at, fn)
+}
+
+// NewAtTimer is like the package level NewAtTimer but the timer is executed
+// by the application
+func (app *App) NewAtTimer(at time.Time, fn TimerFunc) *Timer {
+	t := newTimer(time.Duration(math.MaxInt64), 1, fn)
+	t.condition = &atCondition{at: at.Round(0)}
+
+	return app.timers.add(t)
+}
+
+// Check implements the TimerCondition interface, strip monotonic clock
+// reading to compare with wall clock
+func (c *atCondition) Check(now time.Time) bool {
+	return !now.Round(0).Before(c.at)
+}
+
+// NewTimerContext is like NewTimer but the timer will be stopped automatically
+// when ctx is done, eg: the context of a room or a session.
+func NewTimerContext(ctx context.Context, interval time.Duration, fn TimerFunc, opts ...TimerOption) *Timer {
+	return NewCountTimerContext(ctx, interval, loopForever, fn, opts...)
+}
+
+// NewCountTimerContext is like NewCountTimer but the timer will be stopped
+// automatically when ctx is done.
+func NewCountTimerContext(ctx context.Context, interval time.Duration, count int, fn TimerFunc, opts ...TimerOption) *Timer {
+	return defaultApp.timers.addContext(ctx, interval, count, fn, opts...)
+}
+
+// addContext adds a timer which will be stopped automatically when ctx is done
+func (tm *timerManager) addContext(ctx context.Context, interval time.Duration, count int, fn TimerFunc, opts ...TimerOption) *Timer {
+	if ctx == nil {
+		panic("nano/timer: nil context")
+	}
+
+	t := newTimer(interval, count, fn, opts...)
+	t.ctx = ctx
+
+	return tm.add(t)
+}
+
+// NewAfterTimerContext is like NewAfterTimer but the timer will be stopped
+// automatically when ctx is done.
+func NewAfterTimerContext(ctx context.Context, duration time.Duration, fn TimerFunc, opts ...TimerOption) *Timer {
+	return NewCountTimerContext(ctx, duration, 1, fn, opts...)
+}
+
+// Check implements the TimerCondition interface
+func (c *cronCondition) Check(now time.Time) bool {
+	if c.next.IsZero() || now.Before(c.next) {
+		return false
+	}
+	c.last = c.next
+	c.next = c.schedule.Next(now.In(c.loc))
+	return true
+}
+
+// NewCron returns a new Timer containing a function that will be called at
+// the activation times specified by the cron expression in local time zone,
+// eg: "0 */5 * * * *" means every five minutes. The expression has 6 fields
+// (Seconds, Minutes, Hours, Day of month, Month, Day of week) and the seconds
+// field is optional.
+// Stop the timer to release associated resources.
+func NewCron(spec string, fn TimerFunc) (*Timer, error) {
+	return defaultApp.NewCronInLocation(spec, time.Local, fn)
+}
+
+// NewCronInLocation is like NewCron but the cron expression is interpreted in
+// the given location, eg: daily reset at midnight of the game region.
+func NewCronInLocation(spec string, loc *time.Location, fn TimerFunc) (*Timer, error) {
+	return defaultApp.NewCronInLocation(spec, loc, fn)
+}
+
+// NewCron is like the package level NewCron but the timer is executed by the
+// application
+func (app *App) NewCron(spec string, fn TimerFunc) (*Timer, error) {
+	return app.NewCronInLocation(spec, time.Local, fn)
+}
+
+// NewCronInLocation is like the package level NewCronInLocation but the timer
+// is executed by the application
+func (app *App) NewCronInLocation(spec string, loc *time.Location, fn TimerFunc) (*Timer, error) {
+	schedule, err := cronexpr.Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	next := schedule.Next(app.timers.clock.Now().In(loc))
+	if next.IsZero() {
+		return nil, fmt.Errorf("nano/timer: cron spec never activates: %s", spec)
+	}
+
+	return app.NewCondTimer(&cronCondition{schedule: schedule, loc: loc, next: next}, fn), nil
+}
+
+// NewSingletonCron is like NewCron but each activation runs on exactly one
+// node of the cluster, eg: the daily settlement. The node is elected by the
+// elector set by SetElector for every activation, the name identifies the job
+// and must be the same on all nodes. The job runs on every node if elector
+// is not set.
+func NewSingletonCron(name, spec string, fn TimerFunc) (*Timer, error) {
+	return defaultApp.NewSingletonCronInLocation(name, spec, time.Local, fn)
+}
+
+// NewSingletonCronInLocation is like NewSingletonCron but the cron expression
+// is interpreted in the given location
+func NewSingletonCronInLocation(name, spec string, loc *time.Location, fn TimerFunc) (*Timer, error) {
+	return defaultApp.NewSingletonCronInLocation(name, spec, loc, fn)
+}
+
+// NewSingletonCron is like the package level NewSingletonCron but the timer
+// is executed by the application, and elected by the elector of application
+func (app *App) NewSingletonCron(name, spec string, fn TimerFunc) (*Timer, error) {
+	return app.NewSingletonCronInLocation(name, spec, time.Local, fn)
+}
+
+// NewSingletonCronInLocation is like the package level
+// NewSingletonCronInLocation but the timer is executed by the application
+func (app *App) NewSingletonCronInLocation(name, spec string, loc *time.Location, fn TimerFunc) (*Timer, error) {
+	if fn == nil {
+		panic("nano/timer: nil timer function")
+	}
+
+	schedule, err := cronexpr.Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	next := schedule.Next(app.timers.clock.Now().In(loc))
+	if next.IsZero() {
+		return nil, fmt.Errorf("nano/timer: cron spec never activates: %s", spec)
+	}
+
+	c := &cronCondition{schedule: schedule, loc: loc, next: next}
+	return app.NewCondTimer(c, func() {
+		if app.elected(name, c) {
+			fn()
+		}
+	}), nil
+}
+
+// elected reports whether current node is elected to run the last activation
+// of a singleton cron job
+func (app *App) elected(name string, c *cronCondition) bool {
+	env := app.env
+	if env.elector == nil {
+		return true
+	}
+
+	// keep the winner until next activation
+	ttl := time.Minute
+	if !c.next.IsZero() {
+		ttl = c.next.Sub(c.last)
+	}
+
+	key := fmt.Sprintf("cron.%s.%d", name, c.last.Unix())
+	ok, err := env.elector.Elect(key, env.nodeID, ttl)
+	if err != nil {
+		app.log().Println(fmt.Sprintf("Elect singleton cron failed, Name=%s, Error=%s", name, err.Error()))
+		return false
+	}
+	return ok
 }
 
 // SetTimerPrecision set the ticker precision, and time precision can not less
 // than a Millisecond, and can not change after application running. The default
 // precision is time.Second
 func SetTimerPrecision(precision time.Duration) {
+	defaultApp.SetTimerPrecision(precision)
+}
+
+// SetTimerPrecision set the ticker precision of the application, it can not
+// change after application running
+func (app *App) SetTimerPrecision(precision time.Duration) {
 	if precision < time.Millisecond {
 		panic("time precision can not less than a Millisecond")
 	}
-	timerPrecision = precision
+	app.timers.precision = precision
+	app.timers.wheel = newTimingWheel(app.timers.clock.Now(), precision)
+}
+
+// SetSlowTimerThreshold set the duration that a timer function of the default
+// App is considered slow, see App.SetSlowTimerThreshold
+func SetSlowTimerThreshold(d time.Duration) {
+	defaultApp.SetSlowTimerThreshold(d)
+}
+
+// SetSlowTimerThreshold set the duration that a timer function is considered
+// slow, the slow executions will be logged and counted, zero to disable it.
+// The default threshold is 100ms
+func (app *App) SetSlowTimerThreshold(d time.Duration) {
+	atomic.StoreInt64(&app.timers.slowThreshold, int64(d))
+}
+
+// SlowTimerCount returns the count of slow timer function executions of the
+// default App
+func SlowTimerCount() int64 {
+	return defaultApp.SlowTimerCount()
+}
+
+// SlowTimerCount returns the count of slow timer function executions
+func (app *App) SlowTimerCount() int64 {
+	return atomic.LoadInt64(&app.timers.slowCount)
 }
 
 // SetTimerBacklog set the timer created/closing channel backlog, A small backlog
 // may cause the logic to be blocked when call NewTimer/NewCountTimer/timer.Stop
-// in main logic gorontine.
+// in timer functions.
 func SetTimerBacklog(c int) {
 	if c < 16 {
 		c = 16
@@ -0,0 +1,274 @@
+package nano
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// Errors that could be occurred when scheduling durable timers
+var (
+	ErrNoTimerStore        = errors.New("nano/timer: no timer store")
+	ErrDurableFuncNotFound = errors.New("nano/timer: durable function not registered")
+)
+
+type (
+	// DurableJob represents a one-shot job which survives restart
+	DurableJob struct {
+		ID      string    `json:"id"`      // unique job id
+		Name    string    `json:"name"`    // name of the registered DurableFunc
+		At      time.Time `json:"at"`      // scheduled time
+		Payload []byte    `json:"payload"` // job data
+	}
+
+	// DurableFunc represents the function executes a durable job
+	DurableFunc func(job *DurableJob)
+
+	// TimerStore persists durable jobs, a job is saved when scheduled and
+	// deleted after executed
+	TimerStore interface {
+		Save(job *DurableJob) error
+		Delete(id string) error
+		Load() ([]*DurableJob, error)
+	}
+
+	fileTimerStore struct {
+		mu   sync.Mutex
+		path string
+		jobs map[string]*DurableJob
+	}
+
+	// durableTimers are the timer store and durable functions of an
+	// application
+	durableTimers struct {
+		sync.RWMutex
+		store     TimerStore
+		funcs     map[string]DurableFunc
+		scheduled map[string]*durableEntry // job id map to the scheduled job
+	}
+
+	// durableEntry is a scheduled durable job, it is replaced when a job
+	// with the same id scheduled
+	durableEntry struct {
+		job   *DurableJob
+		timer *Timer
+	}
+)
+
+func newDurableTimers() *durableTimers {
+	return &durableTimers{funcs: map[string]DurableFunc{}, scheduled: map[string]*durableEntry{}}
+}
+
+// SetTimerStore set the store of durable timers, the stored jobs will be
+// scheduled again when application startup
+func SetTimerStore(store TimerStore) {
+	defaultApp.SetTimerStore(store)
+}
+
+// SetTimerStore set the store of the durable timers of the application, see
+// SetTimerStore
+func (app *App) SetTimerStore(store TimerStore) {
+	durable := app.durable
+	durable.Lock()
+	defer durable.Unlock()
+
+	durable.store = store
+}
+
+// RegisterDurableFunc registers the function which executes durable jobs of
+// the name, functions should be registered before application startup
+func RegisterDurableFunc(name string, fn DurableFunc) {
+	defaultApp.RegisterDurableFunc(name, fn)
+}
+
+// RegisterDurableFunc registers the durable function of the application, see
+// RegisterDurableFunc
+func (app *App) RegisterDurableFunc(name string, fn DurableFunc) {
+	durable := app.durable
+	durable.Lock()
+	defer durable.Unlock()
+
+	durable.funcs[name] = fn
+}
+
+// NewDurableTimer schedules a one-shot job which will be executed at the time
+// by the durable function of name, the job is persisted in the timer store
+// and survives restart, overdue jobs are executed immediately after restart.
+// The job scheduled with the id of a pending job replaces it
+func NewDurableTimer(id, name string, at time.Time, payload []byte) (*Timer, error) {
+	return defaultApp.NewDurableTimer(id, name, at, payload)
+}
+
+// NewDurableTimer schedules a durable job by the timers of the application,
+// see NewDurableTimer
+func (app *App) NewDurableTimer(id, name string, at time.Time, payload []byte) (*Timer, error) {
+	durable := app.durable
+	durable.Lock()
+	store, ok := durable.store, durable.funcs[name] != nil
+	if store == nil {
+		durable.Unlock()
+		return nil, ErrNoTimerStore
+	}
+	if !ok {
+		durable.Unlock()
+		return nil, ErrDurableFuncNotFound
+	}
+
+	// the job replaced is overwritten in store as well
+	job := &DurableJob{ID: id, Name: name, At: at, Payload: payload}
+	if err := store.Save(job); err != nil {
+		durable.Unlock()
+		return nil, err
+	}
+	e := durable.replace(job)
+	durable.Unlock()
+
+	return app.scheduleDurable(e), nil
+}
+
+// replace records the job as the scheduled one of its id, and stops the timer
+// of the job replaced, it should be called with lock held
+func (durable *durableTimers) replace(job *DurableJob) *durableEntry {
+	if old, ok := durable.scheduled[job.ID]; ok && old.timer != nil {
+		old.timer.Stop()
+	}
+	e := &durableEntry{job: job}
+	durable.scheduled[job.ID] = e
+	return e
+}
+
+func (app *App) scheduleDurable(e *durableEntry) *Timer {
+	job := e.job
+	d := job.At.Sub(app.clock.Now())
+	if d <= 0 {
+		d = time.Nanosecond // overdue, execute in next tick
+	}
+
+	durable := app.durable
+	t := app.NewAfterTimer(d, func() {
+		durable.RLock()
+		replaced := durable.scheduled[job.ID] != e
+		fn := durable.funcs[job.Name]
+		durable.RUnlock()
+
+		// the job replaced is not executed even if its timer fired
+		if replaced {
+			return
+		}
+		fn(job)
+
+		durable.Lock()
+		defer durable.Unlock()
+		if durable.scheduled[job.ID] != e {
+			return // replaced while executing, keep the new job in store
+		}
+		delete(durable.scheduled, job.ID)
+		if err := durable.store.Delete(job.ID); err != nil {
+			app.log().Println(fmt.Sprintf("nano/timer: delete durable job failed, ID=%s, Error=%s", job.ID, err.Error()))
+		}
+	})
+
+	durable.Lock()
+	e.timer = t
+	durable.Unlock()
+	return t
+}
+
+// restoreDurableTimers schedules all jobs in the timer store of application
+func (app *App) restoreDurableTimers() {
+	durable := app.durable
+	durable.RLock()
+	store := durable.store
+	durable.RUnlock()
+
+	if store == nil {
+		return
+	}
+
+	jobs, err := store.Load()
+	if err != nil {
+		app.log().Println(fmt.Sprintf("nano/timer: load durable jobs failed, Error=%s", err.Error()))
+		return
+	}
+
+	for _, job := range jobs {
+		durable.Lock()
+		_, ok := durable.funcs[job.Name]
+		var e *durableEntry
+		if ok {
+			e = durable.replace(job)
+		}
+		durable.Unlock()
+
+		if !ok {
+			app.log().Println(fmt.Sprintf("nano/timer: durable function not registered, ID=%s, Name=%s", job.ID, job.Name))
+			continue
+		}
+		app.scheduleDurable(e)
+	}
+}
+
+// NewFileTimerStore returns a TimerStore which persists jobs in a JSON file
+func NewFileTimerStore(path string) (TimerStore, error) {
+	s := &fileTimerStore{path: path, jobs: map[string]*DurableJob{}}
+	if !fileExists(path) {
+		return s, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &s.jobs); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *fileTimerStore) Save(job *DurableJob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.jobs[job.ID] = job
+	return s.flush()
+}
+
+func (s *fileTimerStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.jobs, id)
+	return s.flush()
+}
+
+func (s *fileTimerStore) Load() ([]*DurableJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs := make([]*DurableJob, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// flush writes all jobs to a temporary file then renames it, so a crash
+// during writing will not corrupt the store
+func (s *fileTimerStore) flush() error {
+	data, err := json.Marshal(s.jobs)
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
@@ -0,0 +1,122 @@
+package nano
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileTimerStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nano")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "timers.json")
+	store, err := NewFileTimerStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	at := time.Now().Add(time.Hour).Round(0)
+	store.Save(&DurableJob{ID: "auction-1", Name: "auction", At: at, Payload: []byte("1")})
+	store.Save(&DurableJob{ID: "auction-2", Name: "auction", At: at})
+	store.Delete("auction-2")
+
+	// reopen as restart
+	store, err = NewFileTimerStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs, _ := store.Load()
+	if len(jobs) != 1 || jobs[0].ID != "auction-1" || !jobs[0].At.Equal(at) || string(jobs[0].Payload) != "1" {
+		t.Fatalf("unexpected jobs: %+v", jobs)
+	}
+}
+
+func TestNewDurableTimer(t *testing.T) {
+	if _, err := NewDurableTimer("job", "unknown", time.Now(), nil); err != ErrNoTimerStore {
+		t.Fatalf("expect: %v, got: %v", ErrNoTimerStore, err)
+	}
+
+	dir, err := ioutil.TempDir("", "nano")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := NewFileTimerStore(filepath.Join(dir, "timers.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the clock of application is an hour behind the wall clock
+	start := time.Now().Add(-time.Hour)
+	app := NewApp()
+	s := app.Deterministic(start)
+	app.SetTimerStore(store)
+	if _, err := app.NewDurableTimer("job", "unknown", start, nil); err != ErrDurableFuncNotFound {
+		t.Fatalf("expect: %v, got: %v", ErrDurableFuncNotFound, err)
+	}
+
+	var executed []string
+	app.RegisterDurableFunc("auction", func(job *DurableJob) { executed = append(executed, string(job.Payload)) })
+	if _, err := app.NewDurableTimer("job", "auction", start.Add(time.Second), []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	// the pending job of the same id is replaced
+	if _, err := app.NewDurableTimer("job", "auction", start.Add(3*time.Second), []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+
+	s.Advance(2 * time.Second)
+	if len(executed) != 0 {
+		t.Fatalf("replaced job should not be executed, got %v", executed)
+	}
+	if jobs, _ := store.Load(); len(jobs) != 1 || string(jobs[0].Payload) != "2" {
+		t.Fatalf("new job should be kept in store, got %+v", jobs)
+	}
+
+	s.Advance(2 * time.Second)
+	if len(executed) != 1 || executed[0] != "2" {
+		t.Fatalf("unexpected executed jobs %v", executed)
+	}
+	if jobs, _ := store.Load(); len(jobs) != 0 {
+		t.Fatalf("executed job should be deleted, got %+v", jobs)
+	}
+}
+
+func TestApp_RestoreDurableTimers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nano")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := NewFileTimerStore(filepath.Join(dir, "timers.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Save(&DurableJob{ID: "auction-1", Name: "auction", At: time.Now().Add(-time.Second)})
+
+	// the jobs are restored by the application which owns the store
+	app := NewApp()
+	s := app.Deterministic(time.Now())
+	var executed []string
+	app.SetTimerStore(store)
+	app.RegisterDurableFunc("auction", func(job *DurableJob) { executed = append(executed, job.ID) })
+	app.restoreDurableTimers()
+	s.Advance(time.Second)
+
+	if len(executed) != 1 || executed[0] != "auction-1" {
+		t.Fatalf("unexpected executed jobs %v", executed)
+	}
+	if jobs, _ := store.Load(); len(jobs) != 0 {
+		t.Fatalf("executed job should be deleted, got %+v", jobs)
+	}
+	if _, err := NewDurableTimer("job", "auction", time.Now(), nil); err != ErrNoTimerStore {
+		t.Fatalf("the store should not be shared with default app, got %v", err)
+	}
+}
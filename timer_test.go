@@ -0,0 +1,226 @@
+package nano
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kensomanpow/nano/cluster"
+	cronexpr "github.com/kensomanpow/nano/internal/cron"
+)
+
+func TestCronCondition(t *testing.T) {
+	schedule, err := cronexpr.Parse("*/10 * * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2018, 1, 1, 0, 0, 5, 0, time.UTC)
+	c := &cronCondition{schedule: schedule, loc: time.UTC, next: schedule.Next(now)}
+
+	if c.Check(now) {
+		t.Fatal("should not activate before next")
+	}
+	if !c.Check(now.Add(5 * time.Second)) {
+		t.Fatal("should activate at 00:00:10")
+	}
+	if c.Check(now.Add(6 * time.Second)) {
+		t.Fatal("should not activate twice in a period")
+	}
+	if !c.Check(now.Add(15 * time.Second)) {
+		t.Fatal("should activate at 00:00:20")
+	}
+
+	if _, err := NewCron("invalid", func() {}); err == nil {
+		t.Fatal("invalid spec should fail")
+	}
+}
+
+func TestTimerContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	called := false
+	timer := newTimer(time.Nanosecond, loopForever, func() { called = true })
+	timer.ctx = ctx
+	defaultApp.timers.timers[timer.id] = timer
+	defaultApp.timers.wheel.add(timer)
+
+	cancel()
+	defaultApp.timers.wheel.advance(timer.expire, func(t *Timer) {
+		if t.stopped() {
+			defaultApp.timers.remove(t.id)
+		}
+	})
+
+	if called {
+		t.Fatal("timer should not execute after context cancelled")
+	}
+	if atomic.LoadInt32(&timer.closed) != 1 {
+		t.Fatal("timer should be stopped after context cancelled")
+	}
+	if _, ok := defaultApp.timers.timers[timer.id]; ok {
+		t.Fatal("timer should be removed after context cancelled")
+	}
+}
+
+func TestWithJitter(t *testing.T) {
+	interval := time.Second
+	spread := map[int64]bool{}
+	for i := 0; i < 100; i++ {
+		timer := newTimer(interval, loopForever, func() {}, WithJitter(interval))
+		if timer.elapse < int64(interval) || timer.elapse >= int64(2*interval) {
+			t.Fatalf("first execution out of range, elapse=%d", timer.elapse)
+		}
+		spread[timer.elapse] = true
+	}
+	if len(spread) < 2 {
+		t.Fatal("jitter should spread first executions")
+	}
+
+	timer := newTimer(interval, loopForever, func() {}, WithJitter(0))
+	if timer.elapse != int64(interval) {
+		t.Fatal("zero jitter should not delay first execution")
+	}
+}
+
+func TestSingletonCron(t *testing.T) {
+	schedule, err := cronexpr.Parse("0 * * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := &cronCondition{schedule: schedule, loc: time.UTC, next: now}
+	if !c.Check(now) {
+		t.Fatal("should activate")
+	}
+
+	// the apps of two nodes share the elector
+	elector := cluster.NewMemoryElector()
+	gate1, gate2 := NewApp(), NewApp()
+	gate1.SetElector(elector)
+	gate1.SetNodeID("gate-1")
+	gate2.SetElector(elector)
+	gate2.SetNodeID("gate-2")
+	if !gate1.elected("settle", c) {
+		t.Fatal("first node should be elected")
+	}
+	if gate2.elected("settle", c) {
+		t.Fatal("only one node should be elected for an activation")
+	}
+
+	c.Check(now.Add(time.Minute))
+	if !gate2.elected("settle", c) {
+		t.Fatal("election should be held for each activation")
+	}
+
+	// the jobs of the app are executed by its own timers
+	s := gate1.Deterministic(now)
+	var count int
+	if _, err := gate1.NewSingletonCronInLocation("report", "0 * * * * *", time.UTC, func() { count++ }); err != nil {
+		t.Fatal(err)
+	}
+	s.Advance(time.Minute)
+	if count != 1 {
+		t.Fatalf("singleton cron of app should be executed once, got %d", count)
+	}
+}
+
+func TestTimerPauseResume(t *testing.T) {
+	interval := time.Hour
+	timer := newTimer(interval, loopForever, func() {})
+	defaultApp.timers.timers[timer.id] = timer
+	defaultApp.timers.wheel.add(timer)
+	defer defaultApp.timers.remove(timer.id)
+
+	atomic.StoreInt32(&timer.paused, 1)
+	defaultApp.timers.syncPause(timer)
+	if timer.slot != nil {
+		t.Fatal("paused timer should be removed from wheel")
+	}
+	if timer.remaining <= 0 || timer.remaining > int64(interval) {
+		t.Fatalf("unexpected remaining time, remaining=%d", timer.remaining)
+	}
+
+	remaining := timer.remaining
+	atomic.StoreInt32(&timer.paused, 0)
+	defaultApp.timers.syncPause(timer)
+	if timer.slot == nil {
+		t.Fatal("resumed timer should be added to wheel")
+	}
+	if next := timer.createAt + timer.elapse - time.Now().UnixNano(); next > remaining {
+		t.Fatalf("next execution should be after remaining time, next=%d, remaining=%d", next, remaining)
+	}
+}
+
+func TestTimerPause_BacklogFull(t *testing.T) {
+	app := NewApp()
+	timer := app.NewTimer(time.Hour, func() {})
+	other := app.NewTimer(time.Hour, func() {})
+	app.timers.drain()
+
+	for i := 0; i < timerBacklog; i++ {
+		app.timers.chPausingTimer <- other
+	}
+	done := make(chan struct{})
+	go func() {
+		timer.Pause()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("pause should not block when backlog is full")
+	}
+
+	app.timers.drain()
+	if timer.frozen {
+		t.Fatal("dropped pause should not be applied before cron")
+	}
+	app.timers.cron()
+	if !timer.frozen || timer.slot != nil {
+		t.Fatal("paused timer should be removed from wheel in next cron")
+	}
+}
+
+func TestSlowTimer(t *testing.T) {
+	app := NewApp()
+	app.SetSlowTimerThreshold(time.Millisecond)
+	app.timers.pexec(0, func() { time.Sleep(2 * time.Millisecond) })
+	if app.SlowTimerCount() != 1 {
+		t.Fatal("slow timer function should be counted")
+	}
+	if SlowTimerCount() != 0 {
+		t.Fatal("slow timer function should be counted by its application")
+	}
+	app.timers.pexec(0, func() {})
+	if app.SlowTimerCount() != 1 {
+		t.Fatal("fast timer function should not be counted")
+	}
+}
+
+func TestAtTimer(t *testing.T) {
+	at := time.Now().Add(time.Hour)
+	called := 0
+	timer := newTimer(time.Hour, 1, func() { called++ })
+	timer.condition = &atCondition{at: at.Round(0)}
+	defaultApp.timers.timers[timer.id] = timer
+	defaultApp.timers.conditions[timer.id] = timer
+	defer defaultApp.timers.remove(timer.id)
+
+	if timer.condition.Check(at.Add(-time.Second)) {
+		t.Fatal("should not fire before at")
+	}
+	if !timer.condition.Check(at) {
+		t.Fatal("should fire at the time")
+	}
+
+	timer.condition = &atCondition{at: time.Now().Add(-time.Second)}
+	defaultApp.timers.cron()
+	defaultApp.timers.cron()
+	if called != 1 {
+		t.Fatalf("timer should fire once, called=%d", called)
+	}
+	if _, ok := defaultApp.timers.timers[timer.id]; ok {
+		t.Fatal("timer should be removed after fired")
+	}
+}
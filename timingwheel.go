@@ -0,0 +1,155 @@
+package nano
+
+import "time"
+
+// Hierarchical timing wheel layout, the lowest level has 256 slots of one
+// tick, each upper level has 64 slots which span all slots of the level
+// below, so five levels cover 2^32 ticks.
+const (
+	wheelBits0  = 8
+	wheelBitsN  = 6
+	wheelSize0  = 1 << wheelBits0
+	wheelSizeN  = 1 << wheelBitsN
+	wheelLevels = 5
+)
+
+type (
+	// slot contains the timers expire in the same tick range
+	slot map[int64]*Timer
+
+	// timingWheel schedules the interval timers, insert, remove and expire
+	// a timer are O(1) regardless of the timer count, timers in upper levels
+	// cascade to lower levels when the lower level wraps around.
+	timingWheel struct {
+		start     int64         // unix nano of tick 0
+		precision time.Duration // duration of a tick
+		current   uint64        // ticks have been processed
+		levels    [wheelLevels][]slot
+	}
+)
+
+func newTimingWheel(start time.Time, precision time.Duration) *timingWheel {
+	w := &timingWheel{
+		start:     start.UnixNano(),
+		precision: precision,
+	}
+
+	for level := range w.levels {
+		size := wheelSizeN
+		if level == 0 {
+			size = wheelSize0
+		}
+		w.levels[level] = make([]slot, size)
+		for i := range w.levels[level] {
+			w.levels[level][i] = slot{}
+		}
+	}
+	return w
+}
+
+// shift returns the bits covered by the levels below level
+func shift(level int) uint {
+	return uint(wheelBits0 + wheelBitsN*(level-1))
+}
+
+// tickOf returns the first tick not earlier than the unix nano ns
+func (w *timingWheel) tickOf(ns int64) uint64 {
+	d := ns - w.start
+	if d <= 0 {
+		return 0
+	}
+	p := int64(w.precision)
+	return uint64((d + p - 1) / p)
+}
+
+// elapsed returns the ticks have fully elapsed until now
+func (w *timingWheel) elapsed(now time.Time) uint64 {
+	d := now.UnixNano() - w.start
+	if d <= 0 {
+		return 0
+	}
+	return uint64(d / int64(w.precision))
+}
+
+// add schedules the timer at its next execution time
+func (w *timingWheel) add(t *Timer) {
+	expire := w.tickOf(t.createAt + t.elapse)
+	if expire <= w.current {
+		expire = w.current + 1
+	}
+	t.expire = expire
+	w.place(t)
+}
+
+func (w *timingWheel) place(t *Timer) {
+	delta := t.expire - w.current
+	if delta < wheelSize0 {
+		w.put(t, w.levels[0][t.expire&(wheelSize0-1)])
+		return
+	}
+
+	for level := 1; level < wheelLevels; level++ {
+		s := shift(level)
+		if delta < 1<<(s+wheelBitsN) {
+			w.put(t, w.levels[level][(t.expire>>s)&(wheelSizeN-1)])
+			return
+		}
+	}
+
+	// out of range, park in the last slot of top level, it will be placed
+	// again when cascading
+	s := shift(wheelLevels - 1)
+	expire := w.current + 1<<(s+wheelBitsN) - 1
+	w.put(t, w.levels[wheelLevels-1][(expire>>s)&(wheelSizeN-1)])
+}
+
+func (w *timingWheel) put(t *Timer, s slot) {
+	s[t.id] = t
+	t.slot = s
+}
+
+// remove removes the timer from wheel
+func (w *timingWheel) remove(t *Timer) {
+	if t.slot != nil {
+		delete(t.slot, t.id)
+		t.slot = nil
+	}
+}
+
+func (w *timingWheel) cascade(level int, index uint64) {
+	s := w.levels[level][index]
+	w.levels[level][index] = slot{}
+	for _, t := range s {
+		t.slot = nil
+		w.place(t)
+	}
+}
+
+// advance processes all ticks until target, fn is called for each expired
+// timer which has been removed from wheel
+func (w *timingWheel) advance(target uint64, fn func(t *Timer)) {
+	for w.current < target {
+		w.current++
+
+		index := w.current & (wheelSize0 - 1)
+		if index == 0 {
+			for level := 1; level < wheelLevels; level++ {
+				i := (w.current >> shift(level)) & (wheelSizeN - 1)
+				w.cascade(level, i)
+				if i != 0 {
+					break
+				}
+			}
+		}
+
+		expired := w.levels[0][index]
+		if len(expired) < 1 {
+			continue
+		}
+		w.levels[0][index] = slot{}
+		for _, t := range expired {
+			t.slot = nil
+			fn(t)
+		}
+	}
+}
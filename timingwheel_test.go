@@ -0,0 +1,71 @@
+package nano
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimingWheel(t *testing.T) {
+	start := time.Unix(0, 0)
+	w := newTimingWheel(start, time.Millisecond)
+
+	// intervals cover all levels
+	intervals := []time.Duration{
+		time.Millisecond,
+		255 * time.Millisecond,
+		256 * time.Millisecond,
+		time.Second + 7*time.Millisecond,
+		17 * time.Second,
+		5 * time.Minute,
+		3*time.Hour + time.Millisecond,
+	}
+
+	fired := map[int64]uint64{}
+	for i, interval := range intervals {
+		timer := &Timer{id: int64(i), createAt: start.UnixNano(), interval: interval, elapse: int64(interval)}
+		w.add(timer)
+	}
+
+	removed := &Timer{id: 100, createAt: start.UnixNano(), elapse: int64(time.Second)}
+	w.add(removed)
+	w.remove(removed)
+
+	target := w.tickOf(start.Add(3*time.Hour + time.Second).UnixNano())
+	w.advance(target, func(timer *Timer) {
+		if _, ok := fired[timer.id]; ok {
+			t.Fatalf("timer %d fired twice", timer.id)
+		}
+		fired[timer.id] = w.current
+	})
+
+	if _, ok := fired[removed.id]; ok {
+		t.Fatal("removed timer should not fire")
+	}
+	for i, interval := range intervals {
+		tick, ok := fired[int64(i)]
+		if !ok {
+			t.Fatalf("timer %d(%s) not fired", i, interval)
+		}
+		if expect := uint64(interval / time.Millisecond); tick != expect {
+			t.Fatalf("timer %d(%s) expect fired at tick: %d, got: %d", i, interval, expect, tick)
+		}
+	}
+}
+
+func BenchmarkTimingWheel(b *testing.B) {
+	start := time.Unix(0, 0)
+	w := newTimingWheel(start, time.Millisecond)
+	for i := 0; i < 500000; i++ {
+		d := time.Duration(i%60000+1) * time.Millisecond
+		w.add(&Timer{id: int64(i), createAt: start.UnixNano(), interval: d, elapse: int64(d)})
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w.advance(w.current+1, func(timer *Timer) {
+			timer.elapse += int64(timer.interval)
+			w.add(timer)
+		})
+	}
+	b.ReportAllocs()
+}
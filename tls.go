@@ -0,0 +1,113 @@
+package nano
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/kensomanpow/nano/session"
+)
+
+// PeerIdentityKey is the session key of the identity of the verified client
+// certificate, see PeerIdentityOf
+const PeerIdentityKey = "nano.peer"
+
+// PeerIdentity represents the identity of a verified client certificate
+type PeerIdentity struct {
+	CommonName  string
+	DNSNames    []string
+	URIs        []string
+	Certificate *x509.Certificate
+}
+
+// WithTLS serves the connections over TLS with config, which contains the
+// server certificates. It works with both Listen and ListenWS
+func WithTLS(config *tls.Config) Option {
+	return func(opts *options) {
+		if config == nil || (len(config.Certificates) < 1 && config.GetCertificate == nil) {
+			opts.settings = append(opts.settings, func(app *App) error {
+				return invalidOption("WithTLS", "server certificate is required")
+			})
+			return
+		}
+		opts.tlsConfig = config
+	}
+}
+
+// WithMutualTLS serves the connections over TLS, and verifies the client
+// certificates by clientCAs, the identity of verified certificate is exposed
+// on the session, see PeerIdentityOf. If required is false, the clients
+// without certificate are accepted as well, eg: the trusted server to server
+// connections and the players share the same listener
+func WithMutualTLS(config *tls.Config, clientCAs *x509.CertPool, required bool) Option {
+	return func(opts *options) {
+		if clientCAs == nil {
+			opts.settings = append(opts.settings, func(app *App) error {
+				return invalidOption("WithMutualTLS", "client CAs are required")
+			})
+			return
+		}
+		if config != nil {
+			config = config.Clone()
+			config.ClientCAs = clientCAs
+			config.ClientAuth = tls.VerifyClientCertIfGiven
+			if required {
+				config.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+		}
+		WithTLS(config)(opts)
+	}
+}
+
+// PeerIdentityOf returns the identity of the verified client certificate of
+// session, nil if the client does not present a certificate
+func PeerIdentityOf(s *session.Session) *PeerIdentity {
+	id, _ := s.Value(PeerIdentityKey).(*PeerIdentity)
+	return id
+}
+
+// tlsHandshake completes the TLS handshake of conn within timeout, so that
+// the client certificate is verified before the agent created
+func tlsHandshake(conn net.Conn, timeout time.Duration) error {
+	tc, ok := conn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+	if timeout > 0 {
+		tc.SetDeadline(time.Now().Add(timeout))
+		defer tc.SetDeadline(time.Time{})
+	}
+	if err := tc.Handshake(); err != nil {
+		return fmt.Errorf("nano/tls: handshake failed, remote=%s, error=%s", conn.RemoteAddr(), err.Error())
+	}
+	return nil
+}
+
+// peerIdentity returns the identity of verified client certificate of conn,
+// nil if no certificate verified
+func peerIdentity(conn net.Conn) *PeerIdentity {
+	if c, ok := conn.(*wsConn); ok {
+		conn = c.conn.UnderlyingConn()
+	}
+	tc, ok := conn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+	state := tc.ConnectionState()
+	if len(state.VerifiedChains) < 1 || len(state.PeerCertificates) < 1 {
+		return nil
+	}
+
+	cert := state.PeerCertificates[0]
+	id := &PeerIdentity{
+		CommonName:  cert.Subject.CommonName,
+		DNSNames:    cert.DNSNames,
+		Certificate: cert,
+	}
+	for _, uri := range cert.URIs {
+		id.URIs = append(id.URIs, uri.String())
+	}
+	return id
+}
@@ -0,0 +1,106 @@
+package nano
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+// issueCert returns a certificate signed by parent, self-signed if parent is
+// nil
+func issueCert(t *testing.T, name string, parent *tls.Certificate, usage x509.ExtKeyUsage) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+
+	signer, signerKey := tmpl, interface{}(key)
+	if parent == nil {
+		tmpl.IsCA, tmpl.BasicConstraintsValid = true, true
+	} else {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestMutualTLS(t *testing.T) {
+	ca := issueCert(t, "ca", nil, x509.ExtKeyUsageAny)
+	server := issueCert(t, "server", &ca, x509.ExtKeyUsageServerAuth)
+	client := issueCert(t, "backend", &ca, x509.ExtKeyUsageClientAuth)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+
+	app := NewApp()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ln, addr := listenLocal(t)
+	go app.Serve(ctx, ln, WithoutSignals(),
+		WithMutualTLS(&tls.Config{Certificates: []tls.Certificate{server}}, pool, false))
+
+	dial := func(certs []tls.Certificate) *PeerIdentity {
+		var conn net.Conn
+		var err error
+		for i := 0; i < 50; i++ {
+			conn, err = tls.Dial("tcp", addr, &tls.Config{RootCAs: pool, ServerName: "server", Certificates: certs})
+			if err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		c := &testClient{t: t, conn: conn, decoder: DefaultCodec.NewDecoder()}
+		c.write(PacketHandshake, []byte(`{"sys":{"protocol":1}}`))
+		c.read(PacketHandshake)
+
+		var id *PeerIdentity
+		agents.Range(func(_, v interface{}) bool {
+			if a := v.(*agent); a.app == app && a.status() != statusClosed {
+				id = PeerIdentityOf(a.session)
+			}
+			return true
+		})
+		return id
+	}
+
+	if id := dial([]tls.Certificate{client}); id == nil || id.CommonName != "backend" {
+		t.Fatalf("unexpected peer identity %+v", id)
+	}
+	for deadline := time.Now().Add(time.Second); app.agents.Count() > 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("session should be closed")
+		}
+	}
+	if id := dial(nil); id != nil {
+		t.Fatalf("client without certificate should have no identity, got %+v", id)
+	}
+}
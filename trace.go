@@ -0,0 +1,94 @@
+package nano
+
+import (
+	"context"
+	"errors"
+
+	"github.com/kensomanpow/nano/internal/message"
+	"github.com/kensomanpow/nano/session"
+)
+
+type (
+	// Tracer traces the inbound requests, a span is started for each message
+	// before the inbound pipeline, and ended after the handler returned, so
+	// that it covers pipeline, deserialization and handler execution. The
+	// context returned by Start is available to handler by
+	// s.RequestContext(), so that the trace could be propagated to the
+	// downstream services.
+	Tracer interface {
+		// Start starts a span of the message, carrier contains the trace
+		// context propagated by client, eg: W3C `traceparent`, it is empty
+		// if client does not propagate trace context
+		Start(ctx context.Context, s *session.Session, meta *PipelineMeta, carrier map[string]string) (context.Context, Span)
+	}
+
+	// Span represents a traced message, err is nil if the message handled
+	// successfully
+	Span interface {
+		End(err error)
+	}
+)
+
+// TraceKey is the session key of the trace context propagated in handshake,
+// the session level trace context is used for the messages without trace
+// context
+const TraceKey = "nano.trace"
+
+// ErrInvalidTrace represents the trace context in message body is malformed
+var ErrInvalidTrace = errors.New("invalid trace context")
+
+// SetTracer set the tracer of inbound requests
+func SetTracer(t Tracer) {
+	defaultApp.SetTracer(t)
+}
+
+// SetTracer set the tracer of inbound requests of the application
+func (app *App) SetTracer(t Tracer) {
+	app.env.tracer = t
+}
+
+// startSpan starts a span of the message if tracer set, the trace context
+// prefixed to the body is stripped from msg
+func (app *App) startSpan(s *session.Session, meta *PipelineMeta, msg *message.Message) (context.Context, Span, error) {
+	ctx := s.Context()
+
+	var carrier map[string]string
+	if msg.Flags&message.Traced != 0 {
+		parent, data, err := splitTrace(msg.Data)
+		if err != nil {
+			return ctx, nil, err
+		}
+		msg.Data = data
+		msg.Flags &^= message.Traced
+		meta.Flags = msg.Flags
+		carrier = map[string]string{"traceparent": parent}
+	} else if c, ok := s.Value(TraceKey).(map[string]string); ok {
+		carrier = c
+	}
+
+	if app.env.tracer == nil {
+		return ctx, nil, nil
+	}
+	if carrier == nil {
+		carrier = map[string]string{}
+	}
+
+	ctx, span := app.env.tracer.Start(ctx, s, meta, carrier)
+	return ctx, span, nil
+}
+
+// splitTrace splits the traceparent prefixed to data
+func splitTrace(data []byte) (string, []byte, error) {
+	if len(data) < 1 || len(data) < int(data[0])+1 {
+		return "", nil, ErrInvalidTrace
+	}
+	n := int(data[0]) + 1
+	return string(data[1:n]), data[n:], nil
+}
+
+// endSpan ends span if not nil
+func endSpan(span Span, err error) {
+	if span != nil {
+		span.End(err)
+	}
+}
@@ -0,0 +1,96 @@
+package nano
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/kensomanpow/nano/internal/message"
+	"github.com/kensomanpow/nano/session"
+)
+
+type testTracer struct {
+	carrier map[string]string
+	err     error
+	ended   bool
+}
+
+func (t *testTracer) Start(ctx context.Context, s *session.Session, meta *PipelineMeta, carrier map[string]string) (context.Context, Span) {
+	t.carrier = carrier
+	return ctx, t
+}
+
+func (t *testTracer) End(err error) {
+	t.ended, t.err = true, err
+}
+
+func TestStartSpan(t *testing.T) {
+	tracer := &testTracer{}
+	defer SetTracer(nil)
+	SetTracer(tracer)
+
+	parent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	msg := &message.Message{
+		Route: "test.trace",
+		Flags: message.Traced | message.Encrypted,
+		Data:  append(append([]byte{byte(len(parent))}, parent...), "hello"...),
+	}
+	meta := &PipelineMeta{Route: msg.Route, Flags: msg.Flags}
+
+	s := session.New(nil)
+	_, span, err := defaultApp.startSpan(s, meta, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tracer.carrier["traceparent"] != parent {
+		t.Fatalf("unexpected carrier %v", tracer.carrier)
+	}
+	if string(msg.Data) != "hello" || meta.Flags != FlagEncrypted {
+		t.Fatalf("trace context should be stripped, Data=%s, Flags=%d", msg.Data, meta.Flags)
+	}
+
+	endSpan(span, errors.New("failed"))
+	if !tracer.ended || tracer.err == nil {
+		t.Fatal("span should be ended with error")
+	}
+
+	// session level trace context
+	s.Set(TraceKey, map[string]string{"traceparent": parent})
+	msg = &message.Message{Route: "test.trace", Data: []byte("hello")}
+	if _, _, err := defaultApp.startSpan(s, &PipelineMeta{}, msg); err != nil {
+		t.Fatal(err)
+	}
+	if tracer.carrier["traceparent"] != parent {
+		t.Fatalf("unexpected carrier %v", tracer.carrier)
+	}
+
+	// malformed trace context
+	msg = &message.Message{Flags: message.Traced, Data: []byte{10, 'a'}}
+	if _, _, err := defaultApp.startSpan(s, &PipelineMeta{}, msg); err != ErrInvalidTrace {
+		t.Fatalf("expect ErrInvalidTrace, got %v", err)
+	}
+}
+
+func TestEndSpan_Dropped(t *testing.T) {
+	app := NewApp()
+	client, server := net.Pipe()
+	defer client.Close()
+	agent := newAgent(app, server)
+	agent.Close()
+
+	// the session closed before dispatched
+	span := &testTracer{}
+	app.handler.process(unhandledMessage{agent: agent, span: span}, true)
+	if !span.ended || span.err != ErrSessionClosed {
+		t.Fatalf("span should be ended with ErrSessionClosed, got %v", span.err)
+	}
+
+	// the application quit before dispatched
+	span = &testTracer{}
+	app.handler.chLocalProcess <- unhandledMessage{agent: agent, span: span}
+	app.handler.discard()
+	if !span.ended || span.err != ErrSessionClosed {
+		t.Fatalf("span should be ended with ErrSessionClosed, got %v", span.err)
+	}
+}
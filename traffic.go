@@ -0,0 +1,110 @@
+package nano
+
+import (
+	"sort"
+	"sync/atomic"
+
+	"github.com/kensomanpow/nano/session"
+)
+
+type (
+	// TrafficStats represents the traffic statistics, bytes are counted on
+	// the wire, includes packet headers and heartbeats
+	TrafficStats struct {
+		BytesIn     int64 `json:"bytesIn"`
+		BytesOut    int64 `json:"bytesOut"`
+		MessagesIn  int64 `json:"messagesIn"`
+		MessagesOut int64 `json:"messagesOut"`
+	}
+
+	// SessionTraffic represents the traffic statistics of a session
+	SessionTraffic struct {
+		SessionID int64 `json:"sessionId"`
+		UID       int64 `json:"uid"`
+		TrafficStats
+	}
+
+	// trafficCounter counts traffic, it's updated concurrently
+	trafficCounter struct {
+		bytesIn, bytesOut       int64
+		messagesIn, messagesOut int64
+	}
+)
+
+func (c *trafficCounter) stats() TrafficStats {
+	return TrafficStats{
+		BytesIn:     atomic.LoadInt64(&c.bytesIn),
+		BytesOut:    atomic.LoadInt64(&c.bytesOut),
+		MessagesIn:  atomic.LoadInt64(&c.messagesIn),
+		MessagesOut: atomic.LoadInt64(&c.messagesOut),
+	}
+}
+
+// countIn counts the inbound bytes of agent
+func (a *agent) countIn(bytes int) {
+	atomic.AddInt64(&a.traffic.bytesIn, int64(bytes))
+	atomic.AddInt64(&a.app.traffic.bytesIn, int64(bytes))
+	a.countBandwidth(bytes)
+}
+
+// countOut counts the outbound bytes of agent
+func (a *agent) countOut(bytes int) {
+	atomic.AddInt64(&a.traffic.bytesOut, int64(bytes))
+	atomic.AddInt64(&a.app.traffic.bytesOut, int64(bytes))
+}
+
+// countMessageIn counts an inbound message of agent
+func (a *agent) countMessageIn() {
+	atomic.AddInt64(&a.traffic.messagesIn, 1)
+	atomic.AddInt64(&a.app.traffic.messagesIn, 1)
+}
+
+// countMessageOut counts an outbound message of agent
+func (a *agent) countMessageOut() {
+	atomic.AddInt64(&a.traffic.messagesOut, 1)
+	atomic.AddInt64(&a.app.traffic.messagesOut, 1)
+}
+
+// Traffic returns the traffic statistics of the default App, see App.Traffic
+func Traffic() TrafficStats {
+	return defaultApp.Traffic()
+}
+
+// Traffic returns the traffic statistics of all sessions since application
+// started, includes the closed sessions
+func (app *App) Traffic() TrafficStats {
+	return app.traffic.stats()
+}
+
+// SessionTrafficStats returns the traffic statistics of a living session,
+// false if the session has closed
+func SessionTrafficStats(s *session.Session) (TrafficStats, bool) {
+	v, ok := agents.Load(s.ID())
+	if !ok {
+		return TrafficStats{}, false
+	}
+	return v.(*agent).traffic.stats(), true
+}
+
+// TopTrafficSessions returns the n living sessions which consume most
+// bandwidth, in descending order of total bytes
+func TopTrafficSessions(n int) []SessionTraffic {
+	var sessions []SessionTraffic
+	agents.Range(func(_, v interface{}) bool {
+		a := v.(*agent)
+		sessions = append(sessions, SessionTraffic{
+			SessionID:    a.session.ID(),
+			UID:          a.session.UID(),
+			TrafficStats: a.traffic.stats(),
+		})
+		return true
+	})
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].BytesIn+sessions[i].BytesOut > sessions[j].BytesIn+sessions[j].BytesOut
+	})
+	if len(sessions) > n {
+		sessions = sessions[:n]
+	}
+	return sessions
+}
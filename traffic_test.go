@@ -0,0 +1,51 @@
+package nano
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestTraffic(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+
+	a := newAgent(defaultApp, c1)
+	defer a.Close()
+	go a.write()
+
+	total := Traffic()
+	if err := a.Push("traffic", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 64)
+	n, err := c2.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.countIn(10)
+	a.countMessageIn()
+
+	// bytes are counted after Write returned
+	var stats TrafficStats
+	for i := 0; i < 100 && stats.BytesOut == 0; i++ {
+		time.Sleep(time.Millisecond)
+		s, ok := SessionTrafficStats(a.session)
+		if !ok {
+			t.Fatal("session should be alive")
+		}
+		stats = s
+	}
+	expect := TrafficStats{BytesIn: 10, BytesOut: int64(n), MessagesIn: 1, MessagesOut: 1}
+	if stats != expect {
+		t.Fatalf("expect %+v, got %+v", expect, stats)
+	}
+	if Traffic().BytesOut-total.BytesOut < int64(n) {
+		t.Fatal("total traffic should be counted")
+	}
+
+	top := TopTrafficSessions(1)
+	if len(top) != 1 || top[0].SessionID != a.session.ID() {
+		t.Fatalf("unexpected top sessions %+v", top)
+	}
+}
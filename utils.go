@@ -28,17 +28,6 @@ import (
 	"strings"
 )
 
-func serializeOrRaw(v interface{}) ([]byte, error) {
-	if data, ok := v.([]byte); ok {
-		return data, nil
-	}
-	data, err := serializer.Marshal(v)
-	if err != nil {
-		return nil, err
-	}
-	return data, nil
-}
-
 func gobEncode(args ...interface{}) ([]byte, error) {
 	buf := bytes.NewBuffer([]byte(nil))
 	if err := gob.NewEncoder(buf).Encode(args); err != nil {
@@ -21,8 +21,11 @@
 package nano
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"net"
+	"net/http"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -34,8 +37,21 @@ type wsConn struct {
 	conn   *websocket.Conn
 	typ    int // message type
 	reader io.Reader
+	values map[string]interface{} // session values returned by WSUpgradeFunc
 }
 
+// WSSubprotocolKey is the session key of the negotiated WebSocket
+// subprotocol, see SetWSSubprotocols
+const WSSubprotocolKey = "nano.ws.subprotocol"
+
+// WSUpgradeFunc validates the HTTP request before it is upgraded to
+// WebSocket, eg: checks the custom headers, cookies or signed query
+// parameters. The upgrade is rejected if it returns an error, the HTTP
+// status is the code of *Error, eg: ErrUnauthorized, or 403 for other
+// errors and the codes out of 4xx and 5xx. The values returned are set in
+// the session created
+type WSUpgradeFunc func(r *http.Request) (map[string]interface{}, error)
+
 // newWSConn return an initialized *wsConn
 func newWSConn(conn *websocket.Conn) (*wsConn, error) {
 	c := &wsConn{conn: conn}
@@ -136,11 +152,76 @@ func (c *wsConn) SetWriteDeadline(t time.Time) error {
 	return c.conn.SetWriteDeadline(t)
 }
 
-func (h *handlerService) handleWS(conn *websocket.Conn) {
+func (h *handlerService) handleWS(conn *websocket.Conn, o *options, values map[string]interface{}) {
 	c, err := newWSConn(conn)
 	if err != nil {
-		logger.Println(err)
+		h.app.log().Println(err)
 		return
 	}
-	h.handle(c)
+	c.values = values
+	h.handle(c, o)
+}
+
+// SetWSUpgradeFunc set the function that validates the HTTP request before
+// upgraded to WebSocket, nil disables it
+func SetWSUpgradeFunc(fn WSUpgradeFunc) {
+	defaultApp.SetWSUpgradeFunc(fn)
+}
+
+// SetWSUpgradeFunc set the function that validates the WebSocket upgrade
+// request of the application
+func (app *App) SetWSUpgradeFunc(fn WSUpgradeFunc) {
+	app.env.wsUpgrade = fn
+}
+
+// SetWSSubprotocols set the WebSocket subprotocols supported by server in
+// order of preference, the negotiated one is set in session with
+// WSSubprotocolKey
+func SetWSSubprotocols(protocols ...string) {
+	defaultApp.SetWSSubprotocols(protocols...)
+}
+
+// SetWSSubprotocols set the WebSocket subprotocols of the application
+func (app *App) SetWSSubprotocols(protocols ...string) {
+	app.env.wsSubprotocols = protocols
+}
+
+// WithWSUpgrade set the function that validates the HTTP request before
+// upgraded to WebSocket, and the subprotocols supported by server, see
+// SetWSUpgradeFunc and SetWSSubprotocols
+func WithWSUpgrade(fn WSUpgradeFunc, subprotocols ...string) Option {
+	return withSetting(func(app *App) error {
+		for _, p := range subprotocols {
+			if p == "" {
+				return invalidOption("WithWSUpgrade", "subprotocol can not be empty")
+			}
+		}
+		app.SetWSUpgradeFunc(fn)
+		app.SetWSSubprotocols(subprotocols...)
+		return nil
+	})
+}
+
+// upgradeWS validates the upgrade request r, and returns the session values,
+// the request is responded with the error status if it is rejected
+func (app *App) upgradeWS(w http.ResponseWriter, r *http.Request) (map[string]interface{}, bool) {
+	fn := app.env.wsUpgrade
+	if fn == nil {
+		return nil, true
+	}
+	values, err := fn(r)
+	if err == nil {
+		return values, true
+	}
+
+	status := http.StatusForbidden
+	var e *Error
+	if errors.As(err, &e) && e.Code >= 400 && e.Code < 600 {
+		status = int(e.Code)
+	}
+	if app.debugEnabled(LogSession) {
+		app.log().Println(fmt.Sprintf("WebSocket upgrade rejected, Remote=%s, Error=%s", r.RemoteAddr, err.Error()))
+	}
+	http.Error(w, http.StatusText(status), status)
+	return nil, false
 }
@@ -0,0 +1,88 @@
+package nano
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestWSUpgrade(t *testing.T) {
+	app := NewApp()
+	app.SetWSUpgradeFunc(func(r *http.Request) (map[string]interface{}, error) {
+		if r.Header.Get("X-Token") != "secret" {
+			return nil, ErrUnauthorized
+		}
+		return map[string]interface{}{"user": r.URL.Query().Get("user")}, nil
+	})
+	app.SetWSSubprotocols("nano.v2", "nano.v1")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ln, addr := listenLocal(t)
+	go serveWS(ctx, app, ln, WithoutSignals())
+
+	url := "ws://" + addr + "/?user=alice"
+	var resp *http.Response
+	var err error
+	for i := 0; i < 50; i++ {
+		if _, resp, err = websocket.DefaultDialer.Dial(url, nil); resp != nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("upgrade without token should be unauthorized, got %v, %v", resp, err)
+	}
+
+	dialer := websocket.Dialer{Subprotocols: []string{"nano.v1"}}
+	conn, _, err := dialer.Dial(url, http.Header{"X-Token": {"secret"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	p, err := DefaultCodec.Encode(PacketHandshake, []byte(`{"sys":{"protocol":1}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.WriteMessage(websocket.BinaryMessage, p); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := conn.ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+
+	var user, protocol string
+	agents.Range(func(_, v interface{}) bool {
+		if a := v.(*agent); a.app == app {
+			user, protocol = a.session.String("user"), a.session.String(WSSubprotocolKey)
+		}
+		return true
+	})
+	if user != "alice" || protocol != "nano.v1" {
+		t.Fatalf("unexpected session values, user=%s, subprotocol=%s", user, protocol)
+	}
+}
+
+func TestWSUpgrade_InvalidCode(t *testing.T) {
+	app := NewApp()
+	for _, code := range []ErrorCode{0, 200, 999, 1000, CodeServerBusy} {
+		app.SetWSUpgradeFunc(func(r *http.Request) (map[string]interface{}, error) {
+			return nil, &Error{Code: code, Message: "rejected"}
+		})
+		w := httptest.NewRecorder()
+		if _, ok := app.upgradeWS(w, httptest.NewRequest(http.MethodGet, "/", nil)); ok {
+			t.Fatalf("upgrade should be rejected, code %d", code)
+		}
+		expect := http.StatusForbidden
+		if code == CodeServerBusy {
+			expect = int(code)
+		}
+		if w.Code != expect {
+			t.Fatalf("code %d, expect status %d, got %d", code, expect, w.Code)
+		}
+	}
+}